@@ -0,0 +1,144 @@
+package analysis
+
+import (
+	"math"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/streams"
+)
+
+// DescentOptions tune AnalyzeDescents, DefaultDescentOptions suit mountain
+// biking and trail running
+type DescentOptions struct {
+	MinDrop      float64 // meters lost before a way down is a descent
+	MinGrade     float64 // percent, a descent is at least this steep on average
+	Tolerance    float64 // meters climbed again before a descent is over
+	StopSpeed    float64 // meters per second below which the athlete is stopped
+	BrakeDecel   float64 // meters per second squared, slowing harder is braking
+	Technical    float64 // percent of speed variation from which a descent is technical
+	SmoothWindow int     // samples of altitude averaged, barometers step by a meter
+}
+
+var DefaultDescentOptions = DescentOptions{MinDrop: 30, MinGrade: 3, Tolerance: 5, StopSpeed: 0.5, BrakeDecel: 1.5, Technical: 30, SmoothWindow: 5}
+
+// Descent is a way down, in seconds since the start. Variability is the
+// coefficient of variation of the moving speed: a fast fire road is ridden
+// at a steady speed, a technical section is braked into and sprinted out of
+type Descent struct {
+	Start        int     `json:"start"`
+	End          int     `json:"end"`
+	Drop         float64 `json:"drop"`          // meters
+	Distance     float64 `json:"distance"`      // meters
+	AverageGrade float64 `json:"average_grade"` // percent, positive going down
+	MaxSpeed     float64 `json:"max_speed"`     // meters per second
+	AverageSpeed float64 `json:"average_speed"`
+	Variability  float64 `json:"variability"` // percent
+	Brakings     int     `json:"brakings"`    // times the athlete slowed harder than BrakeDecel
+	Technical    bool    `json:"technical"`
+}
+
+type DescentReport struct {
+	Descents  []Descent `json:"descents"`
+	Drop      float64   `json:"drop"`      // meters, of every descent
+	MaxSpeed  float64   `json:"max_speed"` // the fastest of any descent
+	Brakings  int       `json:"brakings"`
+	Technical int       `json:"technical"` // descents that are
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// AnalyzeDescents finds the descents of an activity. A descent runs from a
+// high point to the lowest point before the athlete climbs Tolerance meters
+// again. seconds, meters and altitude are the time, distance and altitude
+// streams; speed is velocity_smooth and, when it was not recorded, nil, the
+// speed then being taken from the distance
+func AnalyzeDescents(seconds []int, meters, altitude, speed []float64, opts DescentOptions) DescentReport {
+	report := DescentReport{Descents: []Descent{}}
+	n := len(seconds)
+	if n < 2 || len(meters) != n || len(altitude) != n || (speed != nil && len(speed) != n) {
+		return report
+	}
+
+	if speed == nil {
+		speed = make([]float64, n)
+		for i := 1; i < n; i++ {
+			if dt := seconds[i] - seconds[i-1]; dt > 0 {
+				speed[i] = (meters[i] - meters[i-1]) / float64(dt)
+			}
+		}
+	}
+	alt := streams.MovingAverage(altitude, opts.SmoothWindow)
+
+	record := func(top, low int) {
+		drop := alt[top] - alt[low]
+		distance := meters[low] - meters[top]
+		if drop < opts.MinDrop || distance <= 0 || drop/distance*100 < opts.MinGrade {
+			return
+		}
+		d := Descent{
+			Start:        seconds[top],
+			End:          seconds[low],
+			Drop:         round1(drop),
+			Distance:     round1(distance),
+			AverageGrade: round1(drop / distance * 100),
+		}
+		if elapsed := seconds[low] - seconds[top]; elapsed > 0 {
+			d.AverageSpeed = round1(distance / float64(elapsed))
+		}
+
+		var sum, squares float64
+		moving := 0
+		braking := false
+		for i := top; i <= low; i++ {
+			d.MaxSpeed = math.Max(d.MaxSpeed, speed[i])
+			if speed[i] >= opts.StopSpeed {
+				sum += speed[i]
+				squares += speed[i] * speed[i]
+				moving++
+			}
+			if i == top {
+				continue
+			}
+			// a run of hard slowing is one braking
+			dt := seconds[i] - seconds[i-1]
+			hard := dt > 0 && (speed[i-1]-speed[i])/float64(dt) > opts.BrakeDecel
+			if hard && !braking {
+				d.Brakings++
+			}
+			braking = hard
+		}
+		if moving > 1 {
+			mean := sum / float64(moving)
+			variance := math.Max(0, squares/float64(moving)-mean*mean)
+			d.Variability = round1(math.Sqrt(variance) / mean * 100)
+		}
+		d.MaxSpeed = round1(d.MaxSpeed)
+		d.Technical = d.Variability >= opts.Technical
+
+		report.Descents = append(report.Descents, d)
+		report.Drop += d.Drop
+		report.MaxSpeed = math.Max(report.MaxSpeed, d.MaxSpeed)
+		report.Brakings += d.Brakings
+		if d.Technical {
+			report.Technical++
+		}
+	}
+
+	top, low := 0, 0
+	for i := 1; i < n; i++ {
+		switch {
+		case alt[i] < alt[low]:
+			low = i
+		case alt[i]-alt[low] > opts.Tolerance:
+			record(top, low)
+			top, low = i, i
+		case alt[i] >= alt[top]:
+			// still going up, the descent starts higher
+			top, low = i, i
+		}
+	}
+	record(top, low)
+	report.Drop = round1(report.Drop)
+	return report
+}
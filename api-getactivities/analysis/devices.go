@@ -0,0 +1,58 @@
+package analysis
+
+import (
+	"strings"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+const (
+	DeviceManual  = "manual"
+	DeviceUnknown = "unknown"
+)
+
+// uploaders as they start the external id, such as garmin_push_123 or zwift-activity-123.fit
+var uploaderPrefixes = []struct{ prefix, name string }{
+	{"garmin", "Garmin"},
+	{"wahoo", "Wahoo"},
+	{"zwift", "Zwift"},
+	{"trainerroad", "TrainerRoad"},
+	{"rouvy", "Rouvy"},
+	{"polar", "Polar"},
+	{"suunto", "Suunto"},
+	{"coros", "COROS"},
+	{"hammerhead", "Hammerhead"},
+}
+
+// RecordingDevice names what recorded the activity: the device name on the
+// detailed activity, such as "Garmin Edge 530", otherwise the uploader read
+// from the external id. deviceName is "" for a summary
+func RecordingDevice(a strava.ActivitySummary, deviceName string) string {
+	if a.Manual {
+		return DeviceManual
+	}
+	if name := strings.TrimSpace(deviceName); name != "" {
+		return name
+	}
+	externalId := strings.ToLower(a.ExternalId)
+	for _, u := range uploaderPrefixes {
+		if strings.HasPrefix(externalId, u.prefix) {
+			return u.name
+		}
+	}
+	return DeviceUnknown
+}
+
+// HeartrateDropouts counts the samples of a heart rate stream reading 0,
+// where the strap lost contact, and the samples there are
+func HeartrateDropouts(set *strava.StreamSet) (dropped int, samples int) {
+	if set == nil || set.Heartrate == nil {
+		return 0, 0
+	}
+	for _, hr := range set.Heartrate.Data {
+		if hr == 0 {
+			dropped++
+		}
+	}
+	return dropped, len(set.Heartrate.Data)
+}
@@ -0,0 +1,115 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// EngagementIntervals are the periods SummarizeEngagement can group by
+var EngagementIntervals = []string{"week", "month", "year"}
+
+type Engagement struct {
+	Count            int     `json:"count"` // activities
+	Kudos            int     `json:"kudos"`
+	Comments         int     `json:"comments"`
+	Photos           int     `json:"photos"`
+	KudosPerActivity float64 `json:"kudos_per_activity"`
+}
+
+// strava's photo_count is only instagram's, total_photo_count also has uploaded ones
+func photos(a strava.ActivitySummary) int {
+	if a.TotalPhotoCount > a.PhotoCount {
+		return a.TotalPhotoCount
+	}
+	return a.PhotoCount
+}
+
+func (e *Engagement) Add(a strava.ActivitySummary) {
+	e.Count++
+	e.Kudos += a.KudosCount
+	e.Comments += a.CommentCount
+	e.Photos += photos(a)
+	e.KudosPerActivity = math.Round(float64(e.Kudos)/float64(e.Count)*10) / 10
+}
+
+type EngagementPeriod struct {
+	Start string `json:"start"` // the local date the week, month or year starts
+	Engagement
+}
+
+type KudoedActivity struct {
+	Highlight
+	Kudos    int `json:"kudos"`
+	Comments int `json:"comments"`
+	Photos   int `json:"photos"`
+}
+
+type EngagementSummary struct {
+	Engagement
+	Interval   string                `json:"interval"`
+	Periods    []EngagementPeriod    `json:"periods"` // oldest first, those without activities left out
+	Sports     map[string]Engagement `json:"sports"`
+	MostKudoed []KudoedActivity      `json:"most_kudoed"`
+}
+
+// SummarizeEngagement adds up the kudos, comments and photos of the activities
+// by week, month or year of their local start, weeks starting on monday, and
+// by sport. MostKudoed are the top activities with the most kudos, ties going
+// to the one with more comments, then the newer one
+func SummarizeEngagement(activities []strava.ActivitySummary, interval string, top int) EngagementSummary {
+	summary := EngagementSummary{Interval: interval, Periods: []EngagementPeriod{}, Sports: make(map[string]Engagement), MostKudoed: []KudoedActivity{}}
+	periods := make(map[string]*EngagementPeriod)
+
+	for _, a := range activities {
+		at, err := a.StartTime()
+		if err != nil {
+			continue
+		}
+		summary.Add(a)
+
+		var start string
+		switch interval {
+		case "week":
+			start = at.AddDate(0, 0, -((int(at.Weekday()) + 6) % 7)).Format("2006-01-02")
+		case "year":
+			start = at.Format("2006") + "-01-01"
+		default:
+			start = at.Format("2006-01") + "-01"
+		}
+		if periods[start] == nil {
+			periods[start] = &EngagementPeriod{Start: start}
+		}
+		periods[start].Add(a)
+
+		sport := strava.NormalizeSportType(a.SportType, a.Type)
+		e := summary.Sports[sport]
+		e.Add(a)
+		summary.Sports[sport] = e
+
+		if a.KudosCount > 0 {
+			summary.MostKudoed = append(summary.MostKudoed, KudoedActivity{Highlight: *highlight(a), Kudos: a.KudosCount, Comments: a.CommentCount, Photos: photos(a)})
+		}
+	}
+
+	for _, p := range periods {
+		summary.Periods = append(summary.Periods, *p)
+	}
+	sort.Slice(summary.Periods, func(i, j int) bool { return summary.Periods[i].Start < summary.Periods[j].Start })
+
+	sort.Slice(summary.MostKudoed, func(i, j int) bool {
+		a, b := summary.MostKudoed[i], summary.MostKudoed[j]
+		if a.Kudos != b.Kudos {
+			return a.Kudos > b.Kudos
+		}
+		if a.Comments != b.Comments {
+			return a.Comments > b.Comments
+		}
+		return a.StartDate > b.StartDate
+	})
+	if len(summary.MostKudoed) > top {
+		summary.MostKudoed = summary.MostKudoed[:top]
+	}
+	return summary
+}
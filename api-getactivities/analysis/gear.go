@@ -0,0 +1,102 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// MaintenanceRecord is work done on a bike or pair of shoes. A component's
+// first record starts counting its use and each later one starts it over
+type MaintenanceRecord struct {
+	Id        int64  `json:"id"`
+	GearId    string `json:"gear_id"`
+	Date      string `json:"date"`      // 2006-01-02, the athlete's day
+	Component string `json:"component"` // e.g. chain, tires, shoes
+	Notes     string `json:"notes,omitempty"`
+}
+
+// ComponentUse is how much a component was used since it was last serviced
+type ComponentUse struct {
+	Component string `json:"component"`
+	Since     string `json:"since"` // the date of the last record
+	Totals
+	AlertKm float64 `json:"alert_km,omitempty"` // 0 without a threshold
+	Due     bool    `json:"due"`                // past the threshold
+}
+
+type GearStatus struct {
+	GearUse
+	Components []ComponentUse `json:"components"`
+}
+
+// GearUsage totals each gear's activities, all of them and those of each
+// component from its last record on, that day included since work is done
+// before a ride more often than after it. thresholds are kilometers by
+// component. Gear is ordered like the year report's, most used first
+func GearUsage(activities []strava.ActivitySummary, records []MaintenanceRecord, thresholds map[string]float64) []GearStatus {
+	gear := make(map[string]*GearStatus)
+	status := func(id string) *GearStatus {
+		if gear[id] == nil {
+			gear[id] = &GearStatus{GearUse: GearUse{Id: id}, Components: []ComponentUse{}}
+		}
+		return gear[id]
+	}
+
+	// the last record of each of the gear's components
+	last := make(map[string]map[string]string)
+	for _, r := range records {
+		status(r.GearId)
+		if last[r.GearId] == nil {
+			last[r.GearId] = make(map[string]string)
+		}
+		if r.Date > last[r.GearId][r.Component] {
+			last[r.GearId][r.Component] = r.Date
+		}
+	}
+	for id, components := range last {
+		g := status(id)
+		for component, since := range components {
+			g.Components = append(g.Components, ComponentUse{Component: component, Since: since, AlertKm: thresholds[component]})
+		}
+		sort.Slice(g.Components, func(i, j int) bool { return g.Components[i].Component < g.Components[j].Component })
+	}
+
+	for _, a := range activities {
+		if a.GearId == "" {
+			continue
+		}
+		g := status(a.GearId)
+		g.Add(a)
+		at, err := a.StartTime()
+		if err != nil {
+			continue
+		}
+		day := at.Format("2006-01-02")
+		for i := range g.Components {
+			if day >= g.Components[i].Since {
+				g.Components[i].Add(a)
+			}
+		}
+	}
+
+	usage := []GearStatus{}
+	for _, g := range gear {
+		for i := range g.Components {
+			c := &g.Components[i]
+			c.Due = c.AlertKm > 0 && c.Distance >= c.AlertKm*1000
+		}
+		usage = append(usage, *g)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		a, b := usage[i], usage[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Distance != b.Distance {
+			return a.Distance > b.Distance
+		}
+		return a.Id < b.Id
+	})
+	return usage
+}
@@ -0,0 +1,132 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// EquatorMeters is the distance around the earth at the equator
+const EquatorMeters = 40075017
+
+const (
+	metersPerKilometer = 1000
+	metersPerMile      = 1609.344
+)
+
+// EddingtonNumber is the largest number E of days with at least E of the unit
+type EddingtonNumber struct {
+	Number int `json:"number"`
+	Next   int `json:"next"` // more days of at least Number+1 needed to reach it
+}
+
+type Eddington struct {
+	Kilometers EddingtonNumber `json:"km"`
+	Miles      EddingtonNumber `json:"mi"`
+}
+
+// WorldProgress is the lifetime distance as trips around the equator
+type WorldProgress struct {
+	Laps    int     `json:"laps"`    // completed
+	Percent float64 `json:"percent"` // of the lap in progress
+}
+
+type Lifetime struct {
+	Totals
+	First          string        `json:"first"` // the local date of the first activity
+	RideEddington  Eddington     `json:"ride_eddington"`
+	RunEddington   Eddington     `json:"run_eddington"`
+	AroundTheWorld WorldProgress `json:"around_the_world"`
+	ActiveDays     int           `json:"active_days"`
+	Weekdays       [7]int        `json:"weekdays"`      // active days on each, monday first
+	DaysPerWeek    [8]int        `json:"days_per_week"` // weeks with 0 to 7 active days
+}
+
+// eddington of the distances of each day in meters, in units of unit meters
+func eddington(days map[string]float64, unit float64) EddingtonNumber {
+	var distances []float64
+	for _, meters := range days {
+		distances = append(distances, meters/unit)
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(distances)))
+
+	// the E-th longest day is at least E long
+	var e EddingtonNumber
+	for i, d := range distances {
+		if d < float64(i+1) {
+			break
+		}
+		e.Number = i + 1
+	}
+	reached := 0
+	for _, d := range distances {
+		if d >= float64(e.Number+1) {
+			reached++
+		}
+	}
+	e.Next = e.Number + 1 - reached
+	return e
+}
+
+// SummarizeLifetime totals every activity, counting each on its local date
+// like SummarizeWeek. Ride and run Eddington numbers add up each day's rides
+// or runs, virtual ones included. DaysPerWeek counts the weeks from the one of
+// the first activity to the one of now, monday to sunday
+func SummarizeLifetime(activities []strava.ActivitySummary, now time.Time) Lifetime {
+	var lifetime Lifetime
+	active := make(map[string]bool)
+	rides := make(map[string]float64)
+	runs := make(map[string]float64)
+	var first time.Time
+
+	for _, a := range activities {
+		at, err := a.StartTime()
+		if err != nil {
+			continue
+		}
+		lifetime.Totals.Add(a)
+		day := at.Format("2006-01-02")
+		if !active[day] {
+			active[day] = true
+			lifetime.Weekdays[(int(at.Weekday())+6)%7]++
+		}
+		if first.IsZero() || day < first.Format("2006-01-02") {
+			first = time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+		}
+
+		sport := strava.NormalizeSportType(a.SportType, a.Type)
+		switch {
+		case strava.MatchesActivityType(rideSports, sport):
+			rides[day] += a.Distance
+		case strava.MatchesActivityType(runSports, sport):
+			runs[day] += a.Distance
+		}
+	}
+	lifetime.ActiveDays = len(active)
+	lifetime.RideEddington = Eddington{Kilometers: eddington(rides, metersPerKilometer), Miles: eddington(rides, metersPerMile)}
+	lifetime.RunEddington = Eddington{Kilometers: eddington(runs, metersPerKilometer), Miles: eddington(runs, metersPerMile)}
+
+	laps := lifetime.Distance / EquatorMeters
+	lifetime.AroundTheWorld = WorldProgress{Laps: int(laps), Percent: math.Round((laps-math.Floor(laps))*1000) / 10}
+
+	if first.IsZero() {
+		return lifetime
+	}
+	lifetime.First = first.Format("2006-01-02")
+	// dates without a zone, so every week is seven days
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	week := first.AddDate(0, 0, -((int(first.Weekday()) + 6) % 7))
+	for !week.After(today) {
+		days := 0
+		for d := 0; d < 7; d++ {
+			if active[week.AddDate(0, 0, d).Format("2006-01-02")] {
+				days++
+			}
+		}
+		lifetime.DaysPerWeek[days]++
+		week = week.AddDate(0, 0, 7)
+	}
+	return lifetime
+}
@@ -0,0 +1,16 @@
+package analysis_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+)
+
+func BenchmarkSummarizeLifetime(b *testing.B) {
+	b.ReportAllocs()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < b.N; i++ {
+		analysis.SummarizeLifetime(activities, now)
+	}
+}
@@ -0,0 +1,65 @@
+package analysis
+
+import (
+	"math"
+	"time"
+)
+
+// the time constants of the training load curve, in days
+const (
+	FitnessDays = 42
+	FatigueDays = 7
+)
+
+// LoadDay is one day of the training load curve. Fitness (CTL) and fatigue
+// (ATL) are exponentially weighted averages of daily TSS, and form (TSB) is
+// fitness minus fatigue going into the day
+type LoadDay struct {
+	Date    string  `json:"date"`
+	TSS     float64 `json:"tss"`
+	Fitness float64 `json:"fitness"`
+	Fatigue float64 `json:"fatigue"`
+	Form    float64 `json:"form"`
+}
+
+// TrainingLoad is the curve from from to to, dates like 2006-01-02, both
+// included. It is built up from the first day in daily, so pass the TSS of
+// the weeks before from as well; days missing from daily had none. nil when
+// the dates can't be parsed or to is before from
+func TrainingLoad(daily map[string]float64, from string, to string) []LoadDay {
+	start, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return nil
+	}
+	end, err := time.Parse("2006-01-02", to)
+	if err != nil || end.Before(start) {
+		return nil
+	}
+	first := start
+	for date := range daily {
+		if day, err := time.Parse("2006-01-02", date); err == nil && day.Before(first) {
+			first = day
+		}
+	}
+
+	var days []LoadDay
+	var fitness, fatigue float64
+	for day := first; !day.After(end); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		tss := daily[date]
+		form := fitness - fatigue
+		fitness += (tss - fitness) / FitnessDays
+		fatigue += (tss - fatigue) / FatigueDays
+		if day.Before(start) {
+			continue
+		}
+		days = append(days, LoadDay{
+			Date:    date,
+			TSS:     math.Round(tss*10) / 10,
+			Fitness: math.Round(fitness*10) / 10,
+			Fatigue: math.Round(fatigue*10) / 10,
+			Form:    math.Round(form*10) / 10,
+		})
+	}
+	return days
+}
@@ -0,0 +1,19 @@
+package analysis_test
+
+import (
+	"testing"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/benchdata"
+)
+
+// what /strava/analytics/lifetime, /strava/analytics/engagement and
+// /strava/reports/year/:year add up once the activities are read
+var activities = benchdata.Activities(benchdata.ActivityCount)
+
+func TestMain(m *testing.M) {
+	benchdata.Main(m, benchdata.Benchmarks{
+		"BenchmarkSummarizeLifetime":   BenchmarkSummarizeLifetime,
+		"BenchmarkSummarizeEngagement": BenchmarkSummarizeEngagement,
+		"BenchmarkSummarizeYear":       BenchmarkSummarizeYear,
+	})
+}
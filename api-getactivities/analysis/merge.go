@@ -0,0 +1,62 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/streams"
+)
+
+// the longest break between two recordings that are still one activity, such
+// as a device restarting after a crash
+const MaxMergeGap = time.Hour
+
+var (
+	ErrMergeSport   = errors.New("activities are of different sports")
+	ErrMergeStreams = errors.New("both activities need recorded streams")
+)
+
+// MergeActivities stitches second, recorded after first, onto it as one
+// activity with first's id, name and settings. Streams are joined and the
+// totals recomputed from them; splits and best efforts can't be joined and are
+// dropped, segment efforts of both are kept
+func MergeActivities(first, second strava.ActivityDetailed, firstSet, secondSet strava.StreamSet) (strava.ActivityDetailed, strava.StreamSet, error) {
+	if strava.NormalizeSportType(first.SportType, first.Type) != strava.NormalizeSportType(second.SportType, second.Type) {
+		return first, firstSet, ErrMergeSport
+	}
+	if firstSet.Len() == 0 || secondSet.Len() == 0 {
+		return first, firstSet, ErrMergeStreams
+	}
+
+	firstStart, err := time.Parse(time.RFC3339, first.StartDate)
+	if err != nil {
+		return first, firstSet, err
+	}
+	secondStart, err := time.Parse(time.RFC3339, second.StartDate)
+	if err != nil {
+		return first, firstSet, err
+	}
+	firstEnd := firstStart.Add(time.Duration(first.ElapsedTime) * time.Second)
+	if gap := secondStart.Sub(firstEnd); gap < 0 || gap > MaxMergeGap {
+		return first, firstSet, fmt.Errorf("the second activity must start within %.0f minutes after the first ends", MaxMergeGap.Minutes())
+	}
+
+	meters := first.Distance
+	if firstSet.Distance != nil && len(firstSet.Distance.Data) > 0 {
+		meters = firstSet.Distance.Data[len(firstSet.Distance.Data)-1]
+	}
+	set := streams.Concat(firstSet, secondSet, int(secondStart.Sub(firstStart).Seconds()), meters)
+
+	merged := first
+	RecomputeTotals(&merged.ActivitySummary, set)
+	merged.Calories = first.Calories + second.Calories
+	merged.SplitsMetric, merged.SplitsStandard, merged.BestEfforts = nil, nil, nil
+	merged.SegmentEfforts = append(append([]strava.SegmentEffortSummary{}, first.SegmentEfforts...), second.SegmentEfforts...)
+	merged.AchievementCount += second.AchievementCount
+	merged.PrCount += second.PrCount
+	// the summary polyline is first's route only, the latlng stream has both
+	merged.Map.SummaryPolyline = ""
+	return merged, set, nil
+}
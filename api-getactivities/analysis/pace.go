@@ -0,0 +1,29 @@
+// Package analysis holds the arithmetic behind the reporting endpoints, free of
+// storage and HTTP so other programs can reuse it on their own activities.
+package analysis
+
+import (
+	"fmt"
+	"math"
+)
+
+const milesPerMeter = 0.000621371
+
+// Pace converts strava's meters and seconds into miles, minutes and minutes per mile
+func Pace(distanceMeters float64, movingSeconds int) (miles float64, minutes float64, pace float64) {
+	miles = distanceMeters * milesPerMeter
+	minutes = float64(movingSeconds) / 60
+	pace = minutes / miles
+	return miles, minutes, pace
+}
+
+// DisplayPace formats minutes per mile as m:ss
+func DisplayPace(pace float64) string {
+	hanging_decimal := pace - float64(int(pace))
+	seconds := float64(math.Round(hanging_decimal * 60))
+	pace_down := float64(int(pace))
+	if seconds < 10 {
+		return fmt.Sprintf("%.0f:0%.0f", pace_down, seconds)
+	}
+	return fmt.Sprintf("%.0f:%.0f", pace_down, seconds)
+}
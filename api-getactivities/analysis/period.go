@@ -0,0 +1,48 @@
+package analysis
+
+import "sort"
+
+const (
+	PeriodInjury   = "injury"
+	PeriodIllness  = "illness"
+	PeriodDowntime = "downtime" // planned time off, travel, an off season
+)
+
+var PeriodTypes = []string{PeriodInjury, PeriodIllness, PeriodDowntime}
+
+// Period is a stretch of days the athlete could not train as usual; End is
+// left empty while it lasts
+type Period struct {
+	Id    int64  `json:"id"`
+	Type  string `json:"type"`
+	Start string `json:"start"`         // 2006-01-02, included
+	End   string `json:"end,omitempty"` // 2006-01-02, included
+	Notes string `json:"notes,omitempty"`
+}
+
+// Covers reports whether the period includes day, a date like 2006-01-02
+func (p Period) Covers(day string) bool {
+	return day >= p.Start && (p.End == "" || day <= p.End)
+}
+
+func coveredBy(periods []Period, day string) bool {
+	for _, p := range periods {
+		if p.Covers(day) {
+			return true
+		}
+	}
+	return false
+}
+
+// Overlapping are the periods with a day from from to to, both included,
+// earliest first
+func Overlapping(periods []Period, from string, to string) []Period {
+	overlapping := []Period{}
+	for _, p := range periods {
+		if p.Start <= to && (p.End == "" || p.End >= from) {
+			overlapping = append(overlapping, p)
+		}
+	}
+	sort.SliceStable(overlapping, func(i, j int) bool { return overlapping[i].Start < overlapping[j].Start })
+	return overlapping
+}
@@ -0,0 +1,98 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/geo"
+)
+
+// PlaceVisit is an activity and the places its route passed through
+type PlaceVisit struct {
+	ActivityId int64
+	StartDate  string // RFC3339, UTC
+	Places     []geo.Place
+}
+
+type FirstVisit struct {
+	Date       string `json:"date"` // the start_date of the activity
+	ActivityId int64  `json:"activity_id"`
+}
+
+type RegionVisits struct {
+	Region     string     `json:"region"`
+	Name       string     `json:"name,omitempty"`
+	FirstVisit FirstVisit `json:"first_visit"`
+	Activities int        `json:"activities"`
+}
+
+type CountryVisits struct {
+	Country    string         `json:"country"`
+	Name       string         `json:"name,omitempty"`
+	FirstVisit FirstVisit     `json:"first_visit"`
+	Activities int            `json:"activities"`
+	Regions    []RegionVisits `json:"regions"`
+}
+
+// PlacesVisited counts the activities in each country and region, an activity
+// crossing a border counting in both, and keeps the first of each. Countries
+// and their regions are ordered by first visit
+func PlacesVisited(visits []PlaceVisit) []CountryVisits {
+	countries := make(map[string]*CountryVisits)
+	regions := make(map[string]map[string]*RegionVisits)
+	earlier := func(first *FirstVisit, v PlaceVisit) {
+		if first.Date == "" || v.StartDate < first.Date || (v.StartDate == first.Date && v.ActivityId < first.ActivityId) {
+			*first = FirstVisit{Date: v.StartDate, ActivityId: v.ActivityId}
+		}
+	}
+
+	for _, v := range visits {
+		counted := make(map[string]bool)
+		for _, p := range v.Places {
+			country := countries[p.Country]
+			if country == nil {
+				country = &CountryVisits{Country: p.Country, Regions: []RegionVisits{}}
+				countries[p.Country] = country
+				regions[p.Country] = make(map[string]*RegionVisits)
+			}
+			if !counted[p.Country] {
+				counted[p.Country] = true
+				country.Activities++
+				earlier(&country.FirstVisit, v)
+			}
+			if p.Region == "" || counted[p.Region] {
+				continue
+			}
+			counted[p.Region] = true
+			region := regions[p.Country][p.Region]
+			if region == nil {
+				region = &RegionVisits{Region: p.Region}
+				regions[p.Country][p.Region] = region
+			}
+			region.Activities++
+			earlier(&region.FirstVisit, v)
+		}
+	}
+
+	byFirstVisit := func(a, b FirstVisit, codeA, codeB string) bool {
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		return codeA < codeB
+	}
+	visited := []CountryVisits{}
+	for code, country := range countries {
+		for _, region := range regions[code] {
+			country.Regions = append(country.Regions, *region)
+		}
+		sort.Slice(country.Regions, func(i, j int) bool {
+			a, b := country.Regions[i], country.Regions[j]
+			return byFirstVisit(a.FirstVisit, b.FirstVisit, a.Region, b.Region)
+		})
+		visited = append(visited, *country)
+	}
+	sort.Slice(visited, func(i, j int) bool {
+		a, b := visited[i], visited[j]
+		return byFirstVisit(a.FirstVisit, b.FirstVisit, a.Country, b.Country)
+	})
+	return visited
+}
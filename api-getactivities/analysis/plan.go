@@ -0,0 +1,173 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// PlannedWorkout is a day of a training plan; targets left at zero are not set
+type PlannedWorkout struct {
+	Id        int64   `json:"id"`
+	Date      string  `json:"date"`       // 2006-01-02, the athlete's day
+	SportType string  `json:"sport_type"` // a legacy type like Ride also matches GravelRide
+	Name      string  `json:"name,omitempty"`
+	Duration  int     `json:"duration,omitempty"` // seconds of moving time
+	Distance  float64 `json:"distance,omitempty"` // meters
+	TSS       float64 `json:"tss,omitempty"`
+}
+
+const (
+	PlanCompleted = "completed"
+	PlanPartial   = "partial"
+	PlanMissed    = "missed"
+	PlanUpcoming  = "upcoming"
+	PlanExcused   = "excused" // missed during a period it is excused by
+)
+
+// a workout reaching this share of its targets counts as completed
+const planCompletedPercent = 80
+
+type PlanActual struct {
+	ActivityId int64   `json:"activity_id"`
+	Name       string  `json:"name"`
+	Duration   int     `json:"duration"`
+	Distance   float64 `json:"distance"`
+	TSS        float64 `json:"tss,omitempty"` // 0 without power or heart rate
+}
+
+type PlanResult struct {
+	Plan    PlannedWorkout `json:"plan"`
+	Status  string         `json:"status"`
+	Percent float64        `json:"percent"` // of the set targets reached, each capped at 100
+	Actual  *PlanActual    `json:"actual"`  // nil when nothing was done
+}
+
+type Compliance struct {
+	Planned   int          `json:"planned"`
+	Completed int          `json:"completed"`
+	Partial   int          `json:"partial"`
+	Missed    int          `json:"missed"`
+	Upcoming  int          `json:"upcoming"`
+	Excused   int          `json:"excused"`
+	Percent   float64      `json:"percent"` // average over the workouts that are due, excused ones left out
+	Workouts  []PlanResult `json:"workouts"`
+}
+
+// TrainingStress estimates an activity's TSS from its average power against
+// ftp, or without power from its average heart rate against the threshold;
+// 0 when neither is known. Average power stands in for normalized power, so
+// steady efforts are estimated better than intervals
+func TrainingStress(a strava.ActivitySummary, ftp int, thresholdHeartrate float64) float64 {
+	hours := float64(a.MovingTime) / 3600
+	var intensity float64
+	switch {
+	case a.AverageWatts > 0 && ftp > 0:
+		intensity = a.AverageWatts / float64(ftp)
+	case a.AverageHeartrate > 0 && thresholdHeartrate > 0:
+		intensity = a.AverageHeartrate / thresholdHeartrate
+	default:
+		return 0
+	}
+	return math.Round(hours*intensity*intensity*1000) / 10
+}
+
+// how much of each set target was reached, averaged; a TSS target is left out
+// when the activity's can't be estimated, and a plan without targets is
+// reached by doing anything
+func planPercent(plan PlannedWorkout, actual PlanActual) float64 {
+	var shares []float64
+	if plan.Duration > 0 {
+		shares = append(shares, float64(actual.Duration)/float64(plan.Duration))
+	}
+	if plan.Distance > 0 {
+		shares = append(shares, actual.Distance/plan.Distance)
+	}
+	if plan.TSS > 0 && actual.TSS > 0 {
+		shares = append(shares, actual.TSS/plan.TSS)
+	}
+	if len(shares) == 0 {
+		return 100
+	}
+	total := 0.0
+	for _, share := range shares {
+		total += math.Min(share, 1)
+	}
+	return math.Round(total/float64(len(shares))*1000) / 10
+}
+
+// CheckCompliance matches each plan with an activity of its sport started on
+// its day, in the activity's own zone, the longest first when there are
+// several, and each activity with one plan at most. Plans from today on are
+// upcoming until done. stress estimates TSS for activities, and a missed plan
+// is excused rather than missed on the days of the excused periods
+func CheckCompliance(plans []PlannedWorkout, activities []strava.ActivitySummary, today string, stress func(strava.ActivitySummary) float64, excused []Period) Compliance {
+	byDay := make(map[string][]strava.ActivitySummary)
+	for _, a := range activities {
+		at, err := a.StartTime()
+		if err != nil {
+			continue
+		}
+		day := at.Format("2006-01-02")
+		byDay[day] = append(byDay[day], a)
+	}
+	for _, day := range byDay {
+		sort.SliceStable(day, func(i, j int) bool { return day[i].MovingTime > day[j].MovingTime })
+	}
+
+	sorted := append([]PlannedWorkout(nil), plans...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Date != sorted[j].Date {
+			return sorted[i].Date < sorted[j].Date
+		}
+		return sorted[i].Id < sorted[j].Id
+	})
+
+	used := make(map[int64]bool)
+	compliance := Compliance{Workouts: []PlanResult{}}
+	due, reached := 0, 0.0
+	for _, plan := range sorted {
+		result := PlanResult{Plan: plan}
+		for _, a := range byDay[plan.Date] {
+			sport := strava.NormalizeSportType(a.SportType, a.Type)
+			if used[a.Id] || !strava.MatchesActivityType([]string{plan.SportType}, sport) {
+				continue
+			}
+			used[a.Id] = true
+			result.Actual = &PlanActual{ActivityId: a.Id, Name: a.Name, Duration: a.MovingTime, Distance: a.Distance, TSS: stress(a)}
+			break
+		}
+
+		compliance.Planned++
+		switch {
+		case result.Actual != nil:
+			result.Percent = planPercent(plan, *result.Actual)
+			if result.Percent >= planCompletedPercent {
+				result.Status = PlanCompleted
+				compliance.Completed++
+			} else {
+				result.Status = PlanPartial
+				compliance.Partial++
+			}
+		case plan.Date >= today:
+			result.Status = PlanUpcoming
+			compliance.Upcoming++
+		case coveredBy(excused, plan.Date):
+			result.Status = PlanExcused
+			compliance.Excused++
+		default:
+			result.Status = PlanMissed
+			compliance.Missed++
+		}
+		if result.Status != PlanUpcoming && result.Status != PlanExcused {
+			due++
+			reached += result.Percent
+		}
+		compliance.Workouts = append(compliance.Workouts, result)
+	}
+	if due > 0 {
+		compliance.Percent = math.Round(reached/float64(due)*10) / 10
+	}
+	return compliance
+}
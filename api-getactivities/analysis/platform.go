@@ -0,0 +1,56 @@
+package analysis
+
+import (
+	"strings"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// virtual platforms that upload to strava
+const (
+	PlatformZwift       = "zwift"
+	PlatformTrainerRoad = "trainerroad"
+	PlatformRouvy       = "rouvy"
+)
+
+var Platforms = []string{PlatformZwift, PlatformTrainerRoad, PlatformRouvy}
+
+// what each platform leaves in the external id of its uploads, such as
+// zwift-activity-123.fit, or in the device name of the detailed activity
+var platformMarkers = map[string][]string{
+	PlatformZwift:       {"zwift"},
+	PlatformTrainerRoad: {"trainerroad", "trainer road"},
+	PlatformRouvy:       {"rouvy"},
+}
+
+// VirtualPlatform names the platform an activity was recorded on, empty for
+// other recordings. deviceName is only on the detailed activity, pass "" for a
+// summary
+func VirtualPlatform(externalId string, deviceName string) string {
+	seen := strings.ToLower(externalId + " " + deviceName)
+	for _, platform := range Platforms {
+		for _, marker := range platformMarkers[platform] {
+			if strings.Contains(seen, marker) {
+				return platform
+			}
+		}
+	}
+	return ""
+}
+
+var virtualSports = map[string]bool{
+	strava.SportVirtualRide: true,
+	strava.SportVirtualRun:  true,
+	strava.SportVirtualRow:  true,
+}
+
+// IsVirtual is whether the activity was done in a virtual world, by its sport
+// type or the platform that uploaded it
+func IsVirtual(a strava.ActivitySummary) bool {
+	return virtualSports[strava.NormalizeSportType(a.SportType, a.Type)] || VirtualPlatform(a.ExternalId, "") != ""
+}
+
+// IsOutdoor is whether the activity was done outside, neither virtual nor on a trainer
+func IsOutdoor(a strava.ActivitySummary) bool {
+	return !IsVirtual(a) && !a.Trainer
+}
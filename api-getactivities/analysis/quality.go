@@ -0,0 +1,108 @@
+package analysis
+
+import (
+	"fmt"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+const (
+	CheckHeartrate     = "heartrate_range"
+	CheckSpeedSpike    = "speed_spike"
+	CheckNegativePower = "negative_power"
+	CheckPowerRange    = "power_range"
+)
+
+// readings past these are sensor faults rather than efforts
+const (
+	maxPlausibleHeartrate = 230
+	maxPlausibleWatts     = 2500
+)
+
+// fastest plausible speed in meters per second by sport, sports without a
+// limit are not checked for speed
+var maxPlausibleSpeed = map[string]float64{
+	strava.SportRun:              12,
+	strava.SportTrailRun:         12,
+	strava.SportVirtualRun:       12,
+	strava.SportWalk:             5,
+	strava.SportHike:             5,
+	strava.SportRide:             30,
+	strava.SportGravelRide:       30,
+	strava.SportMountainBikeRide: 30,
+	strava.SportEBikeRide:        30,
+	strava.SportVirtualRide:      30,
+	strava.SportSwim:             4,
+}
+
+// QualityIssue is one check an activity failed
+type QualityIssue struct {
+	Check   string `json:"check"`
+	Message string `json:"message"`
+	Samples int    `json:"samples,omitempty"` // stream samples affected, 0 when found in the summary
+}
+
+// CheckSensorData looks for readings no athlete or device could produce in
+// the summary and, when set is not nil, in the streams
+func CheckSensorData(a strava.ActivitySummary, set *strava.StreamSet) []QualityIssue {
+	var issues []QualityIssue
+
+	hrSamples := 0
+	if set != nil && set.Heartrate != nil {
+		for _, hr := range set.Heartrate.Data {
+			if hr > maxPlausibleHeartrate {
+				hrSamples++
+			}
+		}
+	}
+	if a.MaxHeartrate > maxPlausibleHeartrate || hrSamples > 0 {
+		issues = append(issues, QualityIssue{
+			Check:   CheckHeartrate,
+			Message: fmt.Sprintf("heart rate above %d bpm", maxPlausibleHeartrate),
+			Samples: hrSamples,
+		})
+	}
+
+	if limit, ok := maxPlausibleSpeed[strava.NormalizeSportType(a.SportType, a.Type)]; ok {
+		// speed between samples from the distance stream, velocity_smooth hides spikes
+		spikes := 0
+		if set != nil && set.Distance != nil && set.Time != nil && len(set.Distance.Data) == len(set.Time.Data) {
+			for i := 1; i < len(set.Time.Data); i++ {
+				dt := set.Time.Data[i] - set.Time.Data[i-1]
+				if dt > 0 && (set.Distance.Data[i]-set.Distance.Data[i-1])/float64(dt) > limit {
+					spikes++
+				}
+			}
+		}
+		if a.MaximunSpeed > limit || spikes > 0 {
+			issues = append(issues, QualityIssue{
+				Check:   CheckSpeedSpike,
+				Message: fmt.Sprintf("speed above %.0f km/h", limit*3.6),
+				Samples: spikes,
+			})
+		}
+	}
+
+	negative, excessive := 0, 0
+	if set != nil && set.Watts != nil {
+		for _, w := range set.Watts.Data {
+			if w < 0 {
+				negative++
+			}
+			if w > maxPlausibleWatts {
+				excessive++
+			}
+		}
+	}
+	if a.AverageWatts < 0 || negative > 0 {
+		issues = append(issues, QualityIssue{Check: CheckNegativePower, Message: "negative power readings", Samples: negative})
+	}
+	if excessive > 0 {
+		issues = append(issues, QualityIssue{
+			Check:   CheckPowerRange,
+			Message: fmt.Sprintf("power above %d W", maxPlausibleWatts),
+			Samples: excessive,
+		})
+	}
+	return issues
+}
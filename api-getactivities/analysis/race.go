@@ -0,0 +1,55 @@
+package analysis
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// workout_type values strava uses for races, runs and rides have their own
+const (
+	workoutRunRace  = 1
+	workoutRideRace = 11
+)
+
+// words athletes put in race names; a plain number of kilometers like 10k
+// is as often a training run, so only the common race distances are listed
+var raceKeywords = regexp.MustCompile(`(?i)\b(race|racing|marathon|half[- ]marathon|parkrun|5k|10k|gran fondo|fondo|triathlon|ironman|duathlon|criterium|crit|time trial|championships?|ultra|relay|turkey trot)\b`)
+
+const (
+	// average heart rate, as a share of the athlete's highest, held only in races
+	raceHeartrateShare = 0.88
+	// shorter efforts at that heart rate are intervals rather than races
+	minRaceSeconds = 20 * 60
+)
+
+// RaceReasons says why an activity looks like a race: strava's workout type,
+// its name, or a heart rate held close to the athlete's maximum for the whole
+// effort. maxHeartrate is the highest the athlete has recorded, 0 when unknown.
+// It is empty for activities that look like training
+func RaceReasons(a strava.ActivitySummary, maxHeartrate float64) []string {
+	var reasons []string
+	if a.WorkoutType == workoutRunRace || a.WorkoutType == workoutRideRace {
+		reasons = append(reasons, "marked as a race on strava")
+	}
+	if keyword := raceKeywords.FindString(a.Name); keyword != "" {
+		reasons = append(reasons, fmt.Sprintf("name mentions %q", keyword))
+	}
+	if maxHeartrate > 0 && a.AverageHeartrate >= raceHeartrateShare*maxHeartrate && a.MovingTime >= minRaceSeconds {
+		reasons = append(reasons, fmt.Sprintf("average heart rate %.0f bpm is %.0f%% of the highest recorded", a.AverageHeartrate, a.AverageHeartrate/maxHeartrate*100))
+	}
+	return reasons
+}
+
+// HighestHeartrate is the athlete's highest recorded heart rate, for
+// RaceReasons; readings CheckSensorData rejects are left out
+func HighestHeartrate(activities []strava.ActivitySummary) float64 {
+	highest := 0.0
+	for _, a := range activities {
+		if a.MaxHeartrate <= maxPlausibleHeartrate && a.MaxHeartrate > highest {
+			highest = a.MaxHeartrate
+		}
+	}
+	return highest
+}
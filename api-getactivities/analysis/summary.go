@@ -0,0 +1,75 @@
+package analysis
+
+import (
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// Totals add up activities in strava's units, meters and seconds
+type Totals struct {
+	Count      int     `json:"count"`
+	Distance   float64 `json:"distance"`
+	MovingTime int     `json:"moving_time"`
+	Elevation  float64 `json:"total_elevation_gain"`
+}
+
+func (t *Totals) Add(a strava.ActivitySummary) {
+	t.Count++
+	t.Distance += a.Distance
+	t.MovingTime += a.MovingTime
+	t.Elevation += a.TotalElevationGain
+}
+
+type WeekSummary struct {
+	Start time.Time `json:"start"`
+	Totals
+	Virtual Totals    `json:"virtual"` // see IsVirtual
+	Outdoor Totals    `json:"outdoor"` // see IsOutdoor, trainer rides are in neither
+	Days    [7]Totals `json:"days"`    // monday first
+}
+
+// SummarizeWeek totals the activities starting in the week from start, a
+// monday as returned by StartOfWeekIn; activities outside the week are ignored.
+// Each activity counts on the day it started where it started, so a 6am run
+// in Denver is monday's even though it is monday afternoon in UTC
+func SummarizeWeek(start time.Time, activities []strava.ActivitySummary) WeekSummary {
+	week := WeekSummary{Start: start}
+	for _, a := range activities {
+		at, err := a.StartTime()
+		if err != nil {
+			continue
+		}
+		day := daysBetween(start, at)
+		if day < 0 || day >= 7 {
+			continue
+		}
+		week.Totals.Add(a)
+		week.Days[day].Add(a)
+		if IsVirtual(a) {
+			week.Virtual.Add(a)
+		}
+		if IsOutdoor(a) {
+			week.Outdoor.Add(a)
+		}
+	}
+	return week
+}
+
+// InWeek reports whether a started in the week from start, on its local day
+// as SummarizeWeek counts it
+func InWeek(start time.Time, a strava.ActivitySummary) bool {
+	at, err := a.StartTime()
+	if err != nil {
+		return false
+	}
+	day := daysBetween(start, at)
+	return day >= 0 && day < 7
+}
+
+// calendar days from from's date to to's date, each read in its own zone
+func daysBetween(from, to time.Time) int {
+	a := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	b := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(b.Sub(a) / (24 * time.Hour))
+}
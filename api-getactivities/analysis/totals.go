@@ -0,0 +1,99 @@
+package analysis
+
+import (
+	"math"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/streams"
+)
+
+const (
+	// samples averaged before elevation gain is counted, so altimeter noise doesn't add up
+	elevationSmoothing = 5
+	// the speed below which a sample is stopped, when strava's moving stream is missing
+	// and speed comes from the velocity or distance stream
+	movingSpeed = 0.5
+)
+
+// RecomputeTotals sets the summary's distance, times, elevation, speeds and
+// averages from the streams, for an activity whose streams were changed
+// locally. Totals of channels that were not recorded are left as they are
+func RecomputeTotals(a *strava.ActivitySummary, set strava.StreamSet) {
+	n := set.Len()
+	if n == 0 {
+		return
+	}
+	times := set.Time.Data
+	a.ElapsedTime = times[n-1] - times[0]
+
+	// a sample is moving for the time until the next one
+	a.MovingTime = 0
+	for i := 0; i+1 < n; i++ {
+		moving := true
+		switch {
+		case set.Moving != nil && i < len(set.Moving.Data):
+			moving = set.Moving.Data[i]
+		case set.VelocitySmooth != nil && i < len(set.VelocitySmooth.Data):
+			moving = set.VelocitySmooth.Data[i] >= movingSpeed
+		case set.Distance != nil && i+1 < len(set.Distance.Data) && times[i+1] > times[i]:
+			moving = (set.Distance.Data[i+1]-set.Distance.Data[i])/float64(times[i+1]-times[i]) >= movingSpeed
+		}
+		if moving {
+			a.MovingTime += times[i+1] - times[i]
+		}
+	}
+
+	if set.Distance != nil && len(set.Distance.Data) > 0 {
+		d := set.Distance.Data
+		a.Distance = d[len(d)-1] - d[0]
+		if a.MovingTime > 0 {
+			a.AverageSpeed = a.Distance / float64(a.MovingTime)
+		}
+	}
+	if set.VelocitySmooth != nil {
+		a.MaximunSpeed = 0
+		for _, v := range set.VelocitySmooth.Data {
+			a.MaximunSpeed = math.Max(a.MaximunSpeed, v)
+		}
+	}
+
+	if set.Altitude != nil && len(set.Altitude.Data) > 0 {
+		smoothed := streams.MovingAverage(set.Altitude.Data, elevationSmoothing)
+		a.TotalElevationGain = 0
+		a.ElevHigh, a.ElevLow = set.Altitude.Data[0], set.Altitude.Data[0]
+		for i, alt := range set.Altitude.Data {
+			a.ElevHigh = math.Max(a.ElevHigh, alt)
+			a.ElevLow = math.Min(a.ElevLow, alt)
+			if i > 0 && smoothed[i] > smoothed[i-1] {
+				a.TotalElevationGain += smoothed[i] - smoothed[i-1]
+			}
+		}
+	}
+
+	if set.LatLng != nil && len(set.LatLng.Data) > 0 {
+		a.StartLocation = set.LatLng.Data[0]
+		a.EndLocation = set.LatLng.Data[len(set.LatLng.Data)-1]
+	}
+
+	if set.Heartrate != nil && len(set.Heartrate.Data) > 0 {
+		a.AverageHeartrate = mean(set.Heartrate.Data)
+		a.MaxHeartrate = 0
+		for _, hr := range set.Heartrate.Data {
+			a.MaxHeartrate = math.Max(a.MaxHeartrate, float64(hr))
+		}
+	}
+	if set.Watts != nil && len(set.Watts.Data) > 0 {
+		a.AverageWatts = mean(set.Watts.Data)
+	}
+	if set.Cadence != nil && len(set.Cadence.Data) > 0 {
+		a.AverageCadence = mean(set.Cadence.Data)
+	}
+}
+
+func mean(data []int) float64 {
+	total := 0
+	for _, v := range data {
+		total += v
+	}
+	return float64(total) / float64(len(data))
+}
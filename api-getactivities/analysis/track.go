@@ -0,0 +1,99 @@
+package analysis
+
+import (
+	"github.com/agentdanger/golang-strava-api/api-getactivities/geo"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/streams"
+)
+
+// TrackOptions tune AnalyzeTrack, DefaultTrackOptions suit runs and rides
+type TrackOptions struct {
+	StopSpeed float64 // meters per second below which the athlete is stopped
+	MinPause  int     // seconds stopped before it is a pause instead of a slow moment
+	MaxSpeed  float64 // meters per second above which the position jumped
+}
+
+var DefaultTrackOptions = TrackOptions{StopSpeed: 0.5, MinPause: 10, MaxSpeed: 50}
+
+// Pause is a stop, in seconds since the start
+type Pause struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Teleport is a gap the athlete could not have covered, such as GPS
+// reacquired after a tunnel or a device that kept recording in a car
+type Teleport struct {
+	At       int     `json:"at"` // seconds since the start, where the track resumes
+	Distance float64 `json:"distance"`
+	Seconds  int     `json:"seconds"`
+}
+
+// Track is distance and moving time recomputed from a cleaned latlng stream
+type Track struct {
+	Distance   float64    `json:"distance"`
+	MovingTime int        `json:"moving_time"`
+	Pauses     []Pause    `json:"pauses"`
+	Teleports  []Teleport `json:"teleports"`
+	Jumps      int        `json:"jumps"` // single bad fixes left out
+}
+
+// AnalyzeTrack walks the track with single-fix jumps removed. Distance covered
+// while stopped is GPS drift and distance across a teleport was not travelled,
+// so neither counts; stops shorter than MinPause count as moving. seconds is
+// the time stream and must be as long as points
+func AnalyzeTrack(points []geo.Point, seconds []int, opts TrackOptions) Track {
+	track := Track{Pauses: []Pause{}, Teleports: []Teleport{}}
+	if len(points) < 2 || len(seconds) != len(points) {
+		return track
+	}
+
+	cleaned, jumps := streams.RemoveJumps(points, seconds, opts.MaxSpeed)
+	track.Jumps = jumps
+
+	// the stop in progress, with what it would add if it turns out to be short
+	stopStart, stopSeconds, stopDistance := -1, 0, 0.0
+	endStop := func() {
+		if stopStart < 0 {
+			return
+		}
+		if stopSeconds >= opts.MinPause {
+			track.Pauses = append(track.Pauses, Pause{Start: seconds[stopStart], End: seconds[stopStart] + stopSeconds})
+		} else {
+			track.Distance += stopDistance
+			track.MovingTime += stopSeconds
+		}
+		stopStart, stopSeconds, stopDistance = -1, 0, 0
+	}
+
+	var zero geo.Point
+	for i := 1; i < len(cleaned); i++ {
+		// fixes at 0,0 are samples recorded without a position
+		if cleaned[i-1] == zero || cleaned[i] == zero {
+			continue
+		}
+		dt := seconds[i] - seconds[i-1]
+		if dt <= 0 {
+			continue
+		}
+		d := geo.Distance(cleaned[i-1], cleaned[i])
+		speed := d / float64(dt)
+
+		switch {
+		case speed > opts.MaxSpeed:
+			endStop()
+			track.Teleports = append(track.Teleports, Teleport{At: seconds[i], Distance: d, Seconds: dt})
+		case speed < opts.StopSpeed:
+			if stopStart < 0 {
+				stopStart = i - 1
+			}
+			stopSeconds += dt
+			stopDistance += d
+		default:
+			endStop()
+			track.Distance += d
+			track.MovingTime += dt
+		}
+	}
+	endStop()
+	return track
+}
@@ -0,0 +1,75 @@
+package analysis
+
+import (
+	"fmt"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/geo"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/streams"
+)
+
+// a ride whose positions all fit in a box this wide, in meters, went nowhere
+const trainerSpread = 100
+
+// rides that can be done on a trainer but are recorded as outdoor ones;
+// virtual rides are indoor by definition
+var outdoorRideTypes = map[string]bool{
+	strava.SportRide:              true,
+	strava.SportMountainBikeRide:  true,
+	strava.SportGravelRide:        true,
+	strava.SportEBikeRide:         true,
+	strava.SportEMountainBikeRide: true,
+}
+
+// spread is the diagonal of the box holding every recorded position, ok is
+// false when there are none
+func spread(points []geo.Point) (float64, bool) {
+	var fixes []geo.Point
+	for _, p := range points {
+		if p != (geo.Point{}) {
+			fixes = append(fixes, p)
+		}
+	}
+	b, ok := geo.BoundsOf(fixes)
+	if !ok {
+		return 0, false
+	}
+	return geo.Distance(geo.Point{Lat: b.MinLat, Lng: b.MinLng}, geo.Point{Lat: b.MaxLat, Lng: b.MaxLng}), true
+}
+
+// TrainerRideReason says why a ride not marked as a trainer ride looks like
+// one: power or cadence was recorded but the position never changed. It is
+// empty when the ride looks right. set may be nil, the summary polyline then
+// stands in for the latlng stream
+func TrainerRideReason(a strava.ActivitySummary, set *strava.StreamSet) string {
+	if a.Trainer || a.Manual || a.MovingTime == 0 {
+		return ""
+	}
+	if !outdoorRideTypes[strava.NormalizeSportType(a.SportType, a.Type)] {
+		return ""
+	}
+
+	pedalled := a.DeviceWatts || a.AverageWatts > 0 || a.AverageCadence > 0
+	if set != nil {
+		pedalled = pedalled || set.Watts != nil || set.Cadence != nil
+	}
+	if !pedalled {
+		return ""
+	}
+
+	var points []geo.Point
+	if set != nil && set.LatLng != nil {
+		points = streams.Points(set.LatLng.Data)
+	} else {
+		points, _ = geo.DecodePolyline(a.Map.SummaryPolyline)
+	}
+
+	meters, ok := spread(points)
+	switch {
+	case !ok:
+		return "power or cadence recorded without a GPS track"
+	case meters < trainerSpread:
+		return fmt.Sprintf("power or cadence recorded but every GPS fix is within %.0f m", meters)
+	}
+	return ""
+}
@@ -0,0 +1,61 @@
+package analysis
+
+import "time"
+
+type TrendLine struct {
+	Slope       float64 `json:"slope_seconds_per_day"` // negative means getting faster
+	Intercept   float64 `json:"intercept_seconds"`
+	FirstFitted float64 `json:"first_fitted_seconds"`
+	LastFitted  float64 `json:"last_fitted_seconds"`
+}
+
+// Sample is one timed observation, e.g. a segment effort's elapsed seconds
+type Sample struct {
+	Unix  int
+	Value float64
+}
+
+// FitTrendLine is a least squares fit of value against days since the first
+// sample, samples must be in time order and nil is returned when there is no line
+func FitTrendLine(samples []Sample) *TrendLine {
+	if len(samples) < 2 {
+		return nil
+	}
+
+	first := samples[0].Unix
+	n := float64(len(samples))
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := float64(s.Unix-first) / 86400
+		y := s.Value
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	denom := n*sumXX - sumX*sumX
+	if denom == 0 {
+		return nil
+	}
+
+	var trend TrendLine
+	trend.Slope = (n*sumXY - sumX*sumY) / denom
+	trend.Intercept = (sumY - trend.Slope*sumX) / n
+	trend.FirstFitted = trend.Intercept
+	lastX := float64(samples[len(samples)-1].Unix-first) / 86400
+	trend.LastFitted = trend.Intercept + trend.Slope*lastX
+	return &trend
+}
+
+// StartOfWeek is monday 00:00 UTC of the week containing now
+func StartOfWeek(now time.Time) time.Time {
+	return StartOfWeekIn(now, time.UTC)
+}
+
+// StartOfWeekIn is monday 00:00 in loc of the week containing now there
+func StartOfWeekIn(now time.Time, loc *time.Location) time.Time {
+	now = now.In(loc)
+	daysSinceMonday := (int(now.Weekday()) + 6) % 7
+	return time.Date(now.Year(), now.Month(), now.Day()-daysSinceMonday, 0, 0, 0, 0, loc)
+}
@@ -0,0 +1,66 @@
+package analysis
+
+import (
+	"errors"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/streams"
+)
+
+var (
+	ErrTrimStreams = errors.New("activity has no recorded streams")
+	ErrTrimRange   = errors.New("start must be before end, and leave at least two samples")
+)
+
+// TrimActivity keeps the part of the activity from start to end, in seconds
+// since it started, as if the recording had been started and stopped then.
+// Totals are recomputed from the streams that are kept; splits and best efforts
+// are dropped, and only the segment efforts inside the kept part stay
+func TrimActivity(a strava.ActivityDetailed, set strava.StreamSet, start int, end int) (strava.ActivityDetailed, strava.StreamSet, error) {
+	n := set.Len()
+	if n == 0 {
+		return a, set, ErrTrimStreams
+	}
+	from, to := n, 0
+	for i, t := range set.Time.Data {
+		if t >= start && t <= end {
+			if i < from {
+				from = i
+			}
+			to = i + 1
+		}
+	}
+	if start < 0 || to-from < 2 {
+		return a, set, ErrTrimRange
+	}
+	offset := set.Time.Data[from]
+	trimmedSet := streams.Slice(set, from, to)
+
+	trimmed := a
+	RecomputeTotals(&trimmed.ActivitySummary, trimmedSet)
+	trimmed.SplitsMetric, trimmed.SplitsStandard, trimmed.BestEfforts = nil, nil, nil
+	trimmed.Map.SummaryPolyline = ""
+
+	began, err := time.Parse(time.RFC3339, a.StartDate)
+	if err != nil {
+		return a, set, err
+	}
+	newStart := began.Add(time.Duration(offset) * time.Second)
+	newEnd := newStart.Add(time.Duration(trimmed.ElapsedTime) * time.Second)
+	trimmed.StartDate = newStart.UTC().Format(time.RFC3339)
+	if local, err := time.Parse(time.RFC3339, a.StartDateLocal); err == nil {
+		trimmed.StartDateLocal = local.Add(time.Duration(offset) * time.Second).Format(time.RFC3339)
+	}
+
+	if a.SegmentEfforts != nil {
+		trimmed.SegmentEfforts = []strava.SegmentEffortSummary{}
+	}
+	for _, effort := range a.SegmentEfforts {
+		at, err := time.Parse(time.RFC3339, effort.StartDate)
+		if err == nil && !at.Before(newStart) && !at.Add(time.Duration(effort.ElapsedTime)*time.Second).After(newEnd) {
+			trimmed.SegmentEfforts = append(trimmed.SegmentEfforts, effort)
+		}
+	}
+	return trimmed, trimmedSet, nil
+}
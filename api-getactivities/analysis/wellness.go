@@ -0,0 +1,141 @@
+package analysis
+
+import "math"
+
+// WellnessEntry is how the athlete was on a day; readings left at zero were
+// not taken
+type WellnessEntry struct {
+	Date             string  `json:"date"`                        // 2006-01-02, the athlete's day
+	Sleep            float64 `json:"sleep,omitempty"`             // hours
+	HRV              float64 `json:"hrv,omitempty"`               // rMSSD, milliseconds
+	RestingHeartrate float64 `json:"resting_heartrate,omitempty"` // beats per minute
+	Soreness         int     `json:"soreness,omitempty"`          // 1 to 10
+	RPE              int     `json:"rpe,omitempty"`               // 1 to 10, how hard the day's training felt
+	Notes            string  `json:"notes,omitempty"`
+}
+
+const (
+	WellnessSleep            = "sleep"
+	WellnessHRV              = "hrv"
+	WellnessRestingHeartrate = "resting_heartrate"
+	WellnessSoreness         = "soreness"
+	WellnessRPE              = "rpe"
+)
+
+var WellnessMetrics = []string{WellnessSleep, WellnessHRV, WellnessRestingHeartrate, WellnessSoreness, WellnessRPE}
+
+// Metric is the reading named like its json field, false when it wasn't taken
+func (e WellnessEntry) Metric(name string) (float64, bool) {
+	var value float64
+	switch name {
+	case WellnessSleep:
+		value = e.Sleep
+	case WellnessHRV:
+		value = e.HRV
+	case WellnessRestingHeartrate:
+		value = e.RestingHeartrate
+	case WellnessSoreness:
+		value = float64(e.Soreness)
+	case WellnessRPE:
+		value = float64(e.RPE)
+	}
+	return value, value != 0
+}
+
+// the load a reading is correlated against
+const (
+	LoadTSS         = "tss"          // the same day's
+	LoadPreviousTSS = "previous_tss" // the day before's, for readings taken in the morning
+	LoadFatigue     = "fatigue"
+	LoadForm        = "form"
+)
+
+// a correlation is left out with fewer days than this having both values
+const minCorrelationDays = 7
+
+type WellnessDay struct {
+	LoadDay
+	Wellness *WellnessEntry `json:"wellness,omitempty"`
+}
+
+type WellnessCorrelation struct {
+	Metric  string  `json:"metric"`
+	Against string  `json:"against"`
+	R       float64 `json:"r"` // Pearson's, -1 to 1
+	Days    int     `json:"days"`
+}
+
+// pearson is nil when either side doesn't vary
+func pearson(xs []float64, ys []float64) *float64 {
+	n := float64(len(xs))
+	var sumX, sumY float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+	var cov, varX, varY float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return nil
+	}
+	r := math.Round(cov/math.Sqrt(varX*varY)*1000) / 1000
+	return &r
+}
+
+// CompareWellness puts each entry on its day of the load curve and
+// correlates every reading with the load, over the days that have both
+func CompareWellness(load []LoadDay, entries map[string]WellnessEntry) ([]WellnessDay, []WellnessCorrelation) {
+	days := make([]WellnessDay, 0, len(load))
+	for _, day := range load {
+		wellnessDay := WellnessDay{LoadDay: day}
+		if entry, ok := entries[day.Date]; ok {
+			wellnessDay.Wellness = &entry
+		}
+		days = append(days, wellnessDay)
+	}
+
+	correlations := []WellnessCorrelation{}
+	for _, metric := range WellnessMetrics {
+		for _, against := range []string{LoadTSS, LoadPreviousTSS, LoadFatigue, LoadForm} {
+			var xs, ys []float64
+			for i, day := range days {
+				if day.Wellness == nil {
+					continue
+				}
+				value, ok := day.Wellness.Metric(metric)
+				if !ok {
+					continue
+				}
+				var load float64
+				switch against {
+				case LoadTSS:
+					load = day.TSS
+				case LoadPreviousTSS:
+					if i == 0 {
+						continue
+					}
+					load = days[i-1].TSS
+				case LoadFatigue:
+					load = day.Fatigue
+				case LoadForm:
+					load = day.Form
+				}
+				xs = append(xs, value)
+				ys = append(ys, load)
+			}
+			if len(xs) < minCorrelationDays {
+				continue
+			}
+			if r := pearson(xs, ys); r != nil {
+				correlations = append(correlations, WellnessCorrelation{Metric: metric, Against: against, R: *r, Days: len(xs)})
+			}
+		}
+	}
+	return days, correlations
+}
@@ -0,0 +1,109 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// a filter of Ride or Run also matches their newer sport types, e.g. GravelRide and TrailRun
+var (
+	rideSports = []string{strava.SportRide, strava.SportVirtualRide, strava.SportEBikeRide}
+	runSports  = []string{strava.SportRun, strava.SportVirtualRun}
+)
+
+// Highlight is one notable activity of the year
+type Highlight struct {
+	Id         int64   `json:"id"`
+	Name       string  `json:"name"`
+	SportType  string  `json:"sport_type"`
+	StartDate  string  `json:"start_date"`
+	Distance   float64 `json:"distance"`
+	MovingTime int     `json:"moving_time"`
+}
+
+// GearUse is how much a bike or pair of shoes was used, Name is left for the
+// caller since activities only carry the gear id
+type GearUse struct {
+	Id   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	Totals
+}
+
+type YearSummary struct {
+	Year int `json:"year"`
+	Totals
+	Virtual     Totals            `json:"virtual"` // see IsVirtual
+	Outdoor     Totals            `json:"outdoor"` // see IsOutdoor, trainer rides are in neither
+	Months      [12]Totals        `json:"months"`  // january first
+	Sports      map[string]Totals `json:"sports"`
+	BiggestRide *Highlight        `json:"biggest_ride"`
+	BiggestRun  *Highlight        `json:"biggest_run"`
+	Gear        []GearUse         `json:"gear"` // most used first
+}
+
+func highlight(a strava.ActivitySummary) *Highlight {
+	return &Highlight{
+		Id:         a.Id,
+		Name:       a.Name,
+		SportType:  strava.NormalizeSportType(a.SportType, a.Type),
+		StartDate:  a.StartDate,
+		Distance:   a.Distance,
+		MovingTime: a.MovingTime,
+	}
+}
+
+// SummarizeYear totals the activities that started in year, on their local
+// date like SummarizeWeek; the biggest ride and run are the longest by distance
+func SummarizeYear(year int, activities []strava.ActivitySummary) YearSummary {
+	summary := YearSummary{Year: year, Sports: make(map[string]Totals), Gear: []GearUse{}}
+	gear := make(map[string]*GearUse)
+	for _, a := range activities {
+		at, err := a.StartTime()
+		if err != nil || at.Year() != year {
+			continue
+		}
+		summary.Totals.Add(a)
+		summary.Months[at.Month()-1].Add(a)
+		if IsVirtual(a) {
+			summary.Virtual.Add(a)
+		}
+		if IsOutdoor(a) {
+			summary.Outdoor.Add(a)
+		}
+
+		sport := strava.NormalizeSportType(a.SportType, a.Type)
+		totals := summary.Sports[sport]
+		totals.Add(a)
+		summary.Sports[sport] = totals
+
+		if strava.MatchesActivityType(rideSports, sport) && (summary.BiggestRide == nil || a.Distance > summary.BiggestRide.Distance) {
+			summary.BiggestRide = highlight(a)
+		}
+		if strava.MatchesActivityType(runSports, sport) && (summary.BiggestRun == nil || a.Distance > summary.BiggestRun.Distance) {
+			summary.BiggestRun = highlight(a)
+		}
+
+		if a.GearId != "" {
+			if gear[a.GearId] == nil {
+				gear[a.GearId] = &GearUse{Id: a.GearId}
+			}
+			gear[a.GearId].Add(a)
+		}
+	}
+
+	for _, g := range gear {
+		summary.Gear = append(summary.Gear, *g)
+	}
+	sort.Slice(summary.Gear, func(i, j int) bool {
+		a, b := summary.Gear[i], summary.Gear[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Distance != b.Distance {
+			return a.Distance > b.Distance
+		}
+		return a.Id < b.Id
+	})
+	return summary
+}
@@ -0,0 +1,14 @@
+package analysis_test
+
+import (
+	"testing"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+)
+
+func BenchmarkSummarizeYear(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		analysis.SummarizeYear(2025, activities)
+	}
+}
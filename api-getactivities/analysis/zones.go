@@ -0,0 +1,59 @@
+package analysis
+
+import (
+	"math"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// upper bounds of the fallback zones as shares of the threshold, the top zone is open
+var (
+	heartrateZoneShares = []float64{0.81, 0.89, 0.93, 0.99}
+	powerZoneShares     = []float64{0.55, 0.75, 0.90, 1.05, 1.20, 1.50}
+)
+
+type ZoneTime struct {
+	Min     int `json:"min"`
+	Max     int `json:"max"` // -1 for the open top zone
+	Seconds int `json:"seconds"`
+}
+
+// ThresholdZones splits 0 to the threshold heart rate or ftp at shares of it,
+// for athletes whose strava zones are not known; nil without a threshold
+func ThresholdZones(threshold float64, power bool) []strava.ZoneRange {
+	if threshold <= 0 {
+		return nil
+	}
+	shares := heartrateZoneShares
+	if power {
+		shares = powerZoneShares
+	}
+
+	zones := make([]strava.ZoneRange, 0, len(shares)+1)
+	min := 0
+	for _, share := range shares {
+		max := int(math.Round(share * threshold))
+		zones = append(zones, strava.ZoneRange{Min: min, Max: max})
+		min = max
+	}
+	return append(zones, strava.ZoneRange{Min: min, Max: -1})
+}
+
+// TimeInZones adds up the seconds spent in each zone. A sample counts for the
+// time until the next one, and belongs to the zone with min <= value < max
+func TimeInZones(zones []strava.ZoneRange, times []int, values []int) []ZoneTime {
+	result := make([]ZoneTime, len(zones))
+	for i, z := range zones {
+		result[i] = ZoneTime{Min: z.Min, Max: z.Max}
+	}
+
+	for i := 0; i+1 < len(times) && i < len(values); i++ {
+		for j, z := range zones {
+			if values[i] >= z.Min && (z.Max < 0 || values[i] < z.Max) {
+				result[j].Seconds += times[i+1] - times[i]
+				break
+			}
+		}
+	}
+	return result
+}
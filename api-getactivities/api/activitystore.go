@@ -0,0 +1,349 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/geo"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/set"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+const activitiesPrefix = "ACTIVITIES/"
+
+const activityIndexObject = activitiesPrefix + "index.json"
+
+type ActivityIndexEntry struct {
+	Id        int64  `json:"id"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	SportType string `json:"sport_type,omitempty"`
+	Platform  string `json:"platform,omitempty"`
+	// empty for entries stored before visibility was tracked, see visibilityFilter
+	Visibility   string `json:"visibility,omitempty"`
+	HideFromHome bool   `json:"hide_from_home,omitempty"`
+	StartDate    string `json:"start_date"`
+	Detailed     bool   `json:"detailed"`
+	StoredAt     string `json:"stored_at"`
+	// the countries and regions the route passes through, see GEO_BOUNDARIES
+	Places []geo.Place `json:"places,omitempty"`
+
+	// the decoded summary polyline for the spatial indexes, only set by saveActivity
+	route []geo.Point
+}
+
+type ActivityIndex struct {
+	UpdatedAt string               `json:"updated_at"`
+	Entries   []ActivityIndexEntry `json:"entries"`
+}
+
+// DecodeStream reads the index an entry at a time, so an index too large for
+// the object cache is never held whole as it is read from storage
+func (index *ActivityIndex) DecodeStream(dec *json.Decoder) error {
+	if t, err := dec.Token(); err != nil || t == nil {
+		// a stored null leaves the index empty, as json.Unmarshal does
+		return err
+	} else if t != json.Delim('{') {
+		return fmt.Errorf("activity index: unexpected %v", t)
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "updated_at":
+			err = dec.Decode(&index.UpdatedAt)
+		case "entries":
+			err = index.decodeEntries(dec)
+		default:
+			var skipped json.RawMessage
+			err = dec.Decode(&skipped)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
+
+func (index *ActivityIndex) decodeEntries(dec *json.Decoder) error {
+	t, err := dec.Token()
+	if err != nil || t == nil {
+		return err
+	} else if t != json.Delim('[') {
+		return fmt.Errorf("activity index entries: unexpected %v", t)
+	}
+	for dec.More() {
+		var e ActivityIndexEntry
+		if err := dec.Decode(&e); err != nil {
+			return err
+		}
+		index.Entries = append(index.Entries, e)
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// the index is read-modify-written so updates from concurrent handlers are serialized
+var activityIndexMu sync.Mutex
+
+// the key entries are deduplicated and merged by
+func indexEntryId(e ActivityIndexEntry) int64 {
+	return e.Id
+}
+
+func activityObject(id int64) string {
+	return fmt.Sprintf("%s%d.json", activitiesPrefix, id)
+}
+
+func loadActivityIndex(ctx context.Context) ActivityIndex {
+	var index ActivityIndex
+	if !decodeDataFromGCS(ctx, activityIndexObject, &index) {
+		return ActivityIndex{}
+	}
+	return index
+}
+
+func parseActivityIndex(slurp []byte) ActivityIndex {
+	var index ActivityIndex
+
+	if slurp == nil {
+		return index
+	}
+	if err := json.Unmarshal(slurp, &index); err != nil {
+		fmt.Println(err)
+	}
+	return index
+}
+
+// applies change to the stored index; a sync in another process that stored
+// the index in between gets change applied on top of its entries
+func updateActivityIndex(ctx context.Context, change func(index *ActivityIndex)) error {
+	return updateObject(ctx, activityIndexObject, func(slurp []byte) ([]byte, error) {
+		index := parseActivityIndex(slurp)
+		change(&index)
+		index.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+		return json.Marshal(index)
+	})
+}
+
+func upsertActivityIndex(ctx context.Context, entries []ActivityIndexEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	activityIndexMu.Lock()
+	defer activityIndexMu.Unlock()
+
+	err := updateActivityIndex(ctx, func(index *ActivityIndex) {
+		positions := set.Positions(index.Entries, indexEntryId)
+		for _, e := range entries {
+			if i, ok := positions[e.Id]; ok {
+				index.Entries[i] = e
+			} else {
+				positions[e.Id] = len(index.Entries)
+				index.Entries = append(index.Entries, e)
+			}
+		}
+
+		// newest first, the same order strava lists activities in
+		sort.Slice(index.Entries, func(i, j int) bool {
+			return cursorLess(index.Entries[i].StartDate, index.Entries[i].Id, index.Entries[j].StartDate, index.Entries[j].Id)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if err := updateNearIndex(ctx, entries, nil); err != nil {
+		return err
+	}
+	return updateBoundsIndex(ctx, entries, nil)
+}
+
+func removeActivityIndexEntries(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	activityIndexMu.Lock()
+	defer activityIndexMu.Unlock()
+
+	removed := set.Of(ids...)
+	err := updateActivityIndex(ctx, func(index *ActivityIndex) {
+		kept := []ActivityIndexEntry{}
+		for _, e := range index.Entries {
+			if !removed.Has(e.Id) {
+				kept = append(kept, e)
+			}
+		}
+		index.Entries = kept
+	})
+	if err != nil {
+		return err
+	}
+	if err := updateNearIndex(ctx, nil, ids); err != nil {
+		return err
+	}
+	return updateBoundsIndex(ctx, nil, ids)
+}
+
+func loadActivity(ctx context.Context, id int64) (strava.ActivityDetailed, bool) {
+	var activity strava.ActivityDetailed
+
+	if !decodeDataFromGCS(ctx, activityObject(id), &activity) {
+		return strava.ActivityDetailed{}, false
+	}
+	return activity, true
+}
+
+// writes the single activity object, callers batch the matching index entries into upsertActivityIndex
+func saveActivity(ctx context.Context, activity strava.ActivityDetailed, detailed bool) (ActivityIndexEntry, error) {
+	var entry ActivityIndexEntry
+	entry.Id = activity.Id
+	entry.Name = activity.Name
+	entry.SportType = strava.NormalizeSportType(activity.SportType, activity.Type)
+	entry.Type = strava.LegacyActivityType(entry.SportType)
+	entry.Platform = analysis.VirtualPlatform(activity.ExternalId, activity.DeviceName)
+	entry.Visibility = activityVisibility(activity.ActivitySummary)
+	entry.HideFromHome = activity.HideFromHome
+	entry.StartDate = activity.StartDate
+	entry.Detailed = detailed
+	entry.StoredAt = time.Now().UTC().Format(time.RFC3339)
+	entry.route = activityRoute(activity)
+	entry.Places = activityPlaces(entry.route)
+
+	bytes_activity, err := json.Marshal(activity)
+	if err != nil {
+		return entry, err
+	}
+	return entry, putDataAtomically(ctx, activityObject(activity.Id), bytes_activity)
+}
+
+func getActivityIndex(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	limit, cur, err := pageParams(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filters, err := activityTypeFilters(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	platforms, err := platformFilters(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	visibility, err := visibilityFilters(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	index := loadActivityIndex(ctx)
+
+	// entries stored before sport_type was tracked fall back to their legacy type
+	matched := []ActivityIndexEntry{}
+	for _, e := range index.Entries {
+		if strava.MatchesActivityType(filters, strava.NormalizeSportType(e.SportType, e.Type)) && matchesFilter(platforms, e.Platform) && visibility.matches(e.Visibility, e.HideFromHome) {
+			matched = append(matched, e)
+		}
+	}
+
+	entries, next, prev := paginate(matched, func(e ActivityIndexEntry) (string, int64) {
+		return e.StartDate, e.Id
+	}, cur, limit)
+	if entries == nil {
+		entries = []ActivityIndexEntry{}
+	}
+	nextCursor, prevCursor := setPageLinks(c, next, prev)
+
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"updated_at":  index.UpdatedAt,
+		"entries":     entries,
+		"next_cursor": nextCursor,
+		"prev_cursor": prevCursor,
+	})
+}
+
+// stored activities are served as they are, others are hydrated and stored on the way
+func loadOrFetchActivity(ctx context.Context, id int64) (strava.ActivityDetailed, error) {
+	if activity, ok := loadActivity(ctx, id); ok {
+		return activity, nil
+	}
+	return fetchAndStoreActivity(ctx, id)
+}
+
+// the detailed activity from strava, stored whether or not it was before
+func fetchAndStoreActivity(ctx context.Context, id int64) (strava.ActivityDetailed, error) {
+	client := strava.DefaultClient
+
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		return strava.ActivityDetailed{}, err
+	}
+
+	activity, err := fetchActivityDetail(client, access_token, id)
+	if err != nil {
+		return activity, err
+	}
+
+	entry, err := saveActivity(ctx, activity, true)
+	if err == nil {
+		err = upsertActivityIndex(ctx, []ActivityIndexEntry{entry})
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	return activity, nil
+}
+
+// ?expand= picks the detail sections served, and a stored activity missing one
+// of them is fetched from strava again; without it the stored activity is served
+func getActivityDetail(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "activity id must be numeric"})
+		return
+	}
+	expand, err := expandParam(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	activity, err := loadOrFetchActivity(ctx, id)
+	if err == nil && expand != nil && missingSections(activity, expand) {
+		activity, err = fetchAndStoreActivity(ctx, id)
+	}
+	if err != nil {
+		respondUpstreamError(c, "unable to fetch activity from strava", err)
+		return
+	}
+
+	activity = expandActivity(activity, expand)
+	detail := annotateActivity(ctx, redactActivity(c, activity))
+	if isAdminRequest(c) {
+		detail.Journal = activityNote(ctx, id)
+	}
+	c.IndentedJSON(http.StatusOK, detail)
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestActivityIndexDecodeStream(t *testing.T) {
+	cases := []struct {
+		name  string
+		in    string
+		fails bool
+	}{
+		{"empty", `{}`, false},
+		{"null", `null`, false},
+		{"null entries", `{"updated_at": "2026-01-01T00:00:00Z", "entries": null}`, false},
+		{"entries", `{"entries": [{"id": 2, "name": "Lunch Run", "places": [{"country": "US"}]}, {"id": 1, "detailed": true}], "updated_at": "2026-01-01T00:00:00Z"}`, false},
+		{"unknown keys skipped", `{"version": {"n": [1, 2]}, "entries": [{"id": 1}]}`, false},
+		{"not an object", `[]`, true},
+		{"entries not an array", `{"entries": {"id": 1}}`, true},
+		{"cut short", `{"entries": [{"id": 1}`, true},
+	}
+	for _, tc := range cases {
+		var streamed ActivityIndex
+		err := streamed.DecodeStream(json.NewDecoder(strings.NewReader(tc.in)))
+		if tc.fails != (err != nil) {
+			t.Errorf("%s: DecodeStream(%s) err %v, want failure %v", tc.name, tc.in, err, tc.fails)
+			continue
+		}
+		if tc.fails {
+			continue
+		}
+		var unmarshaled ActivityIndex
+		if err := json.Unmarshal([]byte(tc.in), &unmarshaled); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(streamed, unmarshaled) {
+			t.Errorf("%s: DecodeStream(%s) = %+v, json.Unmarshal gives %+v", tc.name, tc.in, streamed, unmarshaled)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// admin endpoints are disabled unless ADMIN_TOKEN is set
+func requireAdmin(c *gin.Context) {
+	expected := os.Getenv("ADMIN_TOKEN")
+	if expected == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin api is disabled"})
+		return
+	}
+
+	provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+		return
+	}
+
+	c.Next()
+}
+
+// whether the request carries the admin token, for endpoints that show
+// admins more than the public
+func isAdminRequest(c *gin.Context) bool {
+	expected := os.Getenv("ADMIN_TOKEN")
+	provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return expected != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) == 1
+}
+
+type CredentialsUpdate struct {
+	Client_id     int    `json:"client_id"`
+	Client_secret string `json:"client_secret"`
+	Refresh_token string `json:"refresh_token"`
+}
+
+type CredentialsTestResult struct {
+	Valid     bool   `json:"valid"`
+	Error     string `json:"error,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+	AthleteId int64  `json:"athlete_id,omitempty"`
+}
+
+// refreshes creds to see whether strava accepts them; strava may rotate the
+// refresh token doing so, after which only the returned creds work
+func testCredentials(creds strava.Credentials) (CredentialsTestResult, strava.Credentials, bool) {
+	var result CredentialsTestResult
+
+	refreshed, err := strava.RefreshCredentials(strava.DefaultClient, creds)
+	if err != nil {
+		result.Error = err.Error()
+		return result, creds, false
+	}
+	result.Valid = true
+	result.ExpiresAt = refreshed.Expires_at
+	result.AthleteId = refreshed.Athlete.Id
+
+	rotated := refreshed.Refresh_token != "" && refreshed.Refresh_token != creds.Refresh_token
+	if rotated {
+		creds.Refresh_token = refreshed.Refresh_token
+	}
+	return result, creds, rotated
+}
+
+// merges the supplied fields over the stored credentials, the rotation is
+// rejected unless strava accepts the result
+func postAdminCredentials(c *gin.Context) {
+	ctx := c.Request.Context()
+	var update CredentialsUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "body must be a JSON credentials object"})
+		return
+	}
+
+	creds, err := loadCredentials(ctx, ownerCredentialsObject)
+	if err != nil {
+		fmt.Println(err)
+	}
+	if update.Client_id != 0 {
+		creds.Client_id = update.Client_id
+	}
+	if update.Client_secret != "" {
+		creds.Client_secret = update.Client_secret
+	}
+	if update.Refresh_token != "" {
+		creds.Refresh_token = update.Refresh_token
+	}
+
+	// record which fields were rotated, never their values
+	details := map[string]interface{}{
+		"client_id":     update.Client_id != 0,
+		"client_secret": update.Client_secret != "",
+		"refresh_token": update.Refresh_token != "",
+	}
+
+	result, creds, rotated := testCredentials(creds)
+	details["refresh_token_rotated"] = rotated
+	if !result.Valid {
+		recordAudit(AuditAdminCredentialsRotate, adminActor(c), ownerCredentialsObject, errors.New(result.Error), details)
+		c.IndentedJSON(http.StatusUnprocessableEntity, result)
+		return
+	}
+
+	err = saveCredentials(ownerCredentialsObject, creds)
+	recordAudit(AuditAdminCredentialsRotate, adminActor(c), ownerCredentialsObject, err, details)
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to store credentials"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, result)
+}
+
+func postAdminCredentialsTest(c *gin.Context) {
+	ctx := c.Request.Context()
+	creds, err := loadCredentials(ctx, ownerCredentialsObject)
+	if err != nil {
+		fmt.Println(err)
+		recordAudit(AuditAdminCredentialsTest, adminActor(c), ownerCredentialsObject, err, nil)
+		c.IndentedJSON(http.StatusOK, CredentialsTestResult{Error: "stored credentials could not be read"})
+		return
+	}
+
+	result, refreshed, rotated := testCredentials(creds)
+	var testErr error
+	if !result.Valid {
+		testErr = errors.New(result.Error)
+	}
+	// the stored refresh token stops working once strava rotates it
+	if rotated {
+		if err := saveCredentials(ownerCredentialsObject, refreshed); err != nil {
+			fmt.Println("storing the new refresh token:", err)
+			testErr = err
+		}
+	}
+	recordAudit(AuditAdminCredentialsTest, adminActor(c), ownerCredentialsObject, testErr, map[string]interface{}{"refresh_token_rotated": rotated})
+
+	c.IndentedJSON(http.StatusOK, result)
+}
+
+func getAdminDecodeReport(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, gin.H{"enabled": strava.StrictDecode, "unknown_fields": strava.Report.Snapshot()})
+}
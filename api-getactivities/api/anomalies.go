@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+const AnomalyTrainer = "trainer"
+
+// Anomaly is a stored activity whose details look wrong
+type Anomaly struct {
+	Id        int64  `json:"id"`
+	Name      string `json:"name"`
+	SportType string `json:"sport_type"`
+	StartDate string `json:"start_date"`
+	Kind      string `json:"kind"`
+	Reason    string `json:"reason"`
+}
+
+type AnomalyFixResult struct {
+	Fixed  []int64           `json:"fixed"`
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// stored activities only, with their stored streams when there are any, so
+// checking costs no strava calls
+func findAnomalies(ctx context.Context) []Anomaly {
+	anomalies := []Anomaly{}
+	for _, e := range loadActivityIndex(ctx).Entries {
+		activity, ok := loadActivity(ctx, e.Id)
+		if !ok {
+			continue
+		}
+		reason := analysis.TrainerRideReason(activity.ActivitySummary, storedStreams(ctx, e.Id))
+		if reason == "" {
+			continue
+		}
+		anomalies = append(anomalies, Anomaly{
+			Id:        activity.Id,
+			Name:      activity.Name,
+			SportType: strava.NormalizeSportType(activity.SportType, activity.Type),
+			StartDate: activity.StartDate,
+			Kind:      AnomalyTrainer,
+			Reason:    reason,
+		})
+	}
+	return anomalies
+}
+
+func getAnomalies(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	c.IndentedJSON(http.StatusOK, gin.H{"data": findAnomalies(ctx)})
+}
+
+// marks the flagged rides, or only ?id=, as trainer rides on strava and stores them as updated
+func postAnomaliesFix(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	var only int64
+	if id := c.Query("id"); id != "" {
+		parsed, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "id must be numeric"})
+			return
+		}
+		only = parsed
+	}
+
+	client := stravaClient(c)
+
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		respondUpstreamError(c, "unable to refresh strava token", err)
+		return
+	}
+
+	result := AnomalyFixResult{Fixed: []int64{}}
+	var entries []ActivityIndexEntry
+	var changes []ActivityChange
+	trainer := true
+	for _, anomaly := range findAnomalies(ctx) {
+		if anomaly.Kind != AnomalyTrainer || (only != 0 && anomaly.Id != only) {
+			continue
+		}
+
+		updated, err := strava.UpdateActivity(client, access_token, anomaly.Id, strava.UpdatableActivity{Trainer: &trainer})
+		recordAudit(AuditActivityUpdate, adminActor(c), strconv.FormatInt(anomaly.Id, 10), err, map[string]interface{}{"trainer": true, "reason": anomaly.Reason})
+		if err != nil {
+			var stravaErr *strava.Error
+			if errors.As(err, &stravaErr) && stravaErr.Kind() == strava.KindScope {
+				// every other update would fail the same way
+				respondUpstreamError(c, "unable to update activity on strava", err)
+				return
+			}
+			fmt.Println(anomaly.Id, err)
+			if result.Failed == nil {
+				result.Failed = make(map[string]string)
+			}
+			result.Failed[strconv.FormatInt(anomaly.Id, 10)] = err.Error()
+			continue
+		}
+
+		entry, err := saveActivity(ctx, updated, true)
+		if err != nil {
+			fmt.Println(err)
+		}
+		entries = append(entries, entry)
+		changes = append(changes, ActivityChange{Kind: ChangeUpdated, ActivityId: anomaly.Id, OldName: anomaly.Name, NewName: updated.Name})
+		result.Fixed = append(result.Fixed, anomaly.Id)
+	}
+	if err := upsertActivityIndex(ctx, entries); err != nil {
+		fmt.Println(err)
+	}
+	if err := appendChangelog(ctx, "anomalies", changes); err != nil {
+		fmt.Println(err)
+	}
+
+	c.IndentedJSON(http.StatusOK, result)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+const athleteRegistryObject = "athletes/registry.json"
+
+const (
+	PrivacyPublic    = "public"
+	PrivacyAnonymous = "anonymous"
+	PrivacyHidden    = "hidden"
+)
+
+var athleteRegistryMu sync.Mutex
+
+// athletes besides the owner who have connected their strava account
+type RegisteredAthlete struct {
+	Id                 int64  `json:"id"`
+	Firstname          string `json:"firstname"`
+	Lastname           string `json:"lastname"`
+	LeaderboardPrivacy string `json:"leaderboard_privacy"` // public, anonymous or hidden (the default)
+}
+
+func (a RegisteredAthlete) objectPrefix() string {
+	return fmt.Sprintf("athletes/%d/", a.Id)
+}
+
+func (a RegisteredAthlete) credentialsObject() string {
+	return a.objectPrefix() + "credentials.json"
+}
+
+func loadRegisteredAthletes(ctx context.Context) []RegisteredAthlete {
+	var athletes []RegisteredAthlete
+
+	slurp := getDataFromGCS(ctx, athleteRegistryObject)
+	if slurp == nil {
+		return athletes
+	}
+	if err := json.Unmarshal(slurp, &athletes); err != nil {
+		fmt.Println(err)
+	}
+	return athletes
+}
+
+// adds the athlete or refreshes their name, keeping an existing privacy choice
+func upsertRegisteredAthlete(ctx context.Context, athlete RegisteredAthlete) error {
+	athleteRegistryMu.Lock()
+	defer athleteRegistryMu.Unlock()
+
+	athletes := loadRegisteredAthletes(ctx)
+	found := false
+	for i, a := range athletes {
+		if a.Id == athlete.Id {
+			athletes[i].Firstname = athlete.Firstname
+			athletes[i].Lastname = athlete.Lastname
+			found = true
+		}
+	}
+	if !found {
+		athletes = append(athletes, athlete)
+	}
+
+	bytes_athletes, err := json.Marshal(athletes)
+	if err != nil {
+		return err
+	}
+	return putDataToGCS(ctx, athleteRegistryObject, bytes_athletes)
+}
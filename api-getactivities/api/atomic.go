@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+)
+
+// what writes left staged here before they were made in place is deleted by removeStaleTmpObjects
+const tmpPrefix = "tmp/"
+
+// staged objects older than this were left by a write that crashed
+const tmpMaxAge = time.Hour
+
+// how many times updateObject reads and applies its update before giving up
+const maxUpdateAttempts = 5
+
+// putDataAtomically never leaves object half written: the write is verified,
+// and the previous contents are written back when it does not verify
+func putDataAtomically(ctx context.Context, object string, data []byte) error {
+	previous, _, err := readGCSObjectGeneration(ctx, object)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		previous, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	return putDataVerifiedIf(ctx, object, data, previous, storage.AnyGeneration)
+}
+
+// writes data over previous, what object held at generation, which fails
+// with storage.ErrConflict when another writer changed it since. An upload
+// that arrives other than it was sent is refused by GCS, so the write never
+// shows half an object. The rollback of a write that does not verify is
+// conditional on the generation written, so it never puts older contents
+// over a newer write from another process
+func putDataVerifiedIf(ctx context.Context, object string, data []byte, previous []byte, generation int64) error {
+	written, err := putDataToGCSIf(ctx, object, data, generation)
+	if err != nil {
+		return err
+	}
+	err = verifyGCSObject(ctx, object)
+	if err == nil {
+		return nil
+	}
+
+	var rollback error
+	if previous != nil {
+		_, rollback = putDataToGCSIf(ctx, object, previous, written)
+	} else {
+		rollback = deleteDataFromGCSIf(ctx, object, written)
+	}
+	if rollback != nil {
+		return fmt.Errorf("%s: %v, rolling back: %v", object, err, rollback)
+	}
+	return fmt.Errorf("%s: %w, rolled back", object, err)
+}
+
+// updateObject applies update to the contents of object, nil when there is
+// none, and writes the result atomically unless another writer changed object
+// in between. update is then applied again to the other writer's contents, so
+// both changes are kept; after maxUpdateAttempts the storage.ErrConflict is
+// returned, and the caller can retry later
+func updateObject(ctx context.Context, object string, update func(slurp []byte) ([]byte, error)) error {
+	var err error
+	for attempt := 1; attempt <= maxUpdateAttempts; attempt++ {
+		slurp, generation, readErr := readGCSObjectGeneration(ctx, object)
+		if errors.Is(readErr, storage.ErrObjectNotExist) {
+			slurp, generation, readErr = nil, 0, nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+		data, updateErr := update(slurp)
+		if updateErr != nil {
+			return updateErr
+		}
+		if err = putDataVerifiedIf(ctx, object, data, slurp, generation); !errors.Is(err, storage.ErrConflict) {
+			return err
+		}
+		fmt.Println(object, "changed by another writer, merging:", err)
+		time.Sleep(time.Duration(attempt*attempt) * 50 * time.Millisecond)
+	}
+	return err
+}
+
+// deletes what writes that crashed left staged, returning how many
+func removeStaleTmpObjects(ctx context.Context, now time.Time) (int, error) {
+	names, err := listGCSObjects(ctx, tmpPrefix)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, object := range names {
+		name := strings.TrimSuffix(object, ".previous")
+		nanos, err := strconv.ParseInt(name[strings.LastIndex(name, ".")+1:], 10, 64)
+		if err != nil || now.Sub(time.Unix(0, nanos)) < tmpMaxAge {
+			continue
+		}
+		if err := deleteDataFromGCS(ctx, object); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+)
+
+// memory storage where every written object fails verification, after
+// newer contents from another process land when concurrent is set
+type unverifiedStore struct {
+	storage.ObjectStore
+	concurrent []byte
+}
+
+func (s *unverifiedStore) WithContext(ctx context.Context) storage.ObjectStore {
+	return s
+}
+
+func (s *unverifiedStore) Verify(object string) error {
+	if s.concurrent != nil {
+		if err := s.ObjectStore.Write(object, s.concurrent); err != nil {
+			return err
+		}
+	}
+	return storage.ErrChecksumMismatch
+}
+
+func TestPutDataAtomically(t *testing.T) {
+	defer func(store storage.ObjectStore) { objects = store }(objects)
+
+	cases := []struct {
+		name       string
+		previous   []byte
+		concurrent []byte
+		want       []byte // nil when the object should be gone
+	}{
+		{"rolled back", []byte(`{"v": 1}`), nil, []byte(`{"v": 1}`)},
+		{"new object removed", nil, nil, nil},
+		{"newer write kept", []byte(`{"v": 1}`), []byte(`{"v": 3}`), []byte(`{"v": 3}`)},
+		{"newer new object kept", nil, []byte(`{"v": 3}`), []byte(`{"v": 3}`)},
+	}
+	for _, tc := range cases {
+		store := &unverifiedStore{ObjectStore: storage.NewMemory()}
+		objects = store
+		if tc.previous != nil {
+			if err := store.Write("a.json", tc.previous); err != nil {
+				t.Fatal(err)
+			}
+		}
+		store.concurrent = tc.concurrent
+
+		if err := putDataAtomically(context.Background(), "a.json", []byte(`{"v": 2}`)); err == nil {
+			t.Errorf("%s: a write that does not verify succeeded", tc.name)
+		}
+		got, err := store.Read("a.json")
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			got, err = nil, nil
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(tc.want) {
+			t.Errorf("%s: stored %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestUpdateObjectMerges(t *testing.T) {
+	defer func(store storage.ObjectStore) { objects = store }(objects)
+	objects = storage.NewMemory()
+
+	if err := objects.Write("n.json", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	raced := false
+	err := updateObject(context.Background(), "n.json", func(slurp []byte) ([]byte, error) {
+		if !raced {
+			// another process writes between this read and the write
+			raced = true
+			if err := objects.Write("n.json", []byte("12")); err != nil {
+				return nil, err
+			}
+		}
+		return append(append([]byte{}, slurp...), '3'), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := objects.Read("n.json"); string(got) != "123" {
+		t.Errorf("stored %s, want 123", got)
+	}
+}
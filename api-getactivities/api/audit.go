@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+)
+
+const auditPrefix = "audit/"
+
+const (
+	AuditAdminCredentialsRotate = "admin.credentials.rotate"
+	AuditAdminCredentialsTest   = "admin.credentials.test"
+	AuditTokenRefresh           = "token.refresh"
+	AuditAuthorize              = "auth.authorize"
+	AuditAthleteDeauthorize     = "athlete.deauthorize"
+	AuditSnapshotExport         = "snapshot.export"
+	AuditSnapshotImport         = "snapshot.import"
+	AuditActivitiesSync         = "activities.sync"
+	AuditActivitiesHydrate      = "activities.hydrate"
+	AuditActivityUpdate         = "activity.update"
+	AuditActivitiesReconcile    = "activities.reconcile"
+	AuditCachePurge             = "cache.purge"
+	AuditReportSend             = "report.send"
+	AuditActivityTags           = "activity.tags"
+	AuditPlanCreate             = "plan.create"
+	AuditPlanUpdate             = "plan.update"
+	AuditPlanDelete             = "plan.delete"
+	AuditWebhookRotate          = "webhook.rotate"
+	AuditWebhookReplay          = "webhook.replay"
+	AuditActivityMerge          = "activity.merge"
+	AuditActivityTrim           = "activity.trim"
+	AuditActivityUpload         = "activity.upload"
+	AuditActivityNote           = "activity.note"
+	AuditWellnessUpdate         = "wellness.update"
+	AuditWellnessDelete         = "wellness.delete"
+	AuditPeriodCreate           = "period.create"
+	AuditPeriodUpdate           = "period.update"
+	AuditPeriodDelete           = "period.delete"
+	AuditMaintenanceCreate      = "maintenance.create"
+	AuditMaintenanceUpdate      = "maintenance.update"
+	AuditMaintenanceDelete      = "maintenance.delete"
+	AuditSegmentStar            = "segment.star"
+	AuditSegmentsSync           = "segments.sync"
+	AuditStoragePrune           = "storage.prune"
+	AuditStorageVerify          = "storage.verify"
+)
+
+type AuditEvent struct {
+	Timestamp string                 `json:"timestamp"`
+	Action    string                 `json:"action"`
+	Actor     string                 `json:"actor"`
+	Target    string                 `json:"target,omitempty"`
+	Success   bool                   `json:"success"`
+	Error     string                 `json:"error,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// every event is written to its own object and never rewritten, grouped by
+// day so a day's events can be listed without reading the whole log
+func auditObject(at time.Time, action string) string {
+	return fmt.Sprintf("%s%s/%d-%s.json", auditPrefix, at.Format("2006-01-02"), at.UnixNano(), action)
+}
+
+// not canceled with the request it records, which is audited however it ended
+func recordAudit(action string, actor string, target string, err error, details map[string]interface{}) {
+	now := time.Now().UTC()
+
+	var event AuditEvent
+	event.Timestamp = now.Format(time.RFC3339Nano)
+	event.Action = action
+	event.Actor = actor
+	event.Target = target
+	event.Success = err == nil
+	if err != nil {
+		event.Error = err.Error()
+	}
+	event.Details = details
+
+	bytes_event, err := json.Marshal(event)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := putDataToGCS(context.Background(), auditObject(now, action), bytes_event); err != nil {
+		fmt.Println("audit write failed:", err)
+	}
+}
+
+// a token is refreshed for nearly every request, so routine refreshes of a
+// credentials object are written at most once an interval, counting the
+// refreshes since the last record; failures and rotated refresh tokens are
+// written every time. The counts are per instance
+var tokenRefreshAuditInterval = time.Duration(env.Int("AUDIT_TOKEN_REFRESH_SECONDS", 60)) * time.Second
+
+var tokenRefreshAudits = struct {
+	mu      sync.Mutex
+	written map[string]time.Time
+	pending map[string]int
+}{written: make(map[string]time.Time), pending: make(map[string]int)}
+
+func auditTokenRefresh(credsObject string, err error, rotated bool) {
+	now := time.Now()
+	tokenRefreshAudits.mu.Lock()
+	tokenRefreshAudits.pending[credsObject]++
+	refreshes := tokenRefreshAudits.pending[credsObject]
+	if err == nil && !rotated && now.Sub(tokenRefreshAudits.written[credsObject]) < tokenRefreshAuditInterval {
+		tokenRefreshAudits.mu.Unlock()
+		return
+	}
+	tokenRefreshAudits.pending[credsObject] = 0
+	tokenRefreshAudits.written[credsObject] = now
+	tokenRefreshAudits.mu.Unlock()
+
+	details := map[string]interface{}{"refreshes": refreshes}
+	if rotated {
+		details["refresh_token_rotated"] = true
+	}
+	recordAudit(AuditTokenRefresh, "service", credsObject, err, details)
+}
+
+func adminActor(c *gin.Context) string {
+	return "admin@" + c.ClientIP()
+}
+
+func getAdminAudit(c *gin.Context) {
+	ctx := c.Request.Context()
+	day := c.DefaultQuery("date", time.Now().UTC().Format("2006-01-02"))
+	if _, err := time.Parse("2006-01-02", day); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "date must be formatted YYYY-MM-DD"})
+		return
+	}
+	action := c.Query("action")
+
+	limit, cur, err := pageParams(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	objects, err := listGCSObjects(ctx, auditPrefix+day+"/")
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to list audit log"})
+		return
+	}
+
+	// object names start with the event time, so newest first is reverse name order
+	sort.Sort(sort.Reverse(sort.StringSlice(objects)))
+	var matching []string
+	for _, object := range objects {
+		if action == "" || strings.HasSuffix(object, "-"+action+".json") {
+			matching = append(matching, object)
+		}
+	}
+	page, next, prev := paginate(matching, func(object string) (string, int64) {
+		return object, 0
+	}, cur, limit)
+	nextCursor, prevCursor := setPageLinks(c, next, prev)
+
+	events := []AuditEvent{}
+	for _, object := range page {
+		var event AuditEvent
+		if err := json.Unmarshal(getDataFromGCS(ctx, object), &event); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		events = append(events, event)
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"date": day, "data": events, "next_cursor": nextCursor, "prev_cursor": prevCursor})
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+)
+
+func TestAuditTokenRefresh(t *testing.T) {
+	defer func(store storage.ObjectStore) { objects = store }(objects)
+	objects = storage.NewMemory()
+	defer func(interval time.Duration) { tokenRefreshAuditInterval = interval }(tokenRefreshAuditInterval)
+	tokenRefreshAuditInterval = time.Hour
+
+	refused := errors.New("refresh refused")
+	refreshes := []struct {
+		err     error
+		rotated bool
+	}{
+		{nil, false}, // the first is written
+		{nil, false},
+		{nil, false},
+		{nil, true}, // written with the two before it
+		{nil, false},
+		{refused, false}, // written with the one before it
+		{nil, false},     // left for the next record
+	}
+	for _, r := range refreshes {
+		auditTokenRefresh("credentials.json", r.err, r.rotated)
+	}
+	// counted apart from other credentials
+	auditTokenRefresh("athletes/1/credentials.json", nil, false)
+
+	names, err := listGCSObjects(context.Background(), auditPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	var events []AuditEvent
+	for _, name := range names {
+		var event AuditEvent
+		if err := json.Unmarshal(getDataFromGCS(context.Background(), name), &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Action != AuditTokenRefresh {
+			t.Errorf("%s audited", event.Action)
+		}
+		events = append(events, event)
+	}
+
+	want := []struct {
+		target    string
+		refreshes float64
+		rotated   bool
+		success   bool
+	}{
+		{"credentials.json", 1, false, true},
+		{"credentials.json", 3, true, true},
+		{"credentials.json", 2, false, false},
+		{"athletes/1/credentials.json", 1, false, true},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("%d records, want %d: %+v", len(events), len(want), events)
+	}
+	for i, w := range want {
+		e := events[i]
+		rotated, _ := e.Details["refresh_token_rotated"].(bool)
+		if e.Target != w.target || e.Details["refreshes"] != w.refreshes || rotated != w.rotated || e.Success != w.success {
+			t.Errorf("record %d: %+v, want %+v", i, e, w)
+		}
+	}
+}
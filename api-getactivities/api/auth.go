@@ -0,0 +1,124 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+const defaultAuthScope = "read,activity:read_all,profile:read_all"
+
+const oauthStateCookie = "strava_oauth_state"
+
+// OAUTH_REDIRECT_URL must match the callback domain configured on the strava app
+func oauthRedirectURL(c *gin.Context) string {
+	if redirect := os.Getenv("OAUTH_REDIRECT_URL"); redirect != "" {
+		return redirect
+	}
+	scheme := "https"
+	if c.Request.TLS == nil && c.GetHeader("X-Forwarded-Proto") != "https" {
+		scheme = "http"
+	}
+	return scheme + "://" + c.Request.Host + pathPrefix + "/auth/callback"
+}
+
+// sends the athlete to strava to grant the requested scopes
+func getAuthLogin(c *gin.Context) {
+	ctx := c.Request.Context()
+	creds, err := loadCredentials(ctx, ownerCredentialsObject)
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"error": "strava app credentials are not configured"})
+		return
+	}
+
+	scope := c.DefaultQuery("scope", defaultAuthScope)
+	granted := strava.ParseScopes(scope)
+	if !granted[strava.ScopeRead] && !granted[strava.ScopeReadAll] {
+		scope = strava.ScopeRead + "," + scope
+	}
+
+	state := make([]byte, 16)
+	if _, err := rand.Read(state); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to start authorization"})
+		return
+	}
+	c.SetCookie(oauthStateCookie, hex.EncodeToString(state), 600, pathPrefix+"/auth", "", c.Request.TLS != nil, true)
+
+	parm := url.Values{}
+	parm.Add("client_id", strconv.Itoa(creds.Client_id))
+	parm.Add("redirect_uri", oauthRedirectURL(c))
+	parm.Add("response_type", "code")
+	parm.Add("approval_prompt", "auto")
+	parm.Add("scope", scope)
+	parm.Add("state", hex.EncodeToString(state))
+
+	c.Redirect(http.StatusFound, strava.OAuthBase+"/authorize?"+parm.Encode())
+}
+
+// stores the granted token and scopes, for the owner when the owner authorized
+// and otherwise as a registered athlete who is hidden from leaderboards until they opt in
+func getAuthCallback(c *gin.Context) {
+	ctx := c.Request.Context()
+	state, err := c.Cookie(oauthStateCookie)
+	if err != nil || state == "" || state != c.Query("state") {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "authorization state does not match, start again at /auth/login"})
+		return
+	}
+	if denied := c.Query("error"); denied != "" {
+		c.IndentedJSON(http.StatusForbidden, gin.H{"error": "authorization was denied: " + denied})
+		return
+	}
+
+	app, err := loadCredentials(ctx, ownerCredentialsObject)
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"error": "strava app credentials are not configured"})
+		return
+	}
+
+	granted, err := strava.ExchangeAuthorizationCode(stravaClient(c), app, c.Query("code"))
+	if err != nil {
+		respondUpstreamError(c, "unable to exchange authorization code", err)
+		return
+	}
+
+	// strava reports the scopes the athlete actually accepted on the redirect
+	granted.Scope = c.Query("scope")
+	granted.Client_id = app.Client_id
+	granted.Client_secret = app.Client_secret
+
+	creds_object := ownerCredentialsObject
+	if granted.Athlete.Id != app.Athlete.Id || app.Athlete.Id == 0 {
+		var athlete RegisteredAthlete
+		athlete.Id = granted.Athlete.Id
+		athlete.Firstname = granted.Athlete.Firstname
+		athlete.Lastname = granted.Athlete.Lastname
+		athlete.LeaderboardPrivacy = PrivacyHidden
+		if err := upsertRegisteredAthlete(ctx, athlete); err != nil {
+			fmt.Println(err)
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to register athlete"})
+			return
+		}
+		creds_object = athlete.credentialsObject()
+	}
+
+	err = saveCredentials(creds_object, granted)
+	recordAudit(AuditAuthorize, fmt.Sprintf("athlete:%d", granted.Athlete.Id), creds_object, err, map[string]interface{}{"scope": granted.Scope})
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to store credentials"})
+		return
+	}
+
+	c.SetCookie(oauthStateCookie, "", -1, pathPrefix+"/auth", "", c.Request.TLS != nil, true)
+	c.IndentedJSON(http.StatusOK, gin.H{"athlete_id": granted.Athlete.Id, "scope": granted.Scope})
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/geo"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/set"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// each stored activity's bounding box and the coarse geohash cells it overlaps,
+// updated with the activity index so a map viewport reads only the activities
+// that can be in it
+const boundsIndexObject = activitiesPrefix + "bounds.json"
+
+// cells of about 156 by 156 kilometers, most activities overlap one to four
+const boundsPrecision = 3
+
+// a viewport overlapping more cells than this is checked against every box,
+// which is quicker than looking each cell up
+const maxBoundsLookupCells = 256
+
+type BoundsIndex struct {
+	UpdatedAt string               `json:"updated_at"`
+	Precision int                  `json:"precision"`
+	Boxes     map[int64]geo.Bounds `json:"boxes"`
+	Cells     map[string][]int64   `json:"cells"`
+}
+
+func loadBoundsIndex(ctx context.Context) (BoundsIndex, bool) {
+	return parseBoundsIndex(getDataFromGCS(ctx, boundsIndexObject))
+}
+
+func parseBoundsIndex(slurp []byte) (BoundsIndex, bool) {
+	var index BoundsIndex
+
+	if slurp == nil {
+		return index, false
+	}
+	if err := json.Unmarshal(slurp, &index); err != nil {
+		fmt.Println(err)
+		return index, false
+	}
+	return index, index.Precision == boundsPrecision && index.Boxes != nil && index.Cells != nil
+}
+
+func storeBoundsIndex(ctx context.Context, index BoundsIndex) error {
+	index.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	bytes_index, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return putDataAtomically(ctx, boundsIndexObject, bytes_index)
+}
+
+func (index *BoundsIndex) add(id int64, route []geo.Point) {
+	box, ok := geo.BoundsOf(route)
+	if !ok {
+		return
+	}
+	index.Boxes[id] = box
+	for _, cell := range geo.GeohashBoxCells(box, boundsPrecision) {
+		index.Cells[cell] = append(index.Cells[cell], id)
+	}
+}
+
+// from every stored activity, for storage from before the bounds index was kept
+func buildBoundsIndex(ctx context.Context) BoundsIndex {
+	index := BoundsIndex{Precision: boundsPrecision, Boxes: make(map[int64]geo.Bounds), Cells: make(map[string][]int64)}
+	for _, e := range loadActivityIndex(ctx).Entries {
+		if activity, ok := loadActivity(ctx, e.Id); ok {
+			index.add(e.Id, activityRoute(activity))
+		}
+	}
+	return index
+}
+
+// replaces the saved entries' boxes and drops the removed activities; called
+// with activityIndexMu held, after the activity index was stored
+func updateBoundsIndex(ctx context.Context, saved []ActivityIndexEntry, removed []int64) error {
+	changed := set.Keyed(saved, indexEntryId)
+	for _, id := range removed {
+		changed.Add(id)
+	}
+
+	return updateObject(ctx, boundsIndexObject, func(slurp []byte) ([]byte, error) {
+		index, ok := parseBoundsIndex(slurp)
+		if !ok {
+			index = buildBoundsIndex(ctx)
+		} else {
+			for cell, ids := range index.Cells {
+				kept := ids[:0]
+				for _, id := range ids {
+					if !changed.Has(id) {
+						kept = append(kept, id)
+					}
+				}
+				if len(kept) == 0 {
+					delete(index.Cells, cell)
+				} else {
+					index.Cells[cell] = kept
+				}
+			}
+			for id := range changed {
+				delete(index.Boxes, id)
+			}
+			for _, e := range saved {
+				index.add(e.Id, e.route)
+			}
+		}
+		index.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+		return json.Marshal(index)
+	})
+}
+
+// the stored index, built first when there is none
+func boundsIndex(ctx context.Context) BoundsIndex {
+	index, ok := loadBoundsIndex(ctx)
+	if ok {
+		return index
+	}
+	activityIndexMu.Lock()
+	defer activityIndexMu.Unlock()
+
+	index = buildBoundsIndex(ctx)
+	if err := storeBoundsIndex(ctx, index); err != nil {
+		fmt.Println(err)
+	}
+	return index
+}
+
+// ids of the activities whose boxes intersect the viewport
+func (index BoundsIndex) intersecting(viewport geo.Bounds) map[int64]geo.Bounds {
+	matched := make(map[int64]geo.Bounds)
+	check := func(id int64) {
+		if box, ok := index.Boxes[id]; ok && box.Intersects(viewport) {
+			matched[id] = box
+		}
+	}
+	if geo.GeohashBoxCellCount(viewport, boundsPrecision) > maxBoundsLookupCells {
+		for id := range index.Boxes {
+			check(id)
+		}
+		return matched
+	}
+	for _, cell := range geo.GeohashBoxCells(viewport, boundsPrecision) {
+		for _, id := range index.Cells[cell] {
+			check(id)
+		}
+	}
+	return matched
+}
+
+// ?bbox=south,west,north,east in degrees, the same order as /segments/explore's bounds
+func bboxParam(c *gin.Context) (geo.Bounds, error) {
+	var b geo.Bounds
+
+	parts := strings.Split(c.Query("bbox"), ",")
+	if len(parts) != 4 {
+		return b, fmt.Errorf("bbox must be south,west,north,east latitudes and longitudes")
+	}
+	var values [4]float64
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return b, fmt.Errorf("bbox must be south,west,north,east latitudes and longitudes")
+		}
+		values[i] = value
+	}
+	b = geo.Bounds{MinLat: values[0], MinLng: values[1], MaxLat: values[2], MaxLng: values[3]}
+	if b.MinLat < -90 || b.MaxLat > 90 || b.MinLng < -180 || b.MaxLng > 180 || b.MinLat > b.MaxLat || b.MinLng > b.MaxLng {
+		return b, fmt.Errorf("bbox must have south below north and west of east, within -90 to 90 and -180 to 180")
+	}
+	return b, nil
+}
+
+// stored activities whose routes' boxes intersect the viewport, newest first,
+// for /strava/activities?bbox=; the other filters apply as they do to the index
+func getActivitiesInBounds(c *gin.Context) {
+	ctx := c.Request.Context()
+	viewport, err := bboxParam(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filters, err := activityTypeFilters(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	platforms, err := platformFilters(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	visibility, err := visibilityFilters(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	formatter, err := displayParam(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	boxes := boundsIndex(ctx).intersecting(viewport)
+
+	finalActs := FinalActivities{Data: []FinalActivity{}}
+	for _, e := range loadActivityIndex(ctx).Entries {
+		box, ok := boxes[e.Id]
+		if !ok {
+			continue
+		}
+		// entries stored before sport_type was tracked fall back to their legacy type
+		if !strava.MatchesActivityType(filters, strava.NormalizeSportType(e.SportType, e.Type)) || !matchesFilter(platforms, e.Platform) || !visibility.matches(e.Visibility, e.HideFromHome) {
+			continue
+		}
+		activity, ok := loadActivity(ctx, e.Id)
+		if !ok {
+			continue
+		}
+		a, err := finalActivity(activity.ActivitySummary)
+		if err != nil {
+			fmt.Println(err.Error())
+			finalActs.Warnings = append(finalActs.Warnings, fmt.Sprintf("activity %d skipped: unreadable start_date_local", e.Id))
+			continue
+		}
+		a.Bounds = &box
+		finalActs.Data = append(finalActs.Data, a)
+	}
+	addDisplayFields(formatter, finalActs.Data)
+
+	renderEncoded(c, http.StatusOK, finalActs, func() []byte { return activitiesProto(finalActs) })
+}
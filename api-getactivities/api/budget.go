@@ -0,0 +1,24 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// the most strava calls, and the longest, one request may fan out into before
+// it answers with what it has, so hydrating many activities keeps to the
+// latency of a page load
+var (
+	upstreamBudgetCalls = env.Int("UPSTREAM_BUDGET_CALLS", 20)
+	upstreamBudget      = time.Duration(env.Int("UPSTREAM_BUDGET_MS", 5000)) * time.Millisecond
+)
+
+var budgetWarning = fmt.Sprintf("stopped after the budget of %d strava calls or %s, activities that were not fetched are missing", upstreamBudgetCalls, upstreamBudget)
+
+// starts counting when the request comes in, so create it first thing
+func newRequestBudget() *strava.Budget {
+	return strava.NewBudget(upstreamBudgetCalls, upstreamBudget)
+}
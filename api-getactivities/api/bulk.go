@@ -0,0 +1,123 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/set"
+)
+
+// a comparison or records page needs a handful, hydrating more in one request
+// would take too long and eat into the rate limit
+const maxBulkIds = 50
+
+type BulkActivities struct {
+	Data        []annotatedActivity `json:"data"`
+	Failed      []int64             `json:"failed"`
+	RateLimited bool                `json:"rate_limited,omitempty"`
+	Truncated   bool                `json:"truncated,omitempty"` // see Warnings
+	Warnings    []string            `json:"warnings,omitempty"`
+}
+
+// ?ids=1,2,3 with duplicates dropped and the order kept
+func bulkIds(c *gin.Context) ([]int64, error) {
+	var ids []int64
+	seen := set.New[int64]()
+	for _, s := range strings.Split(c.Query("ids"), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, errors.New("ids must be comma separated activity ids")
+		}
+		if seen.Add(id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 || len(ids) > maxBulkIds {
+		return nil, fmt.Errorf("ids must list between 1 and %d activities", maxBulkIds)
+	}
+	return ids, nil
+}
+
+// the stored details of each id, hydrating the ones that are missing or only
+// stored as summaries; with ?expand= also the ones missing a section asked
+// for. Served for GET /strava/activities?ids=
+func getActivitiesByIds(c *gin.Context) {
+	ctx := c.Request.Context()
+	budget := newRequestBudget()
+
+	ids, err := bulkIds(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	expand, err := expandParam(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	detailed := make(map[int64]bool)
+	for _, e := range loadActivityIndex(ctx).Entries {
+		detailed[e.Id] = e.Detailed
+	}
+	var missing []int64
+	for _, id := range ids {
+		if !detailed[id] {
+			missing = append(missing, id)
+			continue
+		}
+		if expand != nil {
+			if activity, ok := loadActivity(ctx, id); ok && missingSections(activity, expand) {
+				missing = append(missing, id)
+			}
+		}
+	}
+
+	result := BulkActivities{Data: []annotatedActivity{}, Failed: []int64{}}
+	failed := make(map[int64]bool)
+	if len(missing) > 0 {
+		client := budget.Client(stravaClient(c))
+
+		access_token, err := getAccessToken(ctx, client)
+		if err != nil {
+			fmt.Println(err)
+			result.Warnings = append(result.Warnings, "unable to refresh strava token, activities that were not stored are missing")
+			for _, id := range missing {
+				failed[id] = true
+			}
+		} else {
+			// detailed ones are only missing when a section asked for is
+			hydration := hydrateActivities(ctx, client, access_token, missing, true)
+			result.RateLimited = hydration.RateLimited
+			if hydration.Truncated {
+				result.Truncated = true
+				result.Warnings = append(result.Warnings, budgetWarning)
+			}
+			for _, id := range hydration.Failed {
+				failed[id] = true
+			}
+		}
+	}
+
+	for _, id := range ids {
+		activity, ok := loadActivity(ctx, id)
+		if failed[id] || !ok || (!detailed[id] && activity.Resource_state != 3) {
+			// not hydrated, including ids skipped once the rate limit was near
+			result.Failed = append(result.Failed, id)
+			continue
+		}
+		activity = expandActivity(activity, expand)
+		result.Data = append(result.Data, annotateActivity(ctx, redactActivity(c, activity)))
+	}
+
+	renderEncoded(c, http.StatusOK, result, nil)
+}
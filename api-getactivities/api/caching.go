@@ -0,0 +1,167 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/cache"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+)
+
+// how long a CDN may keep responses that change with every sync, and ones
+// about a single activity that rarely change once it is uploaded
+var (
+	latestCacheSeconds     = env.Int("CACHE_LATEST_SECONDS", 60)
+	historicalCacheSeconds = env.Int("CACHE_HISTORICAL_SECONDS", 86400)
+)
+
+// a purge only reaches the CDN, so browsers are never told to keep anything longer
+var browserCacheSeconds = env.Int("CACHE_BROWSER_SECONDS", 300)
+
+// CDN_PURGE_URL is POSTed to purge everything, with CDN_PURGE_HEADER, e.g.
+// "Fastly-Key: ...", and CDN_PURGE_BODY, e.g. {"purge_everything":true} for Cloudflare
+var (
+	cdnPurgeURL    = os.Getenv("CDN_PURGE_URL")
+	cdnPurgeHeader = os.Getenv("CDN_PURGE_HEADER")
+	cdnPurgeBody   = os.Getenv("CDN_PURGE_BODY")
+)
+
+var cdnPurgeClient = &http.Client{Timeout: 10 * time.Second}
+
+var errNoCDN = errors.New("CDN_PURGE_URL is not set")
+
+// sets the cache headers once the status is known, so errors are never cached
+type cachingWriter struct {
+	gin.ResponseWriter
+	seconds int
+	private bool // the owner's view, with notes no one else may see
+}
+
+func (w *cachingWriter) setHeaders(status int) {
+	if w.Written() {
+		return
+	}
+	header := w.Header()
+	if status != http.StatusOK && status != http.StatusNotModified {
+		header.Set("Cache-Control", "no-store")
+		header.Del("Surrogate-Control")
+		return
+	}
+	if w.private {
+		header.Set("Cache-Control", "private, no-store")
+		header.Del("Surrogate-Control")
+		return
+	}
+	browser := w.seconds
+	if browser > browserCacheSeconds {
+		browser = browserCacheSeconds
+	}
+	header.Set("Cache-Control", "public, max-age="+strconv.Itoa(browser))
+	header.Set("Surrogate-Control", "max-age="+strconv.Itoa(w.seconds))
+}
+
+func (w *cachingWriter) WriteHeader(code int) {
+	w.setHeaders(code)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cachingWriter) WriteHeaderNow() {
+	w.setHeaders(w.Status())
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *cachingWriter) Write(data []byte) (int, error) {
+	w.setHeaders(w.Status())
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *cachingWriter) WriteString(s string) (int, error) {
+	w.setHeaders(w.Status())
+	return w.ResponseWriter.WriteString(s)
+}
+
+// cacheFor lets browsers and CDNs reuse successful responses for seconds
+func cacheFor(seconds int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer = &cachingWriter{ResponseWriter: c.Writer, seconds: seconds, private: isAdminRequest(c)}
+		c.Next()
+	}
+}
+
+var (
+	cacheLatest     = cacheFor(latestCacheSeconds)
+	cacheHistorical = cacheFor(historicalCacheSeconds)
+)
+
+// purgeCDN invalidates everything the CDN holds, so a sync shows up before the TTLs run out
+func purgeCDN() error {
+	if cdnPurgeURL == "" {
+		return errNoCDN
+	}
+	req, err := http.NewRequest("POST", cdnPurgeURL, strings.NewReader(cdnPurgeBody))
+	if err != nil {
+		return err
+	}
+	if name, value, ok := strings.Cut(cdnPurgeHeader, ":"); ok {
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	if cdnPurgeBody != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := cdnPurgeClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("cdn purge: %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func postAdminCachePurge(c *gin.Context) {
+	err := purgeCDN()
+	recordAudit(AuditCachePurge, adminActor(c), cdnPurgeURL, err, nil)
+	if errors.Is(err, errNoCDN) {
+		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusBadGateway, gin.H{"error": "unable to purge the cdn"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"purged": true})
+}
+
+// Metrics are the server's in-process counters since it started
+type Metrics struct {
+	ObjectCache       *cache.Stats                `json:"object_cache"`       // nil when storage is not GCS, as in dev mode
+	CacheInvalidation *InvalidationStats          `json:"cache_invalidation"` // nil without CACHE_INVALIDATION_TOPIC
+	Routes            map[string]RouteConcurrency `json:"routes"`             // the ROUTE_CONCURRENCY limited ones
+	Memory            MemoryStats                 `json:"memory"`             // with the 20 routes allocating the most
+}
+
+func getAdminMetrics(c *gin.Context) {
+	var metrics Metrics
+	if objectCache != nil {
+		stats := objectCache.Stats()
+		metrics.ObjectCache = &stats
+	}
+	metrics.CacheInvalidation = invalidationStats()
+	metrics.Routes = routeConcurrencyStats()
+	metrics.Memory = memoryStats(20)
+	c.IndentedJSON(http.StatusOK, metrics)
+}
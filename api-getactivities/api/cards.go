@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"image/color"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/geo"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/render"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+const svgContentType = "image/svg+xml"
+
+func cardStyle(c *gin.Context) (render.Units, color.RGBA, error) {
+	units, err := render.ParseUnits(c.DefaultQuery("units", string(render.Imperial)))
+	if err != nil {
+		return units, color.RGBA{}, err
+	}
+	accent, err := render.ParseColor(c.DefaultQuery("accent", "fc4c02"))
+	return units, accent, err
+}
+
+func getActivityCard(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "activity id must be numeric"})
+		return
+	}
+	units, accent, err := cardStyle(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	activity, err := loadOrFetchActivity(ctx, id)
+	if err != nil {
+		respondUpstreamError(c, "unable to fetch activity from strava", err)
+		return
+	}
+	svg, err := activityCard(activity, units, accent).SVG()
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to render card"})
+		return
+	}
+	c.Data(http.StatusOK, svgContentType, svg)
+}
+
+func activityCard(activity strava.ActivityDetailed, units render.Units, accent color.RGBA) render.ActivityCard {
+	route, err := geo.DecodePolyline(activity.Map.SummaryPolyline)
+	if err != nil {
+		fmt.Println(activity.Id, err)
+	}
+	start, err := activity.StartTime()
+	if err != nil {
+		fmt.Println(activity.Id, err)
+	}
+
+	return render.ActivityCard{
+		Name:       activity.Name,
+		SportType:  strava.NormalizeSportType(activity.SportType, activity.Type),
+		Start:      start,
+		Route:      route,
+		Distance:   activity.Distance,
+		MovingTime: activity.MovingTime,
+		Elevation:  activity.TotalElevationGain,
+		Units:      units,
+		Accent:     accent,
+	}
+}
+
+// stored activities of the week, as fresh as the last sync; activities started
+// in other zones may fall on a day either side, SummarizeWeek leaves those out
+func storedWeek(ctx context.Context, start time.Time) []strava.ActivitySummary {
+	var activities []strava.ActivitySummary
+	for _, activity := range storedWeekDetails(ctx, start) {
+		activities = append(activities, activity.ActivitySummary)
+	}
+	return activities
+}
+
+// storedWeek with the stored details, newest first
+func storedWeekDetails(ctx context.Context, start time.Time) []strava.ActivityDetailed {
+	from := start.AddDate(0, 0, -1)
+	end := start.AddDate(0, 0, 8)
+	var activities []strava.ActivityDetailed
+	for _, e := range loadActivityIndex(ctx).Entries {
+		at, err := time.Parse(time.RFC3339, e.StartDate)
+		if err != nil || at.Before(from) || !at.Before(end) {
+			continue
+		}
+		if activity, ok := loadActivity(ctx, e.Id); ok {
+			activities = append(activities, activity)
+		}
+	}
+	return activities
+}
+
+// the week containing ?week=2006-01-02, the current week without it, both in
+// the athlete's zone
+func weekParam(c *gin.Context) (time.Time, error) {
+	loc, err := athleteZone(c)
+	if err != nil {
+		return time.Time{}, err
+	}
+	week := c.Query("week")
+	if week == "" {
+		return analysis.StartOfWeekIn(time.Now(), loc), nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", week, loc)
+	if err != nil {
+		return day, fmt.Errorf("week must be a date like 2006-01-02")
+	}
+	return analysis.StartOfWeekIn(day, loc), nil
+}
+
+func getWeeklyCard(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	units, accent, err := cardStyle(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	start, err := weekParam(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	svg, err := render.WeeklyCard{
+		Title:  c.DefaultQuery("title", "Weekly training"),
+		Week:   analysis.SummarizeWeek(start, storedWeek(ctx, start)),
+		Units:  units,
+		Accent: accent,
+	}.SVG()
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to render card"})
+		return
+	}
+	c.Data(http.StatusOK, svgContentType, svg)
+}
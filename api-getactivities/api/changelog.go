@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the change sets of each month, so a sync rewrites only the month's shard
+const changelogPrefix = "changelog/activities/"
+
+// the whole log as it was kept before it was sharded, read as the months before the first shard
+const legacyChangelogObject = "changelog/activities.json"
+
+const (
+	ChangeCreated = "created"
+	ChangeRenamed = "renamed"
+	ChangeDeleted = "deleted"
+	ChangeUpdated = "updated"
+)
+
+type ActivityChange struct {
+	Kind       string `json:"kind"`
+	ActivityId int64  `json:"activity_id"`
+	OldName    string `json:"old_name,omitempty"`
+	NewName    string `json:"new_name,omitempty"`
+}
+
+// one entry per sync run that changed anything
+type ChangeSet struct {
+	Seq       int64            `json:"seq"`
+	Timestamp string           `json:"timestamp"`
+	Source    string           `json:"source"`
+	Changes   []ActivityChange `json:"changes"`
+}
+
+var changelogMu sync.Mutex
+
+func changelogShard(t time.Time) string {
+	return changelogPrefix + t.UTC().Format("2006-01") + ".json"
+}
+
+func parseChangeSets(slurp []byte) ([]ChangeSet, error) {
+	var sets []ChangeSet
+	if slurp == nil {
+		return sets, nil
+	}
+	err := json.Unmarshal(slurp, &sets)
+	return sets, err
+}
+
+// the shard names oldest first
+func changelogShards(ctx context.Context) []string {
+	shards, err := listGCSObjects(ctx, changelogPrefix)
+	if err != nil {
+		fmt.Println(err)
+	}
+	sort.Strings(shards)
+	return shards
+}
+
+func loadChangelog(ctx context.Context) []ChangeSet {
+	return loadChangelogSince(ctx, time.Time{})
+}
+
+// the change sets oldest first, skipping the shards of months before since
+func loadChangelogSince(ctx context.Context, since time.Time) []ChangeSet {
+	var changelog []ChangeSet
+
+	if since.IsZero() {
+		legacy, err := parseChangeSets(getDataFromGCS(ctx, legacyChangelogObject))
+		if err != nil {
+			fmt.Println(err)
+		}
+		// numbered by position before sequence numbers were kept with each set
+		for i := range legacy {
+			legacy[i].Seq = int64(i + 1)
+		}
+		changelog = legacy
+	}
+	for _, shard := range changelogShards(ctx) {
+		if !since.IsZero() && shard < changelogShard(since) {
+			continue
+		}
+		sets, err := parseChangeSets(getDataFromGCS(ctx, shard))
+		if err != nil {
+			fmt.Println(shard, err)
+			continue
+		}
+		changelog = append(changelog, sets...)
+	}
+	return changelog
+}
+
+// the sequence number of the last change set before shard, 0 with none
+func lastChangeSetBefore(ctx context.Context, shard string) int64 {
+	shards := changelogShards(ctx)
+	for i := len(shards) - 1; i >= 0; i-- {
+		if shards[i] >= shard {
+			continue
+		}
+		sets, err := parseChangeSets(getDataFromGCS(ctx, shards[i]))
+		if err != nil {
+			fmt.Println(shards[i], err)
+		}
+		if len(sets) > 0 {
+			return sets[len(sets)-1].Seq
+		}
+	}
+	legacy, err := parseChangeSets(getDataFromGCS(ctx, legacyChangelogObject))
+	if err != nil {
+		fmt.Println(err)
+	}
+	return int64(len(legacy))
+}
+
+// the sequence number of the newest change set, which delta cursors count up to
+func latestChangeSet(changelog []ChangeSet) int64 {
+	if len(changelog) == 0 {
+		return 0
+	}
+	return changelog[len(changelog)-1].Seq
+}
+
+func appendChangelog(ctx context.Context, source string, changes []ActivityChange) error {
+	return appendChangeSet(ctx, time.Now().UTC(), source, changes)
+}
+
+// appends to the shard of now's month, numbering the set after the last one
+// stored; an append from another process in between is kept and numbered first
+func appendChangeSet(ctx context.Context, now time.Time, source string, changes []ActivityChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	changelogMu.Lock()
+	defer changelogMu.Unlock()
+
+	var set ChangeSet
+	set.Timestamp = now.Format(time.RFC3339)
+	set.Source = source
+	set.Changes = changes
+
+	shard := changelogShard(now)
+	err := updateObject(ctx, shard, func(slurp []byte) ([]byte, error) {
+		sets, err := parseChangeSets(slurp)
+		if err != nil {
+			// rewriting a shard that does not parse would drop what it holds
+			return nil, fmt.Errorf("%s: %w", shard, err)
+		}
+		if len(sets) > 0 {
+			set.Seq = sets[len(sets)-1].Seq + 1
+		} else {
+			set.Seq = lastChangeSetBefore(ctx, shard) + 1
+		}
+		return json.Marshal(append(sets, set))
+	})
+	if err != nil {
+		return err
+	}
+	publishChangeSet(set)
+	return nil
+}
+
+func getChangelog(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	var since time.Time
+	if s := c.Query("since"); s != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC3339 timestamp"})
+			return
+		}
+	}
+
+	limit, cur, err := pageParams(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// newest first
+	changelog := loadChangelogSince(ctx, since)
+	sets := []ChangeSet{}
+	for i := len(changelog) - 1; i >= 0; i-- {
+		ts, err := time.Parse(time.RFC3339, changelog[i].Timestamp)
+		if err == nil && !since.IsZero() && !ts.After(since) {
+			continue
+		}
+		sets = append(sets, changelog[i])
+	}
+
+	// the log is append only, so its sequence number alone orders it
+	page, next, prev := paginate(sets, func(s ChangeSet) (string, int64) {
+		return "", s.Seq
+	}, cur, limit)
+	nextCursor, prevCursor := setPageLinks(c, next, prev)
+
+	c.IndentedJSON(http.StatusOK, gin.H{"data": page, "next_cursor": nextCursor, "prev_cursor": prevCursor})
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+)
+
+func TestAppendChangeSet(t *testing.T) {
+	defer func(store storage.ObjectStore) { objects = store }(objects)
+	objects = storage.NewMemory()
+
+	// two sets kept in the single object from before the log was sharded
+	legacy, err := json.Marshal([]ChangeSet{
+		{Timestamp: "2026-08-01T00:00:00Z", Source: "sync", Changes: []ActivityChange{{Kind: ChangeCreated, ActivityId: 1}}},
+		{Timestamp: "2026-08-02T00:00:00Z", Source: "sync", Changes: []ActivityChange{{Kind: ChangeCreated, ActivityId: 2}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := objects.Write(legacyChangelogObject, legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	september := time.Date(2026, 9, 30, 23, 0, 0, 0, time.UTC)
+	october := time.Date(2026, 10, 1, 1, 0, 0, 0, time.UTC)
+	if err := appendChangeSet(context.Background(), september, "sync", []ActivityChange{{Kind: ChangeRenamed, ActivityId: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	// as if every instance stored a sync at once
+	var wg sync.WaitGroup
+	for i := int64(0); i < 5; i++ {
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			if err := appendChangeSet(context.Background(), october, "sync", []ActivityChange{{Kind: ChangeCreated, ActivityId: id}}); err != nil {
+				t.Error(err)
+			}
+		}(10 + i)
+	}
+	wg.Wait()
+	if err := appendChangeSet(context.Background(), october, "reconcile", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	changelog := loadChangelog(context.Background())
+	if len(changelog) != 8 {
+		t.Fatalf("%d change sets, want 8", len(changelog))
+	}
+	for i, set := range changelog {
+		if set.Seq != int64(i+1) {
+			t.Errorf("change set %d numbered %d", i+1, set.Seq)
+		}
+	}
+	if latest := latestChangeSet(changelog); latest != 8 {
+		t.Errorf("latest change set %d, want 8", latest)
+	}
+
+	shards := changelogShards(context.Background())
+	if len(shards) != 2 || shards[0] != changelogPrefix+"2026-09.json" || shards[1] != changelogPrefix+"2026-10.json" {
+		t.Errorf("shards %v, want one for september and one for october", shards)
+	}
+	if since := loadChangelogSince(context.Background(), october.Add(-time.Hour)); len(since) != 5 || since[0].Seq != 4 {
+		t.Errorf("since october: %d change sets from %d, want 5 from 4", len(since), since[0].Seq)
+	}
+}
+
+func TestAppendChangeSetKeepsUnparsedShard(t *testing.T) {
+	defer func(store storage.ObjectStore) { objects = store }(objects)
+	objects = storage.NewMemory()
+
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	if err := objects.Write(changelogShard(now), []byte(`{"cut short`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendChangeSet(context.Background(), now, "sync", []ActivityChange{{Kind: ChangeCreated, ActivityId: 1}}); err == nil {
+		t.Error("appended to a shard that does not parse")
+	}
+	if slurp, err := readGCSObject(context.Background(), changelogShard(now)); err != nil || string(slurp) != `{"cut short` {
+		t.Errorf("the shard was rewritten: %q, %v", slurp, err)
+	}
+}
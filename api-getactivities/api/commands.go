@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Commands run instead of the server, e.g. `server export -out backup.tar.gz`
+var Commands = map[string]func(args []string) error{
+	"export":               runExport,
+	"geocode":              runGeocode,
+	"import":               runImport,
+	"bigquery-export":      runBigQueryExport,
+	"parquet-export":       runParquetExport,
+	"prune":                runPrune,
+	"reconcile":            runReconcile,
+	"starred-segments":     runStarredSync,
+	"verify":               runVerify,
+	"weekly-report":        runWeeklyReport,
+	"webhook-subscription": runWebhookSubscription,
+}
+
+func runExport(args []string) error {
+	ctx := context.Background()
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	bucket := fs.String("bucket", bucketName, "bucket to export from")
+	athlete := fs.Int64("athlete", 0, "registered athlete id, the owner when omitted")
+	out := fs.String("out", "-", "file to write the snapshot to, - for stdout")
+	environment := fs.String("env", storageEnv, "storage environment to export from")
+	tenant := fs.String("tenant", storageTenant, "storage tenant to export from")
+	fs.Parse(args)
+
+	if err := useNamespace(*environment, *tenant); err != nil {
+		return err
+	}
+	useBucket(*bucket)
+
+	owner := *athlete == 0 || *athlete == ownerAthleteId(ctx)
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	written, err := writeSnapshot(ctx, w, athleteDataPrefixes(*athlete, owner))
+	fmt.Fprintf(os.Stderr, "exported %d objects from %s\n", written, bucketName)
+	return err
+}
+
+func runImport(args []string) error {
+	ctx := context.Background()
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	bucket := fs.String("bucket", bucketName, "bucket to import into")
+	in := fs.String("in", "-", "snapshot file to read, - for stdin")
+	overwrite := fs.Bool("overwrite", false, "replace objects that already exist")
+	environment := fs.String("env", storageEnv, "storage environment to import into")
+	tenant := fs.String("tenant", storageTenant, "storage tenant to import into")
+	fs.Parse(args)
+
+	if err := useNamespace(*environment, *tenant); err != nil {
+		return err
+	}
+	useBucket(*bucket)
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	result, err := readSnapshot(ctx, r, *overwrite)
+	fmt.Fprintf(os.Stderr, "imported %d objects into %s, skipped %d\n", len(result.Written), bucketName, len(result.Skipped))
+	for _, e := range result.Errors {
+		fmt.Fprintln(os.Stderr, e)
+	}
+	return err
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+)
+
+// routes that hold whole years of activities or streams in memory, a few at
+// once are enough to run a small instance out of it
+var defaultRouteConcurrency = map[string]int{
+	"/strava/reports/year/:year/map.png": 2,
+	"/strava/export.parquet":             2,
+	"/strava/activities.ndjson":          4,
+	"/strava/hydrate":                    2,
+	"/admin/export":                      1,
+}
+
+// a request over its route's limit waits for up to ROUTE_QUEUE_SECONDS, default
+// 10, behind at most ROUTE_QUEUE_DEPTH others, default 8, before answering 503
+var (
+	routeQueueDepth = env.Int("ROUTE_QUEUE_DEPTH", 8)
+	routeQueueWait  = time.Duration(env.Int("ROUTE_QUEUE_SECONDS", 10)) * time.Second
+)
+
+var routeLimits = newRouteLimits(parseRouteConcurrency(os.Getenv("ROUTE_CONCURRENCY")))
+
+// ROUTE_CONCURRENCY is a comma separated list of route=requests, the route as
+// it is registered without the path prefix, such as /strava/export.parquet=1.
+// A limit of 0 lifts a default one
+func parseRouteConcurrency(spec string) map[string]int {
+	limits := make(map[string]int)
+	for route, limit := range defaultRouteConcurrency {
+		limits[route] = limit
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, value, ok := strings.Cut(entry, "=")
+		limit, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil || limit < 0 {
+			fmt.Println("ROUTE_CONCURRENCY: ignoring", entry)
+			continue
+		}
+		limits[strings.TrimSpace(route)] = limit
+	}
+	return limits
+}
+
+// RouteConcurrency is a limited route's load now and its counters since the
+// server started
+type RouteConcurrency struct {
+	Limit     int    `json:"limit"`
+	Active    int    `json:"active"`
+	Queued    int    `json:"queued"`
+	MaxQueued int    `json:"max_queued"`
+	Served    uint64 `json:"served"`
+	Rejected  uint64 `json:"rejected"` // answered 503, the queue being full or too slow
+}
+
+type routeLimit struct {
+	slots chan struct{}
+	mu    sync.Mutex
+	stats RouteConcurrency
+}
+
+func newRouteLimits(limits map[string]int) map[string]*routeLimit {
+	routes := make(map[string]*routeLimit)
+	for route, limit := range limits {
+		if limit > 0 {
+			routes[route] = &routeLimit{slots: make(chan struct{}, limit), stats: RouteConcurrency{Limit: limit}}
+		}
+	}
+	return routes
+}
+
+// takes a slot, queueing for one when the route is busy; false when the queue
+// is full, the wait runs out or the client goes away
+func (l *routeLimit) acquire(ctx context.Context) bool {
+	select {
+	case l.slots <- struct{}{}:
+		l.started()
+		return true
+	default:
+	}
+
+	l.mu.Lock()
+	if l.stats.Queued >= routeQueueDepth {
+		l.stats.Rejected++
+		l.mu.Unlock()
+		return false
+	}
+	l.stats.Queued++
+	if l.stats.Queued > l.stats.MaxQueued {
+		l.stats.MaxQueued = l.stats.Queued
+	}
+	l.mu.Unlock()
+
+	timer := time.NewTimer(routeQueueWait)
+	defer timer.Stop()
+	acquired := false
+	select {
+	case l.slots <- struct{}{}:
+		acquired = true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	l.stats.Queued--
+	if !acquired {
+		l.stats.Rejected++
+	}
+	l.mu.Unlock()
+	if acquired {
+		l.started()
+	}
+	return acquired
+}
+
+func (l *routeLimit) started() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats.Active++
+	l.stats.Served++
+}
+
+func (l *routeLimit) release() {
+	l.mu.Lock()
+	l.stats.Active--
+	l.mu.Unlock()
+	<-l.slots
+}
+
+// runs at most the route's limit of requests at once, ROUTE_CONCURRENCY
+func withRouteConcurrency(c *gin.Context) {
+	limit, ok := routeLimits[strings.TrimPrefix(c.FullPath(), pathPrefix)]
+	if !ok {
+		c.Next()
+		return
+	}
+	if !limit.acquire(c.Request.Context()) {
+		retryAfter := int(math.Max(1, math.Ceil(routeQueueWait.Seconds())))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error": fmt.Sprintf("too many requests to this route at once, retry in %d seconds", retryAfter),
+			"route": strings.TrimPrefix(c.FullPath(), pathPrefix),
+		})
+		return
+	}
+	defer limit.release()
+
+	c.Next()
+}
+
+func routeConcurrencyStats() map[string]RouteConcurrency {
+	stats := make(map[string]RouteConcurrency)
+	for route, limit := range routeLimits {
+		limit.mu.Lock()
+		stats[route] = limit.stats
+		limit.mu.Unlock()
+	}
+	return stats
+}
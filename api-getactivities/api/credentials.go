@@ -0,0 +1,128 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// encrypted objects start with this marker so plaintext objects written before
+// CREDENTIALS_KEY was configured can still be read and are encrypted on next save
+var encryptedPrefix = []byte("enc:v1:")
+
+// CREDENTIALS_KEY is a base64 encoded 32 byte AES-256 key
+func credentialsKey() ([]byte, error) {
+	encoded := os.Getenv("CREDENTIALS_KEY")
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("CREDENTIALS_KEY is not valid base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, errors.New("CREDENTIALS_KEY must decode to 32 bytes")
+	}
+	return key, nil
+}
+
+func encryptCredentials(key []byte, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	out := append([]byte{}, encryptedPrefix...)
+	return append(out, base64.StdEncoding.EncodeToString(sealed)...), nil
+}
+
+func decryptCredentials(key []byte, data []byte) ([]byte, error) {
+	if key == nil {
+		return nil, errors.New("credentials are encrypted but CREDENTIALS_KEY is not set")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(string(bytes.TrimPrefix(data, encryptedPrefix)))
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("encrypted credentials are truncated")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func loadCredentials(ctx context.Context, creds_object string) (strava.Credentials, error) {
+	var creds strava.Credentials
+
+	credsSlurp, err := readGCSObject(ctx, creds_object)
+	if err != nil {
+		return creds, fmt.Errorf("%s: %w", creds_object, err)
+	}
+
+	if bytes.HasPrefix(credsSlurp, encryptedPrefix) {
+		key, err := credentialsKey()
+		if err != nil {
+			return creds, err
+		}
+		credsSlurp, err = decryptCredentials(key, credsSlurp)
+		if err != nil {
+			return creds, err
+		}
+	}
+
+	err = json.Unmarshal(credsSlurp, &creds)
+	return creds, err
+}
+
+// not canceled with the request it is made for: a refresh token strava rotated
+// or granted is the only one that works from then on
+func saveCredentials(creds_object string, creds strava.Credentials) error {
+	bytes_creds, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+
+	key, err := credentialsKey()
+	if err != nil {
+		return err
+	}
+	if key != nil {
+		bytes_creds, err = encryptCredentials(key, bytes_creds)
+		if err != nil {
+			return err
+		}
+	}
+
+	return putDataToGCS(context.Background(), creds_object, bytes_creds)
+}
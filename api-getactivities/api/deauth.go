@@ -0,0 +1,192 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+const (
+	CleanupKeep    = "keep"
+	CleanupPurge   = "purge"
+	CleanupArchive = "archive"
+)
+
+// the owner's cached data lives at the top of the bucket rather than under an athlete prefix
+var ownerDataPrefixes = []string{activitiesPrefix, streamsPrefix, mapsPrefix, "segment_efforts/", segmentsPrefix, "changelog/", "athlete/", revisionsPrefix, notesPrefix, wellnessPrefix, periodsPrefix, gearPrefix, photosPrefix}
+
+type DeauthorizationResult struct {
+	AthleteId          int64    `json:"athlete_id"`
+	Owner              bool     `json:"owner"`
+	Revoked            bool     `json:"revoked"`
+	CredentialsRemoved bool     `json:"credentials_removed"`
+	Cleanup            string   `json:"cleanup"`
+	ObjectsAffected    int      `json:"objects_affected"`
+	Errors             []string `json:"errors,omitempty"`
+}
+
+func athleteDataPrefixes(athleteId int64, owner bool) []string {
+	if owner {
+		return ownerDataPrefixes
+	}
+	return []string{RegisteredAthlete{Id: athleteId}.objectPrefix()}
+}
+
+func ownerAthleteId(ctx context.Context) int64 {
+	creds, err := loadCredentials(ctx, ownerCredentialsObject)
+	if err != nil {
+		return 0
+	}
+	return creds.Athlete.Id
+}
+
+func athleteCredentialsObject(ctx context.Context, athleteId int64) string {
+	if athleteId == ownerAthleteId(ctx) {
+		return ownerCredentialsObject
+	}
+	return RegisteredAthlete{Id: athleteId}.credentialsObject()
+}
+
+// webhook posts are not signed, so a deauthorization is only believed once
+// strava rejects a refresh of the athlete's token; false with a nil error
+// means strava still accepts it, an error that strava could not be asked
+func confirmStravaRevoked(ctx context.Context, client *http.Client, creds_object string) (bool, error) {
+	_, err := getAccessTokenFor(ctx, client, creds_object)
+	if err == nil {
+		return false, nil
+	}
+	var stravaErr *strava.Error
+	if errors.As(err, &stravaErr) && stravaErr.Kind() == strava.KindAuth {
+		return true, nil
+	}
+	return false, err
+}
+
+func revokeStravaAccess(ctx context.Context, client *http.Client, creds_object string) error {
+	access_token, err := getAccessTokenFor(ctx, client, creds_object)
+	if err != nil {
+		return err
+	}
+
+	return strava.Deauthorize(client, access_token)
+}
+
+func removeRegisteredAthlete(ctx context.Context, athleteId int64) error {
+	athleteRegistryMu.Lock()
+	defer athleteRegistryMu.Unlock()
+
+	kept := []RegisteredAthlete{}
+	for _, a := range loadRegisteredAthletes(ctx) {
+		if a.Id != athleteId {
+			kept = append(kept, a)
+		}
+	}
+
+	bytes_athletes, err := json.Marshal(kept)
+	if err != nil {
+		return err
+	}
+	return putDataToGCS(ctx, athleteRegistryObject, bytes_athletes)
+}
+
+// purge deletes the athlete's cached objects, archive moves them under archive/
+func cleanupAthleteData(ctx context.Context, prefixes []string, mode string, archivePrefix string) (int, []error) {
+	var errs []error
+	affected := 0
+
+	for _, prefix := range prefixes {
+		objects, err := listGCSObjects(ctx, prefix)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, object := range objects {
+			if mode == CleanupArchive {
+				if err := copyGCSObject(ctx, object, archivePrefix+object); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+			}
+			if err := deleteDataFromGCS(ctx, object); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			affected++
+		}
+	}
+	return affected, errs
+}
+
+// revoke is skipped for webhook deauthorizations since strava has already revoked the token
+func deauthorizeAthlete(ctx context.Context, athleteId int64, revoke bool, mode string) DeauthorizationResult {
+	var result DeauthorizationResult
+	result.AthleteId = athleteId
+	result.Cleanup = mode
+	creds_object := athleteCredentialsObject(ctx, athleteId)
+	result.Owner = creds_object == ownerCredentialsObject
+	prefixes := athleteDataPrefixes(athleteId, result.Owner)
+
+	if revoke {
+		if err := revokeStravaAccess(ctx, strava.DefaultClient, creds_object); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		} else {
+			result.Revoked = true
+		}
+	}
+
+	if err := deleteDataFromGCS(ctx, creds_object); err != nil {
+		result.Errors = append(result.Errors, err.Error())
+	} else {
+		result.CredentialsRemoved = true
+	}
+
+	if !result.Owner {
+		if err := removeRegisteredAthlete(ctx, athleteId); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		}
+	}
+
+	if mode == CleanupPurge || mode == CleanupArchive {
+		archivePrefix := fmt.Sprintf("archive/athletes/%d/%s/", athleteId, time.Now().UTC().Format("20060102T150405Z"))
+		affected, errs := cleanupAthleteData(ctx, prefixes, mode, archivePrefix)
+		result.ObjectsAffected = affected
+		for _, err := range errs {
+			result.Errors = append(result.Errors, err.Error())
+		}
+	}
+
+	return result
+}
+
+func deleteAthlete(c *gin.Context) {
+	ctx := c.Request.Context()
+	athleteId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "athlete id must be numeric"})
+		return
+	}
+
+	mode := c.DefaultQuery("cleanup", CleanupKeep)
+	if mode != CleanupKeep && mode != CleanupPurge && mode != CleanupArchive {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "cleanup must be keep, purge or archive"})
+		return
+	}
+
+	result := deauthorizeAthlete(ctx, athleteId, true, mode)
+
+	var resultErr error
+	if len(result.Errors) > 0 {
+		resultErr = fmt.Errorf("%d cleanup errors", len(result.Errors))
+	}
+	recordAudit(AuditAthleteDeauthorize, adminActor(c), strconv.FormatInt(athleteId, 10), resultErr, map[string]interface{}{"cleanup": mode, "revoked": result.Revoked})
+
+	c.IndentedJSON(http.StatusOK, result)
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ActivityDelta is the latest state of one activity that changed since the
+// cursor; renames are updates, and deleted activities carry no record
+type ActivityDelta struct {
+	Id       int64          `json:"id"`
+	Kind     string         `json:"kind"`
+	Activity *FinalActivity `json:"activity,omitempty"`
+}
+
+// position in the changelog a client has caught up to
+type deltaCursor struct {
+	Seq int64 `json:"s"`
+}
+
+func encodeDeltaCursor(seq int64) string {
+	bytes_cursor, _ := json.Marshal(deltaCursor{Seq: seq})
+	return base64.RawURLEncoding.EncodeToString(bytes_cursor)
+}
+
+func decodeDeltaCursor(s string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, errBadCursor
+	}
+	var cur deltaCursor
+	if err := json.Unmarshal(raw, &cur); err != nil || cur.Seq < 0 {
+		return 0, errBadCursor
+	}
+	return cur.Seq, nil
+}
+
+// folds the change sets after seq into one change per activity, ordered by
+// when each activity last changed
+func collapseChanges(changelog []ChangeSet, seq int64) []ActivityDelta {
+	kinds := make(map[int64]string)
+	last := make(map[int64]int)
+	order := 0
+	for _, set := range changelog {
+		if set.Seq <= seq {
+			continue
+		}
+		for _, change := range set.Changes {
+			id := change.ActivityId
+			switch {
+			case change.Kind == ChangeDeleted:
+				kinds[id] = ChangeDeleted
+			case change.Kind == ChangeCreated || kinds[id] == ChangeDeleted:
+				// the client may still hold the copy from before a delete, created replaces it
+				kinds[id] = ChangeCreated
+			case kinds[id] != ChangeCreated:
+				kinds[id] = ChangeUpdated
+			}
+			last[id] = order
+			order++
+		}
+	}
+
+	deltas := make([]ActivityDelta, 0, len(kinds))
+	for id, kind := range kinds {
+		deltas = append(deltas, ActivityDelta{Id: id, Kind: kind})
+	}
+	sort.Slice(deltas, func(i, j int) bool { return last[deltas[i].Id] < last[deltas[j].Id] })
+	return deltas
+}
+
+// without ?since= every stored activity is returned as created, the starting
+// point for a client's local copy; the returned cursor is passed as since next time
+func getActivityChanges(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	formatter, err := displayParam(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	changelog := loadChangelog(ctx)
+	latest := latestChangeSet(changelog)
+
+	var deltas []ActivityDelta
+	full := c.Query("since") == ""
+	if full {
+		// the index is newest first, a replay goes oldest first
+		entries := loadActivityIndex(ctx).Entries
+		for i := len(entries) - 1; i >= 0; i-- {
+			deltas = append(deltas, ActivityDelta{Id: entries[i].Id, Kind: ChangeCreated})
+		}
+	} else {
+		seq, err := decodeDeltaCursor(c.Query("since"))
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if seq > latest {
+			// the changelog was replaced, e.g. by a snapshot import
+			c.IndentedJSON(http.StatusGone, gin.H{"error": "cursor is ahead of the changelog, fetch again without since"})
+			return
+		}
+		deltas = collapseChanges(changelog, seq)
+	}
+
+	var finalActs []FinalActivity
+	for i := range deltas {
+		if deltas[i].Kind == ChangeDeleted {
+			continue
+		}
+		activity, ok := loadActivity(ctx, deltas[i].Id)
+		if !ok {
+			deltas[i].Kind = ChangeDeleted
+			continue
+		}
+		finalAct, err := finalActivity(activity.ActivitySummary)
+		if err != nil {
+			fmt.Println(deltas[i].Id, err)
+			continue
+		}
+		finalActs = append(finalActs, finalAct)
+	}
+	addDisplayFields(formatter, finalActs)
+
+	byId := make(map[int64]*FinalActivity)
+	for i := range finalActs {
+		byId[finalActs[i].Id] = &finalActs[i]
+	}
+	data := []ActivityDelta{}
+	for _, delta := range deltas {
+		if delta.Kind != ChangeDeleted {
+			if delta.Activity = byId[delta.Id]; delta.Activity == nil {
+				continue
+			}
+		}
+		data = append(data, delta)
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"data": data, "full": full, "cursor": encodeDeltaCursor(latest)})
+}
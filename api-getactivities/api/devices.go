@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+)
+
+// DeviceStats is what one recording device or app produced, for telling which
+// one drops heart rate or reads implausible values
+type DeviceStats struct {
+	Device     string `json:"device"`
+	Activities int    `json:"activities"`
+	Heartrate  int    `json:"heartrate"` // activities with heart rate recorded
+	Power      int    `json:"power"`     // activities with power from a meter
+
+	// of the activities with stored heart rate streams, the samples reading 0
+	HeartrateSamples int     `json:"heartrate_samples"`
+	HeartrateDropped int     `json:"heartrate_dropped"`
+	DropoutShare     float64 `json:"heartrate_dropout_share"`
+
+	Issues map[string]int `json:"issues"` // activities failing each data quality check
+}
+
+// stored activities grouped by the device that recorded them, using stored
+// streams only so it costs no strava calls
+func getDeviceStats(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	index := loadActivityIndex(ctx)
+	devices := make(map[string]*DeviceStats)
+	for _, e := range index.Entries {
+		activity, ok := loadActivity(ctx, e.Id)
+		if !ok {
+			continue
+		}
+		name := analysis.RecordingDevice(activity.ActivitySummary, activity.DeviceName)
+		stats := devices[name]
+		if stats == nil {
+			stats = &DeviceStats{Device: name, Issues: map[string]int{}}
+			devices[name] = stats
+		}
+
+		stats.Activities++
+		if activity.HasHeartrate {
+			stats.Heartrate++
+		}
+		if activity.DeviceWatts {
+			stats.Power++
+		}
+
+		set := storedStreams(ctx, e.Id)
+		dropped, samples := analysis.HeartrateDropouts(set)
+		stats.HeartrateDropped += dropped
+		stats.HeartrateSamples += samples
+		for _, issue := range analysis.CheckSensorData(activity.ActivitySummary, set) {
+			stats.Issues[issue.Check]++
+		}
+	}
+
+	data := []DeviceStats{}
+	for _, stats := range devices {
+		if stats.HeartrateSamples > 0 {
+			stats.DropoutShare = float64(stats.HeartrateDropped) / float64(stats.HeartrateSamples)
+		}
+		data = append(data, *stats)
+	}
+	sort.Slice(data, func(i, j int) bool {
+		if data[i].Activities != data[j].Activities {
+			return data[i].Activities > data[j].Activities
+		}
+		return data[i].Device < data[j].Device
+	})
+
+	c.IndentedJSON(http.StatusOK, gin.H{"checked": len(index.Entries), "data": data})
+}
@@ -0,0 +1,600 @@
+package api
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// fixture athlete, activities and app credentials served by --dev
+//
+//go:embed fixtures/*.json
+var fixtureFS embed.FS
+
+const devAccessToken = "dev-access-token"
+
+// dev mode keeps objects in memory, seeded with the fixture owner credentials
+func openDevStorage() error {
+	store := storage.NewMemory()
+	creds, err := fixtureFS.ReadFile("fixtures/credentials.json")
+	if err != nil {
+		return err
+	}
+	if err := store.Write(ownerCredentialsObject, creds); err != nil {
+		return err
+	}
+	objects = store
+	return nil
+}
+
+// points the strava client at fixture endpoints served by this process; used
+// by dev mode and alone by the e2e harness, which keeps GCS or its emulator
+func serveFakeStrava(router gin.IRouter, addr string) {
+	// the listen address may name a host such as 0.0.0.0, the fake is always reached on loopback
+	_, port, _ := net.SplitHostPort(addr)
+	base := "http://localhost:" + port + pathPrefix + "/dev/strava"
+	strava.APIBase = base + "/api/v3"
+	strava.OAuthBase = base + "/oauth"
+
+	fake := router.Group("/dev/strava")
+	fake.POST("/oauth/token", postDevToken)
+	fake.POST("/oauth/deauthorize", postDevDeauthorize)
+	fake.GET("/oauth/authorize", getDevAuthorize)
+	fake.GET("/photos/:name", getDevPhotoImage)
+
+	api := fake.Group("/api/v3", requireDevToken)
+	api.GET("/athlete", getDevAthlete)
+	api.GET("/athlete/activities", getDevActivities)
+	api.GET("/athlete/zones", getDevZones)
+	api.GET("/activities/:id", getDevActivity)
+	api.PUT("/activities/:id", putDevActivity)
+	api.GET("/activities/:id/streams", getDevStreams)
+	api.GET("/activities/:id/photos", getDevPhotos(base))
+	api.GET("/segment_efforts", getDevSegmentEfforts)
+	api.GET("/segments/starred", getDevStarredSegments)
+	api.GET("/segments/explore", getDevExploreSegments)
+	api.GET("/segments/:id", getDevSegment)
+	api.PUT("/segments/:id/starred", putDevSegmentStarred)
+	api.POST("/uploads", postDevUpload)
+	api.GET("/uploads/:id", getDevUpload)
+
+	// subscriptions authenticate with the app credentials rather than a token
+	fake.GET("/api/v3/push_subscriptions", requireDevApp, getDevSubscriptions)
+	fake.POST("/api/v3/push_subscriptions", requireDevApp, postDevSubscription)
+	fake.DELETE("/api/v3/push_subscriptions/:id", requireDevApp, deleteDevSubscription)
+}
+
+func devFault(c *gin.Context, status int, message string, field string, code string) {
+	c.JSON(status, strava.Error{Message: message, Errors: []strava.Fault{{Resource: "Application", Field: field, Code: code}}})
+}
+
+func requireDevToken(c *gin.Context) {
+	if c.GetHeader("Authorization") != "Bearer "+devAccessToken {
+		devFault(c, http.StatusUnauthorized, "Authorization Error", "access_token", "invalid")
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+func loadDevActivities() (strava.ActivityList, error) {
+	var activities strava.ActivityList
+	data, err := fixtureFS.ReadFile("fixtures/activities.json")
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &activities)
+	return activities, err
+}
+
+// answers both the refresh_token and authorization_code grants with a fresh token
+func postDevToken(c *gin.Context) {
+	var creds strava.Credentials
+	data, err := fixtureFS.ReadFile("fixtures/credentials.json")
+	if err == nil {
+		err = json.Unmarshal(data, &creds)
+	}
+	if err != nil {
+		devFault(c, http.StatusInternalServerError, "Fixture Error", "credentials", err.Error())
+		return
+	}
+
+	creds.Client_id = 0
+	creds.Client_secret = ""
+	creds.Scope = ""
+	creds.Token_type = "Bearer"
+	creds.Access_token = devAccessToken
+	creds.Expires_in = 6 * 60 * 60
+	creds.Expires_at = time.Now().Unix() + creds.Expires_in
+	c.JSON(http.StatusOK, creds)
+}
+
+func postDevDeauthorize(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"access_token": c.PostForm("access_token")})
+}
+
+// skips the consent screen and sends the browser straight back with a code
+func getDevAuthorize(c *gin.Context) {
+	redirect := c.Query("redirect_uri")
+	if redirect == "" {
+		devFault(c, http.StatusBadRequest, "Bad Request", "redirect_uri", "invalid")
+		return
+	}
+	c.Redirect(http.StatusFound, redirect+"?code=dev-code&scope="+c.Query("scope")+"&state="+c.Query("state"))
+}
+
+func getDevAthlete(c *gin.Context) {
+	data, err := fixtureFS.ReadFile("fixtures/athlete.json")
+	if err != nil {
+		devFault(c, http.StatusInternalServerError, "Fixture Error", "athlete", err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "application/json", data)
+}
+
+// heart rate zones like strava's defaults, and power zones from the fixture's ftp of 230
+func getDevZones(c *gin.Context) {
+	c.JSON(http.StatusOK, strava.Zones{
+		HeartRate: &strava.HeartRateZoneRanges{Zones: []strava.ZoneRange{{Min: 0, Max: 123}, {Min: 123, Max: 153}, {Min: 153, Max: 169}, {Min: 169, Max: 184}, {Min: 184, Max: -1}}},
+		Power:     &strava.PowerZoneRanges{Zones: []strava.ZoneRange{{Min: 0, Max: 127}, {Min: 127, Max: 173}, {Min: 173, Max: 207}, {Min: 207, Max: 242}, {Min: 242, Max: 276}, {Min: 276, Max: 345}, {Min: 345, Max: -1}}},
+	})
+}
+
+// the athlete fixture's bike or shoes, as strava embeds them in the detailed activity
+func devGear(id string) *strava.SummaryGear {
+	var athlete strava.AthleteProfile
+	data, err := fixtureFS.ReadFile("fixtures/athlete.json")
+	if err != nil || id == "" || json.Unmarshal(data, &athlete) != nil {
+		return nil
+	}
+	for _, g := range append(athlete.Bikes, athlete.Shoes...) {
+		if g.Id == id {
+			return &g
+		}
+	}
+	return nil
+}
+
+// honours after, before, page and per_page like the real endpoint, newest first
+func getDevActivities(c *gin.Context) {
+	activities, err := loadDevActivities()
+	if err != nil {
+		devFault(c, http.StatusInternalServerError, "Fixture Error", "activities", err.Error())
+		return
+	}
+
+	after, _ := strconv.ParseInt(c.Query("after"), 10, 64)
+	before, _ := strconv.ParseInt(c.Query("before"), 10, 64)
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "30"))
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = 30
+	}
+
+	matched := []strava.ActivitySummary{}
+	for _, a := range activities {
+		start, err := time.Parse(time.RFC3339, a.StartDate)
+		if err != nil {
+			continue
+		}
+		if after > 0 && start.Unix() <= after {
+			continue
+		}
+		if before > 0 && start.Unix() >= before {
+			continue
+		}
+		matched = append(matched, a)
+	}
+
+	from := (page - 1) * perPage
+	if from > len(matched) {
+		from = len(matched)
+	}
+	to := from + perPage
+	if to > len(matched) {
+		to = len(matched)
+	}
+	c.JSON(http.StatusOK, matched[from:to])
+}
+
+func getDevActivity(c *gin.Context) {
+	activities, err := loadDevActivities()
+	if err != nil {
+		devFault(c, http.StatusInternalServerError, "Fixture Error", "activities", err.Error())
+		return
+	}
+
+	for _, a := range activities {
+		if strconv.FormatInt(a.Id, 10) != c.Param("id") {
+			continue
+		}
+		a.Resource_state = 3
+		detail := strava.ActivityDetailed{ActivitySummary: a}
+		detail.Description = "Fixture activity served in dev mode"
+		detail.Calories = a.Distance / 10
+		detail.DeviceName = "Dev Device"
+		detail.PrivateNote = "Fixture private note, only served with the admin token"
+		detail.SegmentEfforts = []strava.SegmentEffortSummary{}
+		detail.Gear = devGear(a.GearId)
+		c.JSON(http.StatusOK, detail)
+		return
+	}
+	devFault(c, http.StatusNotFound, "Record Not Found", "id", "invalid")
+}
+
+// total_photo_count photos for each fixture, on a url served by the fake
+func getDevPhotos(base string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		activities, err := loadDevActivities()
+		if err != nil {
+			devFault(c, http.StatusInternalServerError, "Fixture Error", "activities", err.Error())
+			return
+		}
+
+		for _, a := range activities {
+			if strconv.FormatInt(a.Id, 10) != c.Param("id") {
+				continue
+			}
+			photos := []strava.Photo{}
+			for i := 0; i < a.TotalPhotoCount; i++ {
+				id := fmt.Sprintf("dev-%d-%d", a.Id, i+1)
+				photos = append(photos, strava.Photo{
+					UniqueId:       id,
+					ActivityId:     a.Id,
+					Caption:        fmt.Sprintf("Fixture photo %d", i+1),
+					Source:         1,
+					CreatedAt:      a.StartDate,
+					CreatedAtLocal: a.StartDateLocal,
+					Urls:           map[string]string{c.DefaultQuery("size", "100"): base + "/photos/" + id + ".jpg"},
+				})
+			}
+			c.JSON(http.StatusOK, photos)
+			return
+		}
+		devFault(c, http.StatusNotFound, "Record Not Found", "id", "invalid")
+	}
+}
+
+// a small grey image, whatever photo is asked for
+func getDevPhotoImage(c *gin.Context) {
+	img := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		devFault(c, http.StatusInternalServerError, "Fixture Error", "photo", err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "image/jpeg", buf.Bytes())
+}
+
+// the update is applied to the reply only, the fixtures stay as they are
+func putDevActivity(c *gin.Context) {
+	var update strava.UpdatableActivity
+	if err := c.ShouldBindJSON(&update); err != nil {
+		devFault(c, http.StatusBadRequest, "Bad Request", "body", "invalid")
+		return
+	}
+
+	activities, err := loadDevActivities()
+	if err != nil {
+		devFault(c, http.StatusInternalServerError, "Fixture Error", "activities", err.Error())
+		return
+	}
+	for _, a := range activities {
+		if strconv.FormatInt(a.Id, 10) != c.Param("id") {
+			continue
+		}
+		if update.Name != nil {
+			a.Name = *update.Name
+		}
+		if update.SportType != nil {
+			a.SportType = *update.SportType
+		}
+		if update.GearId != nil {
+			a.GearId = *update.GearId
+		}
+		if update.Trainer != nil {
+			a.Trainer = *update.Trainer
+		}
+		if update.Commute != nil {
+			a.Commute = *update.Commute
+		}
+		if update.HideFromHome != nil {
+			a.HideFromHome = *update.HideFromHome
+		}
+		a.Resource_state = 3
+		detail := strava.ActivityDetailed{ActivitySummary: a}
+		if update.Description != nil {
+			detail.Description = *update.Description
+		}
+		c.JSON(http.StatusOK, detail)
+		return
+	}
+	devFault(c, http.StatusNotFound, "Record Not Found", "id", "invalid")
+}
+
+func getDevSegmentEfforts(c *gin.Context) {
+	c.JSON(http.StatusOK, []strava.SegmentEffortSummary{})
+}
+
+// the fake's segments, the first starred until changed
+var (
+	devSegmentsMu sync.Mutex
+	devSegments   = []strava.Segment{
+		{Id: 8000000001, Name: "Dev Hill Climb", ActivityType: "Ride", Distance: 2400, AverageGrade: 6.1, MaximumGrade: 11.2, ElevationHigh: 412, ElevationLow: 266, StartLatlng: strava.Location{40.0150, -105.2920}, EndLatlng: strava.Location{40.0001, -105.3012}, ClimbCategory: 2, City: "Boulder", State: "CO", Country: "United States", Starred: true},
+		{Id: 8000000002, Name: "Dev River Path", ActivityType: "Run", Distance: 1609, AverageGrade: 0.2, MaximumGrade: 1.4, ElevationHigh: 1610, ElevationLow: 1604, StartLatlng: strava.Location{40.0176, -105.2797}, EndLatlng: strava.Location{40.0151, -105.2605}, City: "Boulder", State: "CO", Country: "United States"},
+	}
+)
+
+func getDevStarredSegments(c *gin.Context) {
+	devSegmentsMu.Lock()
+	defer devSegmentsMu.Unlock()
+
+	starred := []strava.Segment{}
+	for _, s := range devSegments {
+		if s.Starred {
+			starred = append(starred, s)
+		}
+	}
+	c.JSON(http.StatusOK, starred)
+}
+
+// the fake segments starting within the bounds, latitude first as strava has it
+func getDevExploreSegments(c *gin.Context) {
+	var bounds [4]float64
+	parts := strings.Split(c.Query("bounds"), ",")
+	for i := 0; i < len(parts) && i < 4; i++ {
+		bounds[i], _ = strconv.ParseFloat(parts[i], 64)
+	}
+
+	devSegmentsMu.Lock()
+	defer devSegmentsMu.Unlock()
+
+	sport := map[string]string{"running": "Run", "riding": "Ride"}[c.Query("activity_type")]
+
+	explored := []strava.ExplorerSegment{}
+	for _, s := range devSegments {
+		lat, lng := s.StartLatlng[0], s.StartLatlng[1]
+		if lat < bounds[0] || lat > bounds[2] || lng < bounds[1] || lng > bounds[3] || (sport != "" && s.ActivityType != sport) {
+			continue
+		}
+		explored = append(explored, strava.ExplorerSegment{
+			Id:            s.Id,
+			Name:          s.Name,
+			ClimbCategory: s.ClimbCategory,
+			AverageGrade:  s.AverageGrade,
+			StartLatlng:   s.StartLatlng,
+			EndLatlng:     s.EndLatlng,
+			ElevationDiff: s.ElevationHigh - s.ElevationLow,
+			Distance:      s.Distance,
+			Starred:       s.Starred,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"segments": explored})
+}
+
+func devSegment(c *gin.Context) *strava.Segment {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	for i := range devSegments {
+		if devSegments[i].Id == id {
+			return &devSegments[i]
+		}
+	}
+	devFault(c, http.StatusNotFound, "Record Not Found", "id", "invalid")
+	return nil
+}
+
+func getDevSegment(c *gin.Context) {
+	devSegmentsMu.Lock()
+	defer devSegmentsMu.Unlock()
+
+	if s := devSegment(c); s != nil {
+		c.JSON(http.StatusOK, devSegmentDetail(*s))
+	}
+}
+
+func devSegmentDetail(s strava.Segment) strava.Segment {
+	s.EffortCount, s.AthleteCount, s.StarCount = 5120, 870, 64
+	return s
+}
+
+func putDevSegmentStarred(c *gin.Context) {
+	devSegmentsMu.Lock()
+	defer devSegmentsMu.Unlock()
+
+	if s := devSegment(c); s != nil {
+		s.Starred = c.PostForm("starred") == "true"
+		c.JSON(http.StatusOK, devSegmentDetail(*s))
+	}
+}
+
+// every file becomes the newest fixture activity, processed by the first poll
+const devUploadActivityId = 9000000006
+
+func postDevUpload(c *gin.Context) {
+	if _, err := c.FormFile("file"); err != nil {
+		devFault(c, http.StatusBadRequest, "Bad Request", "file", "empty")
+		return
+	}
+	c.JSON(http.StatusCreated, strava.Upload{Id: 7000000001, IdString: "7000000001", ExternalId: c.PostForm("external_id"), Status: "Your activity is still being processed."})
+}
+
+func getDevUpload(c *gin.Context) {
+	c.JSON(http.StatusOK, strava.Upload{Id: 7000000001, IdString: "7000000001", Status: "Your activity is ready.", ActivityId: devUploadActivityId})
+}
+
+// the fake's one push subscription, nil until created
+var (
+	devSubscriptionMu sync.Mutex
+	devSubscription   *strava.PushSubscription
+)
+
+func requireDevApp(c *gin.Context) {
+	if c.Query("client_secret") != "dev-client-secret" && c.PostForm("client_secret") != "dev-client-secret" {
+		devFault(c, http.StatusUnauthorized, "Authorization Error", "client_secret", "invalid")
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+func getDevSubscriptions(c *gin.Context) {
+	devSubscriptionMu.Lock()
+	defer devSubscriptionMu.Unlock()
+
+	subscriptions := []strava.PushSubscription{}
+	if devSubscription != nil {
+		subscriptions = append(subscriptions, *devSubscription)
+	}
+	c.JSON(http.StatusOK, subscriptions)
+}
+
+// validates the callback like strava, which expects the challenge echoed back
+func postDevSubscription(c *gin.Context) {
+	devSubscriptionMu.Lock()
+	defer devSubscriptionMu.Unlock()
+
+	if devSubscription != nil {
+		devFault(c, http.StatusBadRequest, "Bad Request", "PushSubscription", "already exists")
+		return
+	}
+	callback, err := url.Parse(c.PostForm("callback_url"))
+	if err != nil || callback.Host == "" {
+		devFault(c, http.StatusBadRequest, "Bad Request", "callback url", "invalid")
+		return
+	}
+	callback.RawQuery = url.Values{
+		"hub.mode":         {"subscribe"},
+		"hub.challenge":    {"dev-challenge"},
+		"hub.verify_token": {c.PostForm("verify_token")},
+	}.Encode()
+
+	var echoed struct {
+		Challenge string `json:"hub.challenge"`
+	}
+	res, err := (&http.Client{Timeout: 2 * time.Second}).Get(callback.String())
+	if err == nil {
+		defer res.Body.Close()
+		err = json.NewDecoder(res.Body).Decode(&echoed)
+	}
+	if err != nil || res.StatusCode != http.StatusOK || echoed.Challenge != "dev-challenge" {
+		devFault(c, http.StatusBadRequest, "Bad Request", "callback url", "not verifiable")
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	devSubscription = &strava.PushSubscription{Id: time.Now().Unix(), ResourceState: 2, ApplicationId: 12345, CallbackURL: c.PostForm("callback_url"), CreatedAt: now, UpdatedAt: now}
+	c.JSON(http.StatusCreated, gin.H{"id": devSubscription.Id})
+}
+
+func deleteDevSubscription(c *gin.Context) {
+	devSubscriptionMu.Lock()
+	defer devSubscriptionMu.Unlock()
+
+	if devSubscription == nil || c.Param("id") != strconv.FormatInt(devSubscription.Id, 10) {
+		devFault(c, http.StatusNotFound, "Record Not Found", "id", "invalid")
+		return
+	}
+	devSubscription = nil
+	c.Status(http.StatusNoContent)
+}
+
+func devStream[T any](data []T) *strava.Stream[T] {
+	return &strava.Stream[T]{Data: data, SeriesType: "distance", OriginalSize: len(data), Resolution: "high"}
+}
+
+// a sample every ten seconds around a loop from the start location as long as
+// the activity, shaped like a real recording so charts, track checks and
+// exports have something to show
+func devStreams(a strava.ActivitySummary) strava.StreamSet {
+	const interval = 10
+	const metersPerDegree = 111320
+	n := a.ElapsedTime/interval + 1
+	radius := a.Distance / (2 * math.Pi)
+
+	var (
+		times     []int
+		distances []float64
+		points    []strava.Location
+		altitudes []float64
+		speeds    []float64
+		heartrate []int
+		watts     []int
+		moving    []bool
+		grades    []float64
+	)
+	for i := 0; i < n; i++ {
+		f := float64(i) / float64(n)
+		wave := math.Sin(f * 4 * math.Pi)
+
+		times = append(times, i*interval)
+		distances = append(distances, math.Round(a.Distance*f*10)/10)
+		angle := 2 * math.Pi * f
+		points = append(points, strava.Location{
+			a.StartLocation[0] + radius*math.Sin(angle)/metersPerDegree,
+			a.StartLocation[1] + radius*(1-math.Cos(angle))/(metersPerDegree*math.Cos(a.StartLocation[0]*math.Pi/180)),
+		})
+		altitudes = append(altitudes, math.Round((a.ElevLow+(a.ElevHigh-a.ElevLow)*(0.5+0.5*wave))*10)/10)
+		speeds = append(speeds, math.Round(a.AverageSpeed*(1+0.1*wave)*100)/100)
+		heartrate = append(heartrate, 140+int(15*wave))
+		watts = append(watts, 190+int(40*wave))
+		moving = append(moving, true)
+		grades = append(grades, math.Round(wave*30)/10)
+	}
+
+	streams := strava.StreamSet{
+		Time:           devStream(times),
+		Distance:       devStream(distances),
+		Altitude:       devStream(altitudes),
+		VelocitySmooth: devStream(speeds),
+		Moving:         devStream(moving),
+		GradeSmooth:    devStream(grades),
+	}
+	if a.StartLocation != (strava.Location{}) {
+		streams.LatLng = devStream(points)
+	}
+	if a.HasHeartrate {
+		streams.Heartrate = devStream(heartrate)
+	}
+	if strings.HasSuffix(strava.NormalizeSportType(a.SportType, a.Type), "Ride") {
+		streams.Watts = devStream(watts)
+	}
+	return streams
+}
+
+func getDevStreams(c *gin.Context) {
+	activities, err := loadDevActivities()
+	if err != nil {
+		devFault(c, http.StatusInternalServerError, "Fixture Error", "activities", err.Error())
+		return
+	}
+
+	for _, a := range activities {
+		if strconv.FormatInt(a.Id, 10) == c.Param("id") {
+			c.JSON(http.StatusOK, devStreams(a))
+			return
+		}
+	}
+	devFault(c, http.StatusNotFound, "Record Not Found", "id", "invalid")
+}
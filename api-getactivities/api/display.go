@@ -0,0 +1,66 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/display"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/render"
+)
+
+// DisplayFields are ready to show strings, present when ?locale= is given
+type DisplayFields struct {
+	Distance   string `json:"distance"`
+	Pace       string `json:"pace,omitempty"`
+	Speed      string `json:"speed,omitempty"`
+	MovingTime string `json:"moving_time"`
+	Duration   string `json:"duration"`
+	StartDate  string `json:"start_date,omitempty"`
+	StartTime  string `json:"start_time,omitempty"`
+}
+
+// nil without ?locale=; ?units=metric|imperial overrides the locale's units
+func displayParam(c *gin.Context) (*display.Formatter, error) {
+	locale := c.Query("locale")
+	if locale == "" {
+		return nil, nil
+	}
+	f, err := display.New(locale)
+	if err != nil {
+		return nil, err
+	}
+	if units := c.Query("units"); units != "" {
+		parsed, err := render.ParseUnits(units)
+		if err != nil {
+			return nil, err
+		}
+		f.Metric = parsed == render.Metric
+	}
+	return &f, nil
+}
+
+func addDisplayFields(f *display.Formatter, activities []FinalActivity) {
+	if f == nil {
+		return
+	}
+	for i := range activities {
+		a := &activities[i]
+		fields := DisplayFields{
+			Distance:   f.Distance(a.Distance),
+			Speed:      f.Speed(a.Distance, a.MovingTime),
+			MovingTime: f.Clock(a.MovingTime),
+			Duration:   f.Duration(a.MovingTime),
+		}
+		// pace reads oddly for rides and swims are paced per 100m, so runs and walks only
+		switch a.Type {
+		case "Run", "Walk", "Hike":
+			fields.Pace = f.Pace(a.Distance, a.MovingTime)
+		}
+		if start, err := time.Parse(time.RFC3339, a.StartTime); err == nil {
+			fields.StartDate = f.Date(start)
+			fields.StartTime = f.Time(start)
+		}
+		a.Display = &fields
+	}
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+)
+
+// built exports are kept here so a broken download can be resumed; not owner
+// data, a snapshot must not carry earlier exports
+const exportsPrefix = "exports/"
+
+var exportTTL = time.Duration(env.Int("EXPORT_TTL_HOURS", 24)) * time.Hour
+
+// ExportDownload describes a stored export, its token is the hash of its
+// contents so it doubles as the ETag a resumed download is checked against
+type ExportDownload struct {
+	Token       string `json:"token"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	CreatedAt   string `json:"created_at"`
+	Admin       bool   `json:"admin"` // only resumed through /admin
+}
+
+func exportObject(token string) string {
+	return exportsPrefix + token
+}
+
+func exportMetaObject(token string) string {
+	return exportsPrefix + token + ".json"
+}
+
+func (e ExportDownload) expired(now time.Time) bool {
+	created, err := time.Parse(time.RFC3339, e.CreatedAt)
+	return err != nil || now.Sub(created) > exportTTL
+}
+
+func loadExportDownload(ctx context.Context, token string) (ExportDownload, error) {
+	var download ExportDownload
+
+	slurp, err := readGCSObject(ctx, exportMetaObject(token))
+	if err != nil {
+		return download, err
+	}
+	err = json.Unmarshal(slurp, &download)
+	return download, err
+}
+
+func storeExport(ctx context.Context, download ExportDownload, data []byte) error {
+	if err := putDataToGCS(ctx, exportObject(download.Token), data); err != nil {
+		return err
+	}
+	return storeExportMeta(ctx, download, data)
+}
+
+// the contents are already stored under the token, which is their hash
+func storeExportMeta(ctx context.Context, download ExportDownload, _ []byte) error {
+	bytes_download, err := json.Marshal(download)
+	if err != nil {
+		return err
+	}
+	return putDataToGCS(ctx, exportMetaObject(download.Token), bytes_download)
+}
+
+// drops the exports past EXPORT_TTL_HOURS, run by the worker's housekeeping
+func deleteExpiredExports(ctx context.Context, now time.Time) {
+	objects, err := listGCSObjects(ctx, exportsPrefix)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, object := range objects {
+		if !strings.HasSuffix(object, ".json") {
+			continue
+		}
+		token := strings.TrimSuffix(strings.TrimPrefix(object, exportsPrefix), ".json")
+		if download, err := loadExportDownload(ctx, token); err == nil && !download.expired(now) {
+			continue
+		}
+		for _, o := range []string{exportObject(token), object} {
+			if err := deleteDataFromGCS(ctx, o); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+				fmt.Println(err)
+			}
+		}
+	}
+}
+
+// stores the export under a download token and serves it, honoring Range; the
+// export is still served when it can't be stored, only without a token. An
+// export stored before with the same contents is only given a new expiry
+func serveExport(c *gin.Context, filename string, contentType string, data []byte, admin bool) {
+	ctx := c.Request.Context()
+	sum := sha256.Sum256(data)
+	download := ExportDownload{
+		Token:       hex.EncodeToString(sum[:16]),
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        len(data),
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Admin:       admin,
+	}
+
+	store := storeExport
+	if stored, err := loadExportDownload(ctx, download.Token); err == nil && !stored.expired(time.Now()) && stored.Admin == admin {
+		store = storeExportMeta
+	}
+	if err := store(ctx, download, data); err != nil {
+		fmt.Println(err)
+	} else {
+		c.Header("X-Download-Token", download.Token)
+	}
+	serveExportContent(c, download, data)
+}
+
+func serveExportContent(c *gin.Context, download ExportDownload, data []byte) {
+	created, _ := time.Parse(time.RFC3339, download.CreatedAt)
+
+	c.Header("Content-Type", download.ContentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", download.Filename))
+	c.Header("ETag", `"`+download.Token+`"`)
+	http.ServeContent(c.Writer, c.Request, download.Filename, created, bytes.NewReader(data))
+}
+
+func serveStoredExport(c *gin.Context, admin bool) {
+	ctx := c.Request.Context()
+	token := c.Param("token")
+	download, err := loadExportDownload(ctx, token)
+	if err != nil || download.Admin != admin {
+		if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			fmt.Println(err)
+		}
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "export not found"})
+		return
+	}
+	if download.expired(time.Now()) {
+		c.IndentedJSON(http.StatusGone, gin.H{"error": "export has expired, download it again"})
+		return
+	}
+
+	data, err := readGCSObject(ctx, exportObject(token))
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "export not found"})
+		return
+	}
+	serveExportContent(c, download, data)
+}
+
+// resumes an export downloaded from /strava, such as export.parquet
+func getExportDownload(c *gin.Context) {
+	setCorsHeaders(c)
+	serveStoredExport(c, false)
+}
+
+// resumes an /admin/export snapshot
+func getAdminExportDownload(c *gin.Context) {
+	serveStoredExport(c, true)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/pool"
+)
+
+// the encodings a response can be sent in, chosen by the Accept header
+const (
+	EncodingJSON     = "json"
+	EncodingMsgPack  = "msgpack"
+	EncodingProtobuf = "protobuf" // messages in proto/activities.proto
+)
+
+const MIMEProtobuf = "application/x-protobuf"
+
+var acceptEncodings = map[string]string{
+	"application/json":       EncodingJSON,
+	"application/msgpack":    EncodingMsgPack,
+	"application/x-msgpack":  EncodingMsgPack,
+	"application/protobuf":   EncodingProtobuf,
+	"application/x-protobuf": EncodingProtobuf,
+}
+
+// the first encoding the Accept header lists that the response has, JSON
+// when it lists none of them
+func responseEncoding(c *gin.Context, protobuf bool) string {
+	for _, accept := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		switch encoding := acceptEncodings[mediaType]; {
+		case encoding == EncodingProtobuf && !protobuf:
+			continue
+		case encoding != "":
+			return encoding
+		}
+	}
+	return EncodingJSON
+}
+
+// renders value as JSON or MessagePack, both keyed by the json tags, or as
+// protobuf when the response has a message; errors are always JSON
+func renderEncoded(c *gin.Context, status int, value interface{}, message func() []byte) {
+	switch responseEncoding(c, message != nil) {
+	case EncodingMsgPack:
+		c.Render(status, render.MsgPack{Data: value})
+	case EncodingProtobuf:
+		c.Data(status, MIMEProtobuf, message())
+	default:
+		renderIndentedJSON(c, status, value)
+	}
+}
+
+// c.IndentedJSON through a pooled buffer, these responses being the large
+// activity arrays
+func renderIndentedJSON(c *gin.Context, status int, value interface{}) {
+	buf, err := pool.IndentedJSON(value)
+	if err != nil {
+		c.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	defer pool.PutBuffer(buf)
+	c.Data(status, "application/json; charset=utf-8", buf.Bytes())
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// kudos, comments and photos of the stored activities by ?interval=week, month
+// or year and by sport, with the ?top= most kudoed; ?type= narrows them
+func getEngagement(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	interval := c.DefaultQuery("interval", "month")
+	if !matchesFilter(analysis.EngagementIntervals, interval) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "interval must be week, month or year"})
+		return
+	}
+	top, err := intParam(c, "top", 10, 1, 50)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filters, err := activityTypeFilters(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var activities []strava.ActivitySummary
+	for _, e := range loadActivityIndex(ctx).Entries {
+		if !strava.MatchesActivityType(filters, strava.NormalizeSportType(e.SportType, e.Type)) {
+			continue
+		}
+		if activity, ok := loadActivity(ctx, e.Id); ok {
+			activities = append(activities, activity.ActivitySummary)
+		}
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"data": analysis.SummarizeEngagement(activities, interval, top)})
+}
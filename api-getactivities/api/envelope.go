@@ -0,0 +1,180 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/pool"
+)
+
+const (
+	FormatRaw    = "raw"    // strava shaped snake_case, the default
+	FormatSimple = "simple" // camelCase keys inside a {data, warnings, meta} envelope
+)
+
+// ?format= wins over an Accept profile, e.g. Accept: application/json; profile="simple"
+func responseFormat(c *gin.Context) (string, bool) {
+	format := c.Query("format")
+	if format == "" {
+		for _, accept := range strings.Split(c.GetHeader("Accept"), ",") {
+			if _, params, err := mime.ParseMediaType(strings.TrimSpace(accept)); err == nil && params["profile"] != "" {
+				format = params["profile"]
+				break
+			}
+		}
+	}
+	switch format {
+	case "", FormatRaw:
+		return FormatRaw, true
+	case FormatSimple:
+		return FormatSimple, true
+	}
+	return format, false
+}
+
+// holds a JSON body back so it can be rewritten once the handler is done;
+// any other, such as the ndjson stream, is written as it comes, so a
+// streamed response is never held whole
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer // pooled, only valid until negotiateFormat returns
+
+	decided   bool // by the Content-Type set before the first write
+	streaming bool
+}
+
+func (w *bufferedWriter) buffering() bool {
+	if !w.decided {
+		w.decided = true
+		w.streaming = !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+	}
+	return !w.streaming
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	if !w.buffering() {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	if !w.buffering() {
+		return w.ResponseWriter.WriteString(s)
+	}
+	return w.body.WriteString(s)
+}
+
+// rewrites JSON responses into the requested format, handlers always render the raw shape
+func negotiateFormat(c *gin.Context) {
+	c.Header("Vary", "Accept")
+
+	format, ok := responseFormat(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "format must be raw or simple"})
+		return
+	}
+	if format == FormatRaw {
+		c.Next()
+		return
+	}
+
+	writer := &bufferedWriter{ResponseWriter: c.Writer, body: pool.Buffer()}
+	defer pool.PutBuffer(writer.body)
+	c.Writer = writer
+	c.Next()
+	c.Writer = writer.ResponseWriter
+	if writer.streaming {
+		return
+	}
+
+	body := writer.body.Bytes()
+	if strings.HasPrefix(c.Writer.Header().Get("Content-Type"), "application/json") {
+		if simple, err := simplifyResponse(c.Writer.Status(), body); err == nil {
+			body = simple
+		}
+	}
+	c.Writer.Write(body)
+}
+
+func simplifyResponse(status int, body []byte) ([]byte, error) {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(simpleEnvelope(status, camelizeKeys(value)), "", "    ")
+}
+
+// a payload that already has data keeps it, anything else becomes the data;
+// warnings stay top level and remaining top level keys move into meta
+func simpleEnvelope(status int, value interface{}) map[string]interface{} {
+	envelope := map[string]interface{}{}
+	meta := map[string]interface{}{}
+
+	object, isObject := value.(map[string]interface{})
+	switch {
+	case status >= http.StatusBadRequest:
+		message := ""
+		if isObject {
+			message, _ = object["error"].(string)
+			for k, v := range object {
+				if k != "error" {
+					meta[k] = v
+				}
+			}
+		}
+		envelope["error"] = map[string]interface{}{"status": status, "message": message}
+	case isObject && object["data"] != nil:
+		for k, v := range object {
+			switch k {
+			case "data", "warnings":
+				envelope[k] = v
+			default:
+				meta[k] = v
+			}
+		}
+	default:
+		envelope["data"] = value
+	}
+
+	if len(meta) > 0 {
+		envelope["meta"] = meta
+	}
+	return envelope
+}
+
+func camelizeKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, inner := range v {
+			out[camelCase(k)] = camelizeKeys(inner)
+		}
+		return out
+	case []interface{}:
+		for i, inner := range v {
+			v[i] = camelizeKeys(inner)
+		}
+		return v
+	}
+	return value
+}
+
+// start_date_local becomes startDateLocal, keys without underscores are kept
+func camelCase(key string) string {
+	parts := strings.Split(key, "_")
+	var b strings.Builder
+	b.WriteString(parts[0])
+	for _, p := range parts[1:] {
+		if p == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(p[:1]) + p[1:])
+	}
+	return b.String()
+}
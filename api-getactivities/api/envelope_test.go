@@ -0,0 +1,155 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCamelCase(t *testing.T) {
+	cases := map[string]string{
+		"start_date_local": "startDateLocal",
+		"id":               "id",
+		"sportType":        "sportType",
+		"kudos__count":     "kudosCount",
+		"trailing_":        "trailing",
+		"_leading":         "Leading",
+		"":                 "",
+	}
+	for key, want := range cases {
+		if got := camelCase(key); got != want {
+			t.Errorf("camelCase(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+// the payloads as a handler renders them and as json.Unmarshal reads them back
+func decoded(t *testing.T, body string) interface{} {
+	t.Helper()
+	var value interface{}
+	if err := json.Unmarshal([]byte(body), &value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestCamelizeKeys(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"scalar", `42`, `42`},
+		{"flat", `{"sport_type": "Run", "id": 1}`, `{"sportType": "Run", "id": 1}`},
+		{"nested maps", `{"athlete_stats": {"all_run_totals": {"moving_time": 60}}}`, `{"athleteStats": {"allRunTotals": {"movingTime": 60}}}`},
+		{"arrays of maps", `[{"start_date": "a"}, {"start_date": "b", "best_efforts": [{"pr_rank": 1}]}]`, `[{"startDate": "a"}, {"startDate": "b", "bestEfforts": [{"prRank": 1}]}]`},
+		{"values are kept", `{"split_name": "moving_time", "tags": ["long_run"]}`, `{"splitName": "moving_time", "tags": ["long_run"]}`},
+	}
+	for _, tc := range cases {
+		got := camelizeKeys(decoded(t, tc.in))
+		if want := decoded(t, tc.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: camelizeKeys(%s) = %v, want %v", tc.name, tc.in, got, want)
+		}
+	}
+}
+
+func TestSimpleEnvelope(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+		in     string
+		want   string
+	}{
+		{"array becomes data", http.StatusOK, `[1, 2]`, `{"data": [1, 2]}`},
+		{"object becomes data", http.StatusOK, `{"id": 1}`, `{"data": {"id": 1}}`},
+		{"data and warnings kept, the rest in meta", http.StatusOK,
+			`{"data": [1], "warnings": ["skipped"], "next_cursor": "x", "total": 3}`,
+			`{"data": [1], "warnings": ["skipped"], "meta": {"next_cursor": "x", "total": 3}}`},
+		{"null data is a payload of its own", http.StatusOK, `{"data": null, "total": 0}`, `{"data": {"data": null, "total": 0}}`},
+		{"error", http.StatusNotFound, `{"error": "activity not found"}`, `{"error": {"status": 404, "message": "activity not found"}}`},
+		{"error details in meta", http.StatusConflict,
+			`{"error": "index changed", "retryable": true}`,
+			`{"error": {"status": 409, "message": "index changed"}, "meta": {"retryable": true}}`},
+		{"error without an object", http.StatusBadGateway, `"upstream"`, `{"error": {"status": 502, "message": ""}}`},
+	}
+	for _, tc := range cases {
+		got := simpleEnvelope(tc.status, decoded(t, tc.in))
+		// round tripped so numbers compare as the client sees them
+		data, err := json.Marshal(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := decoded(t, string(data)), decoded(t, tc.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: simpleEnvelope(%d, %s) = %s, want %s", tc.name, tc.status, tc.in, data, tc.want)
+		}
+	}
+}
+
+func TestResponseFormat(t *testing.T) {
+	cases := []struct {
+		name   string
+		query  string
+		accept string
+		want   string
+		ok     bool
+	}{
+		{"default", "", "", FormatRaw, true},
+		{"plain accept", "", "application/json", FormatRaw, true},
+		{"query", "format=simple", "", FormatSimple, true},
+		{"explicit raw", "format=raw", "", FormatRaw, true},
+		{"accept profile", "", `application/json; profile="simple"`, FormatSimple, true},
+		{"first profile listed", "", `text/html, application/json; profile="simple", application/json; profile="raw"`, FormatSimple, true},
+		{"query wins over profile", "format=raw", `application/json; profile="simple"`, FormatRaw, true},
+		{"query wins over profile the other way", "format=simple", `application/json; profile="raw"`, FormatSimple, true},
+		{"unknown query", "format=xml", `application/json; profile="simple"`, "xml", false},
+		{"unknown profile", "", `application/json; profile="compact"`, "compact", false},
+	}
+	gin.SetMode(gin.TestMode)
+	for _, tc := range cases {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/strava/activities?"+tc.query, nil)
+		if tc.accept != "" {
+			c.Request.Header.Set("Accept", tc.accept)
+		}
+		got, ok := responseFormat(c)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("%s: responseFormat = %q, %v, want %q, %v", tc.name, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestSimpleFormatStreams(t *testing.T) {
+	w := httptest.NewRecorder()
+	router := gin.New()
+	router.Use(negotiateFormat)
+	streamed := false
+	router.GET("/activities.ndjson", func(c *gin.Context) {
+		c.Header("Content-Type", ndjsonContentType)
+		c.Writer.WriteString(`{"id": 1, "sport_type": "Run"}` + "\n")
+		c.Writer.Flush()
+		// the first line is out before the handler is done
+		streamed = w.Body.Len() > 0
+		c.Writer.WriteString(`{"id": 2, "sport_type": "Ride"}` + "\n")
+	})
+	router.GET("/activities", func(c *gin.Context) {
+		c.IndentedJSON(http.StatusOK, []gin.H{{"sport_type": "Run"}})
+	})
+
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/activities.ndjson?format=simple", nil))
+	if !streamed {
+		t.Error("format=simple held the ndjson stream back")
+	}
+	if want := `{"id": 1, "sport_type": "Run"}` + "\n" + `{"id": 2, "sport_type": "Ride"}` + "\n"; w.Body.String() != want {
+		t.Errorf("ndjson with format=simple = %q, want it unchanged %q", w.Body.String(), want)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/activities?format=simple", nil))
+	if got, want := decoded(t, w.Body.String()), decoded(t, `{"data": [{"sportType": "Run"}]}`); !reflect.DeepEqual(got, want) {
+		t.Errorf("json with format=simple = %s", w.Body)
+	}
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/bus"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+)
+
+const (
+	EventActivityCreated = "activity.created"
+	EventActivityUpdated = "activity.updated"
+	EventActivityDeleted = "activity.deleted"
+)
+
+// ActivityEvent is the body of each published message, its type and source are
+// repeated as message attributes for subscription filters
+type ActivityEvent struct {
+	Type       string            `json:"type"`
+	ActivityId int64             `json:"activity_id"`
+	OwnerId    int64             `json:"owner_id,omitempty"`
+	Name       string            `json:"name,omitempty"`
+	OldName    string            `json:"old_name,omitempty"`
+	Updates    map[string]string `json:"updates,omitempty"`
+	Source     string            `json:"source"`
+	Timestamp  string            `json:"timestamp"`
+}
+
+// nil unless PUBSUB_TOPIC is set, or in dev mode where events are printed
+var publisher bus.Publisher
+
+func openPublisher(cfg Config) error {
+	if cfg.Dev {
+		publisher = bus.Log{}
+		return nil
+	}
+	topic := os.Getenv("PUBSUB_TOPIC")
+	if topic == "" {
+		return nil
+	}
+	pubsub, err := bus.NewPubSub(topic, time.Duration(env.Int("PUBSUB_TIMEOUT_SECONDS", 10))*time.Second)
+	if err != nil {
+		return err
+	}
+	publisher = pubsub
+	return nil
+}
+
+var changeEventTypes = map[string]string{
+	ChangeCreated: EventActivityCreated,
+	ChangeRenamed: EventActivityUpdated,
+	ChangeDeleted: EventActivityDeleted,
+	ChangeUpdated: EventActivityUpdated,
+}
+
+func publishEvents(events []ActivityEvent) error {
+	if publisher == nil || len(events) == 0 {
+		return nil
+	}
+
+	var messages []bus.Message
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		messages = append(messages, bus.Message{Data: data, Attributes: map[string]string{
+			"type":        e.Type,
+			"source":      e.Source,
+			"activity_id": strconv.FormatInt(e.ActivityId, 10),
+		}})
+	}
+	return publisher.Publish(messages)
+}
+
+func publishChangeSet(set ChangeSet) {
+	var events []ActivityEvent
+	for _, change := range set.Changes {
+		events = append(events, ActivityEvent{
+			Type:       changeEventTypes[change.Kind],
+			ActivityId: change.ActivityId,
+			Name:       change.NewName,
+			OldName:    change.OldName,
+			Source:     set.Source,
+			Timestamp:  set.Timestamp,
+		})
+	}
+	// the changelog is the record of what was ingested, so a failed publish is
+	// logged rather than failing the sync that stored the changes
+	if err := publishEvents(events); err != nil {
+		fmt.Println("publishing activity events:", err)
+	}
+}
+
+// webhook activity events are passed on as strava sent them, the next sync stores the change
+func publishWebhookEvent(event WebhookEvent) error {
+	eventType, ok := map[string]string{"create": EventActivityCreated, "update": EventActivityUpdated, "delete": EventActivityDeleted}[event.AspectType]
+	if event.ObjectType != "activity" || !ok {
+		return nil
+	}
+	return publishEvents([]ActivityEvent{{
+		Type:       eventType,
+		ActivityId: event.ObjectId,
+		OwnerId:    event.OwnerId,
+		Name:       event.Updates["title"],
+		Updates:    event.Updates,
+		Source:     "webhook",
+		Timestamp:  time.Unix(event.EventTime, 0).UTC().Format(time.RFC3339),
+	}})
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// the detail sections ?expand= can ask for
+const (
+	ExpandSplits         = "splits" // splits_metric and splits_standard
+	ExpandBestEfforts    = "best_efforts"
+	ExpandGear           = "gear"
+	ExpandSegmentEfforts = "segment_efforts"
+)
+
+var expandSections = []string{ExpandSplits, ExpandBestEfforts, ExpandGear, ExpandSegmentEfforts}
+
+// ?expand=splits,gear as a set, nil without the parameter, when activities are
+// served as they are stored. An empty ?expand= asks for no sections at all
+func expandParam(c *gin.Context) (map[string]bool, error) {
+	value, ok := c.GetQuery("expand")
+	if !ok {
+		return nil, nil
+	}
+
+	expand := make(map[string]bool)
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		known := false
+		for _, section := range expandSections {
+			known = known || s == section
+		}
+		if !known {
+			return nil, fmt.Errorf("expand must be a comma separated list of %s", strings.Join(expandSections, ", "))
+		}
+		expand[s] = true
+	}
+	return expand, nil
+}
+
+// whether the stored activity is missing a section that is asked for, so it
+// has to be fetched from strava again. Activities stored before gear and
+// segment efforts were kept have neither
+func missingSections(activity strava.ActivityDetailed, expand map[string]bool) bool {
+	detailed := activity.Resource_state == 3
+	switch {
+	case (expand[ExpandSplits] || expand[ExpandBestEfforts]) && !detailed:
+		return true
+	case expand[ExpandGear] && activity.GearId != "" && activity.Gear == nil:
+		return true
+	case expand[ExpandSegmentEfforts] && activity.SegmentEfforts == nil:
+		return true
+	}
+	return false
+}
+
+// the activity with only the sections asked for, all of them without ?expand=
+func expandActivity(activity strava.ActivityDetailed, expand map[string]bool) strava.ActivityDetailed {
+	if expand == nil {
+		return activity
+	}
+	if !expand[ExpandSplits] {
+		activity.SplitsMetric = nil
+		activity.SplitsStandard = nil
+	}
+	if !expand[ExpandBestEfforts] {
+		activity.BestEfforts = nil
+	}
+	if !expand[ExpandGear] {
+		activity.Gear = nil
+	}
+	if !expand[ExpandSegmentEfforts] {
+		activity.SegmentEfforts = nil
+	}
+	return activity
+}
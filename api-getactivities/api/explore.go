@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// explored areas are kept for the map so panning back and forth costs no
+// strava calls; not owner data, a snapshot leaves them out
+const explorePrefix = "explore/"
+
+var exploreTTL = time.Duration(env.Int("EXPLORE_CACHE_HOURS", 24)) * time.Hour
+
+// bounds are rounded to about 100 meters, so nearly the same view is one cached area
+const exploreBoundsDecimals = 3
+
+type ExploredArea struct {
+	FetchedAt string                   `json:"fetched_at"`
+	Segments  []strava.ExplorerSegment `json:"segments"`
+}
+
+// ?bounds=south,west,north,east in degrees, ?activity_type=running or riding,
+// and ?min_cat= and ?max_cat= from 0 to 5
+func exploreParams(c *gin.Context) (strava.ExploreParams, error) {
+	var params strava.ExploreParams
+
+	parts := strings.Split(c.Query("bounds"), ",")
+	if len(parts) != 4 {
+		return params, fmt.Errorf("bounds must be south,west,north,east latitudes and longitudes")
+	}
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return params, fmt.Errorf("bounds must be south,west,north,east latitudes and longitudes")
+		}
+		params.Bounds[i] = roundTo(value, exploreBoundsDecimals)
+	}
+	south, west, north, east := params.Bounds[0], params.Bounds[1], params.Bounds[2], params.Bounds[3]
+	if south < -90 || north > 90 || west < -180 || east > 180 || south >= north || west >= east {
+		return params, fmt.Errorf("bounds must have south below north and west of east, within -90 to 90 and -180 to 180")
+	}
+
+	params.ActivityType = c.Query("activity_type")
+	if params.ActivityType != "" && params.ActivityType != "running" && params.ActivityType != "riding" {
+		return params, fmt.Errorf("activity_type must be running or riding")
+	}
+	for _, cat := range []struct {
+		name  string
+		value *int
+	}{{"min_cat", &params.MinCategory}, {"max_cat", &params.MaxCategory}} {
+		raw := c.Query(cat.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > 5 {
+			return params, fmt.Errorf("%s must be from 0 to 5", cat.name)
+		}
+		*cat.value = n
+	}
+	return params, nil
+}
+
+func roundTo(value float64, decimals int) float64 {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(value, 'f', decimals, 64), 64)
+	return rounded
+}
+
+// one object per rounded query
+func exploreObject(params strava.ExploreParams) string {
+	key := fmt.Sprintf("%v|%s|%d|%d", params.Bounds, params.ActivityType, params.MinCategory, params.MaxCategory)
+	sum := sha256.Sum256([]byte(key))
+	return explorePrefix + hex.EncodeToString(sum[:16]) + ".json"
+}
+
+func loadExploredArea(ctx context.Context, object string) (ExploredArea, bool) {
+	var area ExploredArea
+
+	slurp := getDataFromGCS(ctx, object)
+	if slurp == nil {
+		return area, false
+	}
+	if err := json.Unmarshal(slurp, &area); err != nil {
+		fmt.Println(err)
+		return area, false
+	}
+	return area, true
+}
+
+// the most popular segments in the bounds, from storage while younger than
+// EXPLORE_CACHE_HOURS; an older copy is still served when strava fails
+func getExploreSegments(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	params, err := exploreParams(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	object := exploreObject(params)
+	stored, ok := loadExploredArea(ctx, object)
+	if ok {
+		fetched, err := time.Parse(time.RFC3339, stored.FetchedAt)
+		if err == nil && time.Since(fetched) < exploreTTL {
+			c.IndentedJSON(http.StatusOK, gin.H{"bounds": params.Bounds, "fetched_at": stored.FetchedAt, "data": stored.Segments})
+			return
+		}
+	}
+
+	client := stravaClient(c)
+	access_token, err := getAccessToken(ctx, client)
+	if err == nil {
+		var segments []strava.ExplorerSegment
+		segments, err = strava.ExploreSegments(client, access_token, params)
+		if err == nil {
+			area := ExploredArea{FetchedAt: time.Now().UTC().Format(time.RFC3339), Segments: segments}
+			if bytes_area, err := json.Marshal(area); err == nil {
+				if err := putDataToGCS(ctx, object, bytes_area); err != nil {
+					fmt.Println(err)
+				}
+			}
+			c.IndentedJSON(http.StatusOK, gin.H{"bounds": params.Bounds, "fetched_at": area.FetchedAt, "data": area.Segments})
+			return
+		}
+	}
+	if ok && !timedOut(c) {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusOK, gin.H{"bounds": params.Bounds, "fetched_at": stored.FetchedAt, "data": stored.Segments, "warnings": []string{"strava is unavailable, these segments may be out of date"}})
+		return
+	}
+	respondUpstreamError(c, "unable to explore segments on strava", err)
+}
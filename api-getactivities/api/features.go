@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/apiversion"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// answers 410 Gone for endpoints built on a strava feature this deployment has switched off
+func requireFeature(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !apiversion.Enabled(name) {
+			setCorsHeaders(c)
+			c.AbortWithStatusJSON(http.StatusGone, gin.H{"error": "not available, the strava feature is switched off", "feature": name})
+			return
+		}
+		c.Next()
+	}
+}
+
+// drops the fields of switched off features, activities stored while one was
+// on are served the same as ones stored without it
+func versionedActivity(activity strava.ActivityDetailed) strava.ActivityDetailed {
+	if !apiversion.Enabled(apiversion.PerceivedExertion) {
+		activity.PerceivedExertion = nil
+	}
+	return activity
+}
+
+func getAdminFeatures(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, gin.H{"version": apiversion.Version, "features": apiversion.Features()})
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// ?type=Ride,TrailRun, either enum is accepted
+func activityTypeFilters(c *gin.Context) ([]string, error) {
+	raw := c.Query("type")
+	if raw == "" {
+		return nil, nil
+	}
+	return strava.ParseSportTypes(raw)
+}
+
+// ?platform=zwift,rouvy
+func platformFilters(c *gin.Context) ([]string, error) {
+	raw := c.Query("platform")
+	if raw == "" {
+		return nil, nil
+	}
+	var platforms []string
+	for _, p := range strings.Split(raw, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if !matchesFilter(analysis.Platforms, p) {
+			return nil, fmt.Errorf("unknown platform %q, platforms are %s", p, strings.Join(analysis.Platforms, ","))
+		}
+		platforms = append(platforms, p)
+	}
+	return platforms, nil
+}
+
+// no filters match every value
+func matchesFilter(filters []string, platform string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, f := range filters {
+		if f == platform {
+			return true
+		}
+	}
+	return false
+}
+
+// the visibility values strava uses
+const (
+	VisibilityEveryone      = "everyone"
+	VisibilityFollowersOnly = "followers_only"
+	VisibilityOnlyMe        = "only_me"
+)
+
+var visibilities = []string{VisibilityEveryone, VisibilityFollowersOnly, VisibilityOnlyMe}
+
+// ?visibility=everyone,followers_only and ?hidden=true|false, hidden being
+// strava's hide_from_home
+type visibilityFilter struct {
+	visibilities []string
+	hidden       *bool
+}
+
+func visibilityFilters(c *gin.Context) (visibilityFilter, error) {
+	var filter visibilityFilter
+	if raw := c.Query("visibility"); raw != "" {
+		for _, v := range strings.Split(raw, ",") {
+			v = strings.ToLower(strings.TrimSpace(v))
+			if !matchesFilter(visibilities, v) {
+				return filter, fmt.Errorf("unknown visibility %q, visibilities are %s", v, strings.Join(visibilities, ","))
+			}
+			filter.visibilities = append(filter.visibilities, v)
+		}
+	}
+	if raw := c.Query("hidden"); raw != "" {
+		hidden, err := strconv.ParseBool(raw)
+		if err != nil {
+			return filter, errors.New("hidden must be true or false")
+		}
+		filter.hidden = &hidden
+	}
+	return filter, nil
+}
+
+// an empty visibility, from before it was stored, is unknown and matches no
+// visibility filter; a public page asking for everyone must not get private ones
+func (f visibilityFilter) matches(visibility string, hidden bool) bool {
+	if f.hidden != nil && *f.hidden != hidden {
+		return false
+	}
+	return len(f.visibilities) == 0 || matchesFilter(f.visibilities, visibility)
+}
+
+// strava only sends visibility on newer activities, private ones are only_me
+func activityVisibility(a strava.ActivitySummary) string {
+	switch {
+	case a.Visibility != "":
+		return a.Visibility
+	case a.Private:
+		return VisibilityOnlyMe
+	}
+	return VisibilityEveryone
+}
+
+// the private note is the athlete's own, only requests with the admin token see it
+func redactActivity(c *gin.Context, activity strava.ActivityDetailed) strava.ActivityDetailed {
+	if !isAdminRequest(c) {
+		activity.PrivateNote = ""
+	}
+	return activity
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/apiversion"
+)
+
+// strava only has the current counts, so each sync keeps them to chart growth
+const followersObject = "athlete/followers.json"
+
+// FollowerCount is the athlete's counts on a day, the last sync's of that day
+type FollowerCount struct {
+	Date       string `json:"date"` // the athlete's day
+	Followers  int    `json:"followers"`
+	Friends    int    `json:"friends"` // athletes followed
+	RecordedAt string `json:"recorded_at"`
+}
+
+type FollowerHistory struct {
+	Counts []FollowerCount `json:"counts"` // oldest first
+}
+
+// FollowerGrowth is a day's counts and how they changed since the day before it
+type FollowerGrowth struct {
+	FollowerCount
+	FollowersDelta int `json:"followers_delta"`
+	FriendsDelta   int `json:"friends_delta"`
+}
+
+// the history is read-modify-written so concurrent syncs are serialized
+var followersMu sync.Mutex
+
+func loadFollowerHistory(ctx context.Context) FollowerHistory {
+	history := FollowerHistory{Counts: []FollowerCount{}}
+
+	slurp := getDataFromGCS(ctx, followersObject)
+	if slurp == nil {
+		return history
+	}
+	if err := json.Unmarshal(slurp, &history); err != nil {
+		fmt.Println(err)
+	}
+	return history
+}
+
+// run after an activity sync; a day keeps only its last counts
+func recordFollowerCounts(ctx context.Context, client *http.Client, access_token string) {
+	if !apiversion.Enabled(apiversion.FollowerCounts) {
+		return
+	}
+	profile, err := fetchAthleteProfile(client, access_token)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if profile.FollowerCount == nil || profile.FriendCount == nil {
+		return
+	}
+
+	now := time.Now()
+	count := FollowerCount{
+		Date:       now.In(defaultAthleteZone(ctx)).Format("2006-01-02"),
+		Followers:  *profile.FollowerCount,
+		Friends:    *profile.FriendCount,
+		RecordedAt: now.UTC().Format(time.RFC3339),
+	}
+
+	followersMu.Lock()
+	defer followersMu.Unlock()
+
+	history := loadFollowerHistory(ctx)
+	if n := len(history.Counts); n > 0 && history.Counts[n-1].Date == count.Date {
+		history.Counts[n-1] = count
+	} else {
+		history.Counts = append(history.Counts, count)
+	}
+	bytes_history, err := json.Marshal(history)
+	if err == nil {
+		err = putDataToGCS(ctx, followersObject, bytes_history)
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// the recorded counts between ?from= and ?to=, each with its change since the
+// recorded day before it, and the change over the range, from the recorded day
+// before it when there is one
+func getFollowers(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	from, to, err := planRange(c, "", "")
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	growth := []FollowerGrowth{}
+	var previous *FollowerCount
+	for _, count := range loadFollowerHistory(ctx).Counts {
+		count := count
+		if (from == "" || count.Date >= from) && (to == "" || count.Date <= to) {
+			g := FollowerGrowth{FollowerCount: count}
+			if previous != nil {
+				g.FollowersDelta = count.Followers - previous.Followers
+				g.FriendsDelta = count.Friends - previous.Friends
+			}
+			growth = append(growth, g)
+		}
+		previous = &count
+	}
+
+	total := gin.H{"followers": 0, "friends": 0}
+	if n := len(growth); n > 0 {
+		first, last := growth[0], growth[n-1]
+		total["followers"] = last.Followers - first.Followers + first.FollowersDelta
+		total["friends"] = last.Friends - first.Friends + first.FriendsDelta
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"from": from, "to": to, "data": growth, "growth": total})
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/cache"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+)
+
+// GCS_BUCKET or the -bucket flag of the snapshot commands point the service at
+// another bucket; {env} and {tenant} in it are replaced, for a bucket per tenant
+var bucketName = env.String("GCS_BUCKET", "personal-website-35-stava-api-prod")
+
+// STORAGE_ENV and STORAGE_TENANT, e.g. staging and 12345, keep every object
+// under staging/12345/ so environments and tenants can share a bucket; with
+// neither set objects are at the bucket root
+var (
+	storageEnv    = os.Getenv("STORAGE_ENV")
+	storageTenant = os.Getenv("STORAGE_TENANT")
+	storagePrefix string
+)
+
+// STORAGE_COMPRESSION=gzip stores the JSON objects of at least
+// STORAGE_COMPRESS_MIN_BYTES, default 1024, gzip-compressed; objects are read
+// either way, so it can be switched on and off at any time
+var (
+	storageCompression = os.Getenv("STORAGE_COMPRESSION")
+	compressMinBytes   = env.Int("STORAGE_COMPRESS_MIN_BYTES", 1024)
+)
+
+var gcsTimeout = time.Duration(env.Int("GCS_TIMEOUT_SECONDS", 10)) * time.Second
+
+// chosen by OpenStorage before any request is served
+var objects storage.ObjectStore
+
+// CACHE_MAX_MB bounds the object contents kept in memory, streams can be large
+var cacheMaxBytes = int64(env.Int("CACHE_MAX_MB", 64)) << 20
+
+// what GCS reads are served from, replaced with the bucket; nil in dev mode
+var objectCache *cache.GenerationCache
+
+// created once by OpenStorage and shared by every request
+var gcsClient *gcs.Client
+
+// points objects at bucket, used again by the snapshot commands when -bucket is given
+func useBucket(bucket string) {
+	bucketName = strings.NewReplacer("{env}", storageEnv, "{tenant}", storageTenant).Replace(bucket)
+	objectCache = cache.NewLimited(cacheMaxBytes)
+	store := storage.NewGCSCached(gcsClient, bucketName, gcsTimeout, objectCache)
+	if storageCompression == storage.EncodingGzip {
+		store.CompressJSON(compressMinBytes)
+	}
+	if cacheTrusted() {
+		// peers announce what they write, see openInvalidation
+		store.TrustCache(cacheTrust)
+	}
+	objects = store
+	if storagePrefix != "" {
+		objects = storage.NewNamespaced(objects, storagePrefix)
+	}
+}
+
+// sets the namespace useBucket applies, the snapshot commands use it to move
+// data between environments
+func useNamespace(environment string, tenant string) error {
+	prefix, err := storage.Namespace(environment, tenant)
+	if err != nil {
+		return err
+	}
+	storageEnv, storageTenant, storagePrefix = environment, tenant, prefix
+	return nil
+}
+
+func getDataFromGCS(ctx context.Context, object string) []byte {
+	slurp, err := readGCSObject(ctx, object)
+	if err != nil {
+		fmt.Println(object, err)
+		return nil
+	}
+	return slurp
+}
+
+// like getDataFromGCS but reports why nothing was read, storage.ErrObjectNotExist
+// for a missing object, so callers can degrade per object
+func readGCSObject(ctx context.Context, object string) ([]byte, error) {
+	if objects == nil {
+		return nil, storage.ErrNoStorage
+	}
+	return objects.WithContext(ctx).Read(object)
+}
+
+// getDataFromGCS decoded into v, a StreamDecoder as the object is read,
+// false when it could not be read or decoded
+func decodeDataFromGCS(ctx context.Context, object string, v interface{}) bool {
+	if err := decodeGCSObject(ctx, object, v); err != nil {
+		fmt.Println(object, err)
+		return false
+	}
+	return true
+}
+
+// like decodeDataFromGCS but reports why nothing was decoded,
+// storage.ErrObjectNotExist for a missing object
+func decodeGCSObject(ctx context.Context, object string, v interface{}) error {
+	if objects == nil {
+		return storage.ErrNoStorage
+	}
+	return objects.WithContext(ctx).Decode(object, v)
+}
+
+// readGCSObject with the generation read, for the IfGeneration writes
+func readGCSObjectGeneration(ctx context.Context, object string) ([]byte, int64, error) {
+	if objects == nil {
+		return nil, 0, storage.ErrNoStorage
+	}
+	return objects.WithContext(ctx).ReadGeneration(object)
+}
+
+func putDataToGCS(ctx context.Context, object string, data []byte) error {
+	if objects == nil {
+		return storage.ErrNoStorage
+	}
+	err := objects.WithContext(ctx).Write(object, data)
+	if err == nil {
+		invalidate(object)
+	}
+	return err
+}
+
+// putDataToGCS only when object is still at generation, 0 when it must not
+// exist yet, returning the generation written; storage.ErrConflict when
+// another writer got there first
+func putDataToGCSIf(ctx context.Context, object string, data []byte, generation int64) (int64, error) {
+	if objects == nil {
+		return 0, storage.ErrNoStorage
+	}
+	written, err := objects.WithContext(ctx).WriteIfGeneration(object, data, generation)
+	if err == nil {
+		invalidate(object)
+	}
+	return written, err
+}
+
+func deleteDataFromGCS(ctx context.Context, object string) error {
+	if objects == nil {
+		return storage.ErrNoStorage
+	}
+	err := objects.WithContext(ctx).Delete(object)
+	if err == nil {
+		invalidate(object)
+	}
+	return err
+}
+
+func listGCSObjects(ctx context.Context, prefix string) ([]string, error) {
+	if objects == nil {
+		return nil, storage.ErrNoStorage
+	}
+	return objects.WithContext(ctx).List(prefix)
+}
+
+func listGCSObjectSizes(ctx context.Context, prefix string) (map[string]int64, error) {
+	if objects == nil {
+		return nil, storage.ErrNoStorage
+	}
+	return objects.WithContext(ctx).ListSizes(prefix)
+}
+
+// deleteDataFromGCS only when object is still at generation, storage.ErrConflict otherwise
+func deleteDataFromGCSIf(ctx context.Context, object string, generation int64) error {
+	if objects == nil {
+		return storage.ErrNoStorage
+	}
+	err := objects.WithContext(ctx).DeleteIfGeneration(object, generation)
+	if err == nil {
+		invalidate(object)
+	}
+	return err
+}
+
+func verifyGCSObject(ctx context.Context, object string) error {
+	if objects == nil {
+		return storage.ErrNoStorage
+	}
+	return objects.WithContext(ctx).Verify(object)
+}
+
+func gcsObjectExists(ctx context.Context, object string) (bool, error) {
+	if objects == nil {
+		return false, storage.ErrNoStorage
+	}
+	return objects.WithContext(ctx).Exists(object)
+}
+
+func copyGCSObject(ctx context.Context, src string, dst string) error {
+	if objects == nil {
+		return storage.ErrNoStorage
+	}
+	err := objects.WithContext(ctx).Copy(src, dst)
+	if err == nil {
+		invalidate(dst)
+	}
+	return err
+}
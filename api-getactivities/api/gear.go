@@ -0,0 +1,287 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+const (
+	gearPrefix        = "gear/"
+	maintenanceObject = gearPrefix + "maintenance.json"
+)
+
+// strava's gear ids, b for bikes and g for shoes
+var gearIdPattern = regexp.MustCompile(`^[bg][0-9]+$`)
+
+var componentName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+const maxMaintenanceNotes = 1000
+
+var errRecordNotFound = errors.New("maintenance record not found")
+
+// GEAR_ALERT_KM is a comma separated list of component=kilometers, such as
+// chain=3000,tires=5000,shoes=700; a component is due once it has been used
+// that far since its last maintenance record
+var gearAlerts = parseGearAlerts(os.Getenv("GEAR_ALERT_KM"))
+
+func parseGearAlerts(spec string) map[string]float64 {
+	alerts := make(map[string]float64)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		component, value, ok := strings.Cut(entry, "=")
+		km, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !ok || err != nil || km <= 0 {
+			fmt.Println("GEAR_ALERT_KM: ignoring", entry)
+			continue
+		}
+		alerts[strings.TrimSpace(component)] = km
+	}
+	return alerts
+}
+
+type MaintenanceStore struct {
+	NextId  int64                        `json:"next_id"`
+	Records []analysis.MaintenanceRecord `json:"records"`
+}
+
+// the log is read-modify-written so updates from concurrent handlers are serialized
+var maintenanceMu sync.Mutex
+
+func loadMaintenance(ctx context.Context) MaintenanceStore {
+	store := MaintenanceStore{NextId: 1}
+
+	slurp := getDataFromGCS(ctx, maintenanceObject)
+	if slurp == nil {
+		return store
+	}
+	if err := json.Unmarshal(slurp, &store); err != nil {
+		fmt.Println(err)
+	}
+	return store
+}
+
+func updateMaintenance(ctx context.Context, change func(store *MaintenanceStore) error) error {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+
+	store := loadMaintenance(ctx)
+	if err := change(&store); err != nil {
+		return err
+	}
+
+	bytes_store, err := json.Marshal(store)
+	if err != nil {
+		return err
+	}
+	return putDataToGCS(ctx, maintenanceObject, bytes_store)
+}
+
+func gearParam(c *gin.Context) (string, error) {
+	id := c.Param("id")
+	if !gearIdPattern.MatchString(id) {
+		return "", fmt.Errorf("gear id must be a strava gear id such as b1234 or g5678")
+	}
+	return id, nil
+}
+
+func recordId(c *gin.Context) (int64, error) {
+	id, err := strconv.ParseInt(c.Param("record"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("record id must be numeric")
+	}
+	return id, nil
+}
+
+func bindMaintenance(c *gin.Context) (analysis.MaintenanceRecord, error) {
+	var record analysis.MaintenanceRecord
+	if err := c.ShouldBindJSON(&record); err != nil {
+		return record, fmt.Errorf("body must be a JSON maintenance record")
+	}
+	if _, err := time.Parse("2006-01-02", record.Date); err != nil {
+		return record, fmt.Errorf("date must be formatted YYYY-MM-DD")
+	}
+	record.Component = strings.ToLower(strings.TrimSpace(record.Component))
+	if !componentName.MatchString(record.Component) {
+		return record, fmt.Errorf("component must be lowercase letters, digits, _ and -, such as chain")
+	}
+	record.Notes = strings.TrimSpace(record.Notes)
+	if len(record.Notes) > maxMaintenanceNotes {
+		return record, fmt.Errorf("notes must be at most %d characters", maxMaintenanceNotes)
+	}
+	return record, nil
+}
+
+// each bike and pair of shoes of the stored activities or the log, with its
+// components' use since they were serviced
+func getGear(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	var activities []strava.ActivitySummary
+	for _, e := range loadActivityIndex(ctx).Entries {
+		if activity, ok := loadActivity(ctx, e.Id); ok {
+			activities = append(activities, activity.ActivitySummary)
+		}
+	}
+	usage := analysis.GearUsage(activities, loadMaintenance(ctx).Records, gearAlerts)
+
+	due := []gin.H{}
+	if len(usage) > 0 {
+		names := gearNames(ctx)
+		for i := range usage {
+			usage[i].Name = names[usage[i].Id]
+			for _, component := range usage[i].Components {
+				if component.Due {
+					due = append(due, gin.H{"gear_id": usage[i].Id, "component": component.Component})
+				}
+			}
+		}
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"data": usage, "due": due})
+}
+
+func getGearMaintenance(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	gearId, err := gearParam(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	records := []analysis.MaintenanceRecord{}
+	for _, r := range loadMaintenance(ctx).Records {
+		if r.GearId == gearId {
+			records = append(records, r)
+		}
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"gear_id": gearId, "data": records})
+}
+
+func postGearMaintenance(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	gearId, err := gearParam(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	record, err := bindMaintenance(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	record.GearId = gearId
+
+	err = updateMaintenance(ctx, func(store *MaintenanceStore) error {
+		record.Id = store.NextId
+		store.NextId++
+		store.Records = append(store.Records, record)
+		return nil
+	})
+	recordAudit(AuditMaintenanceCreate, adminActor(c), gearId, err, map[string]interface{}{"id": record.Id, "component": record.Component, "date": record.Date})
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to store maintenance record"})
+		return
+	}
+	c.IndentedJSON(http.StatusCreated, record)
+}
+
+func putGearMaintenance(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	gearId, err := gearParam(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, err := recordId(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	record, err := bindMaintenance(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	record.Id, record.GearId = id, gearId
+
+	err = updateMaintenance(ctx, func(store *MaintenanceStore) error {
+		for i := range store.Records {
+			if store.Records[i].Id == id && store.Records[i].GearId == gearId {
+				store.Records[i] = record
+				return nil
+			}
+		}
+		return errRecordNotFound
+	})
+	recordAudit(AuditMaintenanceUpdate, adminActor(c), gearId, err, map[string]interface{}{"id": id, "component": record.Component, "date": record.Date})
+	if err == errRecordNotFound {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to store maintenance record"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, record)
+}
+
+func deleteGearMaintenance(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	gearId, err := gearParam(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, err := recordId(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = updateMaintenance(ctx, func(store *MaintenanceStore) error {
+		for i := range store.Records {
+			if store.Records[i].Id == id && store.Records[i].GearId == gearId {
+				store.Records = append(store.Records[:i], store.Records[i+1:]...)
+				return nil
+			}
+		}
+		return errRecordNotFound
+	})
+	recordAudit(AuditMaintenanceDelete, adminActor(c), gearId, err, map[string]interface{}{"id": id})
+	if err == errRecordNotFound {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to delete maintenance record"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"id": id, "deleted": true})
+}
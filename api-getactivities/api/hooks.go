@@ -0,0 +1,111 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Hooks let programs embedding the API extend every endpoint without forking
+// it. Before handlers run ahead of the API's own, rate limiting and auth
+// included, and may abort, e.g. to check their own credentials or to add
+// headers. After hooks run once the endpoint has finished, in order, and may
+// change its status, headers or body before anything is sent
+type Hooks struct {
+	Before []gin.HandlerFunc
+	After  []AfterHook
+}
+
+type AfterHook func(c *gin.Context, res *Response)
+
+// Response is what an endpoint wrote, held back until the After hooks ran;
+// Header is the response's own, changes to it are sent
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// holds the response back for the After hooks; streamed responses such as
+// exports are only sent once complete while there are After hooks
+type hookWriter struct {
+	gin.ResponseWriter
+	status  int
+	written bool
+	body    bytes.Buffer
+}
+
+func (w *hookWriter) WriteHeader(code int) {
+	if code > 0 && !w.written {
+		w.status = code
+	}
+}
+
+func (w *hookWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *hookWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.body.Write(data)
+}
+
+func (w *hookWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+func (w *hookWriter) Status() int {
+	return w.status
+}
+
+func (w *hookWriter) Size() int {
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *hookWriter) Written() bool {
+	return w.written
+}
+
+// nothing is sent before the After hooks ran
+func (w *hookWriter) Flush() {}
+
+func runAfterHooks(hooks []AfterHook) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		original := c.Writer
+		w := &hookWriter{ResponseWriter: original, status: original.Status()}
+		c.Writer = w
+		defer func() { c.Writer = original }()
+
+		c.Next()
+
+		res := &Response{Status: w.status, Header: original.Header(), Body: w.body.Bytes()}
+		for _, hook := range hooks {
+			hook(c, res)
+		}
+
+		if len(res.Body) != w.body.Len() {
+			res.Header.Del("Content-Length")
+		}
+		original.WriteHeader(res.Status)
+		if len(res.Body) > 0 {
+			original.Write(res.Body)
+			return
+		}
+		original.WriteHeaderNow()
+	}
+}
+
+// the handlers every route of the API starts with, After hooks outermost so
+// they also see responses a Before handler aborted with
+func (h Hooks) handlers() []gin.HandlerFunc {
+	var handlers []gin.HandlerFunc
+	if len(h.After) > 0 {
+		handlers = append(handlers, runAfterHooks(h.After))
+	}
+	return append(handlers, h.Before...)
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+type HydrationResult struct {
+	Requested   int     `json:"requested"`
+	Hydrated    []int64 `json:"hydrated"`
+	Skipped     []int64 `json:"skipped"`
+	Failed      []int64 `json:"failed"`
+	RateLimited bool    `json:"rate_limited"`
+	Truncated   bool    `json:"truncated,omitempty"` // the request's call budget ran out
+	WorkersUsed int     `json:"workers_used"`
+}
+
+const maxHydrationWorkers = 4
+
+// stop handing out work once either strava window is 90% used
+const hydrationRateLimitFraction = 0.9
+
+func fetchActivityDetail(client *http.Client, access_token string, id int64) (strava.ActivityDetailed, error) {
+	var detail strava.ActivityDetailed
+
+	parm := url.Values{}
+	parm.Add("include_all_efforts", "false")
+
+	err := strava.GetJSON(client, access_token, fmt.Sprintf("/activities/%d", id), parm, &detail)
+	return versionedActivity(detail), err
+}
+
+// fetches and stores the detailed activity for each id using a bounded pool of workers
+func hydrateActivities(ctx context.Context, client *http.Client, access_token string, ids []int64, force bool) HydrationResult {
+	var result HydrationResult
+	result.Requested = len(ids)
+	result.Hydrated = []int64{}
+	result.Skipped = []int64{}
+	result.Failed = []int64{}
+
+	workers := maxHydrationWorkers
+	if len(ids) < workers {
+		workers = len(ids)
+	}
+	result.WorkersUsed = workers
+
+	// the index tells us what is already hydrated without reading each object
+	detailed := make(map[int64]bool)
+	for _, e := range loadActivityIndex(ctx).Entries {
+		detailed[e.Id] = e.Detailed
+	}
+
+	jobs := make(chan int64)
+	var entries []ActivityIndexEntry
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range jobs {
+				if !force && detailed[id] {
+					mu.Lock()
+					result.Skipped = append(result.Skipped, id)
+					mu.Unlock()
+					continue
+				}
+
+				var entry ActivityIndexEntry
+				detail, err := fetchActivityDetail(client, access_token, id)
+				if err == nil {
+					entry, err = saveActivity(ctx, detail, true)
+				}
+
+				mu.Lock()
+				if err != nil {
+					fmt.Println(err)
+					result.Failed = append(result.Failed, id)
+					if errors.Is(err, strava.ErrRateLimited) {
+						result.RateLimited = true
+					}
+					if errors.Is(err, strava.ErrBudgetExhausted) {
+						result.Truncated = true
+					}
+				} else {
+					result.Hydrated = append(result.Hydrated, id)
+					entries = append(entries, entry)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, id := range ids {
+		mu.Lock()
+		if strava.Limits.NearLimit(hydrationRateLimitFraction) {
+			result.RateLimited = true
+		}
+		limited := result.RateLimited || result.Truncated
+		mu.Unlock()
+		if limited {
+			break
+		}
+		jobs <- id
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := upsertActivityIndex(ctx, entries); err != nil {
+		fmt.Println(err)
+	}
+
+	return result
+}
+
+func postHydrate(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	count, err := strconv.Atoi(c.DefaultQuery("count", "30"))
+	if err != nil || count < 1 || count > 200 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "count must be between 1 and 200"})
+		return
+	}
+	force := c.Query("force") == "true"
+
+	client := newRequestBudget().Client(stravaClient(c))
+
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		respondUpstreamError(c, "unable to refresh strava token", err)
+		return
+	}
+
+	parm := url.Values{}
+	parm.Add("per_page", strconv.Itoa(count))
+	parm.Add("page", "1")
+
+	var athActs strava.ActivityList
+	if err := strava.GetJSON(client, access_token, "/athlete/activities", parm, &athActs); err != nil {
+		respondUpstreamError(c, "unable to list strava activities", err)
+		return
+	}
+
+	var ids []int64
+	for _, a := range athActs {
+		ids = append(ids, a.Id)
+	}
+
+	result := hydrateActivities(ctx, client, access_token, ids, force)
+	recordAudit(AuditActivitiesHydrate, "api@"+c.ClientIP(), "", nil, map[string]interface{}{"hydrated": result.Hydrated, "failed": result.Failed})
+
+	c.IndentedJSON(http.StatusOK, result)
+}
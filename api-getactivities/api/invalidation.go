@@ -0,0 +1,229 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/bus"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+)
+
+// CACHE_INVALIDATION_TOPIC, projects/<project>/topics/<topic>, is where every
+// instance announces the objects it writes, and its own subscription to it is
+// where it hears of the ones its peers write. Told of every change, an
+// instance serves an object cached less than CACHE_TRUST_SECONDS ago, default
+// 300, without asking GCS whether it changed; that is as stale as a lost
+// message can leave it
+var (
+	invalidationTopic = os.Getenv("CACHE_INVALIDATION_TOPIC")
+	cacheTrust        = time.Duration(env.Int("CACHE_TRUST_SECONDS", 300)) * time.Second
+)
+
+// how often the objects written are announced, in one message
+const invalidationInterval = time.Second
+
+// the most objects named in one message
+const maxInvalidationObjects = 1000
+
+// how long a pull waits for peers' messages
+const invalidationPullWait = 20 * time.Second
+
+// CacheInvalidation is the body of each message, objects named as in the bucket
+type CacheInvalidation struct {
+	Instance string   `json:"instance"`
+	Objects  []string `json:"objects"`
+}
+
+// InvalidationStats count the messages since the server started
+type InvalidationStats struct {
+	Subscribed bool   `json:"subscribed"` // hearing of peers' writes, so the object cache is trusted
+	Published  uint64 `json:"published"`
+	Received   uint64 `json:"received"`
+	Evicted    uint64 `json:"evicted"`
+	Failed     uint64 `json:"failed"`
+}
+
+var invalidations struct {
+	mu           sync.Mutex
+	publisher    bus.Publisher // nil unless CACHE_INVALIDATION_TOPIC is set
+	subscription *bus.Subscription
+	pending      map[string]bool
+	stats        InvalidationStats
+}
+
+// whether useBucket may trust the object cache
+func cacheTrusted() bool {
+	invalidations.mu.Lock()
+	defer invalidations.mu.Unlock()
+	return invalidations.subscription != nil && cacheTrust > 0
+}
+
+// subscription ids are letters, digits and -_.~+%, starting with a letter
+func invalidationSubscriptionId() string {
+	id := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.~+%", r) {
+			return r
+		}
+		return '-'
+	}, "cache-"+instanceId)
+	if len(id) > 255 {
+		id = id[:255]
+	}
+	return id
+}
+
+// starts announcing writes and listening for peers' when CACHE_INVALIDATION_TOPIC
+// is set; the returned func announces what is left and unsubscribes. Without a
+// subscription writes are still announced, and the cache keeps checking GCS
+func openInvalidation() (func(), error) {
+	if invalidationTopic == "" {
+		return func() {}, nil
+	}
+	timeout := time.Duration(env.Int("PUBSUB_TIMEOUT_SECONDS", 10)) * time.Second
+	publisher, err := bus.NewPubSub(invalidationTopic, timeout)
+	if err != nil {
+		return func() {}, err
+	}
+	invalidations.mu.Lock()
+	invalidations.publisher = publisher
+	invalidations.pending = make(map[string]bool)
+	invalidations.mu.Unlock()
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(invalidationInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				flushInvalidations()
+			}
+		}
+	}()
+
+	subscription, err := bus.NewSubscription(invalidationTopic, invalidationSubscriptionId(), timeout)
+	if err != nil {
+		fmt.Println("cache invalidation: not subscribed:", err)
+	} else {
+		invalidations.mu.Lock()
+		invalidations.subscription = subscription
+		invalidations.stats.Subscribed = true
+		invalidations.mu.Unlock()
+		go receiveInvalidations(subscription, stop)
+	}
+
+	return func() {
+		close(stop)
+		flushInvalidations()
+		if subscription != nil {
+			if err := subscription.Delete(); err != nil {
+				fmt.Println("cache invalidation:", err)
+			}
+		}
+	}, nil
+}
+
+// notes that object changed, so peers drop it; staged objects are never read
+// by them
+func invalidate(object string) {
+	if strings.HasPrefix(object, tmpPrefix) {
+		return
+	}
+	invalidations.mu.Lock()
+	defer invalidations.mu.Unlock()
+	if invalidations.publisher != nil {
+		invalidations.pending[storagePrefix+object] = true
+	}
+}
+
+func flushInvalidations() {
+	invalidations.mu.Lock()
+	publisher := invalidations.publisher
+	var names []string
+	for object := range invalidations.pending {
+		names = append(names, object)
+	}
+	invalidations.pending = make(map[string]bool)
+	invalidations.mu.Unlock()
+
+	if publisher == nil || len(names) == 0 {
+		return
+	}
+	var messages []bus.Message
+	for start := 0; start < len(names); start += maxInvalidationObjects {
+		end := start + maxInvalidationObjects
+		if end > len(names) {
+			end = len(names)
+		}
+		data, err := json.Marshal(CacheInvalidation{Instance: instanceId, Objects: names[start:end]})
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		messages = append(messages, bus.Message{Data: data, Attributes: map[string]string{"type": "cache.invalidate", "instance": instanceId}})
+	}
+
+	err := publisher.Publish(messages)
+	invalidations.mu.Lock()
+	defer invalidations.mu.Unlock()
+	if err != nil {
+		// peers that trust their cache serve these until CACHE_TRUST_SECONDS pass
+		fmt.Println("cache invalidation:", err)
+		invalidations.stats.Failed++
+		return
+	}
+	invalidations.stats.Published += uint64(len(messages))
+}
+
+func receiveInvalidations(subscription *bus.Subscription, stop chan struct{}) {
+	for {
+		messages, err := subscription.Pull(100, invalidationPullWait)
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		if err != nil {
+			fmt.Println("cache invalidation:", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		for _, m := range messages {
+			var message CacheInvalidation
+			if err := json.Unmarshal(m.Data, &message); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			invalidations.mu.Lock()
+			invalidations.stats.Received++
+			invalidations.mu.Unlock()
+			// this instance evicted its own writes as it made them
+			if message.Instance == instanceId || objectCache == nil {
+				continue
+			}
+			for _, object := range message.Objects {
+				objectCache.Evict(object)
+			}
+			invalidations.mu.Lock()
+			invalidations.stats.Evicted += uint64(len(message.Objects))
+			invalidations.mu.Unlock()
+		}
+	}
+}
+
+func invalidationStats() *InvalidationStats {
+	invalidations.mu.Lock()
+	defer invalidations.mu.Unlock()
+	if invalidations.publisher == nil {
+		return nil
+	}
+	stats := invalidations.stats
+	return &stats
+}
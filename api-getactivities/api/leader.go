@@ -0,0 +1,327 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/set"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// whichever instance holds the lease runs the background work, the others
+// stand by and take it over once it expires
+const syncLeaseObject = "leases/sync-worker.json"
+
+// SYNC_INTERVAL_MINUTES syncs the newest activities that often, and
+// WEBHOOK_HYDRATE=true stores the details of activities strava sends create
+// and update events for; every HOUSEKEEPING_MINUTES, default 60, what piles
+// up in storage is cleared. The worker runs on every instance, and the one
+// holding the lease for LEADER_LEASE_SECONDS, default 60, does the work
+var (
+	syncInterval         = time.Duration(env.Int("SYNC_INTERVAL_MINUTES", 0)) * time.Minute
+	webhookHydrate       = os.Getenv("WEBHOOK_HYDRATE") == "true"
+	housekeepingInterval = time.Duration(env.Int("HOUSEKEEPING_MINUTES", 60)) * time.Minute
+	leaseDuration        = time.Duration(env.Int("LEADER_LEASE_SECONDS", 60)) * time.Second
+)
+
+// the most webhook activities hydrated in one turn, the rest wait for the next;
+// they are hydrated one round of the hydration workers at a time, each well
+// inside what is left of a renewed lease, the lease renewed in between
+const (
+	maxWebhookHydrations  = 50
+	webhookHydrationBatch = maxHydrationWorkers
+)
+
+// this process, as it appears in the lease
+var instanceId = func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano())
+}()
+
+// SyncLease is the worker's lease and what it did last, so a new leader
+// carries on where the previous one stopped
+type SyncLease struct {
+	Holder          string `json:"holder"`
+	ExpiresAt       string `json:"expires_at"`
+	LastSyncAt      string `json:"last_sync_at,omitempty"`
+	HydratedThrough string `json:"hydrated_through,omitempty"` // the newest webhook event looked at
+	HousekeptAt     string `json:"housekept_at,omitempty"`
+}
+
+func loadSyncLease(ctx context.Context) (SyncLease, int64, error) {
+	var lease SyncLease
+	slurp, generation, err := readGCSObjectGeneration(ctx, syncLeaseObject)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return lease, 0, nil
+	}
+	if err != nil {
+		return lease, 0, err
+	}
+	if err := json.Unmarshal(slurp, &lease); err != nil {
+		fmt.Println(err)
+	}
+	return lease, generation, nil
+}
+
+// writes the lease unless another instance did since generation, returning
+// the generation written
+func storeSyncLease(ctx context.Context, lease SyncLease, generation int64) (int64, error) {
+	bytes_lease, err := json.Marshal(lease)
+	if err != nil {
+		return generation, err
+	}
+	written, err := putDataToGCSIf(ctx, syncLeaseObject, bytes_lease, generation)
+	if err != nil {
+		return generation, err
+	}
+	return written, nil
+}
+
+// takes the lease when it is free or expired and renews it when held;
+// another instance taking it at the same time makes this one stand by
+func acquireSyncLease(ctx context.Context, now time.Time) (SyncLease, int64, bool, error) {
+	lease, generation, err := loadSyncLease(ctx)
+	if err != nil {
+		return lease, generation, false, err
+	}
+	if lease.Holder != "" && lease.Holder != instanceId {
+		if expires, err := time.Parse(time.RFC3339, lease.ExpiresAt); err == nil && now.Before(expires) {
+			return lease, generation, false, nil
+		}
+	}
+
+	lease.Holder = instanceId
+	lease.ExpiresAt = now.Add(leaseDuration).UTC().Format(time.RFC3339)
+	generation, err = storeSyncLease(ctx, lease, generation)
+	if errors.Is(err, storage.ErrConflict) {
+		return lease, generation, false, nil
+	}
+	return lease, generation, err == nil, err
+}
+
+// StartSyncWorker runs the housekeeping in the background, and the scheduled
+// syncs and webhook hydration when SYNC_INTERVAL_MINUTES or WEBHOOK_HYDRATE
+// ask for them; the returned func stops the worker and gives the lease up
+func StartSyncWorker() func() {
+	ctx := context.Background()
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// renewed well before it expires
+		ticker := time.NewTicker(leaseDuration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				releaseSyncLease(ctx)
+				return
+			case <-ticker.C:
+				leadSyncWorker(ctx, time.Now())
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// the lease while a turn holds it
+type heldLease struct {
+	lease      SyncLease
+	generation int64
+	renewedAt  time.Time
+	ctx        context.Context // the worker's, the lease is stored with
+}
+
+// extends the lease between units of work once a third of it has passed,
+// so a long turn keeps it; false when another instance took it meanwhile,
+// and the turn must stop without storing anything
+func (h *heldLease) renew() bool {
+	now := time.Now()
+	if now.Sub(h.renewedAt) < leaseDuration/3 {
+		return true
+	}
+	h.lease.ExpiresAt = now.Add(leaseDuration).UTC().Format(time.RFC3339)
+	generation, err := storeSyncLease(h.ctx, h.lease, h.generation)
+	if err != nil {
+		fmt.Println("sync lease lost:", err)
+		return false
+	}
+	h.generation, h.renewedAt = generation, now
+	return true
+}
+
+// one turn of the worker, which does nothing unless this instance leads
+func leadSyncWorker(ctx context.Context, now time.Time) {
+	lease, generation, leading, err := acquireSyncLease(ctx, now)
+	if err != nil {
+		fmt.Println("sync lease:", err)
+		return
+	}
+	if !leading {
+		return
+	}
+	held := &heldLease{lease: lease, generation: generation, renewedAt: now, ctx: ctx}
+
+	client := strava.DefaultClient
+	if last, err := time.Parse(time.RFC3339, held.lease.LastSyncAt); syncInterval > 0 && (err != nil || now.Sub(last) >= syncInterval) {
+		var result SyncResult
+		access_token, err := getAccessToken(ctx, client)
+		if err == nil {
+			result, err = syncActivities(ctx, client, access_token, 1)
+		}
+		recordAudit(AuditActivitiesSync, "worker@"+instanceId, "", err, map[string]interface{}{"listed": result.Listed, "changes": len(result.Changes)})
+		if err != nil {
+			fmt.Println("scheduled sync:", err)
+		} else {
+			held.lease.LastSyncAt = now.UTC().Format(time.RFC3339)
+		}
+	}
+
+	if webhookHydrate {
+		through, ok := hydrateWebhookActivities(ctx, client, held.lease.HydratedThrough, held.renew)
+		if !ok {
+			return
+		}
+		held.lease.HydratedThrough = through
+	}
+
+	if last, err := time.Parse(time.RFC3339, held.lease.HousekeptAt); err != nil || now.Sub(last) >= housekeepingInterval {
+		if !housekeep(ctx, now, held) {
+			return
+		}
+		held.lease.HousekeptAt = now.UTC().Format(time.RFC3339)
+	}
+
+	held.lease.ExpiresAt = time.Now().Add(leaseDuration).UTC().Format(time.RFC3339)
+	if _, err := storeSyncLease(ctx, held.lease, held.generation); err != nil {
+		// another instance took over meanwhile, it starts from what was stored before
+		fmt.Println("sync lease:", err)
+	}
+}
+
+// hydrates the activities of the create and update events received after the
+// event through, returning the newest event looked at; the first turn only
+// notes where the events stand. renew is asked before each batch, and false
+// once it fails, the next leader hydrating them again
+func hydrateWebhookActivities(ctx context.Context, client *http.Client, through string, renew func() bool) (string, bool) {
+	names, err := listGCSObjects(ctx, webhookEventsPrefix)
+	if err != nil {
+		fmt.Println(err)
+		return through, true
+	}
+	// ids are the receive time, so they sort oldest first
+	var ids []string
+	for _, object := range names {
+		ids = append(ids, strings.TrimSuffix(strings.TrimPrefix(object, webhookEventsPrefix), ".json"))
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return len(ids[i]) < len(ids[j]) || len(ids[i]) == len(ids[j]) && ids[i] < ids[j]
+	})
+	if len(ids) == 0 {
+		return through, true
+	}
+	if through == "" {
+		return ids[len(ids)-1], true
+	}
+
+	before := through
+	seen := set.New[int64]()
+	var activities []int64
+	for _, id := range ids {
+		if !webhookEventAfter(id, through) {
+			continue
+		}
+		if len(activities) == maxWebhookHydrations {
+			break
+		}
+		through = id
+		stored, ok := loadWebhookEvent(ctx, webhookEventObject(id))
+		if !ok || stored.Event.ObjectType != "activity" || seen.Has(stored.Event.ObjectId) {
+			continue
+		}
+		if stored.Event.AspectType == "create" || stored.Event.AspectType == "update" {
+			seen.Add(stored.Event.ObjectId)
+			activities = append(activities, stored.Event.ObjectId)
+		}
+	}
+	if len(activities) == 0 {
+		return through, true
+	}
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		// looked at again next turn
+		fmt.Println("webhook hydration:", err)
+		return before, true
+	}
+	hydrated := 0
+	for start := 0; start < len(activities); start += webhookHydrationBatch {
+		if !renew() {
+			return before, false
+		}
+		end := start + webhookHydrationBatch
+		if end > len(activities) {
+			end = len(activities)
+		}
+		result := hydrateActivities(ctx, client, access_token, activities[start:end], true)
+		hydrated += len(result.Hydrated)
+		if result.RateLimited || result.Truncated {
+			break
+		}
+	}
+	fmt.Printf("sync worker hydrated %d of %d webhook activities\n", hydrated, len(activities))
+	return through, true
+}
+
+// clears what piles up in storage and picks up what stopped instances left,
+// which no request waits on; false once the lease is lost
+func housekeep(ctx context.Context, now time.Time, held *heldLease) bool {
+	if !held.renew() {
+		return false
+	}
+	deleteExpiredExports(ctx, now)
+	deleteExpiredWebhookMarks(ctx, now)
+	return tendWebhookEvents(ctx, now, held.lease.HydratedThrough, held.renew)
+}
+
+// lets a standby take over at once instead of waiting out the lease
+func releaseSyncLease(ctx context.Context) {
+	lease, generation, err := loadSyncLease(ctx)
+	if err != nil || lease.Holder != instanceId {
+		return
+	}
+	lease.Holder = ""
+	lease.ExpiresAt = ""
+	if _, err := storeSyncLease(ctx, lease, generation); err != nil {
+		fmt.Println("sync lease:", err)
+	}
+}
+
+func getAdminLeader(c *gin.Context) {
+	ctx := c.Request.Context()
+	lease, _, err := loadSyncLease(ctx)
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to read the sync lease"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"instance": instanceId,
+		"leading":  lease.Holder == instanceId,
+		"enabled":  syncInterval > 0 || webhookHydrate,
+		"lease":    lease,
+	})
+}
@@ -0,0 +1,253 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+type LeaderboardEntry struct {
+	Rank        int     `json:"rank"`
+	AthleteId   int64   `json:"athlete_id,omitempty"`
+	DisplayName string  `json:"display_name"`
+	Value       float64 `json:"value"`
+}
+
+type Leaderboard struct {
+	Metric   string             `json:"metric"`
+	Since    string             `json:"since,omitempty"`
+	Entries  []LeaderboardEntry `json:"entries"`
+	Warnings []string           `json:"warnings,omitempty"`
+}
+
+// a request only asks strava for an athlete's recent activities once the
+// stored ones are older than LEADERBOARD_SYNC_MINUTES, default 60
+var leaderboardSyncInterval = time.Duration(env.Int("LEADERBOARD_SYNC_MINUTES", 60)) * time.Minute
+
+const leaderboardActivitiesObject = "leaderboards/activities.json"
+
+// LeaderboardActivities are an athlete's activities since After as last
+// synced, what the weekly leaderboard sums in any zone
+type LeaderboardActivities struct {
+	SyncedAt   string                `json:"synced_at"`
+	After      string                `json:"after"`
+	Activities []LeaderboardActivity `json:"activities"`
+}
+
+type LeaderboardActivity struct {
+	StartDate string  `json:"start_date"`
+	Distance  float64 `json:"distance"`
+}
+
+var leaderboardBudgetWarning = fmt.Sprintf("stopped syncing after the budget of %d strava calls or %s, some athletes are ranked by older activities or left out", upstreamBudgetCalls, upstreamBudget)
+
+// athletes that opted in to leaderboards, hidden athletes are never ranked
+func leaderboardAthletes(ctx context.Context) []RegisteredAthlete {
+	var visible []RegisteredAthlete
+	for _, a := range loadRegisteredAthletes(ctx) {
+		if a.LeaderboardPrivacy != PrivacyPublic && a.LeaderboardPrivacy != PrivacyAnonymous {
+			continue
+		}
+		// athletes who didn't grant activity access can't be ranked
+		creds, err := loadCredentials(ctx, a.credentialsObject())
+		if err != nil || len(strava.MissingScopes(creds, []string{strava.ScopeActivityRead})) > 0 {
+			continue
+		}
+		visible = append(visible, a)
+	}
+	return visible
+}
+
+// sorts the entries by value and applies each athlete's privacy setting
+func rankEntries(athletes []RegisteredAthlete, values []float64, ascending bool) []LeaderboardEntry {
+	entries := []LeaderboardEntry{}
+	for i, a := range athletes {
+		var entry LeaderboardEntry
+		entry.Value = values[i]
+		if a.LeaderboardPrivacy == PrivacyPublic {
+			entry.AthleteId = a.Id
+			entry.DisplayName = a.Firstname + " " + a.Lastname
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if ascending {
+			return entries[i].Value < entries[j].Value
+		}
+		return entries[i].Value > entries[j].Value
+	})
+
+	for i := range entries {
+		entries[i].Rank = i + 1
+		if entries[i].DisplayName == "" {
+			entries[i].DisplayName = fmt.Sprintf("Athlete %d", i+1)
+		}
+	}
+	return entries
+}
+
+func loadLeaderboardActivities(ctx context.Context, a RegisteredAthlete) LeaderboardActivities {
+	var stored LeaderboardActivities
+	if slurp := getDataFromGCS(ctx, a.objectPrefix()+leaderboardActivitiesObject); slurp != nil {
+		if err := json.Unmarshal(slurp, &stored); err != nil {
+			fmt.Println(err)
+		}
+	}
+	return stored
+}
+
+// whether the stored activities are too old, or start too late, for a week
+// starting at since
+func (s LeaderboardActivities) stale(since time.Time, now time.Time) bool {
+	synced, err := time.Parse(time.RFC3339, s.SyncedAt)
+	if err != nil || now.Sub(synced) >= leaderboardSyncInterval {
+		return true
+	}
+	after, err := time.Parse(time.RFC3339, s.After)
+	return err != nil || after.After(since)
+}
+
+// the athlete's activities from a day before since, so a week starting in any
+// zone is covered by the same ones
+func syncLeaderboardActivities(ctx context.Context, client *http.Client, a RegisteredAthlete, since time.Time) (LeaderboardActivities, error) {
+	synced := LeaderboardActivities{Activities: []LeaderboardActivity{}}
+	access_token, err := getAccessTokenFor(ctx, client, a.credentialsObject())
+	if err != nil {
+		return synced, err
+	}
+
+	after := since.Add(-24 * time.Hour)
+	parm := url.Values{}
+	parm.Add("after", strconv.FormatInt(after.Unix(), 10))
+	parm.Add("per_page", "200")
+
+	var athActs strava.ActivityList
+	if err := strava.GetJSON(client, access_token, "/athlete/activities", parm, &athActs); err != nil {
+		return synced, err
+	}
+	for _, act := range athActs {
+		synced.Activities = append(synced.Activities, LeaderboardActivity{StartDate: act.StartDate, Distance: act.Distance})
+	}
+	synced.SyncedAt = time.Now().UTC().Format(time.RFC3339)
+	synced.After = after.UTC().Format(time.RFC3339)
+
+	bytes_synced, err := json.Marshal(synced)
+	if err != nil {
+		return synced, err
+	}
+	return synced, putDataToGCS(ctx, a.objectPrefix()+leaderboardActivitiesObject, bytes_synced)
+}
+
+// the distance of the stored activities started since since, synced first
+// when they are stale; false when there are none to rank the athlete by
+func weeklyDistance(ctx context.Context, client *http.Client, a RegisteredAthlete, since time.Time) (float64, bool) {
+	stored := loadLeaderboardActivities(ctx, a)
+	if stored.stale(since, time.Now()) {
+		synced, err := syncLeaderboardActivities(ctx, client, a, since)
+		if err != nil {
+			// ranked by what is stored, when it covers the week
+			fmt.Println(err)
+		} else {
+			stored = synced
+		}
+	}
+	if after, err := time.Parse(time.RFC3339, stored.After); err != nil || after.After(since) {
+		return 0, false
+	}
+
+	total := 0.0
+	for _, act := range stored.Activities {
+		if start, err := time.Parse(time.RFC3339, act.StartDate); err == nil && !start.Before(since) {
+			total += act.Distance
+		}
+	}
+	return total, true
+}
+
+func getWeeklyLeaderboard(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	loc, err := athleteZone(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	budget := newRequestBudget()
+	client := budget.Client(stravaClient(c))
+	since := analysis.StartOfWeekIn(time.Now(), loc)
+
+	var ranked []RegisteredAthlete
+	var values []float64
+	for _, a := range leaderboardAthletes(ctx) {
+		distance, ok := weeklyDistance(ctx, client, a, since)
+		if !ok {
+			continue
+		}
+		ranked = append(ranked, a)
+		values = append(values, distance)
+	}
+
+	var board Leaderboard
+	board.Metric = "weekly_distance"
+	board.Since = since.Format(time.RFC3339)
+	board.Entries = rankEntries(ranked, values, false)
+	if budget.Exhausted() {
+		board.Warnings = append(board.Warnings, leaderboardBudgetWarning)
+	}
+
+	c.IndentedJSON(http.StatusOK, board)
+}
+
+func getSegmentLeaderboard(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	segmentId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "segment id must be numeric"})
+		return
+	}
+
+	budget := newRequestBudget()
+	client := budget.Client(stravaClient(c))
+
+	var ranked []RegisteredAthlete
+	var values []float64
+	for _, a := range leaderboardAthletes(ctx) {
+		efforts, err := freshSegmentEfforts(ctx, client, a.credentialsObject(), a.objectPrefix(), segmentId)
+		if err != nil {
+			fmt.Println(err)
+		}
+
+		// only athletes who have ridden or run the segment share it
+		history := summarizeSegmentEfforts(segmentId, efforts)
+		if history.EffortCount == 0 {
+			continue
+		}
+		ranked = append(ranked, a)
+		values = append(values, float64(history.BestTime))
+	}
+
+	var board Leaderboard
+	board.Metric = "segment_best_time"
+	board.Entries = rankEntries(ranked, values, true)
+	if budget.Exhausted() {
+		board.Warnings = append(board.Warnings, leaderboardBudgetWarning)
+	}
+
+	c.IndentedJSON(http.StatusOK, board)
+}
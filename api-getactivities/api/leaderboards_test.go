@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+)
+
+func TestWeeklyDistance(t *testing.T) {
+	defer func(store storage.ObjectStore) { objects = store }(objects)
+	objects = storage.NewMemory()
+
+	now := time.Now().UTC()
+	since := now.Add(-72 * time.Hour).Truncate(time.Second)
+	activities := []LeaderboardActivity{
+		{StartDate: since.Add(-time.Hour).Format(time.RFC3339), Distance: 1000},
+		{StartDate: since.Format(time.RFC3339), Distance: 2000},
+		{StartDate: since.Add(time.Hour).Format(time.RFC3339), Distance: 4000},
+	}
+	at := func(d time.Duration) string { return now.Add(d).Format(time.RFC3339) }
+
+	cases := []struct {
+		name   string
+		stored *LeaderboardActivities
+		want   float64
+		ok     bool
+		stale  bool
+	}{
+		{"never synced", nil, 0, false, true},
+		{"synced recently", &LeaderboardActivities{SyncedAt: at(-time.Minute), After: since.Add(-24 * time.Hour).Format(time.RFC3339), Activities: activities}, 6000, true, false},
+		{"stale, strava unreachable", &LeaderboardActivities{SyncedAt: at(-leaderboardSyncInterval - time.Minute), After: since.Add(-24 * time.Hour).Format(time.RFC3339), Activities: activities}, 6000, true, true},
+		{"synced after the week started", &LeaderboardActivities{SyncedAt: at(-time.Minute), After: since.Add(time.Minute).Format(time.RFC3339), Activities: activities}, 0, false, true},
+	}
+	for i, tc := range cases {
+		a := RegisteredAthlete{Id: int64(i + 1)}
+		if tc.stored != nil {
+			data, err := json.Marshal(tc.stored)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := objects.Write(a.objectPrefix()+leaderboardActivitiesObject, data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if stale := loadLeaderboardActivities(context.Background(), a).stale(since, now); stale != tc.stale {
+			t.Errorf("%s: stale %v, want %v", tc.name, stale, tc.stale)
+		}
+		// no credentials are stored, so a sync fails as when strava can't be reached
+		got, ok := weeklyDistance(context.Background(), http.DefaultClient, a, since)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("%s: weeklyDistance = %v, %v, want %v, %v", tc.name, got, ok, tc.want, tc.ok)
+		}
+	}
+}
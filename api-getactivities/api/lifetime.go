@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// Eddington numbers, the distance around the world and active days of every
+// stored activity; ?tz= is the zone the current week is taken in
+func getLifetime(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	loc, err := athleteZone(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var activities []strava.ActivitySummary
+	for _, e := range loadActivityIndex(ctx).Entries {
+		if activity, ok := loadActivity(ctx, e.Id); ok {
+			activities = append(activities, activity.ActivitySummary)
+		}
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"data": analysis.SummarizeLifetime(activities, time.Now().In(loc))})
+}
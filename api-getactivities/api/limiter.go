@@ -0,0 +1,110 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+)
+
+type bucketLimits struct {
+	perSecond float64
+	burst     float64
+}
+
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+	limits   bucketLimits
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.limits.burst, b.tokens+now.Sub(b.lastSeen).Seconds()*b.limits.perSecond)
+	b.lastSeen = now
+}
+
+// token buckets keyed by client IP, or by API key for callers presenting one of API_KEYS
+type RequestLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	ipLimits  bucketLimits
+	keyLimits bucketLimits
+	apiKeys   map[string]bool
+	lastSweep time.Time
+}
+
+func newRequestLimiter() *RequestLimiter {
+	l := &RequestLimiter{
+		buckets: make(map[string]*tokenBucket),
+		apiKeys: make(map[string]bool),
+	}
+	l.ipLimits.perSecond = float64(env.Int("RATE_LIMIT_PER_MINUTE", 60)) / 60
+	l.ipLimits.burst = float64(env.Int("RATE_LIMIT_BURST", 20))
+	l.keyLimits.perSecond = float64(env.Int("API_KEY_RATE_LIMIT_PER_MINUTE", 600)) / 60
+	l.keyLimits.burst = float64(env.Int("API_KEY_RATE_LIMIT_BURST", 100))
+
+	for _, key := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			l.apiKeys[key] = true
+		}
+	}
+	return l
+}
+
+// takes a token for the key, returning how long to wait when none are left
+func (l *RequestLimiter) take(key string, limits bucketLimits, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// drop buckets that have refilled completely, they behave the same as a new one
+	if now.Sub(l.lastSweep) > time.Minute {
+		for k, b := range l.buckets {
+			b.refill(now)
+			if b.tokens >= b.limits.burst {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: limits.burst, lastSeen: now, limits: limits}
+		l.buckets[key] = b
+	}
+	b.refill(now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / limits.perSecond
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+func (l *RequestLimiter) limit(c *gin.Context) {
+	key := "ip:" + c.ClientIP()
+	limits := l.ipLimits
+	if apiKey := c.GetHeader("X-API-Key"); apiKey != "" && l.apiKeys[apiKey] {
+		key = "key:" + apiKey
+		limits = l.keyLimits
+	}
+
+	allowed, wait := l.take(key, limits, time.Now())
+	if !allowed {
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("rate limit exceeded, retry in %d seconds", retryAfter)})
+		return
+	}
+
+	c.Next()
+}
@@ -0,0 +1,315 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/apiversion"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/geo"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+type FinalActivity struct {
+	Id             int64          `json:"id"`
+	Type           string         `json:"type"`
+	SportType      string         `json:"sport_type"`
+	Platform       string         `json:"platform,omitempty"` // zwift, trainerroad or rouvy
+	Visibility     string         `json:"visibility"`
+	HideFromHome   bool           `json:"hide_from_home,omitempty"`
+	Distance       float64        `json:"distance"`
+	MovingTime     int            `json:"moving_time"`
+	StartDate      string         `json:"start_date"`
+	StartDateLocal string         `json:"start_date_local"`
+	StartDateUnix  int            `json:"start_date_unix"`
+	StartTime      string         `json:"start_time"` // local time with its real offset, e.g. 2023-10-14T07:05:00-06:00
+	TimeZone       string         `json:"timezone"`
+	Zone           string         `json:"zone"` // IANA name parsed from timezone
+	UtcOffset      int            `json:"utc_offset"`
+	Miles          float64        `json:"miles"`
+	Minutes        float64        `json:"minutes"`
+	Pace           float64        `json:"pace"`
+	DisplayPace    string         `json:"display_pace"`
+	Display        *DisplayFields `json:"display,omitempty"`
+	Bounds         *geo.Bounds    `json:"bounds,omitempty"` // the route's box, only with ?bbox=
+}
+
+type FinalActivities struct {
+	Athlete  *strava.AthleteProfile `json:"athlete,omitempty"`
+	Data     []FinalActivity        `json:"data"`
+	Warnings []string               `json:"warnings,omitempty"`
+	Meta     *ResponseMeta          `json:"meta,omitempty"`
+}
+
+type SourceStatus struct {
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// per source outcome so clients can tell a partial payload from an empty one
+type ResponseMeta struct {
+	Sources map[string]SourceStatus `json:"sources"`
+}
+
+func (m *ResponseMeta) record(source string, err error) {
+	if m.Sources == nil {
+		m.Sources = make(map[string]SourceStatus)
+	}
+	if err != nil {
+		m.Sources[source] = SourceStatus{Error: err.Error()}
+	} else {
+		m.Sources[source] = SourceStatus{Ok: true}
+	}
+}
+
+func setCorsHeaders(c *gin.Context) {
+	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+	c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+	c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+	c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT")
+}
+
+const ownerCredentialsObject = "credentials/strava_refresh_token.json"
+
+func getAccessToken(ctx context.Context, client *http.Client) (string, error) {
+	return getAccessTokenFor(ctx, client, ownerCredentialsObject)
+}
+
+// exchange the stored refresh token for a short lived access token
+func getAccessTokenFor(ctx context.Context, client *http.Client, creds_object string) (string, error) {
+	creds, err := loadCredentials(ctx, creds_object)
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", creds_object, err)
+	}
+
+	credsToUse, err := strava.RefreshCredentials(client, creds)
+	if err != nil {
+		auditTokenRefresh(creds_object, err, false)
+		return "", err
+	}
+
+	// strava hands out a new refresh token once the old one nears expiry, and
+	// only the new one works after that
+	if credsToUse.Refresh_token != "" && credsToUse.Refresh_token != creds.Refresh_token {
+		creds.Refresh_token = credsToUse.Refresh_token
+		err := saveCredentials(creds_object, creds)
+		auditTokenRefresh(creds_object, err, true)
+		if err != nil {
+			fmt.Println("storing the new refresh token:", err)
+		}
+	} else {
+		auditTokenRefresh(creds_object, nil, false)
+	}
+
+	return credsToUse.Access_token, nil
+}
+
+func fetchFinalActivities(client *http.Client, access_token string) (FinalActivities, error) {
+	parm := url.Values{}
+	parm.Add("per_page", "30")
+	parm.Add("page", "1")
+
+	var athActs strava.ActivityList
+
+	if err := strava.GetJSON(client, access_token, "/athlete/activities", parm, &athActs); err != nil {
+		return FinalActivities{}, err
+	}
+
+	var finalActs FinalActivities
+	finalActs.Data = []FinalActivity{}
+
+	for _, a := range athActs {
+		finalAct, err := finalActivity(a)
+		if err != nil {
+			fmt.Println(err.Error())
+			finalActs.Warnings = append(finalActs.Warnings, fmt.Sprintf("activity %d skipped: unreadable start_date_local", a.Id))
+			continue
+		}
+		finalActs.Data = append(finalActs.Data, finalAct)
+	}
+
+	return finalActs, nil
+}
+
+// the reporting shape of a strava activity, which needs a readable start_date_local
+func finalActivity(a strava.ActivitySummary) (FinalActivity, error) {
+	var finalAct FinalActivity
+	finalAct.Id = a.Id
+	finalAct.SportType = strava.NormalizeSportType(a.SportType, a.Type)
+	finalAct.Type = strava.LegacyActivityType(finalAct.SportType)
+	finalAct.Platform = analysis.VirtualPlatform(a.ExternalId, "")
+	finalAct.Visibility = activityVisibility(a)
+	finalAct.HideFromHome = a.HideFromHome
+	finalAct.Distance = a.Distance
+	finalAct.MovingTime = a.MovingTime
+	finalAct.StartDate = a.StartDate
+	finalAct.StartDateLocal = a.StartDateLocal
+	finalAct.TimeZone = a.TimeZone
+	finalAct.UtcOffset = a.UtcOffset
+	// convert zulu string time to unix time
+	time_temp, err := time.Parse(time.RFC3339, a.StartDateLocal)
+	if err != nil {
+		return finalAct, err
+	}
+	finalAct.StartDateUnix = int(time_temp.Unix())
+	if start, err := a.StartTime(); err == nil {
+		finalAct.StartTime = start.Format(time.RFC3339)
+		finalAct.Zone = start.Location().String()
+	}
+	finalAct.Miles, finalAct.Minutes, finalAct.Pace = analysis.Pace(a.Distance, a.MovingTime)
+	finalAct.DisplayPace = analysis.DisplayPace(finalAct.Pace)
+	return finalAct, nil
+}
+
+func fetchAthleteProfile(client *http.Client, access_token string) (strava.AthleteProfile, error) {
+	var profile strava.AthleteProfile
+	err := strava.GetJSON(client, access_token, "/athlete", nil, &profile)
+	if !apiversion.Enabled(apiversion.FollowerCounts) {
+		profile.FollowerCount, profile.FriendCount = nil, nil
+	}
+	return profile, err
+}
+
+func getStravaAthlete(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	client := stravaClient(c)
+
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		respondUpstreamError(c, "unable to refresh strava token", err)
+		return
+	}
+
+	profile, err := fetchAthleteProfile(client, access_token)
+	if err != nil {
+		respondUpstreamError(c, "unable to fetch athlete from strava", err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, profile)
+}
+
+func getStravaActivities(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	if c.Query("ids") != "" {
+		getActivitiesByIds(c)
+		return
+	}
+	if c.Query("bbox") != "" {
+		getActivitiesInBounds(c)
+		return
+	}
+
+	filters, err := activityTypeFilters(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	platforms, err := platformFilters(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	visibility, err := visibilityFilters(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	formatter, err := displayParam(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	client := stravaClient(c)
+
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		respondUpstreamError(c, "unable to refresh strava token", err)
+		return
+	}
+
+	finalActs, err := fetchFinalActivities(client, access_token)
+	if err != nil {
+		respondUpstreamError(c, "unable to fetch activities from strava", err)
+		return
+	}
+
+	matched := []FinalActivity{}
+	for _, a := range finalActs.Data {
+		if strava.MatchesActivityType(filters, a.SportType) && matchesFilter(platforms, a.Platform) && visibility.matches(a.Visibility, a.HideFromHome) {
+			matched = append(matched, a)
+		}
+	}
+	finalActs.Data = matched
+	addDisplayFields(formatter, finalActs.Data)
+
+	renderEncoded(c, http.StatusOK, finalActs, func() []byte { return activitiesProto(finalActs) })
+}
+
+// composite of /strava/athlete and /strava/activities kept for existing clients,
+// whichever part is available is returned with a warning for the other
+func getStravaData(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	formatter, err := displayParam(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	client := stravaClient(c)
+
+	var meta ResponseMeta
+
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		fmt.Println(err)
+		meta.record("token", err)
+		c.IndentedJSON(http.StatusBadGateway, gin.H{"error": "unable to refresh strava token", "meta": meta})
+		return
+	}
+	meta.record("token", nil)
+
+	finalActs, actsErr := fetchFinalActivities(client, access_token)
+	meta.record("activities", actsErr)
+	if actsErr != nil {
+		fmt.Println(actsErr)
+		finalActs.Data = []FinalActivity{}
+		finalActs.Warnings = append(finalActs.Warnings, "activities are unavailable")
+	}
+	addDisplayFields(formatter, finalActs.Data)
+
+	profile, athleteErr := fetchAthleteProfile(client, access_token)
+	meta.record("athlete", athleteErr)
+	if athleteErr != nil {
+		fmt.Println(athleteErr)
+		finalActs.Warnings = append(finalActs.Warnings, "athlete profile is unavailable")
+	} else {
+		finalActs.Athlete = &profile
+	}
+
+	finalActs.Meta = &meta
+
+	if actsErr != nil && athleteErr != nil {
+		c.IndentedJSON(http.StatusBadGateway, finalActs)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, finalActs)
+}
+
+const ContentTypeHTML = "text/html; charset=utf-8"
+
+func getIndex(c *gin.Context) {
+	c.Data(http.StatusOK, ContentTypeHTML, []byte("<html>The Strava API Application Works.</html>"))
+}
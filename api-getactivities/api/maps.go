@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/geo"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/render"
+)
+
+const mapsPrefix = "maps/"
+
+// MAP_TILE_URL, e.g. https://tile.openstreetmap.org/{z}/{x}/{y}.png, puts routes
+// over map tiles; without it routes are drawn on a transparent background
+var mapTileURL = os.Getenv("MAP_TILE_URL")
+
+var tileClient = &http.Client{Timeout: 10 * time.Second}
+
+// every rendering option is part of the name, so each variant is cached separately
+func mapObject(id int64, opts render.MapOptions) string {
+	background := "plain"
+	if opts.TileURL != "" {
+		background = "tiles"
+	}
+	c := opts.Color
+	return fmt.Sprintf("%s%d/%dx%d-%02x%02x%02x%02x-%g-%s.png", mapsPrefix, id, opts.Width, opts.Height, c.R, c.G, c.B, c.A, opts.Weight, background)
+}
+
+func intParam(c *gin.Context, name string, fallback int, min int, max int) (int, error) {
+	value, err := strconv.Atoi(c.DefaultQuery(name, strconv.Itoa(fallback)))
+	if err != nil || value < min || value > max {
+		return 0, fmt.Errorf("%s must be between %d and %d", name, min, max)
+	}
+	return value, nil
+}
+
+func mapOptions(c *gin.Context) (render.MapOptions, error) {
+	opts := render.MapOptions{Padding: 20, TileClient: tileClient}
+
+	var err error
+	if opts.Width, err = intParam(c, "width", 600, 64, 2048); err != nil {
+		return opts, err
+	}
+	if opts.Height, err = intParam(c, "height", 400, 64, 2048); err != nil {
+		return opts, err
+	}
+	weight, err := intParam(c, "weight", 3, 1, 20)
+	if err != nil {
+		return opts, err
+	}
+	opts.Weight = float64(weight)
+	if opts.Color, err = render.ParseColor(c.DefaultQuery("color", "fc4c02")); err != nil {
+		return opts, err
+	}
+
+	switch tiles := c.DefaultQuery("tiles", "true"); tiles {
+	case "true":
+		opts.TileURL = mapTileURL
+	case "false":
+	default:
+		return opts, fmt.Errorf("tiles must be true or false")
+	}
+	return opts, nil
+}
+
+func getActivityMap(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "activity id must be numeric"})
+		return
+	}
+	opts, err := mapOptions(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	object := mapObject(id, opts)
+	if cached, err := readGCSObject(ctx, object); err == nil {
+		c.Data(http.StatusOK, "image/png", cached)
+		return
+	}
+
+	activity, err := loadOrFetchActivity(ctx, id)
+	if err != nil {
+		respondUpstreamError(c, "unable to fetch activity from strava", err)
+		return
+	}
+	points, err := geo.DecodePolyline(activity.Map.SummaryPolyline)
+	if err != nil {
+		fmt.Println(id, err)
+	}
+	if len(points) == 0 {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "activity has no route"})
+		return
+	}
+
+	img, missing, err := render.MapImage(points, opts)
+	var buf bytes.Buffer
+	if err == nil {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to render map"})
+		return
+	}
+
+	// an image with missing tiles is served but rendered again next time
+	if missing == 0 {
+		if err := putDataToGCS(ctx, object, buf.Bytes()); err != nil {
+			fmt.Println(err)
+		}
+	}
+	c.Data(http.StatusOK, "image/png", buf.Bytes())
+}
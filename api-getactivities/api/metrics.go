@@ -0,0 +1,236 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/streams"
+)
+
+// fixes reached faster than this, in meters per second, are GPS jumps
+const maxGPSSpeed = 50
+
+// ActivityMetrics are an activity's streams shrunk for charting, every series
+// has Size points and time is always included as the x axis
+type ActivityMetrics struct {
+	Id           int64          `json:"id"`
+	Resolution   string         `json:"resolution"`
+	Method       string         `json:"method"`
+	OriginalSize int            `json:"original_size"`
+	Size         int            `json:"size"`
+	Series       map[string]any `json:"series"`
+	Missing      []string       `json:"missing,omitempty"` // asked for but not recorded
+	Cleaned      map[string]int `json:"cleaned,omitempty"` // samples replaced by ?clean=true
+}
+
+func floats[T int | float64](s *strava.Stream[T]) ([]float64, bool) {
+	if s == nil {
+		return nil, false
+	}
+	return streams.Floats(s.Data), true
+}
+
+// a recorded numeric stream as floats, false for latlng, moving and streams
+// the activity did not record
+func numericStream(set strava.StreamSet, key string) ([]float64, bool) {
+	switch key {
+	case "time":
+		return floats(set.Time)
+	case "distance":
+		return floats(set.Distance)
+	case "altitude":
+		return floats(set.Altitude)
+	case "velocity_smooth":
+		return floats(set.VelocitySmooth)
+	case "heartrate":
+		return floats(set.Heartrate)
+	case "cadence":
+		return floats(set.Cadence)
+	case "watts":
+		return floats(set.Watts)
+	case "temp":
+		return floats(set.Temp)
+	case "grade_smooth":
+		return floats(set.GradeSmooth)
+	}
+	return nil, false
+}
+
+// shrinks every series to the same points, the means of equal runs or, for
+// lttb, the samples LTTB picked on one series
+type resampler struct {
+	n       int
+	indices []int
+}
+
+func (r resampler) numeric(values []float64) []float64 {
+	if r.indices == nil {
+		return streams.Mean(values, r.n)
+	}
+	picked := streams.Pick(values, r.indices)
+	for i, v := range picked {
+		picked[i] = math.Round(v*100) / 100
+	}
+	return picked
+}
+
+func resampleAny[T any](r resampler, data []T) []T {
+	if r.indices == nil {
+		return streams.First(data, r.n)
+	}
+	return streams.Pick(data, r.indices)
+}
+
+// ?fields=heartrate,watts, every recorded stream without it
+func metricFields(c *gin.Context) ([]string, error) {
+	fields := c.Query("fields")
+	if fields == "" {
+		return strava.StreamKeys, nil
+	}
+
+	known := make(map[string]bool)
+	for _, key := range strava.StreamKeys {
+		known[key] = true
+	}
+	var keys []string
+	for _, key := range strings.Split(fields, ",") {
+		key = strings.TrimSpace(key)
+		if !known[key] {
+			return nil, fmt.Errorf("unknown field %q, fields are %s", key, strings.Join(strava.StreamKeys, ","))
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func getActivityMetrics(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "activity id must be numeric"})
+		return
+	}
+	fields, err := metricFields(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	resolution := c.DefaultQuery("resolution", "medium")
+	points, ok := streams.Resolutions[resolution]
+	if !ok {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "resolution must be low, medium or high"})
+		return
+	}
+	method := c.DefaultQuery("method", "mean")
+	if method != "mean" && method != "lttb" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "method must be mean or lttb"})
+		return
+	}
+	smooth, err := intParam(c, "smooth", 0, 0, 120)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	clean := c.Query("clean") == "true"
+
+	client := stravaClient(c)
+
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		respondUpstreamError(c, "unable to refresh strava token", err)
+		return
+	}
+
+	set, err := loadStreams(ctx, client, access_token, id)
+	if err != nil {
+		respondUpstreamError(c, "unable to fetch streams from strava", err)
+		return
+	}
+	if set.Len() == 0 {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "activity has no streams"})
+		return
+	}
+
+	metrics := ActivityMetrics{
+		Id:           id,
+		Resolution:   resolution,
+		Method:       method,
+		OriginalSize: set.Len(),
+		Series:       make(map[string]any),
+	}
+	if clean {
+		metrics.Cleaned = make(map[string]int)
+	}
+
+	// cleaned and smoothed numeric series before they are shrunk
+	numeric := make(map[string][]float64)
+	for _, key := range append([]string{"time"}, fields...) {
+		values, ok := numericStream(set, key)
+		if !ok {
+			continue
+		}
+		if clean && key == "heartrate" {
+			values, metrics.Cleaned[key] = streams.CleanHeartrate(set.Heartrate.Data)
+		}
+		// the axes are not smoothed
+		if key != "time" && key != "distance" {
+			values = streams.MovingAverage(values, smooth)
+		}
+		numeric[key] = values
+	}
+
+	r := resampler{n: points}
+	if method == "lttb" {
+		// points are picked on the first charted series, the rest are sampled at the same points
+		base := numeric["time"]
+		for _, key := range fields {
+			if values, ok := numeric[key]; ok && key != "time" && key != "distance" {
+				base = values
+				break
+			}
+		}
+		r.indices = streams.LTTB(numeric["time"], base, points)
+	}
+
+	metrics.Series["time"] = r.numeric(numeric["time"])
+	metrics.Size = len(metrics.Series["time"].([]float64))
+	for _, key := range fields {
+		switch {
+		case numeric[key] != nil:
+			metrics.Series[key] = r.numeric(numeric[key])
+		case key == "latlng" && set.LatLng != nil:
+			track := set.LatLng.Data
+			if clean {
+				track, metrics.Cleaned[key] = cleanTrack(set)
+			}
+			metrics.Series[key] = resampleAny(r, track)
+		case key == "moving" && set.Moving != nil:
+			metrics.Series[key] = resampleAny(r, set.Moving.Data)
+		default:
+			// without ?fields= every recorded stream is wanted, nothing is missing
+			if c.Query("fields") != "" {
+				metrics.Missing = append(metrics.Missing, key)
+			}
+		}
+	}
+
+	renderEncoded(c, http.StatusOK, metrics, func() []byte { return metricsProto(metrics) })
+}
+
+// the latlng stream with GPS jumps replaced, and how many there were
+func cleanTrack(set strava.StreamSet) ([]strava.Location, int) {
+	points, replaced := streams.RemoveJumps(streams.Points(set.LatLng.Data), set.Time.Data, maxGPSSpeed)
+	track := make([]strava.Location, len(points))
+	for i, p := range points {
+		track[i] = strava.Location{p.Lat, p.Lng}
+	}
+	return track, replaced
+}
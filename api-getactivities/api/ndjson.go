@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+const ndjsonContentType = "application/x-ndjson"
+
+// every stored activity as one JSON object per line, in index order, as on
+// /strava/activities/:id. Each line is read and flushed before the next, so
+// memory stays flat and a slow reader slows the reads down instead of
+// piling them up; the reads stop when the client goes away
+func getActivitiesNDJSON(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	filters, err := activityTypeFilters(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	platforms, err := platformFilters(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	visibility, err := visibilityFilters(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ids []int64
+	for _, e := range loadActivityIndex(ctx).Entries {
+		if strava.MatchesActivityType(filters, strava.NormalizeSportType(e.SportType, e.Type)) && matchesFilter(platforms, e.Platform) && visibility.matches(e.Visibility, e.HideFromHome) {
+			ids = append(ids, e.Id)
+		}
+	}
+
+	c.Header("Content-Type", ndjsonContentType)
+	c.Header("Content-Disposition", `attachment; filename="activities.ndjson"`)
+	c.Status(http.StatusOK)
+	if len(ids) == 0 {
+		return
+	}
+
+	// once streaming a failed read can only be logged, the line is left out
+	next := 0
+	c.Stream(func(w io.Writer) bool {
+		for next < len(ids) {
+			id := ids[next]
+			next++
+
+			activity, ok := loadActivity(ctx, id)
+			if !ok {
+				fmt.Println("ndjson: activity", id, "not readable, left out")
+				continue
+			}
+			line, err := json.Marshal(annotateActivity(ctx, redactActivity(c, activity)))
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			w.Write(append(line, '\n'))
+			break
+		}
+		return next < len(ids)
+	})
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/geo"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/set"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// the geohash cells each stored activity's route passes through, kept next to
+// the index and updated with it so a search reads only the activities nearby
+const nearIndexObject = activitiesPrefix + "near.json"
+
+// cells of about 5 by 5 kilometers, a ride is a few dozen of them
+const nearPrecision = 5
+
+const (
+	defaultNearRadius = 1000
+	maxNearRadius     = 25000
+)
+
+type NearIndex struct {
+	UpdatedAt string             `json:"updated_at"`
+	Precision int                `json:"precision"`
+	Cells     map[string][]int64 `json:"cells"`
+}
+
+type NearActivity struct {
+	ActivityIndexEntry
+	Distance float64 `json:"distance"` // meters from the point to the closest part of the route
+}
+
+func loadNearIndex(ctx context.Context) (NearIndex, bool) {
+	return parseNearIndex(getDataFromGCS(ctx, nearIndexObject))
+}
+
+func parseNearIndex(slurp []byte) (NearIndex, bool) {
+	var index NearIndex
+
+	if slurp == nil {
+		return index, false
+	}
+	if err := json.Unmarshal(slurp, &index); err != nil {
+		fmt.Println(err)
+		return index, false
+	}
+	return index, index.Precision == nearPrecision && index.Cells != nil
+}
+
+func storeNearIndex(ctx context.Context, index NearIndex) error {
+	index.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	bytes_index, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return putDataAtomically(ctx, nearIndexObject, bytes_index)
+}
+
+func activityRoute(activity strava.ActivityDetailed) []geo.Point {
+	route, err := geo.DecodePolyline(activity.Map.SummaryPolyline)
+	if err != nil {
+		fmt.Println(activity.Id, err)
+		return nil
+	}
+	return route
+}
+
+// from every stored activity, for storage from before the near index was kept
+func buildNearIndex(ctx context.Context) NearIndex {
+	index := NearIndex{Precision: nearPrecision, Cells: make(map[string][]int64)}
+	for _, e := range loadActivityIndex(ctx).Entries {
+		activity, ok := loadActivity(ctx, e.Id)
+		if !ok {
+			continue
+		}
+		for _, cell := range geo.GeohashCells(activityRoute(activity), nearPrecision) {
+			index.Cells[cell] = append(index.Cells[cell], e.Id)
+		}
+	}
+	return index
+}
+
+// moves the saved entries to their cells and drops the removed activities;
+// called with activityIndexMu held, after the activity index was stored
+func updateNearIndex(ctx context.Context, saved []ActivityIndexEntry, removed []int64) error {
+	changed := set.Keyed(saved, indexEntryId)
+	for _, id := range removed {
+		changed.Add(id)
+	}
+
+	return updateObject(ctx, nearIndexObject, func(slurp []byte) ([]byte, error) {
+		index, ok := parseNearIndex(slurp)
+		if !ok {
+			index = buildNearIndex(ctx)
+		} else {
+			for cell, ids := range index.Cells {
+				kept := ids[:0]
+				for _, id := range ids {
+					if !changed.Has(id) {
+						kept = append(kept, id)
+					}
+				}
+				if len(kept) == 0 {
+					delete(index.Cells, cell)
+				} else {
+					index.Cells[cell] = kept
+				}
+			}
+			for _, e := range saved {
+				for _, cell := range geo.GeohashCells(e.route, nearPrecision) {
+					index.Cells[cell] = append(index.Cells[cell], e.Id)
+				}
+			}
+		}
+		index.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+		return json.Marshal(index)
+	})
+}
+
+// ?lat= and ?lng= in degrees, ?radius= in meters
+func nearParams(c *gin.Context) (geo.Point, float64, error) {
+	var point geo.Point
+
+	lat, err := strconv.ParseFloat(c.Query("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return point, 0, fmt.Errorf("lat must be a latitude from -90 to 90")
+	}
+	lng, err := strconv.ParseFloat(c.Query("lng"), 64)
+	if err != nil || lng < -180 || lng > 180 {
+		return point, 0, fmt.Errorf("lng must be a longitude from -180 to 180")
+	}
+	radius := float64(defaultNearRadius)
+	if raw := c.Query("radius"); raw != "" {
+		radius, err = strconv.ParseFloat(raw, 64)
+		if err != nil || radius <= 0 || radius > maxNearRadius {
+			return point, 0, fmt.Errorf("radius must be meters from 1 to %d", maxNearRadius)
+		}
+	}
+	return geo.Point{Lat: lat, Lng: lng}, radius, nil
+}
+
+// stored activities whose routes pass within the radius of the point, the
+// closest first; the cells around the point narrow which routes are measured
+func getActivitiesNear(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	point, radius, err := nearParams(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filters, err := activityTypeFilters(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	visibility, err := visibilityFilters(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	index, ok := loadNearIndex(ctx)
+	if !ok {
+		activityIndexMu.Lock()
+		index = buildNearIndex(ctx)
+		if err := storeNearIndex(ctx, index); err != nil {
+			fmt.Println(err)
+		}
+		activityIndexMu.Unlock()
+	}
+
+	candidates := make(map[int64]bool)
+	for _, cell := range geo.GeohashCovering(point, radius, nearPrecision) {
+		for _, id := range index.Cells[cell] {
+			candidates[id] = true
+		}
+	}
+
+	near := []NearActivity{}
+	for _, e := range loadActivityIndex(ctx).Entries {
+		if !candidates[e.Id] {
+			continue
+		}
+		if !strava.MatchesActivityType(filters, strava.NormalizeSportType(e.SportType, e.Type)) || !visibility.matches(e.Visibility, e.HideFromHome) {
+			continue
+		}
+		activity, ok := loadActivity(ctx, e.Id)
+		if !ok {
+			continue
+		}
+		if distance := geo.DistanceToRoute(point, activityRoute(activity)); distance >= 0 && distance <= radius {
+			near = append(near, NearActivity{ActivityIndexEntry: e, Distance: math.Round(distance)})
+		}
+	}
+	// the index is newest first, which ties keep
+	sort.SliceStable(near, func(i, j int) bool { return near[i].Distance < near[j].Distance })
+
+	c.IndentedJSON(http.StatusOK, gin.H{"lat": point.Lat, "lng": point.Lng, "radius": radius, "updated_at": index.UpdatedAt, "data": near})
+}
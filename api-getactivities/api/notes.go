@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+)
+
+// the athlete's own journal for an activity, kept here and never sent to
+// strava, so it is not lost when the description is edited there
+const notesPrefix = "notes/"
+
+const maxNoteLength = 4000
+
+// ActivityNote is the journal entry of one activity, only served with the admin token
+type ActivityNote struct {
+	Id              int64  `json:"id"`
+	PerceivedEffort int    `json:"perceived_effort,omitempty"` // 1 to 10
+	Nutrition       string `json:"nutrition,omitempty"`
+	Injuries        string `json:"injuries,omitempty"`
+	Text            string `json:"text,omitempty"`
+	CreatedAt       string `json:"created_at"`
+	UpdatedAt       string `json:"updated_at"`
+}
+
+func noteObject(id int64) string {
+	return fmt.Sprintf("%s%d.json", notesPrefix, id)
+}
+
+func loadNote(ctx context.Context, id int64) (ActivityNote, error) {
+	var note ActivityNote
+
+	slurp, err := readGCSObject(ctx, noteObject(id))
+	if err != nil {
+		return note, err
+	}
+	err = json.Unmarshal(slurp, &note)
+	return note, err
+}
+
+// the note merged into the owner's view of an activity, nil when it has none
+func activityNote(ctx context.Context, id int64) *ActivityNote {
+	note, err := loadNote(ctx, id)
+	if err != nil {
+		if !errors.Is(err, storage.ErrObjectNotExist) {
+			fmt.Println(err)
+		}
+		return nil
+	}
+	return &note
+}
+
+func bindNote(c *gin.Context) (ActivityNote, error) {
+	var note ActivityNote
+	if err := c.ShouldBindJSON(&note); err != nil {
+		return note, fmt.Errorf("body must be a JSON object with perceived_effort, nutrition, injuries and text")
+	}
+	note.Nutrition = strings.TrimSpace(note.Nutrition)
+	note.Injuries = strings.TrimSpace(note.Injuries)
+	note.Text = strings.TrimSpace(note.Text)
+	if note.PerceivedEffort < 0 || note.PerceivedEffort > 10 {
+		return note, fmt.Errorf("perceived_effort must be from 1 to 10, or 0 to leave it out")
+	}
+	if len(note.Nutrition)+len(note.Injuries)+len(note.Text) > maxNoteLength {
+		return note, fmt.Errorf("a note must be at most %d characters", maxNoteLength)
+	}
+	if note.PerceivedEffort == 0 && note.Nutrition == "" && note.Injuries == "" && note.Text == "" {
+		return note, fmt.Errorf("a note must have at least one field, DELETE it instead")
+	}
+	return note, nil
+}
+
+func noteActivityId(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "activity id must be numeric"})
+		return 0, false
+	}
+	return id, true
+}
+
+func getActivityNote(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, ok := noteActivityId(c)
+	if !ok {
+		return
+	}
+
+	note, err := loadNote(ctx, id)
+	if err != nil {
+		if !errors.Is(err, storage.ErrObjectNotExist) {
+			fmt.Println(err)
+		}
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "activity has no note"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, note)
+}
+
+// creates or replaces the note, keeping when it was first written
+func putActivityNote(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, ok := noteActivityId(c)
+	if !ok {
+		return
+	}
+	note, err := bindNote(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := loadActivity(ctx, id); !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "activity is not stored"})
+		return
+	}
+
+	status := http.StatusOK
+	now := time.Now().UTC().Format(time.RFC3339)
+	note.Id = id
+	note.CreatedAt = now
+	note.UpdatedAt = now
+	if existing, err := loadNote(ctx, id); err == nil {
+		note.CreatedAt = existing.CreatedAt
+	} else {
+		status = http.StatusCreated
+	}
+
+	bytes_note, err := json.Marshal(note)
+	if err == nil {
+		err = putDataToGCS(ctx, noteObject(id), bytes_note)
+	}
+	// only which fields are set, the journal itself stays out of the audit log
+	recordAudit(AuditActivityNote, adminActor(c), strconv.FormatInt(id, 10), err, map[string]interface{}{
+		"perceived_effort": note.PerceivedEffort != 0,
+		"nutrition":        note.Nutrition != "",
+		"injuries":         note.Injuries != "",
+		"text":             note.Text != "",
+	})
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to store note"})
+		return
+	}
+	c.IndentedJSON(status, note)
+}
+
+func deleteActivityNote(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, ok := noteActivityId(c)
+	if !ok {
+		return
+	}
+
+	err := deleteDataFromGCS(ctx, noteObject(id))
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "activity has no note"})
+		return
+	}
+	recordAudit(AuditActivityNote, adminActor(c), strconv.FormatInt(id, 10), err, map[string]interface{}{"deleted": true})
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to delete note"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"id": id, "deleted": true})
+}
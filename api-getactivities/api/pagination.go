@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// position of an item in a list ordered newest first by key and then id,
+// pages are cut relative to it so items inserted by a sync don't shift later pages
+type pageCursor struct {
+	Key    string `json:"k"`
+	Id     int64  `json:"i"`
+	Before bool   `json:"b,omitempty"`
+}
+
+var errBadCursor = errors.New("cursor is not valid")
+
+func encodeCursor(cur pageCursor) string {
+	bytes_cursor, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(bytes_cursor)
+}
+
+func decodeCursor(s string) (*pageCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errBadCursor
+	}
+	var cur pageCursor
+	if err := json.Unmarshal(raw, &cur); err != nil {
+		return nil, errBadCursor
+	}
+	return &cur, nil
+}
+
+// reads limit and cursor from the query string
+func pageParams(c *gin.Context) (int, *pageCursor, error) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPageSize)))
+	if err != nil || limit < 1 || limit > maxPageSize {
+		return 0, nil, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+	}
+	cur, err := decodeCursor(c.Query("cursor"))
+	return limit, cur, err
+}
+
+// true when a sorts before b in newest first order
+func cursorLess(aKey string, aId int64, bKey string, bId int64) bool {
+	if aKey != bKey {
+		return aKey > bKey
+	}
+	return aId > bId
+}
+
+// cuts one page out of items, which must already be ordered newest first by key
+func paginate[T any](items []T, key func(T) (string, int64), cur *pageCursor, limit int) ([]T, *pageCursor, *pageCursor) {
+	start, end := 0, len(items)
+	if cur != nil {
+		if cur.Before {
+			end = 0
+			for end < len(items) {
+				k, id := key(items[end])
+				if !cursorLess(k, id, cur.Key, cur.Id) {
+					break
+				}
+				end++
+			}
+			start = end - limit
+			if start < 0 {
+				start = 0
+			}
+		} else {
+			for start < len(items) {
+				k, id := key(items[start])
+				if cursorLess(cur.Key, cur.Id, k, id) {
+					break
+				}
+				start++
+			}
+		}
+	}
+	if end-start > limit {
+		end = start + limit
+	}
+
+	page := items[start:end]
+
+	var next, prev *pageCursor
+	if end < len(items) && len(page) > 0 {
+		k, id := key(page[len(page)-1])
+		next = &pageCursor{Key: k, Id: id}
+	}
+	if start > 0 && len(page) > 0 {
+		k, id := key(page[0])
+		prev = &pageCursor{Key: k, Id: id, Before: true}
+	}
+	return page, next, prev
+}
+
+// sets an RFC 5988 Link header pointing at the neighbouring pages and returns
+// the cursors for the response body
+func setPageLinks(c *gin.Context, next *pageCursor, prev *pageCursor) (string, string) {
+	var links []string
+	var nextCursor, prevCursor string
+
+	link := func(cur *pageCursor, rel string) string {
+		encoded := encodeCursor(*cur)
+		u := *c.Request.URL
+		q := u.Query()
+		q.Set("cursor", encoded)
+		u.RawQuery = q.Encode()
+		links = append(links, fmt.Sprintf("<%s>; rel=\"%s\"", u.RequestURI(), rel))
+		return encoded
+	}
+
+	if next != nil {
+		nextCursor = link(next, "next")
+	}
+	if prev != nil {
+		prevCursor = link(prev, "prev")
+	}
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+	return nextCursor, prevCursor
+}
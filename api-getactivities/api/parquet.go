@@ -0,0 +1,213 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/parquet"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/warehouse"
+)
+
+const parquetContentType = "application/vnd.apache.parquet"
+
+// rows are stamped with when the index last changed rather than now, so
+// exporting unchanged data gives the same file and its stored export is reused
+func exportedAt(index ActivityIndex) time.Time {
+	if t, err := time.Parse(time.RFC3339, index.UpdatedAt); err == nil {
+		return t
+	}
+	return time.Now()
+}
+
+// the same normalized rows the BigQuery export streams, so both give the same columns
+func storedActivityRows(ctx context.Context) []warehouse.ActivityRow {
+	index := loadActivityIndex(ctx)
+	now := exportedAt(index)
+	var rows []warehouse.ActivityRow
+	for _, e := range index.Entries {
+		if activity, ok := loadActivity(ctx, e.Id); ok {
+			rows = append(rows, warehouse.NewActivityRow(activity, now))
+		}
+	}
+	return rows
+}
+
+// only streams already stored are exported, an export never calls strava
+func storedSampleRows(ctx context.Context) ([]warehouse.SampleRow, error) {
+	index := loadActivityIndex(ctx)
+	now := exportedAt(index)
+	var rows []warehouse.SampleRow
+	for _, e := range index.Entries {
+		slurp, err := readGCSObject(ctx, streamsObject(e.Id))
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var streams strava.StreamSet
+		if err := json.Unmarshal(slurp, &streams); err != nil {
+			fmt.Println(streamsObject(e.Id), err)
+			continue
+		}
+		rows = append(rows, warehouse.NewSampleRows(e.Id, streams, now)...)
+	}
+	return rows, nil
+}
+
+func parseTimestamp(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+// one field of every row, as a column's values
+func pick[R any, T any](rows []R, field func(R) T) []T {
+	values := make([]T, len(rows))
+	for i, r := range rows {
+		values[i] = field(r)
+	}
+	return values
+}
+
+func activityColumns(rows []warehouse.ActivityRow) []parquet.Column {
+	type row = warehouse.ActivityRow
+	return []parquet.Column{
+		parquet.Int64("activity_id", pick(rows, func(r row) int64 { return r.ActivityId })),
+		parquet.Int64("athlete_id", pick(rows, func(r row) int64 { return r.AthleteId })),
+		parquet.String("name", pick(rows, func(r row) string { return r.Name })),
+		parquet.String("type", pick(rows, func(r row) string { return r.Type })),
+		parquet.String("sport_type", pick(rows, func(r row) string { return r.SportType })),
+		parquet.Int64("workout_type", pick(rows, func(r row) int64 { return int64(r.WorkoutType) })),
+		parquet.Timestamp("start_date", pick(rows, func(r row) time.Time { return parseTimestamp(r.StartDate) })),
+		parquet.String("start_date_local", pick(rows, func(r row) string { return r.StartDateLocal })),
+		parquet.String("timezone", pick(rows, func(r row) string { return r.TimeZone })),
+		parquet.Float64("distance_m", pick(rows, func(r row) float64 { return r.Distance })),
+		parquet.Int64("moving_time_s", pick(rows, func(r row) int64 { return int64(r.MovingTime) })),
+		parquet.Int64("elapsed_time_s", pick(rows, func(r row) int64 { return int64(r.ElapsedTime) })),
+		parquet.Float64("total_elevation_gain_m", pick(rows, func(r row) float64 { return r.TotalElevationGain })),
+		parquet.Float64("average_speed_mps", pick(rows, func(r row) float64 { return r.AverageSpeed })),
+		parquet.Float64("max_speed_mps", pick(rows, func(r row) float64 { return r.MaxSpeed })),
+		parquet.Bool("has_heartrate", pick(rows, func(r row) bool { return r.HasHeartrate })),
+		parquet.Float64("calories", pick(rows, func(r row) float64 { return r.Calories })),
+		parquet.Int64("kudos_count", pick(rows, func(r row) int64 { return int64(r.KudosCount) })),
+		parquet.Int64("comment_count", pick(rows, func(r row) int64 { return int64(r.CommentCount) })),
+		parquet.Int64("achievement_count", pick(rows, func(r row) int64 { return int64(r.AchievementCount) })),
+		parquet.Int64("pr_count", pick(rows, func(r row) int64 { return int64(r.PrCount) })),
+		parquet.String("gear_id", pick(rows, func(r row) string { return r.GearId })),
+		parquet.Bool("trainer", pick(rows, func(r row) bool { return r.Trainer })),
+		parquet.Bool("commute", pick(rows, func(r row) bool { return r.Commute })),
+		parquet.Bool("manual", pick(rows, func(r row) bool { return r.Manual })),
+		parquet.Bool("private", pick(rows, func(r row) bool { return r.Private })),
+		parquet.String("device_name", pick(rows, func(r row) string { return r.DeviceName })),
+		parquet.Timestamp("exported_at", pick(rows, func(r row) time.Time { return parseTimestamp(r.SyncedAt) })),
+	}
+}
+
+func widen(v *int) *int64 {
+	if v == nil {
+		return nil
+	}
+	w := int64(*v)
+	return &w
+}
+
+func sampleColumns(rows []warehouse.SampleRow) []parquet.Column {
+	type row = warehouse.SampleRow
+	return []parquet.Column{
+		parquet.Int64("activity_id", pick(rows, func(r row) int64 { return r.ActivityId })),
+		parquet.Int64("offset_s", pick(rows, func(r row) int64 { return int64(r.Offset) })),
+		parquet.OptionalFloat64("distance_m", pick(rows, func(r row) *float64 { return r.Distance })),
+		parquet.OptionalFloat64("lat", pick(rows, func(r row) *float64 { return r.Lat })),
+		parquet.OptionalFloat64("lng", pick(rows, func(r row) *float64 { return r.Lng })),
+		parquet.OptionalFloat64("altitude_m", pick(rows, func(r row) *float64 { return r.Altitude })),
+		parquet.OptionalFloat64("velocity_mps", pick(rows, func(r row) *float64 { return r.Velocity })),
+		parquet.OptionalInt64("heartrate", pick(rows, func(r row) *int64 { return widen(r.Heartrate) })),
+		parquet.OptionalInt64("cadence", pick(rows, func(r row) *int64 { return widen(r.Cadence) })),
+		parquet.OptionalInt64("watts", pick(rows, func(r row) *int64 { return widen(r.Watts) })),
+		parquet.OptionalInt64("temp_c", pick(rows, func(r row) *int64 { return widen(r.Temp) })),
+		parquet.OptionalBool("moving", pick(rows, func(r row) *bool { return r.Moving })),
+		parquet.OptionalFloat64("grade_percent", pick(rows, func(r row) *float64 { return r.Grade })),
+	}
+}
+
+func parquetTable(ctx context.Context, table string) ([]parquet.Column, error) {
+	switch table {
+	case "activities":
+		return activityColumns(storedActivityRows(ctx)), nil
+	case "samples":
+		rows, err := storedSampleRows(ctx)
+		return sampleColumns(rows), err
+	}
+	return nil, fmt.Errorf("table must be activities or samples")
+}
+
+func getParquetExport(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	table := c.DefaultQuery("table", "activities")
+	columns, err := parquetTable(ctx, table)
+	if columns == nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusBadGateway, gin.H{"error": "unable to read stored streams"})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := parquet.Write(&buf, columns); err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to encode parquet"})
+		return
+	}
+	serveExport(c, table+".parquet", parquetContentType, buf.Bytes(), false)
+}
+
+func runParquetExport(args []string) error {
+	ctx := context.Background()
+	fs := flag.NewFlagSet("parquet-export", flag.ExitOnError)
+	bucket := fs.String("bucket", bucketName, "bucket to read stored activities from")
+	out := fs.String("out", "activities.parquet", "file to write the activity table to")
+	samples := fs.String("samples", "", "file to write the flattened stored streams to, skipped when empty")
+	fs.Parse(args)
+
+	useBucket(*bucket)
+
+	tables := [][2]string{{"activities", *out}}
+	if *samples != "" {
+		tables = append(tables, [2]string{"samples", *samples})
+	}
+	for _, t := range tables {
+		columns, err := parquetTable(ctx, t[0])
+		if err != nil {
+			return err
+		}
+		f, err := os.Create(t[1])
+		if err != nil {
+			return err
+		}
+		err = parquet.Write(f, columns)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "wrote %s to %s\n", t[0], t[1])
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+)
+
+// injury, illness and downtime periods; health data, so the records and their
+// notes take the admin token, while aggregates only show the type and dates
+const (
+	periodsPrefix = "periods/"
+	periodsObject = periodsPrefix + "records.json"
+)
+
+const maxPeriodNotes = 1000
+
+var errPeriodNotFound = errors.New("period not found")
+
+// EXCLUDED_PERIOD_TYPES, e.g. injury,illness: plans missed during periods of
+// these types are excused and left out of compliance
+var excludedPeriodTypes = parsePeriodTypes(os.Getenv("EXCLUDED_PERIOD_TYPES"))
+
+func parsePeriodTypes(s string) map[string]bool {
+	types := make(map[string]bool)
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types[t] = true
+		}
+	}
+	return types
+}
+
+type PeriodStore struct {
+	NextId  int64             `json:"next_id"`
+	Periods []analysis.Period `json:"periods"`
+}
+
+// the periods are read-modify-written so updates from concurrent handlers are serialized
+var periodsMu sync.Mutex
+
+func loadPeriods(ctx context.Context) PeriodStore {
+	store := PeriodStore{NextId: 1}
+
+	slurp := getDataFromGCS(ctx, periodsObject)
+	if slurp == nil {
+		return store
+	}
+	if err := json.Unmarshal(slurp, &store); err != nil {
+		fmt.Println(err)
+	}
+	return store
+}
+
+func updatePeriods(ctx context.Context, change func(store *PeriodStore) error) error {
+	periodsMu.Lock()
+	defer periodsMu.Unlock()
+
+	store := loadPeriods(ctx)
+	if err := change(&store); err != nil {
+		return err
+	}
+
+	bytes_store, err := json.Marshal(store)
+	if err != nil {
+		return err
+	}
+	return putDataToGCS(ctx, periodsObject, bytes_store)
+}
+
+// the periods overlapping from to to, both dates included, without their
+// notes, for annotating what is shown without the admin token
+func periodAnnotations(ctx context.Context, from string, to string) []analysis.Period {
+	periods := analysis.Overlapping(loadPeriods(ctx).Periods, from, to)
+	for i := range periods {
+		periods[i].Notes = ""
+	}
+	return periods
+}
+
+// the periods of EXCLUDED_PERIOD_TYPES overlapping from to to
+func excludedPeriods(ctx context.Context, from string, to string) []analysis.Period {
+	var excluded []analysis.Period
+	for _, p := range analysis.Overlapping(loadPeriods(ctx).Periods, from, to) {
+		if excludedPeriodTypes[p.Type] {
+			excluded = append(excluded, p)
+		}
+	}
+	return excluded
+}
+
+func bindPeriod(c *gin.Context) (analysis.Period, error) {
+	var period analysis.Period
+	if err := c.ShouldBindJSON(&period); err != nil {
+		return period, fmt.Errorf("body must be a JSON period")
+	}
+	known := false
+	for _, t := range analysis.PeriodTypes {
+		known = known || t == period.Type
+	}
+	if !known {
+		return period, fmt.Errorf("type must be one of %s", strings.Join(analysis.PeriodTypes, ", "))
+	}
+	if _, err := time.Parse("2006-01-02", period.Start); err != nil {
+		return period, fmt.Errorf("start must be formatted YYYY-MM-DD")
+	}
+	if period.End != "" {
+		if _, err := time.Parse("2006-01-02", period.End); err != nil {
+			return period, fmt.Errorf("end must be formatted YYYY-MM-DD, or left out while the period lasts")
+		}
+		if period.End < period.Start {
+			return period, fmt.Errorf("end must not be before start")
+		}
+	}
+	period.Notes = strings.TrimSpace(period.Notes)
+	if len(period.Notes) > maxPeriodNotes {
+		return period, fmt.Errorf("notes must be at most %d characters", maxPeriodNotes)
+	}
+	return period, nil
+}
+
+func periodId(c *gin.Context) (int64, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("period id must be numeric")
+	}
+	return id, nil
+}
+
+// the periods overlapping ?from= to ?to=, all of them without either
+func getPeriods(c *gin.Context) {
+	ctx := c.Request.Context()
+	from, to, err := planRange(c, "", "")
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if to == "" {
+		to = "9999-12-31"
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"data": analysis.Overlapping(loadPeriods(ctx).Periods, from, to)})
+}
+
+func getPeriod(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, err := periodId(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, period := range loadPeriods(ctx).Periods {
+		if period.Id == id {
+			c.IndentedJSON(http.StatusOK, period)
+			return
+		}
+	}
+	c.IndentedJSON(http.StatusNotFound, gin.H{"error": errPeriodNotFound.Error()})
+}
+
+func postPeriod(c *gin.Context) {
+	ctx := c.Request.Context()
+	period, err := bindPeriod(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = updatePeriods(ctx, func(store *PeriodStore) error {
+		period.Id = store.NextId
+		store.NextId++
+		store.Periods = append(store.Periods, period)
+		return nil
+	})
+	recordAudit(AuditPeriodCreate, adminActor(c), strconv.FormatInt(period.Id, 10), err, map[string]interface{}{"type": period.Type})
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to store period"})
+		return
+	}
+	c.IndentedJSON(http.StatusCreated, period)
+}
+
+func putPeriod(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, err := periodId(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	period, err := bindPeriod(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	period.Id = id
+
+	err = updatePeriods(ctx, func(store *PeriodStore) error {
+		for i := range store.Periods {
+			if store.Periods[i].Id == id {
+				store.Periods[i] = period
+				return nil
+			}
+		}
+		return errPeriodNotFound
+	})
+	recordAudit(AuditPeriodUpdate, adminActor(c), strconv.FormatInt(id, 10), err, map[string]interface{}{"type": period.Type})
+	if err == errPeriodNotFound {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to store period"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, period)
+}
+
+func deletePeriod(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, err := periodId(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = updatePeriods(ctx, func(store *PeriodStore) error {
+		for i := range store.Periods {
+			if store.Periods[i].Id == id {
+				store.Periods = append(store.Periods[:i], store.Periods[i+1:]...)
+				return nil
+			}
+		}
+		return errPeriodNotFound
+	})
+	recordAudit(AuditPeriodDelete, adminActor(c), strconv.FormatInt(id, 10), err, nil)
+	if err == errPeriodNotFound {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to delete period"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"id": id, "deleted": true})
+}
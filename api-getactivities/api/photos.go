@@ -0,0 +1,317 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// each activity's photo list, and the images mirrored the first time they
+// are asked for so they outlive strava's links
+const (
+	photosPrefix      = "photos/"
+	photoImagesPrefix = photosPrefix + "images/"
+)
+
+// the longest side, in pixels, of the images listed and mirrored
+const photoSize = 2048
+
+// activities whose photos are listed from strava in one gallery request, the
+// rest are listed by the next ones
+const maxPhotoListings = 20
+
+const maxPhotoBytes = 20 << 20
+
+var photoClient = &http.Client{Timeout: 30 * time.Second}
+
+type ActivityPhotos struct {
+	FetchedAt string         `json:"fetched_at"`
+	Photos    []strava.Photo `json:"photos"`
+}
+
+type GalleryPhoto struct {
+	Id           string `json:"id"`
+	ActivityId   int64  `json:"activity_id"`
+	ActivityName string `json:"activity_name"`
+	Activity     string `json:"activity"` // link to the activity
+	Caption      string `json:"caption"`
+	TakenAt      string `json:"taken_at"`
+	Url          string `json:"url"` // the mirror, which fetches the image the first time
+	Thumbnail    string `json:"thumbnail"`
+	Mirrored     bool   `json:"mirrored"`
+}
+
+func activityPhotosObject(activityId int64) string {
+	return fmt.Sprintf("%s%d.json", photosPrefix, activityId)
+}
+
+func photoImageObject(uniqueId string) string {
+	return photoImagesPrefix + uniqueId
+}
+
+func loadActivityPhotos(ctx context.Context, activityId int64) (ActivityPhotos, bool) {
+	var photos ActivityPhotos
+
+	slurp := getDataFromGCS(ctx, activityPhotosObject(activityId))
+	if slurp == nil {
+		return photos, false
+	}
+	if err := json.Unmarshal(slurp, &photos); err != nil {
+		fmt.Println(err)
+		return photos, false
+	}
+	return photos, true
+}
+
+func fetchActivityPhotos(ctx context.Context, client *http.Client, access_token string, activityId int64) (ActivityPhotos, error) {
+	list, err := strava.ListActivityPhotos(client, access_token, activityId, photoSize)
+	if err != nil {
+		return ActivityPhotos{}, err
+	}
+	photos := ActivityPhotos{FetchedAt: time.Now().UTC().Format(time.RFC3339), Photos: list}
+	bytes_photos, err := json.Marshal(photos)
+	if err != nil {
+		return photos, err
+	}
+	return photos, putDataToGCS(ctx, activityPhotosObject(activityId), bytes_photos)
+}
+
+// a stored list is listed again once the activity was stored after it, since
+// photos may have been added in between
+func photosStale(photos ActivityPhotos, entry ActivityIndexEntry) bool {
+	return entry.StoredAt > photos.FetchedAt
+}
+
+func photoCount(a strava.ActivitySummary) int {
+	if a.TotalPhotoCount > a.PhotoCount {
+		return a.TotalPhotoCount
+	}
+	return a.PhotoCount
+}
+
+// every photo of the stored activities, newest first and paginated like the
+// activity index; lists not stored yet are fetched a few activities at a time
+// and counted as pending
+func getPhotos(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	limit, cur, err := pageParams(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filters, err := activityTypeFilters(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	visibility, err := visibilityFilters(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	mirrored := make(map[string]bool)
+	if objects, err := listGCSObjects(ctx, photoImagesPrefix); err == nil {
+		for _, object := range objects {
+			mirrored[object[len(photoImagesPrefix):]] = true
+		}
+	} else {
+		fmt.Println(err)
+	}
+
+	var client *http.Client
+	var access_token string
+	listings, pending := 0, 0
+	gallery := []GalleryPhoto{}
+	for _, e := range loadActivityIndex(ctx).Entries {
+		if !strava.MatchesActivityType(filters, strava.NormalizeSportType(e.SportType, e.Type)) || !visibility.matches(e.Visibility, e.HideFromHome) {
+			continue
+		}
+		activity, ok := loadActivity(ctx, e.Id)
+		if !ok || photoCount(activity.ActivitySummary) == 0 {
+			continue
+		}
+		photos, ok := loadActivityPhotos(ctx, e.Id)
+		if !ok || photosStale(photos, e) {
+			if listings >= maxPhotoListings || timedOut(c) {
+				pending++
+				if !ok {
+					continue
+				}
+			} else {
+				listings++
+				if client == nil {
+					client = stravaClient(c)
+					access_token, err = getAccessToken(ctx, client)
+				}
+				if err == nil {
+					var fetched ActivityPhotos
+					if fetched, err = fetchActivityPhotos(ctx, client, access_token, e.Id); err == nil {
+						photos, ok = fetched, true
+					}
+				}
+				if err != nil {
+					fmt.Println(e.Id, err)
+					pending++
+					err = nil
+					if !ok {
+						continue
+					}
+				}
+			}
+		}
+
+		for _, p := range photos.Photos {
+			gallery = append(gallery, GalleryPhoto{
+				Id:           p.UniqueId,
+				ActivityId:   e.Id,
+				ActivityName: activity.Name,
+				Activity:     fmt.Sprintf("%s/strava/activities/%d", pathPrefix, e.Id),
+				Caption:      p.Caption,
+				TakenAt:      p.CreatedAt,
+				Url:          fmt.Sprintf("%s/strava/activities/%d/photos/%s", pathPrefix, e.Id, p.UniqueId),
+				Thumbnail:    fmt.Sprintf("%s/strava/photos/%s/thumb", pathPrefix, p.UniqueId),
+				Mirrored:     mirrored[p.UniqueId],
+			})
+		}
+	}
+
+	// newest first like the index, photos taken together ordered by id
+	key := func(p GalleryPhoto) (string, int64) {
+		return p.TakenAt + "|" + p.Id, p.ActivityId
+	}
+	sort.Slice(gallery, func(i, j int) bool {
+		ki, ii := key(gallery[i])
+		kj, ij := key(gallery[j])
+		return cursorLess(ki, ii, kj, ij)
+	})
+
+	page, next, prev := paginate(gallery, key, cur, limit)
+	nextCursor, prevCursor := setPageLinks(c, next, prev)
+
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"data":        page,
+		"pending":     pending,
+		"next_cursor": nextCursor,
+		"prev_cursor": prevCursor,
+	})
+}
+
+// the activity a photo was listed for, from the stored lists
+func photoActivity(ctx context.Context, uniqueId string) (int64, bool) {
+	objects, err := listGCSObjects(ctx, photosPrefix)
+	if err != nil {
+		fmt.Println(err)
+		return 0, false
+	}
+	for _, object := range objects {
+		id, err := strconv.ParseInt(strings.TrimSuffix(object[len(photosPrefix):], ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+		photos, _ := loadActivityPhotos(ctx, id)
+		for _, p := range photos.Photos {
+			if p.UniqueId == uniqueId {
+				return id, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// the mirrored image, fetched from strava's link and stored the first time;
+// an activityId of 0 is looked up in the stored lists. Errors are answered
+func mirroredPhoto(c *gin.Context, activityId int64, uniqueId string) ([]byte, bool) {
+	ctx := c.Request.Context()
+	object := photoImageObject(uniqueId)
+	if image, err := readGCSObject(ctx, object); err == nil {
+		return image, true
+	}
+
+	if activityId == 0 {
+		var ok bool
+		if activityId, ok = photoActivity(ctx, uniqueId); !ok {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"error": "photo not found"})
+			return nil, false
+		}
+	}
+	photos, ok := loadActivityPhotos(ctx, activityId)
+	if !ok {
+		client := stravaClient(c)
+		access_token, err := getAccessToken(ctx, client)
+		if err != nil {
+			respondUpstreamError(c, "unable to refresh strava token", err)
+			return nil, false
+		}
+		if photos, err = fetchActivityPhotos(ctx, client, access_token, activityId); err != nil {
+			respondUpstreamError(c, "unable to fetch photos from strava", err)
+			return nil, false
+		}
+	}
+
+	source := ""
+	for _, p := range photos.Photos {
+		if p.UniqueId != uniqueId {
+			continue
+		}
+		source = p.Urls[strconv.Itoa(photoSize)]
+		for _, u := range p.Urls {
+			if source == "" {
+				source = u
+			}
+		}
+	}
+	if source == "" {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "photo not found"})
+		return nil, false
+	}
+
+	res, err := photoClient.Get(source)
+	if err == nil && res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		err = fmt.Errorf("photo %s: %s", uniqueId, res.Status)
+	}
+	if err != nil {
+		respondUpstreamError(c, "unable to fetch photo", err)
+		return nil, false
+	}
+	defer res.Body.Close()
+	image, err := io.ReadAll(io.LimitReader(res.Body, maxPhotoBytes+1))
+	if err == nil && len(image) > maxPhotoBytes {
+		err = fmt.Errorf("photo %s is larger than %d bytes", uniqueId, maxPhotoBytes)
+	}
+	if err != nil {
+		respondUpstreamError(c, "unable to fetch photo", err)
+		return nil, false
+	}
+
+	if err := putDataToGCS(ctx, object, image); err != nil {
+		fmt.Println(err)
+	}
+	return image, true
+}
+
+func getActivityPhoto(c *gin.Context) {
+	setCorsHeaders(c)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "activity id must be numeric"})
+		return
+	}
+	if image, ok := mirroredPhoto(c, id, c.Param("photo")); ok {
+		c.Data(http.StatusOK, http.DetectContentType(image), image)
+	}
+}
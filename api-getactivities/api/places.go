@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/geo"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// the country or region polygons activities are located with, nil without
+// GEO_BOUNDARIES; nothing is sent to a geocoding service
+var boundaries *geo.Boundaries
+
+// GEO_BOUNDARIES is the path of a GeoJSON file such as Natural Earth's admin 1
+// states and provinces; dev mode falls back to rough fixture boxes
+func openBoundaries(cfg Config) {
+	var data []byte
+	var err error
+	if path := os.Getenv("GEO_BOUNDARIES"); path != "" {
+		data, err = os.ReadFile(path)
+	} else if cfg.Dev {
+		data, err = fixtureFS.ReadFile("fixtures/boundaries.json")
+	} else {
+		return
+	}
+	if err == nil {
+		boundaries, err = geo.ParseBoundaries(data)
+	}
+	if err != nil {
+		fmt.Println("geo boundaries broken:", err)
+	}
+}
+
+// nil when there are no boundaries, the entry then keeps no places
+func activityPlaces(route []geo.Point) []geo.Place {
+	if boundaries == nil {
+		return nil
+	}
+	return boundaries.Places(route)
+}
+
+// the countries and regions the stored activities passed through, with the
+// first activity in each; ?type= narrows it to rides or runs
+func getCountries(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	filters, err := activityTypeFilters(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var visits []analysis.PlaceVisit
+	for _, e := range loadActivityIndex(ctx).Entries {
+		if len(e.Places) > 0 && strava.MatchesActivityType(filters, strava.NormalizeSportType(e.SportType, e.Type)) {
+			visits = append(visits, analysis.PlaceVisit{ActivityId: e.Id, StartDate: e.StartDate, Places: e.Places})
+		}
+	}
+	countries := analysis.PlacesVisited(visits)
+
+	response := gin.H{"data": countries}
+	if boundaries == nil {
+		response["warnings"] = []string{"GEO_BOUNDARIES is not configured, activities are not being located"}
+	} else {
+		for i := range countries {
+			countries[i].Name = boundaries.Name(countries[i].Country)
+			for j := range countries[i].Regions {
+				countries[i].Regions[j].Name = boundaries.Name(countries[i].Regions[j].Region)
+			}
+		}
+	}
+	c.IndentedJSON(http.StatusOK, response)
+}
+
+// locates every stored activity again, after GEO_BOUNDARIES was first set or
+// changed to other boundaries
+func runGeocode(args []string) error {
+	ctx := context.Background()
+	fs := flag.NewFlagSet("geocode", flag.ExitOnError)
+	bucket := fs.String("bucket", bucketName, "bucket the activities are stored in")
+	fs.Parse(args)
+
+	useBucket(*bucket)
+
+	if boundaries == nil {
+		return fmt.Errorf("GEO_BOUNDARIES must name a GeoJSON file of country or region polygons")
+	}
+
+	var entries []ActivityIndexEntry
+	located := 0
+	for _, e := range loadActivityIndex(ctx).Entries {
+		activity, ok := loadActivity(ctx, e.Id)
+		if !ok {
+			continue
+		}
+		// upsertActivityIndex also moves the entry in the spatial indexes
+		e.route = activityRoute(activity)
+		e.Places = activityPlaces(e.route)
+		if len(e.Places) > 0 {
+			located++
+		}
+		entries = append(entries, e)
+	}
+	if err := upsertActivityIndex(ctx, entries); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "located %d of %d activities\n", located, len(entries))
+	return nil
+}
@@ -0,0 +1,337 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+const plansObject = "plans/workouts.json"
+
+// compliance is reported for the last four weeks unless ?from= says otherwise
+const complianceDays = 28
+
+// what TSS is estimated against; without them the ftp on the athlete's strava
+// profile and 90% of the highest heart rate in the report are used
+var (
+	thresholdHeartrate = env.Int("THRESHOLD_HEARTRATE", 0)
+	athleteFtp         = env.Int("ATHLETE_FTP", 0)
+)
+
+const thresholdHeartrateShare = 0.9
+
+var errPlanNotFound = errors.New("planned workout not found")
+
+type PlanStore struct {
+	NextId   int64                     `json:"next_id"`
+	Workouts []analysis.PlannedWorkout `json:"workouts"`
+}
+
+// the plans are read-modify-written so updates from concurrent handlers are serialized
+var plansMu sync.Mutex
+
+func loadPlans(ctx context.Context) PlanStore {
+	store := PlanStore{NextId: 1}
+
+	slurp := getDataFromGCS(ctx, plansObject)
+	if slurp == nil {
+		return store
+	}
+	if err := json.Unmarshal(slurp, &store); err != nil {
+		fmt.Println(err)
+	}
+	return store
+}
+
+func updatePlans(ctx context.Context, change func(store *PlanStore) error) error {
+	plansMu.Lock()
+	defer plansMu.Unlock()
+
+	store := loadPlans(ctx)
+	if err := change(&store); err != nil {
+		return err
+	}
+
+	bytes_store, err := json.Marshal(store)
+	if err != nil {
+		return err
+	}
+	return putDataToGCS(ctx, plansObject, bytes_store)
+}
+
+// a planned workout from the request body, its sport type made canonical
+func bindPlan(c *gin.Context) (analysis.PlannedWorkout, error) {
+	var plan analysis.PlannedWorkout
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		return plan, fmt.Errorf("body must be a JSON planned workout")
+	}
+	if _, err := time.Parse("2006-01-02", plan.Date); err != nil {
+		return plan, fmt.Errorf("date must be formatted YYYY-MM-DD")
+	}
+	sport, ok := strava.CanonicalSportType(plan.SportType)
+	if !ok {
+		return plan, fmt.Errorf("unknown sport type %q", plan.SportType)
+	}
+	plan.SportType = sport
+	if plan.Duration < 0 || plan.Distance < 0 || plan.TSS < 0 {
+		return plan, fmt.Errorf("duration, distance and tss must not be negative")
+	}
+	return plan, nil
+}
+
+func planId(c *gin.Context) (int64, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("plan id must be numeric")
+	}
+	return id, nil
+}
+
+// ?from= and ?to=, dates like 2006-01-02, both included; either defaults
+// when missing
+func planRange(c *gin.Context, from string, to string) (string, string, error) {
+	from = c.DefaultQuery("from", from)
+	to = c.DefaultQuery("to", to)
+	for _, day := range []string{from, to} {
+		if day == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", day); err != nil {
+			return "", "", fmt.Errorf("from and to must be formatted YYYY-MM-DD")
+		}
+	}
+	return from, to, nil
+}
+
+func plansBetween(ctx context.Context, from string, to string) []analysis.PlannedWorkout {
+	plans := []analysis.PlannedWorkout{}
+	for _, plan := range loadPlans(ctx).Workouts {
+		if (from == "" || plan.Date >= from) && (to == "" || plan.Date <= to) {
+			plans = append(plans, plan)
+		}
+	}
+	sort.SliceStable(plans, func(i, j int) bool { return plans[i].Date < plans[j].Date })
+	return plans
+}
+
+func getPlans(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	from, to, err := planRange(c, "", "")
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"data": plansBetween(ctx, from, to)})
+}
+
+func getPlan(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	id, err := planId(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, plan := range loadPlans(ctx).Workouts {
+		if plan.Id == id {
+			c.IndentedJSON(http.StatusOK, plan)
+			return
+		}
+	}
+	c.IndentedJSON(http.StatusNotFound, gin.H{"error": errPlanNotFound.Error()})
+}
+
+func postPlan(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	plan, err := bindPlan(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = updatePlans(ctx, func(store *PlanStore) error {
+		plan.Id = store.NextId
+		store.NextId++
+		store.Workouts = append(store.Workouts, plan)
+		return nil
+	})
+	recordAudit(AuditPlanCreate, adminActor(c), strconv.FormatInt(plan.Id, 10), err, map[string]interface{}{"date": plan.Date, "sport_type": plan.SportType})
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to store planned workout"})
+		return
+	}
+	c.IndentedJSON(http.StatusCreated, plan)
+}
+
+func putPlan(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	id, err := planId(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	plan, err := bindPlan(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	plan.Id = id
+
+	err = updatePlans(ctx, func(store *PlanStore) error {
+		for i := range store.Workouts {
+			if store.Workouts[i].Id == id {
+				store.Workouts[i] = plan
+				return nil
+			}
+		}
+		return errPlanNotFound
+	})
+	recordAudit(AuditPlanUpdate, adminActor(c), strconv.FormatInt(id, 10), err, map[string]interface{}{"date": plan.Date, "sport_type": plan.SportType})
+	if err == errPlanNotFound {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to store planned workout"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, plan)
+}
+
+func deletePlan(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	id, err := planId(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = updatePlans(ctx, func(store *PlanStore) error {
+		for i := range store.Workouts {
+			if store.Workouts[i].Id == id {
+				store.Workouts = append(store.Workouts[:i], store.Workouts[i+1:]...)
+				return nil
+			}
+		}
+		return errPlanNotFound
+	})
+	recordAudit(AuditPlanDelete, adminActor(c), strconv.FormatInt(id, 10), err, nil)
+	if err == errPlanNotFound {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to store planned workout"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"id": id, "deleted": true})
+}
+
+// ATHLETE_FTP, then the ftp on the athlete's strava profile; one strava call
+// that is skipped unless wanted, 0 when it fails
+func trainingFtp(ctx context.Context, wanted bool) int {
+	if athleteFtp > 0 {
+		return athleteFtp
+	}
+	if !wanted {
+		return 0
+	}
+	client := strava.DefaultClient
+
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		fmt.Println(err)
+		return 0
+	}
+	profile, err := fetchAthleteProfile(client, access_token)
+	if err != nil {
+		fmt.Println(err)
+		return 0
+	}
+	return profile.Ftp
+}
+
+// the ftp is only looked up when a plan has a TSS target
+func planFtp(ctx context.Context, plans []analysis.PlannedWorkout) int {
+	wanted := false
+	for _, plan := range plans {
+		wanted = wanted || plan.TSS > 0
+	}
+	return trainingFtp(ctx, wanted)
+}
+
+// estimates TSS against THRESHOLD_HEARTRATE, or without it a share of the
+// highest heart rate among the activities
+func trainingStress(activities []strava.ActivitySummary, ftp int) func(strava.ActivitySummary) float64 {
+	threshold := float64(thresholdHeartrate)
+	if threshold == 0 {
+		threshold = thresholdHeartrateShare * analysis.HighestHeartrate(activities)
+	}
+	return func(a strava.ActivitySummary) float64 {
+		return analysis.TrainingStress(a, ftp, threshold)
+	}
+}
+
+// planned workouts between ?from= and ?to= matched with the stored
+// activities that completed them
+func getPlanCompliance(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	loc, err := athleteZone(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now().In(loc)
+	today := now.Format("2006-01-02")
+	from, to, err := planRange(c, now.AddDate(0, 0, -complianceDays+1).Format("2006-01-02"), today)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	plans := plansBetween(ctx, from, to)
+
+	// activities started in other zones may fall on a day either side
+	start, _ := time.Parse("2006-01-02", from)
+	end, _ := time.Parse("2006-01-02", to)
+	start, end = start.AddDate(0, 0, -1), end.AddDate(0, 0, 2)
+	var activities []strava.ActivitySummary
+	for _, e := range loadActivityIndex(ctx).Entries {
+		at, err := time.Parse(time.RFC3339, e.StartDate)
+		if err != nil || at.Before(start) || !at.Before(end) {
+			continue
+		}
+		if activity, ok := loadActivity(ctx, e.Id); ok {
+			activities = append(activities, activity.ActivitySummary)
+		}
+	}
+
+	stress := trainingStress(activities, planFtp(ctx, plans))
+	compliance := analysis.CheckCompliance(plans, activities, today, stress, excludedPeriods(ctx, from, to))
+	c.IndentedJSON(http.StatusOK, gin.H{"from": from, "to": to, "data": compliance, "periods": periodAnnotations(ctx, from, to)})
+}
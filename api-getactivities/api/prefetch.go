@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// how many of the newest activities have their streams fetched after a sync,
+// PREFETCH_STREAMS=0 turns prefetching off
+var prefetchStreamCount = func() int {
+	if os.Getenv("PREFETCH_STREAMS") == "0" {
+		return 0
+	}
+	return env.Int("PREFETCH_STREAMS", 5)
+}()
+
+// a sync that starts while the last prefetch is still running leaves it to finish
+var prefetchMu sync.Mutex
+
+type PrefetchResult struct {
+	Fetched     int
+	Failed      int
+	RateLimited bool
+}
+
+// prefetchStreams stores the streams of the newest activities that don't have
+// them yet, so the first chart of a new ride is served from storage instead
+// of waiting on strava. It gives way to requests once the rate limit is near
+func prefetchStreams(ctx context.Context, client *http.Client, access_token string) PrefetchResult {
+	var result PrefetchResult
+	if !prefetchMu.TryLock() {
+		return result
+	}
+	defer prefetchMu.Unlock()
+
+	for i, e := range loadActivityIndex(ctx).Entries {
+		if i >= prefetchStreamCount {
+			break
+		}
+		exists, err := gcsObjectExists(ctx, streamsObject(e.Id))
+		if err != nil || exists {
+			continue
+		}
+		if strava.Limits.NearLimit(hydrationRateLimitFraction) {
+			result.RateLimited = true
+			break
+		}
+
+		if _, err := loadStreams(ctx, client, access_token, e.Id); err != nil {
+			fmt.Printf("prefetching streams of %d: %v\n", e.Id, err)
+			result.Failed++
+			if errors.Is(err, strava.ErrRateLimited) {
+				result.RateLimited = true
+				break
+			}
+			continue
+		}
+		result.Fetched++
+	}
+	return result
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// StorageProfile is a named data set the same binary can be pointed at
+type StorageProfile struct {
+	Bucket      string // empty keeps GCS_BUCKET
+	Environment string // namespace the objects are under, empty for the bucket root
+}
+
+// production is the bucket root so existing data keeps working
+var storageProfiles = map[string]StorageProfile{
+	"production": {},
+	"staging":    {Environment: "staging"},
+	"test":       {Environment: "test"},
+}
+
+// STORAGE_PROFILES adds or replaces profiles, as comma separated
+// name=environment or name=bucket/environment pairs
+func loadStorageProfiles() (map[string]StorageProfile, error) {
+	profiles := make(map[string]StorageProfile)
+	for name, profile := range storageProfiles {
+		profiles[name] = profile
+	}
+	for _, pair := range strings.Split(os.Getenv("STORAGE_PROFILES"), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("storage profile %q is not name=environment", pair)
+		}
+		var profile StorageProfile
+		if bucket, environment, ok := strings.Cut(value, "/"); ok {
+			profile = StorageProfile{Bucket: bucket, Environment: environment}
+		} else {
+			profile = StorageProfile{Environment: value}
+		}
+		profiles[name] = profile
+	}
+	return profiles, nil
+}
+
+// selects the bucket and environment of the named profile, STORAGE_ENV and
+// GCS_BUCKET still win when set; an empty name changes nothing
+func useProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+	profiles, err := loadStorageProfiles()
+	if err != nil {
+		return err
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		var names []string
+		for known := range profiles {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown storage profile %q, known profiles are %s", name, strings.Join(names, ", "))
+	}
+	if os.Getenv("STORAGE_ENV") == "" {
+		storageEnv = profile.Environment
+	}
+	if os.Getenv("GCS_BUCKET") == "" && profile.Bucket != "" {
+		bucketName = profile.Bucket
+	}
+	return nil
+}
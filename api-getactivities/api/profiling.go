@@ -0,0 +1,144 @@
+package api
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime/metrics"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the profiles net/http/pprof serves under /admin/debug/pprof, heap and
+// allocs being the ones for memory spikes
+func profilingRoutes(admin gin.IRouter) {
+	debug := admin.Group("/debug/pprof")
+	debug.GET("/", gin.WrapF(pprof.Index))
+	debug.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	debug.GET("/profile", gin.WrapF(pprof.Profile))
+	debug.GET("/symbol", gin.WrapF(pprof.Symbol))
+	debug.POST("/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/trace", gin.WrapF(pprof.Trace))
+	debug.GET("/:profile", func(c *gin.Context) {
+		pprof.Handler(c.Param("profile")).ServeHTTP(c.Writer, c.Request)
+	})
+}
+
+// DebugHandler serves only /admin/debug/pprof and the admin metrics, for the
+// -debug-addr port kept off the public one; the admin token is still needed
+func DebugHandler() http.Handler {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	admin := router.Group("/admin", requireAdmin)
+	admin.GET("/metrics", getAdminMetrics)
+	profilingRoutes(admin)
+	return router
+}
+
+// MemoryStats are the runtime's figures when asked, and the bytes allocated
+// while each route's requests ran. Requests running at the same time add to
+// each other's, so a route's figures only point at where the memory goes
+type MemoryStats struct {
+	HeapBytes      uint64                 `json:"heap_bytes"` // held by live and not yet collected objects
+	HeapGoalBytes  uint64                 `json:"heap_goal_bytes"`
+	TotalBytes     uint64                 `json:"total_bytes"` // mapped from the OS
+	AllocatedBytes uint64                 `json:"allocated_bytes"`
+	GCCycles       uint64                 `json:"gc_cycles"`
+	Goroutines     uint64                 `json:"goroutines"`
+	Routes         map[string]RouteMemory `json:"routes"`
+}
+
+type RouteMemory struct {
+	Requests          uint64 `json:"requests"`
+	AllocatedBytes    uint64 `json:"allocated_bytes"`
+	MaxAllocatedBytes uint64 `json:"max_allocated_bytes"` // by a single request
+}
+
+const allocatedMetric = "/gc/heap/allocs:bytes"
+
+var routeMemory = struct {
+	mu     sync.Mutex
+	routes map[string]*RouteMemory
+}{routes: make(map[string]*RouteMemory)}
+
+func allocatedBytes() uint64 {
+	sample := []metrics.Sample{{Name: allocatedMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// counts the bytes allocated while the request ran against its route; reading
+// the runtime's counter does not stop the world, unlike runtime.ReadMemStats
+func withAllocationStats(c *gin.Context) {
+	route := strings.TrimPrefix(c.FullPath(), pathPrefix)
+	if route == "" {
+		c.Next()
+		return
+	}
+	before := allocatedBytes()
+	c.Next()
+	allocated := allocatedBytes() - before
+
+	routeMemory.mu.Lock()
+	defer routeMemory.mu.Unlock()
+	m, ok := routeMemory.routes[route]
+	if !ok {
+		m = &RouteMemory{}
+		routeMemory.routes[route] = m
+	}
+	m.Requests++
+	m.AllocatedBytes += allocated
+	if allocated > m.MaxAllocatedBytes {
+		m.MaxAllocatedBytes = allocated
+	}
+}
+
+// the routes allocating the most, at most limit of them
+func memoryStats(limit int) MemoryStats {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/heap/objects:bytes"},
+		{Name: "/gc/heap/goal:bytes"},
+		{Name: "/memory/classes/total:bytes"},
+		{Name: allocatedMetric},
+		{Name: "/gc/cycles/total:gc-cycles"},
+		{Name: "/sched/goroutines:goroutines"},
+	}
+	metrics.Read(samples)
+	values := make([]uint64, len(samples))
+	for i, s := range samples {
+		if s.Value.Kind() == metrics.KindUint64 {
+			values[i] = s.Value.Uint64()
+		}
+	}
+	stats := MemoryStats{
+		HeapBytes:      values[0],
+		HeapGoalBytes:  values[1],
+		TotalBytes:     values[2],
+		AllocatedBytes: values[3],
+		GCCycles:       values[4],
+		Goroutines:     values[5],
+		Routes:         make(map[string]RouteMemory),
+	}
+
+	routeMemory.mu.Lock()
+	defer routeMemory.mu.Unlock()
+	var routes []string
+	for route := range routeMemory.routes {
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routeMemory.routes[routes[i]].AllocatedBytes > routeMemory.routes[routes[j]].AllocatedBytes
+	})
+	if len(routes) > limit {
+		routes = routes[:limit]
+	}
+	for _, route := range routes {
+		stats.Routes[route] = *routeMemory.routes[route]
+	}
+	return stats
+}
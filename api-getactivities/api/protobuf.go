@@ -0,0 +1,174 @@
+package api
+
+import (
+	"math"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// hand written encoders for the messages in proto/activities.proto, from the
+// same models the JSON is rendered from. proto3 leaves zero values out
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+func appendMessage(b []byte, num protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+func appendPackedDoubles(b []byte, num protowire.Number, values []float64) []byte {
+	if len(values) == 0 {
+		return b
+	}
+	packed := make([]byte, 0, 8*len(values))
+	for _, v := range values {
+		packed = protowire.AppendFixed64(packed, math.Float64bits(v))
+	}
+	return appendMessage(b, num, packed)
+}
+
+func appendPackedBools(b []byte, num protowire.Number, values []bool) []byte {
+	if len(values) == 0 {
+		return b
+	}
+	packed := make([]byte, 0, len(values))
+	for _, v := range values {
+		packed = protowire.AppendVarint(packed, protowire.EncodeBool(v))
+	}
+	return appendMessage(b, num, packed)
+}
+
+func displayProto(d *DisplayFields) []byte {
+	var b []byte
+	b = appendString(b, 1, d.Distance)
+	b = appendString(b, 2, d.Pace)
+	b = appendString(b, 3, d.Speed)
+	b = appendString(b, 4, d.MovingTime)
+	b = appendString(b, 5, d.Duration)
+	b = appendString(b, 6, d.StartDate)
+	b = appendString(b, 7, d.StartTime)
+	return b
+}
+
+func activityProto(a FinalActivity) []byte {
+	var b []byte
+	b = appendInt(b, 1, a.Id)
+	b = appendString(b, 2, a.Type)
+	b = appendString(b, 3, a.SportType)
+	b = appendString(b, 4, a.Platform)
+	b = appendDouble(b, 5, a.Distance)
+	b = appendInt(b, 6, int64(a.MovingTime))
+	b = appendString(b, 7, a.StartDate)
+	b = appendString(b, 8, a.StartDateLocal)
+	b = appendInt(b, 9, int64(a.StartDateUnix))
+	b = appendString(b, 10, a.StartTime)
+	b = appendString(b, 11, a.TimeZone)
+	b = appendString(b, 12, a.Zone)
+	b = appendInt(b, 13, int64(a.UtcOffset))
+	b = appendDouble(b, 14, a.Miles)
+	b = appendDouble(b, 15, a.Minutes)
+	b = appendDouble(b, 16, a.Pace)
+	b = appendString(b, 17, a.DisplayPace)
+	if a.Display != nil {
+		b = appendMessage(b, 18, displayProto(a.Display))
+	}
+	b = appendString(b, 19, a.Visibility)
+	if a.HideFromHome {
+		b = protowire.AppendTag(b, 20, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(true))
+	}
+	return b
+}
+
+// the Activities message, the athlete and meta are only sent as JSON
+func activitiesProto(acts FinalActivities) []byte {
+	var b []byte
+	for _, a := range acts.Data {
+		b = appendMessage(b, 1, activityProto(a))
+	}
+	for _, w := range acts.Warnings {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, w)
+	}
+	return b
+}
+
+func seriesProto(key string, series any) []byte {
+	b := appendString(nil, 1, key)
+	switch s := series.(type) {
+	case []float64:
+		b = appendPackedDoubles(b, 2, s)
+	case []strava.Location:
+		points := make([]float64, 0, 2*len(s))
+		for _, p := range s {
+			points = append(points, p[0], p[1])
+		}
+		b = appendPackedDoubles(b, 3, points)
+	case []bool:
+		b = appendPackedBools(b, 4, s)
+	}
+	return b
+}
+
+func metricsProto(m ActivityMetrics) []byte {
+	var b []byte
+	b = appendInt(b, 1, m.Id)
+	b = appendString(b, 2, m.Resolution)
+	b = appendString(b, 3, m.Method)
+	b = appendInt(b, 4, int64(m.OriginalSize))
+	b = appendInt(b, 5, int64(m.Size))
+
+	keys := make([]string, 0, len(m.Series))
+	for key := range m.Series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b = appendMessage(b, 6, seriesProto(key, m.Series[key]))
+	}
+	for _, key := range m.Missing {
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		b = protowire.AppendString(b, key)
+	}
+
+	keys = keys[:0]
+	for key := range m.Cleaned {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// a map entry is a message of key 1 and value 2, both always written
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, key)
+		entry = protowire.AppendTag(entry, 2, protowire.VarintType)
+		entry = protowire.AppendVarint(entry, uint64(m.Cleaned[key]))
+		b = appendMessage(b, 8, entry)
+	}
+	return b
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the platforms TRUSTED_PLATFORM names, by the header each sets to the client's address
+var trustedPlatforms = map[string]string{
+	"appengine":  gin.PlatformGoogleAppEngine,
+	"cloudflare": gin.PlatformCloudflare,
+}
+
+// the client address rate limits and audit entries use is only taken from
+// X-Forwarded-For when it was added by one of TRUSTED_PROXIES, a comma
+// separated list of addresses and CIDR ranges, or from the header the
+// TRUSTED_PLATFORM sets. Otherwise it is the connection's own address, since
+// any client can send the header
+func trustProxies(router *gin.Engine) {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		fmt.Println("TRUSTED_PROXIES: trusting none,", err)
+		router.SetTrustedProxies(nil)
+	}
+
+	if platform := os.Getenv("TRUSTED_PLATFORM"); platform != "" {
+		header, ok := trustedPlatforms[platform]
+		if !ok {
+			fmt.Println("TRUSTED_PLATFORM: ignoring", platform)
+			return
+		}
+		router.TrustedPlatform = header
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTrustProxies(t *testing.T) {
+	cases := []struct {
+		name      string
+		proxies   string
+		platform  string
+		forwarded string
+		appEngine string
+		want      string
+	}{
+		{"no proxies trusted", "", "", "203.0.113.9", "", "192.0.2.1"},
+		{"forwarded by a trusted proxy", "192.0.2.0/24", "", "198.51.100.7, 203.0.113.9", "", "203.0.113.9"},
+		{"forwarded by an untrusted proxy", "10.0.0.0/8", "", "203.0.113.9", "", "192.0.2.1"},
+		{"invalid proxies trust none", "not-an-address", "", "203.0.113.9", "", "192.0.2.1"},
+		{"platform header", "", "appengine", "203.0.113.9", "198.51.100.7", "198.51.100.7"},
+		{"unknown platform", "", "heroku", "203.0.113.9", "198.51.100.7", "192.0.2.1"},
+	}
+	gin.SetMode(gin.TestMode)
+	for _, tc := range cases {
+		t.Setenv("TRUSTED_PROXIES", tc.proxies)
+		t.Setenv("TRUSTED_PLATFORM", tc.platform)
+		router := gin.New()
+		trustProxies(router)
+
+		var got string
+		router.GET("/", func(c *gin.Context) { got = c.ClientIP() })
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.0.2.1:4321"
+		req.Header.Set("X-Forwarded-For", tc.forwarded)
+		if tc.appEngine != "" {
+			req.Header.Set(gin.PlatformGoogleAppEngine, tc.appEngine)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		if got != tc.want {
+			t.Errorf("%s: ClientIP = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
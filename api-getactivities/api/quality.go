@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// ActivityQuality is a stored activity with sensor readings that cannot be right
+type ActivityQuality struct {
+	Id        int64                   `json:"id"`
+	Name      string                  `json:"name"`
+	SportType string                  `json:"sport_type"`
+	StartDate string                  `json:"start_date"`
+	Issues    []analysis.QualityIssue `json:"issues"`
+}
+
+// the activity detail response, with the checks it failed
+type annotatedActivity struct {
+	strava.ActivityDetailed
+	Platform    string                  `json:"platform,omitempty"` // the virtual platform it was recorded on
+	DataQuality []analysis.QualityIssue `json:"data_quality,omitempty"`
+	Journal     *ActivityNote           `json:"journal,omitempty"` // the owner's note, admin token only
+}
+
+func annotateActivity(ctx context.Context, activity strava.ActivityDetailed) annotatedActivity {
+	return annotatedActivity{
+		ActivityDetailed: versionedActivity(activity),
+		Platform:         analysis.VirtualPlatform(activity.ExternalId, activity.DeviceName),
+		DataQuality:      checkActivity(ctx, activity),
+	}
+}
+
+// summary and stored streams only, fetching streams for a check is not worth a strava call
+func checkActivity(ctx context.Context, activity strava.ActivityDetailed) []analysis.QualityIssue {
+	return analysis.CheckSensorData(activity.ActivitySummary, storedStreams(ctx, activity.Id))
+}
+
+func getDataQuality(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	index := loadActivityIndex(ctx)
+	report := []ActivityQuality{}
+	for _, e := range index.Entries {
+		activity, ok := loadActivity(ctx, e.Id)
+		if !ok {
+			continue
+		}
+		issues := checkActivity(ctx, activity)
+		if len(issues) == 0 {
+			continue
+		}
+		report = append(report, ActivityQuality{
+			Id:        activity.Id,
+			Name:      activity.Name,
+			SportType: strava.NormalizeSportType(activity.SportType, activity.Type),
+			StartDate: activity.StartDate,
+			Issues:    issues,
+		})
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"checked": len(index.Entries), "data": report})
+}
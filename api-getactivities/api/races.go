@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// training a race is compared with, the weeks of the build up to it
+const raceTrainingDays = 90
+
+// TrainingComparison is a race's speed against the same sport's training
+// before it, training being every activity in that window not tagged a race
+type TrainingComparison struct {
+	Activities    int     `json:"activities"`
+	AverageSpeed  float64 `json:"average_speed"`  // meters per second
+	FasterPercent float64 `json:"faster_percent"` // negative when the race was slower
+}
+
+type Race struct {
+	Id           int64               `json:"id"`
+	Name         string              `json:"name"`
+	SportType    string              `json:"sport_type"`
+	StartDate    string              `json:"start_date"`
+	Distance     float64             `json:"distance"`
+	MovingTime   int                 `json:"moving_time"`
+	ElapsedTime  int                 `json:"elapsed_time"`
+	AverageSpeed float64             `json:"average_speed"`
+	DisplayPace  string              `json:"display_pace,omitempty"` // min/mi, runs only
+	Reasons      []string            `json:"reasons"`                // empty when tagged by the athlete
+	Training     *TrainingComparison `json:"training"`               // nil without training to compare with
+}
+
+// runs detection over every stored activity and keeps the auto race tags in
+// step with it; returns the stored activities, newest first, their tags and
+// why detection picked each race
+func refreshRaceTags(ctx context.Context) ([]strava.ActivityDetailed, map[int64]ActivityTags, map[int64][]string, error) {
+	var activities []strava.ActivityDetailed
+	var summaries []strava.ActivitySummary
+	for _, e := range loadActivityIndex(ctx).Entries {
+		if activity, ok := loadActivity(ctx, e.Id); ok {
+			activities = append(activities, activity)
+			summaries = append(summaries, activity.ActivitySummary)
+		}
+	}
+	maxHeartrate := analysis.HighestHeartrate(summaries)
+
+	reasons := make(map[int64][]string)
+	for _, activity := range activities {
+		if r := analysis.RaceReasons(activity.ActivitySummary, maxHeartrate); len(r) > 0 {
+			reasons[activity.Id] = r
+		}
+	}
+
+	var tags map[int64]ActivityTags
+	err := updateTags(ctx, func(stored map[int64]ActivityTags) bool {
+		changed := false
+		for _, activity := range activities {
+			if setAutoTag(stored, activity.Id, TagRace, reasons[activity.Id] != nil) {
+				changed = true
+			}
+		}
+		tags = stored
+		return changed
+	})
+	return activities, tags, reasons, err
+}
+
+func compareWithTraining(race strava.ActivitySummary, activities []strava.ActivityDetailed, tags map[int64]ActivityTags) *TrainingComparison {
+	start, err := time.Parse(time.RFC3339, race.StartDate)
+	if err != nil || race.MovingTime == 0 {
+		return nil
+	}
+	from := start.AddDate(0, 0, -raceTrainingDays)
+	sport := strava.LegacyActivityType(strava.NormalizeSportType(race.SportType, race.Type))
+
+	var training analysis.Totals
+	for _, a := range activities {
+		at, err := time.Parse(time.RFC3339, a.StartDate)
+		if err != nil || at.Before(from) || !at.Before(start) {
+			continue
+		}
+		if strava.LegacyActivityType(strava.NormalizeSportType(a.SportType, a.Type)) != sport || containsTag(tags[a.Id].Tags(), TagRace) {
+			continue
+		}
+		training.Add(a.ActivitySummary)
+	}
+	if training.MovingTime == 0 {
+		return nil
+	}
+
+	speed := race.Distance / float64(race.MovingTime)
+	trainingSpeed := training.Distance / float64(training.MovingTime)
+	return &TrainingComparison{
+		Activities:    training.Count,
+		AverageSpeed:  math.Round(trainingSpeed*1000) / 1000,
+		FasterPercent: math.Round((speed/trainingSpeed-1)*1000) / 10,
+	}
+}
+
+// stored activities tagged as races, by detection or by the athlete, newest first
+func getRaces(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	activities, tags, reasons, err := refreshRaceTags(ctx)
+	if err != nil {
+		// the races are still listed, the tags are refreshed next time
+		fmt.Println(err)
+	}
+
+	races := []Race{}
+	for _, a := range activities {
+		if !containsTag(tags[a.Id].Tags(), TagRace) {
+			continue
+		}
+		race := Race{
+			Id:          a.Id,
+			Name:        a.Name,
+			SportType:   strava.NormalizeSportType(a.SportType, a.Type),
+			StartDate:   a.StartDate,
+			Distance:    a.Distance,
+			MovingTime:  a.MovingTime,
+			ElapsedTime: a.ElapsedTime,
+			Reasons:     reasons[a.Id],
+			Training:    compareWithTraining(a.ActivitySummary, activities, tags),
+		}
+		if race.Reasons == nil {
+			race.Reasons = []string{}
+		}
+		if a.MovingTime > 0 {
+			race.AverageSpeed = math.Round(a.Distance/float64(a.MovingTime)*1000) / 1000
+		}
+		if strava.LegacyActivityType(race.SportType) == strava.SportRun {
+			_, _, pace := analysis.Pace(a.Distance, a.MovingTime)
+			race.DisplayPace = analysis.DisplayPace(pace)
+		}
+		races = append(races, race)
+	}
+	sort.SliceStable(races, func(i, j int) bool { return races[i].StartDate > races[j].StartDate })
+
+	c.IndentedJSON(http.StatusOK, gin.H{"data": races})
+}
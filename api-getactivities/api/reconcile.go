@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// StaleActivity is stored but no longer matches strava's listing
+type StaleActivity struct {
+	Id     int64    `json:"id"`
+	Fields []string `json:"fields"`
+}
+
+// ReconcileReport compares every stored activity with a full strava listing;
+// unlike a sync it also looks past the most recent pages and at more than names
+type ReconcileReport struct {
+	Listed   int              `json:"listed"`
+	Stored   int              `json:"stored"`
+	Missing  []int64          `json:"missing"` // on strava, not stored or not indexed
+	Extra    []int64          `json:"extra"`   // stored, gone from strava
+	Stale    []StaleActivity  `json:"stale"`
+	Repaired bool             `json:"repaired"`
+	Changes  []ActivityChange `json:"changes,omitempty"`
+}
+
+// summary fields a stored activity must agree with strava on; social counts
+// change all the time and are not compared
+func staleFields(stored, listed strava.ActivitySummary) []string {
+	var fields []string
+	compare := func(name string, equal bool) {
+		if !equal {
+			fields = append(fields, name)
+		}
+	}
+	compare("name", stored.Name == listed.Name)
+	compare("sport_type", strava.NormalizeSportType(stored.SportType, stored.Type) == strava.NormalizeSportType(listed.SportType, listed.Type))
+	compare("start_date", stored.StartDate == listed.StartDate)
+	compare("distance", stored.Distance == listed.Distance)
+	compare("moving_time", stored.MovingTime == listed.MovingTime)
+	compare("elapsed_time", stored.ElapsedTime == listed.ElapsedTime)
+	compare("total_elevation_gain", stored.TotalElevationGain == listed.TotalElevationGain)
+	compare("trainer", stored.Trainer == listed.Trainer)
+	compare("commute", stored.Commute == listed.Commute)
+	compare("private", stored.Private == listed.Private)
+	compare("gear_id", stored.GearId == listed.GearId)
+	return fields
+}
+
+// ids of the stored activity objects, the indexes aside
+func storedActivityIds(ctx context.Context) ([]int64, error) {
+	objects, err := listGCSObjects(ctx, activitiesPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for _, object := range objects {
+		id, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(object, activitiesPrefix), ".json"), 10, 64)
+		if err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func reconcileActivities(ctx context.Context, client *http.Client, access_token string, repair bool) (ReconcileReport, error) {
+	report := ReconcileReport{Missing: []int64{}, Extra: []int64{}, Stale: []StaleActivity{}, Repaired: repair}
+
+	listed, err := listActivities(client, access_token, 0)
+	if err != nil {
+		return report, err
+	}
+	report.Listed = len(listed)
+
+	indexed := make(map[int64]ActivityIndexEntry)
+	for _, e := range loadActivityIndex(ctx).Entries {
+		indexed[e.Id] = e
+	}
+	objectIds, err := storedActivityIds(ctx)
+	if err != nil {
+		return report, err
+	}
+	stored := make(map[int64]bool)
+	for _, id := range objectIds {
+		stored[id] = true
+	}
+	for id := range indexed {
+		stored[id] = true
+	}
+	report.Stored = len(stored)
+
+	var entries []ActivityIndexEntry
+	onStrava := make(map[int64]bool)
+	for _, a := range listed {
+		onStrava[a.Id] = true
+
+		entry, indexedOk := indexed[a.Id]
+		activity, found := loadActivity(ctx, a.Id)
+		if !found || !indexedOk {
+			report.Missing = append(report.Missing, a.Id)
+			if repair {
+				// an unindexed object keeps its detail, otherwise the listed summary is stored
+				detailed := found && activity.Resource_state == 3
+				if found {
+					activity.ActivitySummary = a
+				} else {
+					activity = strava.ActivityDetailed{ActivitySummary: a}
+				}
+				saved, err := saveActivity(ctx, activity, detailed)
+				if err != nil {
+					fmt.Println(err)
+					continue
+				}
+				entries = append(entries, saved)
+				report.Changes = append(report.Changes, ActivityChange{Kind: ChangeCreated, ActivityId: a.Id, NewName: a.Name})
+			}
+			continue
+		}
+
+		fields := staleFields(activity.ActivitySummary, a)
+		if len(fields) == 0 {
+			continue
+		}
+		report.Stale = append(report.Stale, StaleActivity{Id: a.Id, Fields: fields})
+		if repair {
+			oldName := activity.Name
+			// hydrated detail is kept, only the summary is replaced
+			activity.ActivitySummary = a
+			saved, err := saveActivity(ctx, activity, entry.Detailed)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			entries = append(entries, saved)
+			change := ActivityChange{Kind: ChangeUpdated, ActivityId: a.Id, OldName: oldName, NewName: a.Name}
+			if len(fields) == 1 && fields[0] == "name" {
+				change.Kind = ChangeRenamed
+			}
+			report.Changes = append(report.Changes, change)
+		}
+	}
+
+	var extra []int64
+	for id := range stored {
+		if !onStrava[id] {
+			extra = append(extra, id)
+		}
+	}
+	sort.Slice(extra, func(i, j int) bool { return extra[i] > extra[j] })
+	if extra != nil {
+		report.Extra = extra
+	}
+
+	if !repair {
+		return report, nil
+	}
+
+	if err := upsertActivityIndex(ctx, entries); err != nil {
+		return report, err
+	}
+	if err := removeActivityIndexEntries(ctx, extra); err != nil {
+		return report, err
+	}
+	for _, id := range extra {
+		if err := deleteDataFromGCS(ctx, activityObject(id)); err != nil {
+			fmt.Println(err)
+		}
+		report.Changes = append(report.Changes, ActivityChange{Kind: ChangeDeleted, ActivityId: id, OldName: indexed[id].Name})
+	}
+
+	if err := appendChangelog(ctx, "reconcile", report.Changes); err != nil {
+		return report, err
+	}
+	if err := exportChanges(ctx, client, access_token, report.Changes); err != nil {
+		fmt.Println("bigquery export:", err)
+	}
+	return report, nil
+}
+
+func runReconcile(args []string) error {
+	ctx := context.Background()
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	bucket := fs.String("bucket", bucketName, "bucket holding the stored activities")
+	repair := fs.Bool("repair", false, "store missing and stale activities and delete extra ones")
+	fs.Parse(args)
+
+	useBucket(*bucket)
+
+	client := strava.DefaultClient
+
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	report, err := reconcileActivities(ctx, client, access_token, *repair)
+	recordAudit(AuditActivitiesReconcile, "cli", "", err, map[string]interface{}{
+		"missing": len(report.Missing), "extra": len(report.Extra), "stale": len(report.Stale), "repaired": *repair,
+	})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "listed %d, stored %d: %d missing, %d extra, %d stale\n", report.Listed, report.Stored, len(report.Missing), len(report.Extra), len(report.Stale))
+	return nil
+}
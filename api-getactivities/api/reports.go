@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image/color"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/notify"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/render"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// nil unless SMTP_ADDR and REPORT_TO are set, or in dev mode where reports are logged
+var notifier notify.Notifier
+
+var errNoNotifier = errors.New("reports are not delivered, set SMTP_ADDR and REPORT_TO")
+
+// SMTP_ADDR, e.g. smtp.example.com:587, with SMTP_USERNAME and SMTP_PASSWORD,
+// sends the weekly report from REPORT_FROM to the comma separated REPORT_TO
+func openNotifier(cfg Config) {
+	if cfg.Dev {
+		notifier = notify.Log{}
+		return
+	}
+	addr, to := os.Getenv("SMTP_ADDR"), os.Getenv("REPORT_TO")
+	if addr == "" || to == "" {
+		return
+	}
+	var recipients []string
+	for _, r := range strings.Split(to, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			recipients = append(recipients, r)
+		}
+	}
+	notifier = notify.SMTP{
+		Addr:     addr,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     env.String("REPORT_FROM", recipients[0]),
+		To:       recipients,
+	}
+}
+
+// the last full week, the one a report sent on monday is about
+func latestReportWeek(loc *time.Location) time.Time {
+	return analysis.StartOfWeekIn(time.Now(), loc).AddDate(0, 0, -7)
+}
+
+func weeklyReport(ctx context.Context, start time.Time, units render.Units, accent color.RGBA) render.WeeklyReport {
+	details := storedWeekDetails(ctx, start)
+	var summaries []strava.ActivitySummary
+	var activities []render.ReportActivity
+	// oldest first, as the week was trained
+	for i := len(details) - 1; i >= 0; i-- {
+		a := details[i]
+		if !analysis.InWeek(start, a.ActivitySummary) {
+			continue
+		}
+		summaries = append(summaries, a.ActivitySummary)
+		at, err := a.StartTime()
+		if err != nil {
+			fmt.Println(a.Id, err)
+		}
+		activities = append(activities, render.ReportActivity{
+			Name:       a.Name,
+			SportType:  strava.NormalizeSportType(a.SportType, a.Type),
+			Start:      at,
+			Distance:   a.Distance,
+			MovingTime: a.MovingTime,
+			PrCount:    a.PrCount,
+		})
+	}
+
+	previous := start.AddDate(0, 0, -7)
+	return render.WeeklyReport{
+		Title:      "Weekly training",
+		Week:       analysis.SummarizeWeek(start, summaries),
+		Previous:   analysis.SummarizeWeek(previous, storedWeek(ctx, previous)).Totals,
+		Activities: activities,
+		Periods:    periodAnnotations(ctx, start.Format("2006-01-02"), start.AddDate(0, 0, 6).Format("2006-01-02")),
+		Units:      units,
+		Accent:     accent,
+	}
+}
+
+// renders the report and hands it to the notifier
+func sendWeeklyReport(report render.WeeklyReport) error {
+	if notifier == nil {
+		return errNoNotifier
+	}
+	page, err := report.HTML()
+	if err != nil {
+		return err
+	}
+	return notifier.Notify(notify.Message{Subject: report.Subject(), HTML: page})
+}
+
+func getLatestWeeklyReport(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	units, accent, err := cardStyle(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	loc, err := athleteZone(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	start := latestReportWeek(loc)
+	page, err := weeklyReport(ctx, start, units, accent).HTML()
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to render report"})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="weekly-%s.html"`, start.Format("2006-01-02")))
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+}
+
+// sends last week's report, for a scheduler that cannot run the command
+func postAdminWeeklyReport(c *gin.Context) {
+	ctx := c.Request.Context()
+	units, accent, err := cardStyle(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	loc, err := athleteZone(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	start := latestReportWeek(loc)
+	err = sendWeeklyReport(weeklyReport(ctx, start, units, accent))
+	recordAudit(AuditReportSend, adminActor(c), start.Format("2006-01-02"), err, nil)
+	if errors.Is(err, errNoNotifier) {
+		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusBadGateway, gin.H{"error": "unable to send report"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"sent": true, "week": start.Format("2006-01-02")})
+}
+
+func runWeeklyReport(args []string) error {
+	ctx := context.Background()
+	fs := flag.NewFlagSet("weekly-report", flag.ExitOnError)
+	week := fs.String("week", "", "a day of the week to report on, 2006-01-02, last week when omitted")
+	units := fs.String("units", string(render.Imperial), "imperial or metric")
+	send := fs.Bool("send", false, "email the report instead of writing it")
+	out := fs.String("out", "-", "file to write the report to, - for stdout")
+	fs.Parse(args)
+
+	reportUnits, err := render.ParseUnits(*units)
+	if err != nil {
+		return err
+	}
+	accent, _ := render.ParseColor("fc4c02")
+
+	loc := defaultAthleteZone(ctx)
+	start := latestReportWeek(loc)
+	if *week != "" {
+		day, err := time.ParseInLocation("2006-01-02", *week, loc)
+		if err != nil {
+			return fmt.Errorf("week must be a date like 2006-01-02")
+		}
+		start = analysis.StartOfWeekIn(day, loc)
+	}
+	report := weeklyReport(ctx, start, reportUnits, accent)
+
+	if *send {
+		err := sendWeeklyReport(report)
+		recordAudit(AuditReportSend, "cli", start.Format("2006-01-02"), err, nil)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "sent the report for the week of", start.Format("2006-01-02"))
+		return nil
+	}
+
+	page, err := report.HTML()
+	if err != nil {
+		return err
+	}
+	if *out == "-" {
+		_, err = os.Stdout.Write(page)
+		return err
+	}
+	return os.WriteFile(*out, page, 0o644)
+}
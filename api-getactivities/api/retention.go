@@ -0,0 +1,337 @@
+package api
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+)
+
+// the stored objects that can be pruned: each belongs to one activity and is
+// fetched from strava or rendered again when it is next asked for. Summaries,
+// notes and the other records are never pruned
+var retentionClasses = []string{"streams", "revisions", "maps", "photos"}
+
+// STORAGE_RETENTION is a comma separated list of class=days, such as
+// streams=730,maps=90; a class's objects are pruned once their activity
+// started more than that many days ago
+var storageRetention = parseStorageRetention(os.Getenv("STORAGE_RETENTION"))
+
+// STORAGE_QUOTA_MB is how much each athlete may store, no quota when unset;
+// pruning past it also drops the prunable objects of the oldest activities
+var storageQuota = int64(env.Int("STORAGE_QUOTA_MB", 0)) << 20
+
+func parseStorageRetention(spec string) map[string]int {
+	retention := make(map[string]int)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		class, value, ok := strings.Cut(entry, "=")
+		class = strings.TrimSpace(class)
+		days, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil || days <= 0 || !matchesFilter(retentionClasses, class) {
+			fmt.Println("STORAGE_RETENTION: ignoring", entry)
+			continue
+		}
+		retention[class] = days
+	}
+	return retention
+}
+
+type PrefixUsage struct {
+	Objects int   `json:"objects"`
+	Bytes   int64 `json:"bytes"`
+}
+
+func (u *PrefixUsage) add(bytes int64) {
+	u.Objects++
+	u.Bytes += bytes
+}
+
+type StorageUsage struct {
+	AthleteId int64 `json:"athlete_id"`
+	Owner     bool  `json:"owner"`
+	PrefixUsage
+	Quota     int64                  `json:"quota"` // bytes, 0 for none
+	OverQuota bool                   `json:"over_quota"`
+	Prefixes  map[string]PrefixUsage `json:"prefixes"`
+}
+
+// the objects exported and cleaned up for the athlete, by prefix
+func storageUsage(ctx context.Context, athleteId int64, owner bool) (StorageUsage, error) {
+	usage := StorageUsage{AthleteId: athleteId, Owner: owner, Quota: storageQuota, Prefixes: make(map[string]PrefixUsage)}
+	for _, prefix := range athleteDataPrefixes(athleteId, owner) {
+		sizes, err := listGCSObjectSizes(ctx, prefix)
+		if err != nil {
+			return usage, err
+		}
+		var p PrefixUsage
+		for _, size := range sizes {
+			p.add(size)
+			usage.add(size)
+		}
+		usage.Prefixes[prefix] = p
+	}
+	usage.OverQuota = storageQuota > 0 && usage.Bytes > storageQuota
+	return usage, nil
+}
+
+// object sizes by activity
+type activityObjects map[int64]map[string]int64
+
+func (a activityObjects) add(id int64, object string, size int64) {
+	if a[id] == nil {
+		a[id] = make(map[string]int64)
+	}
+	a[id][object] = size
+}
+
+// the activity id an object name starts with, after prefix
+func objectActivity(object string, prefix string) (int64, bool) {
+	name, _, _ := strings.Cut(strings.TrimPrefix(object, prefix), "/")
+	id, err := strconv.ParseInt(strings.TrimSuffix(name, ".json"), 10, 64)
+	return id, err == nil
+}
+
+// the prunable objects of every activity, by class. A revision's streams go
+// but the list of revisions stays, as do the photo lists: only the mirrored
+// images and their thumbnails go
+func prunableObjects(ctx context.Context) (map[string]activityObjects, error) {
+	classes := make(map[string]activityObjects)
+	for _, class := range retentionClasses {
+		classes[class] = make(activityObjects)
+	}
+
+	sizes, err := listGCSObjectSizes(ctx, streamsPrefix)
+	if err != nil {
+		return classes, err
+	}
+	for object, size := range sizes {
+		if id, ok := objectActivity(object, streamsPrefix); ok {
+			classes["streams"].add(id, object, size)
+		}
+	}
+
+	if sizes, err = listGCSObjectSizes(ctx, revisionsPrefix); err != nil {
+		return classes, err
+	}
+	for object, size := range sizes {
+		if !strings.Contains(strings.TrimPrefix(object, revisionsPrefix), "/") {
+			continue
+		}
+		if id, ok := objectActivity(object, revisionsPrefix); ok {
+			classes["revisions"].add(id, object, size)
+		}
+	}
+
+	if sizes, err = listGCSObjectSizes(ctx, mapsPrefix); err != nil {
+		return classes, err
+	}
+	for object, size := range sizes {
+		if id, ok := objectActivity(object, mapsPrefix); ok {
+			classes["maps"].add(id, object, size)
+		}
+	}
+
+	// images are named after the photo, the lists tell whose they are
+	if sizes, err = listGCSObjectSizes(ctx, photosPrefix); err != nil {
+		return classes, err
+	}
+	photoActivities := make(map[string]int64)
+	for object := range sizes {
+		if strings.Contains(strings.TrimPrefix(object, photosPrefix), "/") {
+			continue
+		}
+		if id, ok := objectActivity(object, photosPrefix); ok {
+			photos, _ := loadActivityPhotos(ctx, id)
+			for _, p := range photos.Photos {
+				photoActivities[p.UniqueId] = id
+			}
+		}
+	}
+	for object, size := range sizes {
+		var uniqueId string
+		switch {
+		case strings.HasPrefix(object, photoImagesPrefix):
+			uniqueId = strings.TrimPrefix(object, photoImagesPrefix)
+		case strings.HasPrefix(object, photoThumbsPrefix):
+			name := strings.TrimSuffix(strings.TrimPrefix(object, photoThumbsPrefix), ".jpg")
+			if i := strings.LastIndex(name, "-"); i > 0 {
+				uniqueId = name[:i]
+			}
+		}
+		if id, ok := photoActivities[uniqueId]; ok {
+			classes["photos"].add(id, object, size)
+		}
+	}
+	return classes, nil
+}
+
+type PruneResult struct {
+	DryRun bool `json:"dry_run"`
+	PrefixUsage
+	Classes map[string]PrefixUsage `json:"classes"`
+	// activities whose objects were pruned to get back under the quota
+	QuotaActivities int      `json:"quota_activities"`
+	Temporary       int      `json:"temporary"` // staged objects left by writes that crashed
+	OverQuota       bool     `json:"over_quota"`
+	Errors          []string `json:"errors,omitempty"`
+}
+
+// prunes the owner's objects kept longer than STORAGE_RETENTION, then those
+// of the oldest activities while the owner is over STORAGE_QUOTA_MB; a dry
+// run reports what would go. Staged objects of crashed writes go too
+func pruneStorage(ctx context.Context, now time.Time, dryRun bool) (PruneResult, error) {
+	result := PruneResult{DryRun: dryRun, Classes: make(map[string]PrefixUsage)}
+
+	if !dryRun {
+		removed, err := removeStaleTmpObjects(ctx, now)
+		if err != nil {
+			return result, err
+		}
+		result.Temporary = removed
+	}
+
+	classes, err := prunableObjects(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	entries := append([]ActivityIndexEntry{}, loadActivityIndex(ctx).Entries...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].StartDate < entries[j].StartDate })
+
+	prune := func(class string, id int64) {
+		for object, size := range classes[class][id] {
+			if !dryRun {
+				if err := deleteDataFromGCS(ctx, object); err != nil {
+					result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", object, err))
+					continue
+				}
+			}
+			result.add(size)
+			usage := result.Classes[class]
+			usage.add(size)
+			result.Classes[class] = usage
+		}
+		delete(classes[class], id)
+	}
+
+	for _, e := range entries {
+		start, err := time.Parse(time.RFC3339, e.StartDate)
+		if err != nil {
+			continue
+		}
+		for class, days := range storageRetention {
+			if start.Before(now.AddDate(0, 0, -days)) {
+				prune(class, e.Id)
+			}
+		}
+	}
+
+	if storageQuota == 0 {
+		return result, nil
+	}
+	usage, err := storageUsage(ctx, ownerAthleteId(ctx), true)
+	if err != nil {
+		return result, err
+	}
+	used := usage.Bytes
+	if dryRun {
+		used -= result.Bytes
+	}
+	for _, e := range entries {
+		if used <= storageQuota {
+			break
+		}
+		before := result.Bytes
+		for _, class := range retentionClasses {
+			prune(class, e.Id)
+		}
+		if result.Bytes > before {
+			result.QuotaActivities++
+			used -= result.Bytes - before
+		}
+	}
+	result.OverQuota = used > storageQuota
+	return result, nil
+}
+
+// what the owner and each registered athlete store, and the retention applied
+func getAdminStorage(c *gin.Context) {
+	ctx := c.Request.Context()
+	owner, err := storageUsage(ctx, ownerAthleteId(ctx), true)
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to list stored objects"})
+		return
+	}
+	athletes := []StorageUsage{owner}
+	for _, a := range loadRegisteredAthletes(ctx) {
+		if a.Id == owner.AthleteId {
+			continue
+		}
+		usage, err := storageUsage(ctx, a.Id, false)
+		if err != nil {
+			fmt.Println(err)
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to list stored objects"})
+			return
+		}
+		athletes = append(athletes, usage)
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"retention": storageRetention, "quota": storageQuota, "athletes": athletes})
+}
+
+func postAdminStoragePrune(c *gin.Context) {
+	ctx := c.Request.Context()
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "dry_run must be true or false"})
+		return
+	}
+
+	result, err := pruneStorage(ctx, time.Now(), dryRun)
+	recordAudit(AuditStoragePrune, adminActor(c), "", err, map[string]interface{}{
+		"objects": result.Objects, "bytes": result.Bytes, "dry_run": dryRun,
+	})
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to prune storage"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, result)
+}
+
+func runPrune(args []string) error {
+	ctx := context.Background()
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	bucket := fs.String("bucket", bucketName, "bucket to prune")
+	dryRun := fs.Bool("dry-run", false, "report what would be pruned without deleting it")
+	fs.Parse(args)
+
+	useBucket(*bucket)
+
+	result, err := pruneStorage(ctx, time.Now(), *dryRun)
+	recordAudit(AuditStoragePrune, "cli", "", err, map[string]interface{}{
+		"objects": result.Objects, "bytes": result.Bytes, "dry_run": *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range result.Errors {
+		fmt.Fprintln(os.Stderr, e)
+	}
+	fmt.Fprintf(os.Stderr, "pruned %d objects, %d bytes, %d activities for the quota\n", result.Objects, result.Bytes, result.QuotaActivities)
+	return nil
+}
@@ -0,0 +1,298 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+const revisionsPrefix = "revisions/"
+
+const (
+	RevisionMerge = "merge"
+	RevisionTrim  = "trim"
+)
+
+// ActivityRevision is a local change to an activity, strava's copy is never
+// changed. The stored activity from strava is revision 0
+type ActivityRevision struct {
+	Revision  int                     `json:"revision"`
+	Kind      string                  `json:"kind"`
+	Sources   []int64                 `json:"sources"` // the activities it was made from
+	CreatedAt string                  `json:"created_at"`
+	Activity  strava.ActivityDetailed `json:"activity"`
+}
+
+type ActivityRevisions struct {
+	Id         int64              `json:"id"`
+	MergedInto int64              `json:"merged_into,omitempty"` // the activity this one is now part of
+	Revisions  []ActivityRevision `json:"revisions"`
+}
+
+// revisions are read-modify-written, and a merge changes two activities' at once
+var revisionsMu sync.Mutex
+
+func revisionsObject(id int64) string {
+	return fmt.Sprintf("%s%d.json", revisionsPrefix, id)
+}
+
+// streams are kept apart from the revisions, listing them should not read every sample
+func revisionStreamsObject(id int64, revision int) string {
+	return fmt.Sprintf("%s%d/%d.streams.json", revisionsPrefix, id, revision)
+}
+
+func loadRevisions(ctx context.Context, id int64) ActivityRevisions {
+	revisions := ActivityRevisions{Id: id, Revisions: []ActivityRevision{}}
+
+	slurp := getDataFromGCS(ctx, revisionsObject(id))
+	if slurp == nil {
+		return revisions
+	}
+	if err := json.Unmarshal(slurp, &revisions); err != nil {
+		fmt.Println(err)
+	}
+	return revisions
+}
+
+func saveRevisions(ctx context.Context, revisions ActivityRevisions) error {
+	bytes_revisions, err := json.Marshal(revisions)
+	if err != nil {
+		return err
+	}
+	return putDataToGCS(ctx, revisionsObject(revisions.Id), bytes_revisions)
+}
+
+func loadRevisionStreams(ctx context.Context, id int64, revision int) (strava.StreamSet, error) {
+	var set strava.StreamSet
+
+	slurp, err := readGCSObject(ctx, revisionStreamsObject(id, revision))
+	if err != nil {
+		return set, err
+	}
+	err = json.Unmarshal(slurp, &set)
+	return set, err
+}
+
+// the latest revision of the activity and its streams, the one from strava
+// until it has been changed locally
+func currentActivity(ctx context.Context, client *http.Client, access_token string, id int64) (strava.ActivityDetailed, strava.StreamSet, error) {
+	revisions := loadRevisions(ctx, id)
+	if n := len(revisions.Revisions); n > 0 {
+		latest := revisions.Revisions[n-1]
+		set, err := loadRevisionStreams(ctx, id, latest.Revision)
+		return latest.Activity, set, err
+	}
+
+	activity, err := loadOrFetchActivity(ctx, id)
+	if err != nil {
+		return activity, strava.StreamSet{}, err
+	}
+	set, err := loadStreams(ctx, client, access_token, id)
+	return activity, set, err
+}
+
+// adds the next revision of the activity, revisionsMu is held
+func addRevision(ctx context.Context, revisions *ActivityRevisions, kind string, sources []int64, activity strava.ActivityDetailed, set strava.StreamSet) (ActivityRevision, error) {
+	revision := ActivityRevision{
+		Revision:  len(revisions.Revisions) + 1,
+		Kind:      kind,
+		Sources:   sources,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Activity:  activity,
+	}
+
+	bytes_streams, err := json.Marshal(set)
+	if err != nil {
+		return revision, err
+	}
+	if err := putDataToGCS(ctx, revisionStreamsObject(revisions.Id, revision.Revision), bytes_streams); err != nil {
+		return revision, err
+	}
+	revisions.Revisions = append(revisions.Revisions, revision)
+	return revision, saveRevisions(ctx, *revisions)
+}
+
+func getActivityRevisions(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "activity id must be numeric"})
+		return
+	}
+	revisions := loadRevisions(ctx, id)
+	for i, r := range revisions.Revisions {
+		revisions.Revisions[i].Activity = redactActivity(c, r.Activity)
+	}
+	c.IndentedJSON(http.StatusOK, revisions)
+}
+
+func getActivityRevisionStreams(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "activity id must be numeric"})
+		return
+	}
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil || revision < 1 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "revision must be a number from 1"})
+		return
+	}
+
+	set, err := loadRevisionStreams(ctx, id, revision)
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, set)
+}
+
+type MergeRequest struct {
+	Ids []int64 `json:"ids"`
+}
+
+// stitches two activities recorded back to back into a revision of the
+// earlier one, the later one is linked to it; both stay as they are on strava
+func postActivitiesMerge(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	var merge MergeRequest
+	if err := c.ShouldBindJSON(&merge); err != nil || len(merge.Ids) != 2 || merge.Ids[0] == merge.Ids[1] {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "body must be a JSON object with the ids of two activities"})
+		return
+	}
+
+	client := stravaClient(c)
+
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		respondUpstreamError(c, "unable to refresh strava token", err)
+		return
+	}
+
+	revisionsMu.Lock()
+	defer revisionsMu.Unlock()
+
+	var activities [2]strava.ActivityDetailed
+	var sets [2]strava.StreamSet
+	for i, id := range merge.Ids {
+		if into := loadRevisions(ctx, id).MergedInto; into != 0 {
+			c.IndentedJSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("activity %d is already merged into %d", id, into)})
+			return
+		}
+		activities[i], sets[i], err = currentActivity(ctx, client, access_token, id)
+		if err != nil {
+			respondUpstreamError(c, "unable to fetch activity from strava", err)
+			return
+		}
+	}
+	if activities[1].StartDate < activities[0].StartDate {
+		activities[0], activities[1] = activities[1], activities[0]
+		sets[0], sets[1] = sets[1], sets[0]
+	}
+	first, second := activities[0].Id, activities[1].Id
+
+	merged, set, err := analysis.MergeActivities(activities[0], activities[1], sets[0], sets[1])
+	if err != nil {
+		c.IndentedJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	firstRevisions := loadRevisions(ctx, first)
+	revision, err := addRevision(ctx, &firstRevisions, RevisionMerge, []int64{first, second}, merged, set)
+	if err == nil {
+		secondRevisions := loadRevisions(ctx, second)
+		secondRevisions.MergedInto = first
+		err = saveRevisions(ctx, secondRevisions)
+	}
+	recordAudit(AuditActivityMerge, adminActor(c), strconv.FormatInt(first, 10), err, map[string]interface{}{"merged": second, "revision": revision.Revision})
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to store merged activity"})
+		return
+	}
+	c.IndentedJSON(http.StatusCreated, revision)
+}
+
+// seconds since the activity started, of the part to keep
+type TrimRequest struct {
+	Start int  `json:"start"`
+	End   *int `json:"end"` // the end of the recording when omitted
+}
+
+// cuts the start and end off the latest revision of the activity, stored as
+// the next revision
+func postActivityTrim(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "activity id must be numeric"})
+		return
+	}
+	var trim TrimRequest
+	if err := c.ShouldBindJSON(&trim); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "body must be a JSON object with start and end in seconds"})
+		return
+	}
+
+	client := stravaClient(c)
+
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		respondUpstreamError(c, "unable to refresh strava token", err)
+		return
+	}
+
+	revisionsMu.Lock()
+	defer revisionsMu.Unlock()
+
+	revisions := loadRevisions(ctx, id)
+	if revisions.MergedInto != 0 {
+		c.IndentedJSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("activity %d is merged into %d, trim that one", id, revisions.MergedInto)})
+		return
+	}
+	activity, set, err := currentActivity(ctx, client, access_token, id)
+	if err != nil {
+		respondUpstreamError(c, "unable to fetch activity from strava", err)
+		return
+	}
+
+	end := activity.ElapsedTime
+	if set.Len() > 0 {
+		end = set.Time.Data[set.Len()-1]
+	}
+	if trim.End != nil {
+		end = *trim.End
+	}
+	trimmed, trimmedSet, err := analysis.TrimActivity(activity, set, trim.Start, end)
+	if err != nil {
+		c.IndentedJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	revision, err := addRevision(ctx, &revisions, RevisionTrim, []int64{id}, trimmed, trimmedSet)
+	recordAudit(AuditActivityTrim, adminActor(c), strconv.FormatInt(id, 10), err, map[string]interface{}{"start": trim.Start, "end": end, "revision": revision.Revision})
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to store trimmed activity"})
+		return
+	}
+	c.IndentedJSON(http.StatusCreated, revision)
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+func reauthorizeURL(scopes []string) string {
+	return pathPrefix + "/auth/login?scope=" + url.QueryEscape(strings.Join(scopes, ","))
+}
+
+func respondMissingScopes(c *gin.Context, missing []string) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"error":          fmt.Sprintf("missing scope %s, re-authorize at %s", strings.Join(missing, ","), reauthorizeURL(missing)),
+		"missing_scopes": missing,
+		"reauthorize":    reauthorizeURL(missing),
+	})
+}
+
+// rejects the request up front when the owner's token can't satisfy the route,
+// instead of letting strava answer with an opaque 401
+func requireScopes(required ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		creds, err := loadCredentials(ctx, ownerCredentialsObject)
+		if err != nil {
+			// the handler reports credential problems itself
+			c.Next()
+			return
+		}
+		if missing := strava.MissingScopes(creds, required); len(missing) > 0 {
+			respondMissingScopes(c, missing)
+			return
+		}
+		c.Next()
+	}
+}
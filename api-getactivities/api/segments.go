@@ -0,0 +1,190 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/set"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+type SegmentEffortPoint struct {
+	Id            int64  `json:"id"`
+	ActivityId    int64  `json:"activity_id"`
+	StartDate     string `json:"start_date"`
+	StartDateUnix int    `json:"start_date_unix"`
+	ElapsedTime   int    `json:"elapsed_time"`
+}
+
+type SegmentEffortHistory struct {
+	SegmentId   int64                `json:"segment_id"`
+	SyncedAt    string               `json:"synced_at,omitempty"`
+	EffortCount int                  `json:"effort_count"`
+	BestTime    int                  `json:"best_time"`
+	AverageTime float64              `json:"average_time"`
+	Efforts     []SegmentEffortPoint `json:"efforts"`
+	Trend       *analysis.TrendLine  `json:"trend"`
+}
+
+// a request only asks strava for an athlete's efforts on a segment once the
+// stored ones are older than SEGMENT_EFFORTS_SYNC_HOURS, default 24
+var segmentEffortsSyncInterval = time.Duration(env.Int("SEGMENT_EFFORTS_SYNC_HOURS", 24)) * time.Hour
+
+// SegmentEfforts is an athlete's efforts on a segment as last synced, none
+// is stored too so a segment without efforts is not asked for again
+type SegmentEfforts struct {
+	SyncedAt string                        `json:"synced_at"`
+	Efforts  []strava.SegmentEffortSummary `json:"efforts"`
+}
+
+func segmentEffortsObject(segmentId int64) string {
+	return fmt.Sprintf("segment_efforts/%d.json", segmentId)
+}
+
+// whether strava should be asked for efforts newer than the stored ones
+func (s SegmentEfforts) stale(now time.Time) bool {
+	synced, err := time.Parse(time.RFC3339, s.SyncedAt)
+	return err != nil || now.Sub(synced) >= segmentEffortsSyncInterval
+}
+
+// prefix is "" for the owner and the athlete's storage prefix for registered athletes
+func loadSegmentEfforts(ctx context.Context, prefix string, segmentId int64) SegmentEfforts {
+	var stored SegmentEfforts
+
+	slurp := getDataFromGCS(ctx, prefix+segmentEffortsObject(segmentId))
+	if slurp == nil {
+		return stored
+	}
+	// efforts were stored as a bare array before they were synced on a schedule
+	v := interface{}(&stored)
+	if bytes.HasPrefix(bytes.TrimSpace(slurp), []byte("[")) {
+		v = &stored.Efforts
+	}
+	if err := json.Unmarshal(slurp, v); err != nil {
+		fmt.Println(err)
+	}
+	return stored
+}
+
+// pull the athlete's efforts on the segment from strava and fold them into the stored history
+func syncSegmentEfforts(ctx context.Context, client *http.Client, creds_object string, prefix string, segmentId int64, stored SegmentEfforts) (SegmentEfforts, error) {
+	access_token, err := getAccessTokenFor(ctx, client, creds_object)
+	if err != nil {
+		return stored, err
+	}
+
+	seen := set.Keyed(stored.Efforts, func(e strava.SegmentEffortSummary) int64 { return e.Id })
+
+	merged := SegmentEfforts{Efforts: stored.Efforts}
+	for page := 1; ; page++ {
+		parm := url.Values{}
+		parm.Add("segment_id", strconv.FormatInt(segmentId, 10))
+		parm.Add("per_page", "200")
+		parm.Add("page", strconv.Itoa(page))
+
+		var fetched []strava.SegmentEffortSummary
+		if err := strava.GetJSON(client, access_token, "/segment_efforts", parm, &fetched); err != nil {
+			merged.SyncedAt = stored.SyncedAt
+			return merged, err
+		}
+		for _, e := range fetched {
+			if seen.Add(e.Id) {
+				merged.Efforts = append(merged.Efforts, e)
+			}
+		}
+		if len(fetched) < 200 {
+			break
+		}
+	}
+
+	merged.SyncedAt = time.Now().UTC().Format(time.RFC3339)
+	bytes_efforts, err := json.Marshal(merged)
+	if err != nil {
+		return merged, err
+	}
+	return merged, putDataToGCS(ctx, prefix+segmentEffortsObject(segmentId), bytes_efforts)
+}
+
+// the stored efforts, synced first when they are stale; when strava can't be
+// reached the stored ones are returned with the error
+func freshSegmentEfforts(ctx context.Context, client *http.Client, creds_object string, prefix string, segmentId int64) (SegmentEfforts, error) {
+	stored := loadSegmentEfforts(ctx, prefix, segmentId)
+	if !stored.stale(time.Now()) {
+		return stored, nil
+	}
+	return syncSegmentEfforts(ctx, client, creds_object, prefix, segmentId, stored)
+}
+
+func summarizeSegmentEfforts(segmentId int64, stored SegmentEfforts) SegmentEffortHistory {
+	var history SegmentEffortHistory
+	history.SegmentId = segmentId
+	history.SyncedAt = stored.SyncedAt
+	history.Efforts = []SegmentEffortPoint{}
+
+	total := 0
+	for _, e := range stored.Efforts {
+		time_temp, err := time.Parse(time.RFC3339, e.StartDate)
+		if err != nil {
+			fmt.Println(err.Error())
+			continue
+		}
+		var point SegmentEffortPoint
+		point.Id = e.Id
+		point.ActivityId = e.ActivityId
+		point.StartDate = e.StartDate
+		point.StartDateUnix = int(time_temp.Unix())
+		point.ElapsedTime = e.ElapsedTime
+		history.Efforts = append(history.Efforts, point)
+
+		total += e.ElapsedTime
+		if history.BestTime == 0 || e.ElapsedTime < history.BestTime {
+			history.BestTime = e.ElapsedTime
+		}
+	}
+
+	sort.Slice(history.Efforts, func(i, j int) bool {
+		return history.Efforts[i].StartDateUnix < history.Efforts[j].StartDateUnix
+	})
+
+	history.EffortCount = len(history.Efforts)
+	if history.EffortCount > 0 {
+		history.AverageTime = float64(total) / float64(history.EffortCount)
+	}
+	samples := make([]analysis.Sample, len(history.Efforts))
+	for i, e := range history.Efforts {
+		samples[i] = analysis.Sample{Unix: e.StartDateUnix, Value: float64(e.ElapsedTime)}
+	}
+	history.Trend = analysis.FitTrendLine(samples)
+	return history
+}
+
+func getSegmentEfforts(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	segmentId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "segment id must be numeric"})
+		return
+	}
+
+	// serve whatever is stored if strava can't be reached
+	client := newRequestBudget().Client(stravaClient(c))
+	efforts, err := freshSegmentEfforts(ctx, client, ownerCredentialsObject, "", segmentId)
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	c.IndentedJSON(http.StatusOK, summarizeSegmentEfforts(segmentId, efforts))
+}
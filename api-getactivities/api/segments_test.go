@@ -0,0 +1,41 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+)
+
+func TestLoadSegmentEfforts(t *testing.T) {
+	defer func(store storage.ObjectStore) { objects = store }(objects)
+	objects = storage.NewMemory()
+
+	now := time.Now().UTC()
+	synced := now.Add(-time.Hour).Format(time.RFC3339)
+	cases := []struct {
+		name    string
+		stored  string // empty when nothing is
+		efforts int
+		stale   bool
+	}{
+		{"never synced", "", 0, true},
+		{"stored before syncs were timed", `[{"id": 1}, {"id": 2}]`, 2, true},
+		{"synced recently", `{"synced_at": "` + synced + `", "efforts": [{"id": 1}]}`, 1, false},
+		{"synced recently without efforts", `{"synced_at": "` + synced + `", "efforts": null}`, 0, false},
+		{"synced long ago", `{"synced_at": "2020-01-01T00:00:00Z", "efforts": [{"id": 1}]}`, 1, true},
+	}
+	for i, tc := range cases {
+		prefix := "athletes/" + string(rune('a'+i)) + "/"
+		if tc.stored != "" {
+			if err := objects.Write(prefix+segmentEffortsObject(1), []byte(tc.stored)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got := loadSegmentEfforts(context.Background(), prefix, 1)
+		if len(got.Efforts) != tc.efforts || got.stale(now) != tc.stale {
+			t.Errorf("%s: %d efforts, stale %v, want %d, %v", tc.name, len(got.Efforts), got.stale(now), tc.efforts, tc.stale)
+		}
+	}
+}
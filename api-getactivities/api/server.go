@@ -0,0 +1,232 @@
+// Package api serves the /strava, /auth, /webhook and /admin endpoints over the
+// strava client, with stored data kept through the storage package.
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/apiversion"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// Config is set from the cmd/server flags, or by programs embedding the API
+type Config struct {
+	Addr       string // where the server listens, the fake strava is reached through it
+	PathPrefix string // e.g. /running when mounted under /running in another server
+	Dev        bool   // fixture data kept in memory, no GCP project or strava account needed
+	FakeStrava bool   // fixture strava but real storage, used by the e2e harness
+	Profile    string // storage profile such as staging, STORAGE_PROFILE when empty
+	Hooks      Hooks  // run around every endpoint, see Hooks
+}
+
+// set by Routes, so links and cookies this API hands out point under its mount point
+var pathPrefix string
+
+// OpenStorage must run before Routes or Commands; the returned func releases the GCS client.
+// It also opens the PUBSUB_TOPIC publisher and the BIGQUERY_DATASET exporter that
+// ingested changes are sent to, the SMTP_ADDR notifier reports are sent by, and
+// the GEO_BOUNDARIES activities are located with, and the CACHE_INVALIDATION_TOPIC
+// instances tell each other what they wrote on
+func OpenStorage(cfg Config) (func(), error) {
+	profile := cfg.Profile
+	if profile == "" {
+		profile = os.Getenv("STORAGE_PROFILE")
+	}
+	if err := useProfile(profile); err != nil {
+		return func() {}, err
+	}
+	if err := useNamespace(storageEnv, storageTenant); err != nil {
+		return func() {}, err
+	}
+	if storageCompression != "" && storageCompression != storage.EncodingGzip {
+		return func() {}, fmt.Errorf("STORAGE_COMPRESSION must be %s or unset", storage.EncodingGzip)
+	}
+	if err := openPublisher(cfg); err != nil {
+		// changes are still stored and logged, they just are not published
+		fmt.Println("publisher broken:", err)
+	}
+	if err := openExporter(); err != nil {
+		fmt.Println("bigquery broken:", err)
+	}
+	openNotifier(cfg)
+	openBoundaries(cfg)
+	if cfg.Dev {
+		return func() {}, openDevStorage()
+	}
+
+	client, err := storage.NewClient()
+	if err != nil {
+		// requests then fail with storage.ErrNoStorage instead of the process failing to start
+		fmt.Println("storage broken:", err)
+		return func() {}, nil
+	}
+	gcsClient = client
+	closeInvalidation, err := openInvalidation()
+	if err != nil {
+		// every read then checks GCS for changes, as with one instance
+		fmt.Println("cache invalidation broken:", err)
+	}
+	useBucket(bucketName)
+	if profile != "" {
+		fmt.Printf("storage profile %s: bucket %s, prefix %q\n", profile, bucketName, storagePrefix)
+	}
+	return func() {
+		closeInvalidation()
+		client.Close()
+	}, nil
+}
+
+// NewRouter is a standalone engine serving the API under cfg.PathPrefix;
+// call OpenStorage first
+func NewRouter(cfg Config) *gin.Engine {
+	router := gin.New()
+	trustProxies(router)
+	router.Use(gin.Logger(), gin.Recovery())
+	Routes(router, cfg)
+	return router
+}
+
+// NewHandler is NewRouter for net/http, echo and other non-gin servers; the
+// request path must still include cfg.PathPrefix, so do not strip it when mounting
+func NewHandler(cfg Config) http.Handler {
+	return NewRouter(cfg)
+}
+
+// Routes registers every endpoint on router, which may be an existing engine
+// or group of another gin server
+func Routes(router gin.IRouter, cfg Config) {
+	pathPrefix = strings.TrimSuffix(cfg.PathPrefix, "/")
+	if pathPrefix != "" {
+		router = router.Group(pathPrefix)
+	}
+	if handlers := cfg.Hooks.handlers(); len(handlers) > 0 {
+		router = router.Group("", handlers...)
+	}
+	// a request only starts its deadline once it leaves the route's queue
+	router = router.Group("", withAllocationStats, withRouteConcurrency, withRouteTimeout)
+
+	if cfg.Dev || cfg.FakeStrava {
+		serveFakeStrava(router, cfg.Addr)
+	}
+	if cfg.Dev {
+		fmt.Println("dev mode: serving fixture data, storage is in memory")
+	}
+
+	activityRead := requireScopes(strava.ScopeActivityRead)
+
+	routes := router.Group("/strava", newRequestLimiter().limit, negotiateFormat)
+	routes.GET("", cacheLatest, activityRead, getStravaData)
+	routes.GET("/athlete", cacheLatest, requireScopes(strava.ScopeRead), getStravaAthlete)
+	routes.GET("/athlete/zones", cacheLatest, requireScopes(strava.ScopeProfileReadAll), getStravaAthleteZones)
+	routes.GET("/activities", cacheLatest, activityRead, getStravaActivities)
+	routes.GET("/segments/starred", getStarredSegments)
+	routes.GET("/segments/explore", cacheLatest, getExploreSegments)
+	routes.GET("/segments/:id", getSegment)
+	routes.PUT("/segments/:id/star", requireAdmin, requireScopes(strava.ScopeProfileWrite), putSegmentStar)
+	routes.DELETE("/segments/:id/star", requireAdmin, requireScopes(strava.ScopeProfileWrite), deleteSegmentStar)
+	routes.GET("/segments/:id/my-efforts", requireFeature(apiversion.SegmentLeaderboards), activityRead, getSegmentEfforts)
+	routes.GET("/leaderboards", cacheLatest, getWeeklyLeaderboard)
+	routes.GET("/leaderboards/segments/:id", requireFeature(apiversion.SegmentLeaderboards), getSegmentLeaderboard)
+	routes.POST("/hydrate", requireAdmin, activityRead, postHydrate)
+	routes.GET("/activities/index", cacheLatest, getActivityIndex)
+	routes.GET("/activities/near", cacheLatest, getActivitiesNear)
+	routes.GET("/analytics/countries", cacheLatest, getCountries)
+	routes.GET("/analytics/lifetime", cacheLatest, getLifetime)
+	routes.GET("/analytics/engagement", cacheLatest, getEngagement)
+	routes.GET("/analytics/followers", requireFeature(apiversion.FollowerCounts), cacheLatest, getFollowers)
+	routes.GET("/photos", cacheLatest, activityRead, getPhotos)
+	routes.GET("/photos/:id/thumb", cacheHistorical, activityRead, getPhotoThumbnail)
+	routes.GET("/activities.ndjson", activityRead, getActivitiesNDJSON)
+	routes.GET("/activities/changes", getActivityChanges)
+	routes.GET("/export.parquet", requireAdmin, getParquetExport)
+	routes.GET("/exports/:token", requireAdmin, getExportDownload)
+	routes.GET("/activities/:id", cacheHistorical, activityRead, getActivityDetail)
+	routes.GET("/activities/:id/map.png", cacheHistorical, activityRead, getActivityMap)
+	routes.GET("/activities/:id/card.svg", cacheHistorical, activityRead, getActivityCard)
+	routes.GET("/activities/:id/metrics", cacheHistorical, activityRead, getActivityMetrics)
+	routes.GET("/activities/:id/track", cacheHistorical, activityRead, getActivityTrack)
+	routes.GET("/activities/:id/photos/:photo", cacheHistorical, activityRead, getActivityPhoto)
+	routes.GET("/activities/:id/zones", cacheLatest, activityRead, getActivityZones)
+	routes.GET("/activities/:id/revisions", getActivityRevisions)
+	routes.GET("/activities/:id/revisions/:revision/streams", getActivityRevisionStreams)
+	routes.POST("/activities/merge", requireAdmin, activityRead, postActivitiesMerge)
+	routes.POST("/activities/:id/trim", requireAdmin, activityRead, postActivityTrim)
+	routes.POST("/uploads", requireAdmin, requireScopes(strava.ScopeActivityWrite), postUpload)
+	routes.PUT("/uploads/:id", requireAdmin, putUploadChunk)
+	routes.GET("/uploads/:id", requireAdmin, getUpload)
+	routes.GET("/tracks/discrepancies", getTrackDiscrepancies)
+	routes.GET("/cards/weekly.svg", cacheLatest, getWeeklyCard)
+	routes.GET("/reports/weekly/latest", cacheLatest, getLatestWeeklyReport)
+	routes.GET("/reports/year/:year", cacheYear, getYearReport)
+	routes.GET("/reports/year/:year/map.png", cacheYear, getYearMap)
+	routes.POST("/sync", requireAdmin, activityRead, postSync)
+	routes.GET("/changelog", getChangelog)
+	routes.GET("/anomalies", getAnomalies)
+	routes.GET("/data-quality", getDataQuality)
+	routes.GET("/devices", getDeviceStats)
+	routes.GET("/races", getRaces)
+	routes.GET("/tags", getTags)
+	routes.GET("/activities/:id/tags", getActivityTags)
+	routes.GET("/activities/:id/note", requireAdmin, getActivityNote)
+	routes.PUT("/activities/:id/note", requireAdmin, putActivityNote)
+	routes.DELETE("/activities/:id/note", requireAdmin, deleteActivityNote)
+	routes.PUT("/activities/:id/tags", requireAdmin, putActivityTags)
+	routes.GET("/plans", getPlans)
+	routes.GET("/plans/compliance", getPlanCompliance)
+	routes.GET("/plans/:id", getPlan)
+	routes.POST("/plans", requireAdmin, postPlan)
+	routes.PUT("/plans/:id", requireAdmin, putPlan)
+	routes.DELETE("/plans/:id", requireAdmin, deletePlan)
+	routes.GET("/wellness", requireAdmin, getWellness)
+	routes.GET("/wellness/report", requireAdmin, getWellnessReport)
+	routes.GET("/wellness/:date", requireAdmin, getWellnessEntry)
+	routes.PUT("/wellness/:date", requireAdmin, putWellnessEntry)
+	routes.DELETE("/wellness/:date", requireAdmin, deleteWellnessEntry)
+	routes.GET("/gear", getGear)
+	routes.GET("/gear/:id/maintenance", getGearMaintenance)
+	routes.POST("/gear/:id/maintenance", requireAdmin, postGearMaintenance)
+	routes.PUT("/gear/:id/maintenance/:record", requireAdmin, putGearMaintenance)
+	routes.DELETE("/gear/:id/maintenance/:record", requireAdmin, deleteGearMaintenance)
+	routes.GET("/periods", requireAdmin, getPeriods)
+	routes.GET("/periods/:id", requireAdmin, getPeriod)
+	routes.POST("/periods", requireAdmin, postPeriod)
+	routes.PUT("/periods/:id", requireAdmin, putPeriod)
+	routes.DELETE("/periods/:id", requireAdmin, deletePeriod)
+	routes.POST("/anomalies/fix", requireAdmin, requireScopes(strava.ScopeActivityWrite), postAnomaliesFix)
+	routes.DELETE("/athletes/:id", requireAdmin, deleteAthlete)
+	router.GET("/", getIndex)
+	router.GET("/auth/login", getAuthLogin)
+	router.GET("/auth/callback", getAuthCallback)
+	router.GET("/widgets/latest-activity", getLatestActivityWidget)
+	router.GET("/widgets/weekly-summary", getWeeklySummaryWidget)
+	router.GET("/webhook", getWebhook)
+	router.POST("/webhook", postWebhook)
+
+	admin := router.Group("/admin", requireAdmin)
+	admin.POST("/credentials", postAdminCredentials)
+	admin.POST("/credentials/test", postAdminCredentialsTest)
+	admin.GET("/audit", getAdminAudit)
+	admin.GET("/export", getAdminExport)
+	admin.GET("/exports/:token", getAdminExportDownload)
+	admin.POST("/import", postAdminImport)
+	admin.GET("/decode-report", getAdminDecodeReport)
+	admin.POST("/cache/purge", postAdminCachePurge)
+	admin.GET("/metrics", getAdminMetrics)
+	profilingRoutes(admin)
+	admin.GET("/storage", getAdminStorage)
+	admin.POST("/storage/prune", postAdminStoragePrune)
+	admin.POST("/storage/verify", postAdminStorageVerify)
+	admin.GET("/features", getAdminFeatures)
+	admin.GET("/leader", getAdminLeader)
+	admin.POST("/reports/weekly/send", postAdminWeeklyReport)
+	admin.GET("/webhook/subscription", getAdminSubscription)
+	admin.POST("/webhook/subscription/rotate", postAdminSubscriptionRotate)
+	admin.GET("/webhooks/dead-letters", getAdminWebhookDeadLetters)
+	admin.POST("/webhooks/replay/:id", postAdminWebhookReplay)
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// a snapshot is never allowed to carry secrets
+func isSecretObject(object string) bool {
+	return strings.HasPrefix(object, "credentials/") || strings.HasSuffix(object, "credentials.json")
+}
+
+// the objects of a registered athlete, see RegisteredAthlete.objectPrefix
+var registeredAthleteObject = regexp.MustCompile(`^athletes/[0-9]+/`)
+
+// only what writeSnapshot exports may be restored, so an import can not
+// rewrite the audit log, the leases or the webhook state
+func isRestorableObject(object string) bool {
+	if isSecretObject(object) {
+		return false
+	}
+	for _, prefix := range ownerDataPrefixes {
+		if strings.HasPrefix(object, prefix) {
+			return true
+		}
+	}
+	return registeredAthleteObject.MatchString(object)
+}
+
+type SnapshotImportResult struct {
+	Written []string `json:"written"`
+	Skipped []string `json:"skipped"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// writes every stored object under the prefixes into a gzipped tarball keyed by object name
+func writeSnapshot(ctx context.Context, w io.Writer, prefixes []string) (int, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	written := 0
+	for _, prefix := range prefixes {
+		objects, err := listGCSObjects(ctx, prefix)
+		if err != nil {
+			return written, err
+		}
+		for _, object := range objects {
+			if isSecretObject(object) {
+				continue
+			}
+			data, err := readGCSObject(ctx, object)
+			if err != nil {
+				return written, fmt.Errorf("%s: %w", object, err)
+			}
+
+			header := &tar.Header{Name: object, Mode: 0644, Size: int64(len(data)), ModTime: time.Now().UTC()}
+			if err := tw.WriteHeader(header); err != nil {
+				return written, err
+			}
+			if _, err := tw.Write(data); err != nil {
+				return written, err
+			}
+			written++
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return written, err
+	}
+	return written, gz.Close()
+}
+
+// restores a snapshot written by writeSnapshot, existing objects are kept unless overwrite is set
+func readSnapshot(ctx context.Context, r io.Reader, overwrite bool) (SnapshotImportResult, error) {
+	var result SnapshotImportResult
+	result.Written = []string{}
+	result.Skipped = []string{}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return result, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		object := header.Name
+		if object != path.Clean(object) || strings.HasPrefix(object, "/") || strings.HasPrefix(object, "../") || !isRestorableObject(object) {
+			result.Skipped = append(result.Skipped, object)
+			continue
+		}
+
+		if !overwrite {
+			exists, err := gcsObjectExists(ctx, object)
+			if err != nil || exists {
+				result.Skipped = append(result.Skipped, object)
+				continue
+			}
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return result, err
+		}
+		if err := putDataToGCS(ctx, object, data); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", object, err))
+			continue
+		}
+		result.Written = append(result.Written, object)
+	}
+	return result, nil
+}
+
+func snapshotPrefixes(c *gin.Context) ([]string, int64, error) {
+	ctx := c.Request.Context()
+	athleteId := ownerAthleteId(ctx)
+	if s := c.Query("athlete"); s != "" {
+		var err error
+		athleteId, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return athleteDataPrefixes(athleteId, athleteId == ownerAthleteId(ctx)), athleteId, nil
+}
+
+func getAdminExport(c *gin.Context) {
+	ctx := c.Request.Context()
+	prefixes, athleteId, err := snapshotPrefixes(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "athlete must be numeric"})
+		return
+	}
+
+	// built in full before sending, so it can be stored for a resumed download
+	var buf bytes.Buffer
+	written, err := writeSnapshot(ctx, &buf, prefixes)
+	recordAudit(AuditSnapshotExport, adminActor(c), strconv.FormatInt(athleteId, 10), err, map[string]interface{}{"objects": written})
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to build snapshot", "objects": written})
+		return
+	}
+
+	filename := fmt.Sprintf("strava-snapshot-%d-%s.tar.gz", athleteId, time.Now().UTC().Format("20060102"))
+	serveExport(c, filename, "application/gzip", buf.Bytes(), true)
+}
+
+func postAdminImport(c *gin.Context) {
+	ctx := c.Request.Context()
+	overwrite := c.Query("overwrite") == "true"
+
+	result, err := readSnapshot(ctx, c.Request.Body, overwrite)
+	recordAudit(AuditSnapshotImport, adminActor(c), "", err, map[string]interface{}{"written": len(result.Written), "skipped": len(result.Skipped)})
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "body must be a snapshot tarball", "partial": result})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, result)
+}
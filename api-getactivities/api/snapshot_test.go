@@ -0,0 +1,66 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+)
+
+func TestReadSnapshot(t *testing.T) {
+	defer func(store storage.ObjectStore) { objects = store }(objects)
+	objects = storage.NewMemory()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	names := []string{
+		"ACTIVITIES/1.json",
+		"changelog/activities/2026-10.json",
+		"athletes/5/profile.json",
+		"audit/2026-10-01/1-admin.import.json",
+		syncLeaseObject,
+		webhookEventObject("1"),
+		"credentials/strava_refresh_token.json",
+		"athletes/5/credentials.json",
+		"athletes/registry.json",
+		"../ACTIVITIES/2.json",
+		"/ACTIVITIES/3.json",
+	}
+	for _, name := range names {
+		data := []byte(`{"restored": true}`)
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := readSnapshot(context.Background(), &buf, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := names[:3]; !reflect.DeepEqual(result.Written, want) {
+		t.Errorf("written %v, want %v", result.Written, want)
+	}
+	if want := names[3:]; !reflect.DeepEqual(result.Skipped, want) {
+		t.Errorf("skipped %v, want %v", result.Skipped, want)
+	}
+	for _, name := range names[3:] {
+		if _, err := objects.Read(name); !errors.Is(err, storage.ErrObjectNotExist) {
+			t.Errorf("%s was stored", name)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// starred segments and their details are kept so the segment endpoints still
+// answer when strava can't be reached
+const (
+	segmentsPrefix        = "segments/"
+	starredSegmentsObject = segmentsPrefix + "starred.json"
+)
+
+// a sync also syncs the starred segments once they are older than this
+var starredSyncInterval = time.Duration(env.Int("STARRED_SYNC_HOURS", 24)) * time.Hour
+
+type StarredSegments struct {
+	SyncedAt string           `json:"synced_at"`
+	Segments []strava.Segment `json:"segments"`
+}
+
+type StarredSyncResult struct {
+	Segments int     `json:"segments"`
+	Detailed int     `json:"detailed"` // segments whose details were fetched
+	Efforts  int     `json:"efforts"`  // of the athlete, on all of them
+	Failed   []int64 `json:"failed"`
+}
+
+func segmentObject(segmentId int64) string {
+	return fmt.Sprintf("%s%d.json", segmentsPrefix, segmentId)
+}
+
+// the starred list is read-modify-written so a star and a sync are serialized
+var starredMu sync.Mutex
+
+func loadStarredSegments(ctx context.Context) StarredSegments {
+	starred := StarredSegments{Segments: []strava.Segment{}}
+
+	slurp := getDataFromGCS(ctx, starredSegmentsObject)
+	if slurp == nil {
+		return starred
+	}
+	if err := json.Unmarshal(slurp, &starred); err != nil {
+		fmt.Println(err)
+	}
+	return starred
+}
+
+func storeStarredSegments(ctx context.Context, starred StarredSegments) error {
+	bytes_starred, err := json.Marshal(starred)
+	if err != nil {
+		return err
+	}
+	return putDataToGCS(ctx, starredSegmentsObject, bytes_starred)
+}
+
+func loadSegment(ctx context.Context, segmentId int64) (strava.Segment, error) {
+	var segment strava.Segment
+
+	slurp, err := readGCSObject(ctx, segmentObject(segmentId))
+	if err != nil {
+		return segment, err
+	}
+	err = json.Unmarshal(slurp, &segment)
+	return segment, err
+}
+
+func storeSegment(ctx context.Context, segment strava.Segment) error {
+	bytes_segment, err := json.Marshal(segment)
+	if err != nil {
+		return err
+	}
+	return putDataToGCS(ctx, segmentObject(segment.Id), bytes_segment)
+}
+
+// stores the starred list, the details of segments not stored yet, and the
+// athlete's efforts on each; one segment failing does not stop the rest
+func syncStarredSegments(ctx context.Context, client *http.Client, access_token string) (StarredSyncResult, error) {
+	result := StarredSyncResult{Failed: []int64{}}
+
+	segments, err := strava.ListStarredSegments(client, access_token)
+	if err != nil {
+		return result, err
+	}
+	result.Segments = len(segments)
+
+	for _, s := range segments {
+		if _, err := loadSegment(ctx, s.Id); errors.Is(err, storage.ErrObjectNotExist) {
+			detail, err := strava.GetSegment(client, access_token, s.Id)
+			if err == nil {
+				err = storeSegment(ctx, detail)
+			}
+			if err != nil {
+				fmt.Println(err)
+				result.Failed = append(result.Failed, s.Id)
+				continue
+			}
+			result.Detailed++
+		}
+		efforts, err := syncSegmentEfforts(ctx, client, ownerCredentialsObject, "", s.Id, loadSegmentEfforts(ctx, "", s.Id))
+		if err != nil {
+			fmt.Println(err)
+			result.Failed = append(result.Failed, s.Id)
+		}
+		result.Efforts += len(efforts.Efforts)
+	}
+
+	starredMu.Lock()
+	defer starredMu.Unlock()
+	err = storeStarredSegments(ctx, StarredSegments{SyncedAt: time.Now().UTC().Format(time.RFC3339), Segments: segments})
+	return result, err
+}
+
+// run after an activity sync, once the stored list is older than STARRED_SYNC_HOURS
+func syncStarredSegmentsIfStale(ctx context.Context, client *http.Client, access_token string) {
+	synced, err := time.Parse(time.RFC3339, loadStarredSegments(ctx).SyncedAt)
+	if err == nil && time.Since(synced) < starredSyncInterval {
+		return
+	}
+	result, err := syncStarredSegments(ctx, client, access_token)
+	recordAudit(AuditSegmentsSync, "sync", "", err, map[string]interface{}{"segments": result.Segments, "failed": len(result.Failed)})
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// the stored starred segments, synced first when they never were
+func getStarredSegments(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	starred := loadStarredSegments(ctx)
+	if starred.SyncedAt == "" {
+		client := stravaClient(c)
+		access_token, err := getAccessToken(ctx, client)
+		if err != nil {
+			respondUpstreamError(c, "unable to refresh strava token", err)
+			return
+		}
+		if _, err := syncStarredSegments(ctx, client, access_token); err != nil {
+			respondUpstreamError(c, "unable to fetch starred segments from strava", err)
+			return
+		}
+		starred = loadStarredSegments(ctx)
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"synced_at": starred.SyncedAt, "data": starred.Segments})
+}
+
+// the stored details, fetched and stored when there are none
+func getSegment(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	segmentId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "segment id must be numeric"})
+		return
+	}
+	if segment, err := loadSegment(ctx, segmentId); err == nil {
+		c.IndentedJSON(http.StatusOK, segment)
+		return
+	}
+
+	client := stravaClient(c)
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		respondUpstreamError(c, "unable to refresh strava token", err)
+		return
+	}
+	segment, err := strava.GetSegment(client, access_token, segmentId)
+	if err != nil {
+		respondUpstreamError(c, "unable to fetch segment from strava", err)
+		return
+	}
+	if err := storeSegment(ctx, segment); err != nil {
+		fmt.Println(err)
+	}
+	c.IndentedJSON(http.StatusOK, segment)
+}
+
+// stars or unstars the segment on strava and in the stored list
+func starSegment(c *gin.Context, starred bool) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	segmentId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "segment id must be numeric"})
+		return
+	}
+
+	client := stravaClient(c)
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		respondUpstreamError(c, "unable to refresh strava token", err)
+		return
+	}
+	segment, err := strava.StarSegment(client, access_token, segmentId, starred)
+	recordAudit(AuditSegmentStar, adminActor(c), strconv.FormatInt(segmentId, 10), err, map[string]interface{}{"starred": starred})
+	if err != nil {
+		respondUpstreamError(c, "unable to star segment on strava", err)
+		return
+	}
+
+	if err := storeSegment(ctx, segment); err != nil {
+		fmt.Println(err)
+	}
+	starredMu.Lock()
+	list := loadStarredSegments(ctx)
+	kept := []strava.Segment{}
+	for _, s := range list.Segments {
+		if s.Id != segmentId {
+			kept = append(kept, s)
+		}
+	}
+	if starred {
+		kept = append([]strava.Segment{segment}, kept...)
+	}
+	list.Segments = kept
+	if err := storeStarredSegments(ctx, list); err != nil {
+		fmt.Println(err)
+	}
+	starredMu.Unlock()
+
+	c.IndentedJSON(http.StatusOK, segment)
+}
+
+func putSegmentStar(c *gin.Context) {
+	starSegment(c, true)
+}
+
+func deleteSegmentStar(c *gin.Context) {
+	starSegment(c, false)
+}
+
+func runStarredSync(args []string) error {
+	ctx := context.Background()
+	fs := flag.NewFlagSet("starred-segments", flag.ExitOnError)
+	bucket := fs.String("bucket", bucketName, "bucket to store the segments in")
+	fs.Parse(args)
+
+	useBucket(*bucket)
+
+	client := strava.DefaultClient
+
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	result, err := syncStarredSegments(ctx, client, access_token)
+	recordAudit(AuditSegmentsSync, "cli", "", err, map[string]interface{}{"segments": result.Segments, "failed": len(result.Failed)})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "synced %d starred segments, %d efforts, %d failed\n", result.Segments, result.Efforts, len(result.Failed))
+	return nil
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// writes this service's error envelope, adding the sanitized strava error when there is one
+func respondUpstreamError(c *gin.Context, message string, err error) {
+	fmt.Println(message+":", err)
+	if timedOut(c) {
+		respondTimeout(c)
+		return
+	}
+
+	var stravaErr *strava.Error
+	if !errors.As(err, &stravaErr) {
+		c.IndentedJSON(http.StatusBadGateway, gin.H{"error": message})
+		return
+	}
+
+	if stravaErr.Kind() == strava.KindScope {
+		var missing []string
+		for _, f := range stravaErr.Errors {
+			if f.Code == "missing" {
+				missing = append(missing, strings.TrimSuffix(f.Field, "_permission"))
+			}
+		}
+		respondMissingScopes(c, missing)
+		return
+	}
+
+	status := http.StatusBadGateway
+	switch stravaErr.Kind() {
+	case strava.KindRateLimit:
+		status = http.StatusServiceUnavailable
+		c.Header("Retry-After", "900")
+	case strava.KindNotFound:
+		status = http.StatusNotFound
+	}
+
+	// only strava's own message and fault codes are passed through, never request details
+	c.IndentedJSON(status, gin.H{
+		"error": message,
+		"upstream": gin.H{
+			"kind":    stravaErr.Kind(),
+			"status":  stravaErr.StatusCode,
+			"message": stravaErr.Message,
+			"errors":  stravaErr.Errors,
+		},
+	})
+}
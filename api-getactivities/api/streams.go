@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+const streamsPrefix = "streams/"
+
+func streamsObject(id int64) string {
+	return fmt.Sprintf("%s%d.json", streamsPrefix, id)
+}
+
+// stored streams only, nil when they have not been fetched yet
+func storedStreams(ctx context.Context, id int64) *strava.StreamSet {
+	var streams strava.StreamSet
+	if !decodeDataFromGCS(ctx, streamsObject(id), &streams) {
+		return nil
+	}
+	return &streams
+}
+
+// streams of a finished activity never change, so once stored they are not fetched again
+func loadStreams(ctx context.Context, client *http.Client, access_token string, id int64) (strava.StreamSet, error) {
+	var streams strava.StreamSet
+
+	err := decodeGCSObject(ctx, streamsObject(id), &streams)
+	if err == nil {
+		return streams, nil
+	}
+	if !errors.Is(err, storage.ErrObjectNotExist) {
+		return streams, err
+	}
+
+	streams, err = strava.GetStreams(client, access_token, id)
+	if err != nil {
+		return streams, err
+	}
+	bytes_streams, err := json.Marshal(streams)
+	if err != nil {
+		return streams, err
+	}
+	if err := putDataToGCS(ctx, streamsObject(id), bytes_streams); err != nil {
+		fmt.Println(err)
+	}
+	return streams, nil
+}
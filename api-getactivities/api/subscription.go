@@ -0,0 +1,253 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+const subscriptionObject = "webhook/subscription.json"
+
+// the verify token is replaced, and the subscription created again, once it is this old
+var webhookTokenMaxAgeDays = env.Int("WEBHOOK_TOKEN_MAX_AGE_DAYS", 90)
+
+// WebhookSubscription is the managed push subscription; before the first
+// rotation STRAVA_SUBSCRIPTION_ID and STRAVA_VERIFY_TOKEN are used instead
+type WebhookSubscription struct {
+	Id          int64  `json:"id"` // 0 until strava has validated the callback
+	CallbackURL string `json:"callback_url"`
+	VerifyToken string `json:"verify_token"`
+	RotatedAt   string `json:"rotated_at,omitempty"`
+}
+
+type SubscriptionStatus struct {
+	Id           int64                     `json:"id"`
+	CallbackURL  string                    `json:"callback_url"`
+	RotatedAt    string                    `json:"rotated_at,omitempty"`
+	TokenAgeDays int                       `json:"token_age_days,omitempty"`
+	Active       bool                      `json:"active"` // strava lists the subscription
+	Strava       []strava.PushSubscription `json:"strava"`
+	Error        string                    `json:"error,omitempty"`
+}
+
+// rotations are serialized; the webhook handlers only read, since strava calls
+// back during a rotation
+var subscriptionMu sync.Mutex
+
+func loadSubscription(ctx context.Context) WebhookSubscription {
+	var sub WebhookSubscription
+
+	slurp := getDataFromGCS(ctx, subscriptionObject)
+	if slurp == nil {
+		sub.Id, _ = strconv.ParseInt(os.Getenv("STRAVA_SUBSCRIPTION_ID"), 10, 64)
+		sub.VerifyToken = os.Getenv("STRAVA_VERIFY_TOKEN")
+		return sub
+	}
+	if err := json.Unmarshal(slurp, &sub); err != nil {
+		fmt.Println(err)
+	}
+	return sub
+}
+
+func saveSubscription(ctx context.Context, sub WebhookSubscription) error {
+	bytes_sub, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	return putDataToGCS(ctx, subscriptionObject, bytes_sub)
+}
+
+// WEBHOOK_CALLBACK_URL, then the stored callback, then /webhook on the requesting host
+func webhookCallbackURL(c *gin.Context) string {
+	ctx := c.Request.Context()
+	if callback := os.Getenv("WEBHOOK_CALLBACK_URL"); callback != "" {
+		return callback
+	}
+	if callback := loadSubscription(ctx).CallbackURL; callback != "" {
+		return callback
+	}
+	scheme := "https"
+	if c.Request.TLS == nil && c.GetHeader("X-Forwarded-Proto") != "https" {
+		scheme = "http"
+	}
+	return scheme + "://" + c.Request.Host + pathPrefix + "/webhook"
+}
+
+func newVerifyToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// rotateSubscription replaces the verify token and creates the subscription
+// again with it, strava only checks the token then, which also re-validates
+// the callback. The new token is stored first so the callback accepts it;
+// strava allows one subscription per app, so the old one is deleted first too
+func rotateSubscription(ctx context.Context, callbackURL string) (WebhookSubscription, error) {
+	subscriptionMu.Lock()
+	defer subscriptionMu.Unlock()
+
+	if callbackURL == "" {
+		return WebhookSubscription{}, errors.New("callback url is not known, set WEBHOOK_CALLBACK_URL")
+	}
+	app, err := loadCredentials(ctx, ownerCredentialsObject)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	token, err := newVerifyToken()
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+
+	sub := loadSubscription(ctx)
+	sub.CallbackURL = callbackURL
+	sub.VerifyToken = token
+	if err := saveSubscription(ctx, sub); err != nil {
+		return sub, err
+	}
+
+	client := strava.DefaultClient
+	existing, err := strava.ListPushSubscriptions(client, app)
+	if err != nil {
+		return sub, err
+	}
+	for _, s := range existing {
+		if err := strava.DeletePushSubscription(client, app, s.Id); err != nil {
+			return sub, err
+		}
+	}
+
+	id, err := strava.CreatePushSubscription(client, app, callbackURL, token)
+	sub.Id = id
+	if err == nil {
+		sub.RotatedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	if saveErr := saveSubscription(ctx, sub); err == nil {
+		err = saveErr
+	}
+	return sub, err
+}
+
+func subscriptionStatus(ctx context.Context) SubscriptionStatus {
+	sub := loadSubscription(ctx)
+	status := SubscriptionStatus{Id: sub.Id, CallbackURL: sub.CallbackURL, RotatedAt: sub.RotatedAt, Strava: []strava.PushSubscription{}}
+	if rotated, err := time.Parse(time.RFC3339, sub.RotatedAt); err == nil {
+		status.TokenAgeDays = int(time.Since(rotated).Hours() / 24)
+	}
+
+	app, err := loadCredentials(ctx, ownerCredentialsObject)
+	if err == nil {
+		status.Strava, err = strava.ListPushSubscriptions(strava.DefaultClient, app)
+	}
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	for _, s := range status.Strava {
+		status.Active = status.Active || (sub.Id != 0 && s.Id == sub.Id)
+	}
+	return status
+}
+
+// whether the subscription has to be created again: strava drops it after
+// callbacks keep failing, and the token is replaced once it gets old
+func subscriptionStale(status SubscriptionStatus) (string, bool) {
+	switch {
+	case status.Error != "":
+		return "", false
+	case !status.Active:
+		return "not listed by strava", true
+	case status.RotatedAt == "":
+		return "token was never rotated", true
+	case status.TokenAgeDays >= webhookTokenMaxAgeDays:
+		return fmt.Sprintf("token is %d days old", status.TokenAgeDays), true
+	}
+	return "", false
+}
+
+func getAdminSubscription(c *gin.Context) {
+	ctx := c.Request.Context()
+	status := subscriptionStatus(ctx)
+	if status.Error != "" {
+		c.IndentedJSON(http.StatusBadGateway, status)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, status)
+}
+
+type SubscriptionRotation struct {
+	CallbackURL string `json:"callback_url"`
+}
+
+func postAdminSubscriptionRotate(c *gin.Context) {
+	ctx := c.Request.Context()
+	var rotation SubscriptionRotation
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&rotation); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "body must be a JSON object with callback_url"})
+			return
+		}
+	}
+	if rotation.CallbackURL == "" {
+		rotation.CallbackURL = webhookCallbackURL(c)
+	}
+
+	sub, err := rotateSubscription(ctx, rotation.CallbackURL)
+	recordAudit(AuditWebhookRotate, adminActor(c), sub.CallbackURL, err, map[string]interface{}{"subscription_id": sub.Id})
+	if err != nil {
+		respondUpstreamError(c, "unable to rotate the webhook subscription", err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, subscriptionStatus(ctx))
+}
+
+// for a daily job: creates the subscription again when strava no longer
+// lists it or its token is older than WEBHOOK_TOKEN_MAX_AGE_DAYS
+func runWebhookSubscription(args []string) error {
+	ctx := context.Background()
+	fs := flag.NewFlagSet("webhook-subscription", flag.ExitOnError)
+	callback := fs.String("callback", "", "callback url, WEBHOOK_CALLBACK_URL or the stored one when omitted")
+	rotate := fs.Bool("rotate", false, "rotate even when the subscription is current")
+	fs.Parse(args)
+
+	status := subscriptionStatus(ctx)
+	if status.Error != "" {
+		return errors.New(status.Error)
+	}
+	reason, stale := subscriptionStale(status)
+	if *rotate {
+		reason, stale = "requested", true
+	}
+	if !stale {
+		fmt.Printf("subscription %d is current, token %d days old\n", status.Id, status.TokenAgeDays)
+		return nil
+	}
+
+	callbackURL := *callback
+	if callbackURL == "" {
+		callbackURL = env.String("WEBHOOK_CALLBACK_URL", status.CallbackURL)
+	}
+	sub, err := rotateSubscription(ctx, callbackURL)
+	recordAudit(AuditWebhookRotate, "service", sub.CallbackURL, err, map[string]interface{}{"subscription_id": sub.Id, "reason": reason})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("subscription %d created for %s: %s\n", sub.Id, sub.CallbackURL, reason)
+	return nil
+}
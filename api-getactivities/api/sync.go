@@ -0,0 +1,192 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/set"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+type SyncResult struct {
+	Listed  int              `json:"listed"`
+	Changes []ActivityChange `json:"changes"`
+}
+
+// the most recent pages of 200 activities, every page when pages is 0
+func listActivities(client *http.Client, access_token string, pages int) ([]strava.ActivitySummary, error) {
+	var listed []strava.ActivitySummary
+	for page := 1; pages == 0 || page <= pages; page++ {
+		parm := url.Values{}
+		parm.Add("per_page", "200")
+		parm.Add("page", strconv.Itoa(page))
+
+		var athActs strava.ActivityList
+		if err := strava.GetJSON(client, access_token, "/athlete/activities", parm, &athActs); err != nil {
+			return listed, err
+		}
+		listed = append(listed, athActs...)
+		if len(athActs) < 200 {
+			break
+		}
+	}
+	return listed, nil
+}
+
+// diffs the most recent pages of strava activities against the stored index,
+// storing new and renamed activities and dropping ones deleted upstream
+func syncActivities(ctx context.Context, client *http.Client, access_token string, pages int) (SyncResult, error) {
+	var result SyncResult
+	result.Changes = []ActivityChange{}
+
+	listed, err := listActivities(client, access_token, pages)
+	if err != nil {
+		return result, err
+	}
+	result.Listed = len(listed)
+
+	stored := make(map[int64]ActivityIndexEntry)
+	for _, e := range loadActivityIndex(ctx).Entries {
+		stored[e.Id] = e
+	}
+
+	var entries []ActivityIndexEntry
+	seen := set.New[int64]()
+	oldest := ""
+	for _, a := range listed {
+		seen.Add(a.Id)
+		if oldest == "" || a.StartDate < oldest {
+			oldest = a.StartDate
+		}
+
+		previous, ok := stored[a.Id]
+		if ok && previous.Name == a.Name {
+			continue
+		}
+
+		// keep hydrated detail when only the name changed
+		activity := strava.ActivityDetailed{ActivitySummary: a}
+		detailed := false
+		if ok && previous.Detailed {
+			if existing, found := loadActivity(ctx, a.Id); found {
+				activity = existing
+				activity.Name = a.Name
+				detailed = true
+			}
+		}
+
+		entry, err := saveActivity(ctx, activity, detailed)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		entries = append(entries, entry)
+
+		if ok {
+			result.Changes = append(result.Changes, ActivityChange{Kind: ChangeRenamed, ActivityId: a.Id, OldName: previous.Name, NewName: a.Name})
+		} else {
+			result.Changes = append(result.Changes, ActivityChange{Kind: ChangeCreated, ActivityId: a.Id, NewName: a.Name})
+		}
+	}
+
+	// only activities inside the listed window can be known to be deleted
+	var deleted []int64
+	if len(listed) > 0 {
+		for id, e := range stored {
+			if !seen.Has(id) && e.StartDate >= oldest {
+				deleted = append(deleted, id)
+				result.Changes = append(result.Changes, ActivityChange{Kind: ChangeDeleted, ActivityId: id, OldName: e.Name})
+			}
+		}
+	}
+
+	if err := upsertActivityIndex(ctx, entries); err != nil {
+		return result, err
+	}
+	if err := removeActivityIndexEntries(ctx, deleted); err != nil {
+		return result, err
+	}
+	for _, id := range deleted {
+		if err := deleteDataFromGCS(ctx, activityObject(id)); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	if err := appendChangelog(ctx, "sync", result.Changes); err != nil {
+		return result, err
+	}
+
+	// the warehouse is a copy for analysis, the stored activities stay the source of truth
+	if err := exportChanges(ctx, client, access_token, result.Changes); err != nil {
+		fmt.Println("bigquery export:", err)
+	}
+	return result, nil
+}
+
+func postSync(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	pages, err := strconv.Atoi(c.DefaultQuery("pages", "1"))
+	if err != nil || pages < 1 || pages > 50 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "pages must be between 1 and 50"})
+		return
+	}
+
+	client := stravaClient(c)
+
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		respondUpstreamError(c, "unable to refresh strava token", err)
+		return
+	}
+
+	result, err := syncActivities(ctx, client, access_token, pages)
+	recordAudit(AuditActivitiesSync, "api@"+c.ClientIP(), "", err, map[string]interface{}{"listed": result.Listed, "changes": len(result.Changes)})
+	if errors.Is(err, storage.ErrConflict) {
+		// another sync kept changing the index; what it stored is intact
+		fmt.Println(err)
+		c.Header("Retry-After", "5")
+		c.IndentedJSON(http.StatusConflict, gin.H{"error": "another sync is writing the activity index, retry", "retryable": true, "partial": result})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusBadGateway, gin.H{"error": "sync did not complete", "partial": result})
+		return
+	}
+	if len(result.Changes) > 0 {
+		if _, _, _, err := refreshRaceTags(ctx); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if prefetchStreamCount > 0 {
+		// after the response, a new activity's chart then finds its streams stored
+		go func() {
+			prefetched := prefetchStreams(context.Background(), strava.DefaultClient, access_token)
+			if prefetched.Fetched > 0 || prefetched.Failed > 0 {
+				fmt.Printf("prefetched streams of %d activities, %d failed\n", prefetched.Fetched, prefetched.Failed)
+			}
+		}()
+	}
+	// after the response as well, starring is rare so this is mostly a no-op
+	go syncStarredSegmentsIfStale(context.Background(), strava.DefaultClient, access_token)
+	// one athlete call, strava keeps no history of the counts
+	go recordFollowerCounts(context.Background(), strava.DefaultClient, access_token)
+	if len(result.Changes) > 0 && cdnPurgeURL != "" {
+		err := purgeCDN()
+		recordAudit(AuditCachePurge, "sync", cdnPurgeURL, err, nil)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	c.IndentedJSON(http.StatusOK, result)
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const tagsObject = "tags/activities.json"
+
+const TagRace = "race"
+
+var tagName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// ActivityTags keeps tags set by detection apart from the athlete's, so a
+// detection run never undoes what the athlete changed
+type ActivityTags struct {
+	Auto    []string `json:"auto,omitempty"`
+	Manual  []string `json:"manual,omitempty"`
+	Removed []string `json:"removed,omitempty"` // tags the athlete took off, detection leaves them off
+}
+
+type TagsUpdate struct {
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutTag(tags []string, tag string) []string {
+	var kept []string
+	for _, t := range tags {
+		if t != tag {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// Tags are the auto tags the athlete kept and their own, sorted
+func (t ActivityTags) Tags() []string {
+	tags := []string{}
+	for _, tag := range t.Auto {
+		if !containsTag(t.Removed, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	for _, tag := range t.Manual {
+		if !containsTag(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// the tags are read-modify-written so updates from concurrent handlers are serialized
+var tagsMu sync.Mutex
+
+func loadTags(ctx context.Context) map[int64]ActivityTags {
+	tags := make(map[int64]ActivityTags)
+
+	slurp := getDataFromGCS(ctx, tagsObject)
+	if slurp == nil {
+		return tags
+	}
+	if err := json.Unmarshal(slurp, &tags); err != nil {
+		fmt.Println(err)
+	}
+	return tags
+}
+
+// change edits the tags in place and reports whether it changed anything,
+// they are only written back when it did
+func updateTags(ctx context.Context, change func(tags map[int64]ActivityTags) bool) error {
+	tagsMu.Lock()
+	defer tagsMu.Unlock()
+
+	tags := loadTags(ctx)
+	if !change(tags) {
+		return nil
+	}
+	for id, t := range tags {
+		if len(t.Auto) == 0 && len(t.Manual) == 0 && len(t.Removed) == 0 {
+			delete(tags, id)
+		}
+	}
+
+	bytes_tags, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+	return putDataToGCS(ctx, tagsObject, bytes_tags)
+}
+
+// sets or clears an auto tag, true when that changed the activity's tags
+func setAutoTag(tags map[int64]ActivityTags, id int64, tag string, on bool) bool {
+	t := tags[id]
+	if containsTag(t.Auto, tag) == on {
+		return false
+	}
+	if on {
+		t.Auto = append(t.Auto, tag)
+	} else {
+		t.Auto = withoutTag(t.Auto, tag)
+	}
+	tags[id] = t
+	return true
+}
+
+func getTags(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	counts := make(map[string]int)
+	for _, t := range loadTags(ctx) {
+		for _, tag := range t.Tags() {
+			counts[tag]++
+		}
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"data": counts})
+}
+
+func getActivityTags(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "activity id must be numeric"})
+		return
+	}
+
+	t := loadTags(ctx)[id]
+	c.IndentedJSON(http.StatusOK, gin.H{"id": id, "tags": t.Tags(), "detail": t})
+}
+
+// adds the athlete's tags and takes tags off, auto tags included, which
+// detection then leaves off
+func putActivityTags(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "activity id must be numeric"})
+		return
+	}
+	var update TagsUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "body must be a JSON object with add and remove lists"})
+		return
+	}
+	for _, tag := range append(update.Add, update.Remove...) {
+		if !tagName.MatchString(tag) {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("tag %q must be lowercase letters, digits, _ and -", tag)})
+			return
+		}
+	}
+	if _, ok := loadActivity(ctx, id); !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "activity is not stored"})
+		return
+	}
+
+	var result ActivityTags
+	err = updateTags(ctx, func(tags map[int64]ActivityTags) bool {
+		t := tags[id]
+		for _, tag := range update.Remove {
+			t.Manual = withoutTag(t.Manual, tag)
+			// kept even when not auto tagged yet, so a later detection does not add it
+			if !containsTag(t.Removed, tag) {
+				t.Removed = append(t.Removed, tag)
+			}
+		}
+		for _, tag := range update.Add {
+			t.Removed = withoutTag(t.Removed, tag)
+			if !containsTag(t.Manual, tag) {
+				t.Manual = append(t.Manual, tag)
+			}
+		}
+		tags[id] = t
+		result = t
+		return true
+	})
+	recordAudit(AuditActivityTags, adminActor(c), strconv.FormatInt(id, 10), err, map[string]interface{}{"add": update.Add, "remove": update.Remove})
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to store tags"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"id": id, "tags": result.Tags(), "detail": result})
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/render"
+)
+
+// thumbnails are resized from the mirrored photos and kept for each size asked
+const photoThumbsPrefix = photosPrefix + "thumbs/"
+
+const (
+	maxThumbSide      = 1024
+	defaultThumbWidth = 400
+)
+
+func photoThumbObject(uniqueId string, width, height int) string {
+	return fmt.Sprintf("%s%s-%dx%d.jpg", photoThumbsPrefix, uniqueId, width, height)
+}
+
+// the photo scaled down to fit ?w= by ?h=, either left out to follow the
+// other; the photo is mirrored first when it was not yet
+func getPhotoThumbnail(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	width, err := intParam(c, "w", 0, 0, maxThumbSide)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	height, err := intParam(c, "h", 0, 0, maxThumbSide)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if width == 0 && height == 0 {
+		width = defaultThumbWidth
+	}
+	uniqueId := c.Param("id")
+
+	object := photoThumbObject(uniqueId, width, height)
+	if cached, err := readGCSObject(ctx, object); err == nil {
+		c.Data(http.StatusOK, "image/jpeg", cached)
+		return
+	}
+
+	original, ok := mirroredPhoto(c, 0, uniqueId)
+	if !ok {
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(original))
+	var buf bytes.Buffer
+	if err == nil {
+		err = jpeg.Encode(&buf, render.Thumbnail(img, width, height), &jpeg.Options{Quality: 85})
+	}
+	if err != nil {
+		fmt.Println(uniqueId, err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to resize photo"})
+		return
+	}
+
+	if err := putDataToGCS(ctx, object, buf.Bytes()); err != nil {
+		fmt.Println(err)
+	}
+	c.Data(http.StatusOK, "image/jpeg", buf.Bytes())
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// how long a request may take before its strava calls are canceled and it
+// answers 504, unless ROUTE_TIMEOUTS gives its route another
+var requestTimeout = time.Duration(env.Int("REQUEST_TIMEOUT_SECONDS", 30)) * time.Second
+
+var routeTimeouts = parseRouteTimeouts(os.Getenv("ROUTE_TIMEOUTS"))
+
+// a sync of many pages outlasts any page load, a download takes as long
+// as the client reads and a profile as long as it asks to record
+var defaultRouteTimeouts = map[string]time.Duration{
+	"/strava/sync":               2 * time.Minute,
+	"/strava/activities.ndjson":  0,
+	"/admin/debug/pprof/profile": 0,
+	"/admin/debug/pprof/trace":   0,
+}
+
+const timeoutKey = "request_timeout"
+
+// ROUTE_TIMEOUTS is a comma separated list of route=duration, the route as it
+// is registered without the path prefix, such as /strava/sync=2m. A duration
+// of 0 leaves the route without a timeout
+func parseRouteTimeouts(spec string) map[string]time.Duration {
+	timeouts := make(map[string]time.Duration)
+	for route, timeout := range defaultRouteTimeouts {
+		timeouts[route] = timeout
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, value, ok := strings.Cut(entry, "=")
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if !ok || err != nil || timeout < 0 {
+			fmt.Println("ROUTE_TIMEOUTS: ignoring", entry)
+			continue
+		}
+		timeouts[strings.TrimSpace(route)] = timeout
+	}
+	return timeouts
+}
+
+func routeTimeout(route string) time.Duration {
+	if timeout, ok := routeTimeouts[strings.TrimPrefix(route, pathPrefix)]; ok {
+		return timeout
+	}
+	return requestTimeout
+}
+
+// puts a deadline on the request's context, the strava calls made with
+// stravaClient and the Cloud Storage calls made with the context are
+// canceled at it; each storage call still gets GCS_TIMEOUT_SECONDS at most
+func withRouteTimeout(c *gin.Context) {
+	timeout := routeTimeout(c.FullPath())
+	if timeout == 0 {
+		c.Next()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+	c.Request = c.Request.WithContext(ctx)
+	c.Set(timeoutKey, timeout)
+
+	c.Next()
+
+	if ctx.Err() == context.DeadlineExceeded && !c.Writer.Written() {
+		respondTimeout(c)
+	}
+}
+
+// whether the request ran out of time, so a failed call should be answered
+// with respondTimeout rather than blamed on strava
+func timedOut(c *gin.Context) bool {
+	return c.Request.Context().Err() == context.DeadlineExceeded
+}
+
+func respondTimeout(c *gin.Context) {
+	timeout := c.GetDuration(timeoutKey)
+	c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{
+		"error":      fmt.Sprintf("request did not finish in %s", timeout),
+		"route":      strings.TrimPrefix(c.FullPath(), pathPrefix),
+		"timeout_ms": timeout.Milliseconds(),
+	})
+}
+
+// strava.DefaultClient with its calls canceled when the request times out;
+// work that outlives the request, such as the prefetch after a sync, must not use it
+func stravaClient(c *gin.Context) *http.Client {
+	return strava.Wrap(strava.DefaultClient, strava.WithContext(c.Request.Context()))
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+)
+
+// memory storage noting the contexts its calls are made with
+type contextStore struct {
+	storage.ObjectStore
+	mu       sync.Mutex
+	contexts []context.Context
+}
+
+func (s *contextStore) WithContext(ctx context.Context) storage.ObjectStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.contexts = append(s.contexts, ctx)
+	return s.ObjectStore
+}
+
+func TestStorageCallsHaveRouteDeadline(t *testing.T) {
+	defer func(store storage.ObjectStore) { objects = store }(objects)
+	store := &contextStore{ObjectStore: storage.NewMemory()}
+	objects = store
+
+	router := gin.New()
+	router.GET("/activities/index", withRouteTimeout, getActivityIndex)
+	before := time.Now()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/activities/index", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	if len(store.contexts) == 0 {
+		t.Fatal("the index was not read")
+	}
+	for _, ctx := range store.contexts {
+		deadline, ok := ctx.Deadline()
+		if !ok || deadline.After(before.Add(requestTimeout+time.Second)) {
+			t.Errorf("storage call with deadline %s, %v, want the request's", deadline, ok)
+		}
+		if ctx.Err() == nil {
+			t.Error("storage call context still live after the request")
+		}
+	}
+}
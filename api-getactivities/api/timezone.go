@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ATHLETE_TIMEZONE, e.g. America/Denver, is where weeks start for the weekly
+// endpoints; without it the zone of the newest stored activity is used
+var athleteTimeZone = os.Getenv("ATHLETE_TIMEZONE")
+
+// the zone aggregation endpoints bucket days in, ?tz= overrides it for one request
+func athleteZone(c *gin.Context) (*time.Location, error) {
+	ctx := c.Request.Context()
+	if tz := c.Query("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("tz must be a zone name like America/Denver")
+		}
+		return loc, nil
+	}
+	return defaultAthleteZone(ctx), nil
+}
+
+// ATHLETE_TIMEZONE, then the newest stored activity's zone, then UTC
+func defaultAthleteZone(ctx context.Context) *time.Location {
+	if athleteTimeZone != "" {
+		loc, err := time.LoadLocation(athleteTimeZone)
+		if err == nil {
+			return loc
+		}
+		fmt.Println("ATHLETE_TIMEZONE:", err)
+	}
+
+	// the index is newest first
+	for _, e := range loadActivityIndex(ctx).Entries {
+		if activity, ok := loadActivity(ctx, e.Id); ok {
+			return activity.Zone()
+		}
+	}
+	return time.UTC
+}
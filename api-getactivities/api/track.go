@@ -0,0 +1,147 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/streams"
+)
+
+// activities whose recomputed distance or moving time differ from strava's by
+// more than this percentage are flagged
+var trackDiscrepancyPercent = env.Int("TRACK_DISCREPANCY_PERCENT", 5)
+
+type TrackValues struct {
+	Distance   float64 `json:"distance"`
+	MovingTime int     `json:"moving_time"`
+}
+
+// TrackReport sets strava's distance and moving time beside the ones
+// recomputed from the cleaned track
+type TrackReport struct {
+	Id                    int64               `json:"id"`
+	Raw                   TrackValues         `json:"raw"`
+	Corrected             TrackValues         `json:"corrected"`
+	DistanceDiscrepancy   float64             `json:"distance_discrepancy"` // percent, positive when the track is longer
+	MovingTimeDiscrepancy float64             `json:"moving_time_discrepancy"`
+	Flagged               bool                `json:"flagged"`
+	Pauses                []analysis.Pause    `json:"pauses"`
+	Teleports             []analysis.Teleport `json:"teleports"`
+	Jumps                 int                 `json:"jumps"`
+	// with an altitude stream, where the athlete went down and how hard they braked
+	Descents *analysis.DescentReport `json:"descents,omitempty"`
+}
+
+func percentDifference(corrected, raw float64) float64 {
+	if raw == 0 {
+		return 0
+	}
+	return math.Round((corrected-raw)/raw*1000) / 10
+}
+
+// nil when the activity has no track
+func trackReport(activity strava.ActivitySummary, set strava.StreamSet) *TrackReport {
+	if set.LatLng == nil || set.Time == nil {
+		return nil
+	}
+	track := analysis.AnalyzeTrack(streams.Points(set.LatLng.Data), set.Time.Data, analysis.DefaultTrackOptions)
+
+	report := TrackReport{
+		Id:        activity.Id,
+		Raw:       TrackValues{Distance: activity.Distance, MovingTime: activity.MovingTime},
+		Corrected: TrackValues{Distance: math.Round(track.Distance*10) / 10, MovingTime: track.MovingTime},
+		Pauses:    track.Pauses,
+		Teleports: track.Teleports,
+		Jumps:     track.Jumps,
+	}
+	report.DistanceDiscrepancy = percentDifference(track.Distance, activity.Distance)
+	report.MovingTimeDiscrepancy = percentDifference(float64(track.MovingTime), float64(activity.MovingTime))
+	limit := float64(trackDiscrepancyPercent)
+	report.Flagged = math.Abs(report.DistanceDiscrepancy) > limit || math.Abs(report.MovingTimeDiscrepancy) > limit
+
+	if set.Altitude != nil && set.Distance != nil {
+		var speed []float64
+		if set.VelocitySmooth != nil {
+			speed = set.VelocitySmooth.Data
+		}
+		descents := analysis.AnalyzeDescents(set.Time.Data, set.Distance.Data, set.Altitude.Data, speed, analysis.DefaultDescentOptions)
+		report.Descents = &descents
+	}
+	return &report
+}
+
+func getActivityTrack(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "activity id must be numeric"})
+		return
+	}
+
+	activity, err := loadOrFetchActivity(ctx, id)
+	if err != nil {
+		respondUpstreamError(c, "unable to fetch activity from strava", err)
+		return
+	}
+
+	client := stravaClient(c)
+
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		respondUpstreamError(c, "unable to refresh strava token", err)
+		return
+	}
+
+	set, err := loadStreams(ctx, client, access_token, id)
+	if err != nil {
+		respondUpstreamError(c, "unable to fetch streams from strava", err)
+		return
+	}
+
+	report := trackReport(activity.ActivitySummary, set)
+	if report == nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "activity has no gps track"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, report)
+}
+
+// flagged reports of the activities whose streams are already stored, so
+// listing them costs no strava calls
+func getTrackDiscrepancies(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	objects, err := listGCSObjects(ctx, streamsPrefix)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to list stored streams"})
+		return
+	}
+
+	flagged := []TrackReport{}
+	for _, object := range objects {
+		id, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(object, streamsPrefix), ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+		activity, ok := loadActivity(ctx, id)
+		set := storedStreams(ctx, id)
+		if !ok || set == nil {
+			continue
+		}
+		if report := trackReport(activity.ActivitySummary, *set); report != nil && report.Flagged {
+			flagged = append(flagged, *report)
+		}
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"threshold_percent": trackDiscrepancyPercent, "checked": len(objects), "flagged": flagged})
+}
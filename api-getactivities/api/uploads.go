@@ -0,0 +1,461 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+const uploadsPrefix = "uploads/"
+
+// the stages of an upload job
+const (
+	UploadReceiving  = "receiving"  // waiting for the rest of the chunks
+	UploadSending    = "sending"    // the file is being sent to strava
+	UploadProcessing = "processing" // strava is turning it into an activity
+	UploadReady      = "ready"
+	UploadFailed     = "failed"
+)
+
+var (
+	uploadMaxBytes      = int64(env.Int("UPLOAD_MAX_MB", 100)) << 20
+	uploadChunkMaxBytes = int64(env.Int("UPLOAD_CHUNK_MAX_MB", 8)) << 20
+)
+
+// strava takes seconds for most files, the poll gives up well after that
+const (
+	uploadPollInterval = 2 * time.Second
+	uploadPollTimeout  = 5 * time.Minute
+)
+
+// UploadJob is a file on its way to becoming a strava activity. Chunks are
+// stored as they arrive, so an interrupted upload resumes from Received
+type UploadJob struct {
+	Id             string  `json:"id"`
+	Filename       string  `json:"filename"`
+	DataType       string  `json:"data_type"`
+	Name           string  `json:"name,omitempty"`
+	Description    string  `json:"description,omitempty"`
+	ExternalId     string  `json:"external_id,omitempty"`
+	Size           int64   `json:"size"`
+	Received       int64   `json:"received"`
+	Chunks         []int64 `json:"chunks"` // the offset each stored chunk starts at
+	Status         string  `json:"status"`
+	StravaUploadId int64   `json:"strava_upload_id,omitempty"`
+	StravaStatus   string  `json:"strava_status,omitempty"`
+	ActivityId     int64   `json:"activity_id,omitempty"`
+	Error          string  `json:"error,omitempty"`
+	CreatedAt      string  `json:"created_at"`
+	UpdatedAt      string  `json:"updated_at"`
+}
+
+// the percent of the file received
+func (j UploadJob) Progress() int {
+	if j.Size == 0 {
+		return 0
+	}
+	return int(j.Received * 100 / j.Size)
+}
+
+func (j UploadJob) MarshalJSON() ([]byte, error) {
+	type plain UploadJob
+	return json.Marshal(struct {
+		plain
+		Progress int `json:"progress"`
+	}{plain(j), j.Progress()})
+}
+
+// UploadRequest starts a chunked upload of a file of Size bytes
+type UploadRequest struct {
+	Filename    string `json:"filename"`
+	Size        int64  `json:"size"`
+	DataType    string `json:"data_type"` // from the filename when omitted
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ExternalId  string `json:"external_id"`
+}
+
+// jobs are read-modify-written by the chunk handlers and the processing goroutine
+var uploadsMu sync.Mutex
+
+func uploadJobObject(id string) string {
+	return uploadsPrefix + id + ".json"
+}
+
+func uploadChunkObject(id string, offset int64) string {
+	return fmt.Sprintf("%s%s/%d", uploadsPrefix, id, offset)
+}
+
+func loadUploadJob(ctx context.Context, id string) (UploadJob, error) {
+	var job UploadJob
+
+	slurp, err := readGCSObject(ctx, uploadJobObject(id))
+	if err != nil {
+		return job, err
+	}
+	err = json.Unmarshal(slurp, &job)
+	return job, err
+}
+
+func saveUploadJob(ctx context.Context, job UploadJob) error {
+	job.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	bytes_job, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return putDataToGCS(ctx, uploadJobObject(job.Id), bytes_job)
+}
+
+// changes the stored job under uploadsMu, for the processing goroutine
+func updateUploadJob(ctx context.Context, id string, update func(*UploadJob)) UploadJob {
+	uploadsMu.Lock()
+	defer uploadsMu.Unlock()
+
+	job, err := loadUploadJob(ctx, id)
+	if err != nil {
+		fmt.Println(err)
+		return job
+	}
+	update(&job)
+	if err := saveUploadJob(ctx, job); err != nil {
+		fmt.Println(err)
+	}
+	return job
+}
+
+// the data type named in the request, or taken from the filename, e.g.
+// ride.fit.gz is fit.gz
+func uploadDataType(dataType string, filename string) (string, error) {
+	if dataType == "" {
+		base := strings.ToLower(path.Base(filename))
+		dataType = strings.TrimPrefix(path.Ext(base), ".")
+		if dataType == "gz" {
+			dataType = strings.TrimPrefix(path.Ext(strings.TrimSuffix(base, ".gz")), ".") + ".gz"
+		}
+	}
+	for _, t := range strava.UploadDataTypes {
+		if dataType == t {
+			return dataType, nil
+		}
+	}
+	return "", fmt.Errorf("data_type must be one of %s", strings.Join(strava.UploadDataTypes, ", "))
+}
+
+func newUploadJob(req UploadRequest) (UploadJob, error) {
+	if req.Filename == "" {
+		return UploadJob{}, errors.New("filename is required")
+	}
+	if req.Size < 1 || req.Size > uploadMaxBytes {
+		return UploadJob{}, fmt.Errorf("size must be between 1 and %d bytes", uploadMaxBytes)
+	}
+	dataType, err := uploadDataType(req.DataType, req.Filename)
+	if err != nil {
+		return UploadJob{}, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return UploadJob{}, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	return UploadJob{
+		Id:          hex.EncodeToString(id),
+		Filename:    path.Base(req.Filename),
+		DataType:    dataType,
+		Name:        req.Name,
+		Description: req.Description,
+		ExternalId:  req.ExternalId,
+		Size:        req.Size,
+		Chunks:      []int64{},
+		Status:      UploadReceiving,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, nil
+}
+
+// stores the chunk at job.Received, uploadsMu is held
+func appendUploadChunk(ctx context.Context, job *UploadJob, chunk []byte) error {
+	if err := putDataToGCS(ctx, uploadChunkObject(job.Id, job.Received), chunk); err != nil {
+		return err
+	}
+	job.Chunks = append(job.Chunks, job.Received)
+	job.Received += int64(len(chunk))
+	if job.Received == job.Size {
+		job.Status = UploadSending
+	}
+	return saveUploadJob(ctx, *job)
+}
+
+func readUploadFile(ctx context.Context, job UploadJob) ([]byte, error) {
+	offsets := append([]int64{}, job.Chunks...)
+	sort.Slice(offsets, func(i, k int) bool { return offsets[i] < offsets[k] })
+
+	var file bytes.Buffer
+	for _, offset := range offsets {
+		chunk, err := readGCSObject(ctx, uploadChunkObject(job.Id, offset))
+		if err != nil {
+			return nil, err
+		}
+		file.Write(chunk)
+	}
+	if int64(file.Len()) != job.Size {
+		return nil, fmt.Errorf("upload %s has %d of %d bytes", job.Id, file.Len(), job.Size)
+	}
+	return file.Bytes(), nil
+}
+
+func deleteUploadChunks(ctx context.Context, job UploadJob) {
+	for _, offset := range job.Chunks {
+		if err := deleteDataFromGCS(ctx, uploadChunkObject(job.Id, offset)); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// sends the received file to strava and polls it until the activity exists,
+// after the response; the request that completed the file is long gone
+func processUpload(ctx context.Context, id string) {
+	fail := func(err error) {
+		fmt.Println("upload", id, err)
+		updateUploadJob(ctx, id, func(j *UploadJob) {
+			j.Status = UploadFailed
+			j.Error = err.Error()
+		})
+	}
+
+	job, err := loadUploadJob(ctx, id)
+	if err != nil {
+		fail(err)
+		return
+	}
+	file, err := readUploadFile(ctx, job)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	client := strava.DefaultClient
+
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		fail(err)
+		return
+	}
+	params := strava.UploadParams{DataType: job.DataType, Name: job.Name, Description: job.Description, ExternalId: job.ExternalId}
+	upload, err := strava.CreateUpload(client, access_token, job.Filename, bytes.NewReader(file), params)
+	recordAudit(AuditActivityUpload, "upload", id, err, map[string]interface{}{"filename": job.Filename, "size": job.Size, "strava_upload_id": upload.Id})
+	if err != nil {
+		fail(err)
+		return
+	}
+	deleteUploadChunks(ctx, job)
+	updateUploadJob(ctx, id, func(j *UploadJob) {
+		j.Status = UploadProcessing
+		j.StravaUploadId = upload.Id
+		j.StravaStatus = upload.Status
+	})
+
+	for deadline := time.Now().Add(uploadPollTimeout); upload.ActivityId == 0 && upload.Error == ""; {
+		if time.Now().After(deadline) {
+			fail(fmt.Errorf("strava was still processing upload %d after %s", upload.Id, uploadPollTimeout))
+			return
+		}
+		time.Sleep(uploadPollInterval)
+		polled, err := strava.GetUpload(client, access_token, upload.Id)
+		if err != nil {
+			// a failed poll is tried again, the token lasts longer than the poll
+			fmt.Println("upload", id, err)
+			continue
+		}
+		upload = polled
+		updateUploadJob(ctx, id, func(j *UploadJob) { j.StravaStatus = upload.Status })
+	}
+	if upload.Error != "" {
+		fail(errors.New(upload.Error))
+		return
+	}
+
+	// stored now so it is served before the next sync
+	if _, err := fetchAndStoreActivity(ctx, upload.ActivityId); err != nil {
+		fmt.Println(err)
+	}
+	updateUploadJob(ctx, id, func(j *UploadJob) {
+		j.Status = UploadReady
+		j.ActivityId = upload.ActivityId
+	})
+}
+
+// starts an upload: a multipart form with the whole file is sent to strava
+// straight away, a JSON UploadRequest opens a chunked upload for PUT
+func postUpload(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		postUploadFile(c)
+		return
+	}
+
+	var req UploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "body must be a multipart form with a file, or a JSON object with filename and size"})
+		return
+	}
+	job, err := newUploadJob(req)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := saveUploadJob(ctx, job); err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to store upload"})
+		return
+	}
+
+	c.Header("Location", pathPrefix+"/strava/uploads/"+job.Id)
+	c.IndentedJSON(http.StatusCreated, job)
+}
+
+func postUploadFile(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, uploadMaxBytes+1<<20)
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("form must have a file of at most %d bytes", uploadMaxBytes)})
+		return
+	}
+	f, err := header.Open()
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "unable to read file"})
+		return
+	}
+	defer f.Close()
+	file, err := io.ReadAll(f)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "unable to read file"})
+		return
+	}
+
+	job, err := newUploadJob(UploadRequest{
+		Filename:    header.Filename,
+		Size:        int64(len(file)),
+		DataType:    c.PostForm("data_type"),
+		Name:        c.PostForm("name"),
+		Description: c.PostForm("description"),
+		ExternalId:  c.PostForm("external_id"),
+	})
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	uploadsMu.Lock()
+	err = appendUploadChunk(ctx, &job, file)
+	uploadsMu.Unlock()
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to store upload"})
+		return
+	}
+	go processUpload(context.Background(), job.Id)
+
+	c.Header("Location", pathPrefix+"/strava/uploads/"+job.Id)
+	c.IndentedJSON(http.StatusAccepted, job)
+}
+
+// Content-Range: bytes 0-1048575/73400320
+func parseContentRange(header string) (start int64, end int64, total int64, err error) {
+	_, err = fmt.Sscanf(header, "bytes %d-%d/%d", &start, &end, &total)
+	if err == nil && (start < 0 || end < start || total <= end) {
+		err = errors.New("range is out of order")
+	}
+	return start, end, total, err
+}
+
+// stores the next chunk of a chunked upload, sending the file to strava once
+// it is complete. A chunk that does not start where the last one ended is
+// refused with the offset to resume from
+func putUploadChunk(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	start, end, total, err := parseContentRange(c.GetHeader("Content-Range"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Content-Range must be bytes start-end/size"})
+		return
+	}
+	if end-start+1 > uploadChunkMaxBytes {
+		c.IndentedJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("chunks must be at most %d bytes", uploadChunkMaxBytes)})
+		return
+	}
+	chunk, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, uploadChunkMaxBytes))
+	if err != nil || int64(len(chunk)) != end-start+1 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "body must be the bytes in Content-Range"})
+		return
+	}
+
+	uploadsMu.Lock()
+	defer uploadsMu.Unlock()
+
+	job, err := loadUploadJob(ctx, c.Param("id"))
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "upload not found"})
+		return
+	}
+	switch {
+	case job.Status != UploadReceiving:
+		c.IndentedJSON(http.StatusConflict, gin.H{"error": "upload has all its bytes", "status": job.Status})
+		return
+	case total != job.Size:
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("size in Content-Range must be %d", job.Size)})
+		return
+	case start != job.Received:
+		// a retried chunk that was stored, or one after a gap; resume from here
+		c.IndentedJSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("next chunk must start at byte %d", job.Received), "received": job.Received})
+		return
+	}
+
+	if err := appendUploadChunk(ctx, &job, chunk); err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to store chunk"})
+		return
+	}
+	if job.Status == UploadSending {
+		go processUpload(context.Background(), job.Id)
+		c.IndentedJSON(http.StatusAccepted, job)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, job)
+}
+
+// how far an upload has got, poll until ready or failed
+func getUpload(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	job, err := loadUploadJob(ctx, c.Param("id"))
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "upload not found"})
+		return
+	}
+	if job.Status == UploadReceiving || job.Status == UploadSending || job.Status == UploadProcessing {
+		c.Header("Retry-After", strconv.Itoa(int(uploadPollInterval.Seconds())))
+	}
+	c.IndentedJSON(http.StatusOK, job)
+}
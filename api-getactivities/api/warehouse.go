@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/warehouse"
+)
+
+// nil unless BIGQUERY_DATASET is set
+var exporter *warehouse.BigQuery
+
+// BIGQUERY_STREAMS adds every sample of new activities to the samples table,
+// costing one more strava call per activity
+var exportStreams = os.Getenv("BIGQUERY_STREAMS") == "true"
+
+func openExporter() error {
+	dataset := os.Getenv("BIGQUERY_DATASET")
+	if dataset == "" {
+		return nil
+	}
+	bq, err := warehouse.NewBigQuery(dataset, time.Duration(env.Int("BIGQUERY_TIMEOUT_SECONDS", 30))*time.Second)
+	if err != nil {
+		return err
+	}
+	if err := bq.EnsureTables(); err != nil {
+		return err
+	}
+	exporter = bq
+	return nil
+}
+
+// appends the stored state of each changed activity, and a tombstone for deleted ones
+func exportChanges(ctx context.Context, client *http.Client, access_token string, changes []ActivityChange) error {
+	if exporter == nil || len(changes) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	var rows []warehouse.ActivityRow
+	var samples []warehouse.SampleRow
+	for _, change := range changes {
+		if change.Kind == ChangeDeleted {
+			rows = append(rows, warehouse.NewDeletedRow(change.ActivityId, now))
+			continue
+		}
+		activity, ok := loadActivity(ctx, change.ActivityId)
+		if !ok {
+			continue
+		}
+		rows = append(rows, warehouse.NewActivityRow(activity, now))
+
+		if exportStreams && change.Kind == ChangeCreated && !activity.Manual {
+			streams, err := loadStreams(ctx, client, access_token, change.ActivityId)
+			if err != nil {
+				fmt.Println("streams of", change.ActivityId, err)
+				continue
+			}
+			samples = append(samples, warehouse.NewSampleRows(change.ActivityId, streams, now)...)
+		}
+	}
+
+	if err := exporter.InsertActivities(rows); err != nil {
+		return err
+	}
+	return exporter.InsertSamples(samples)
+}
+
+// backfills the warehouse with every stored activity, for the history from before it was configured
+func runBigQueryExport(args []string) error {
+	ctx := context.Background()
+	fs := flag.NewFlagSet("bigquery-export", flag.ExitOnError)
+	bucket := fs.String("bucket", bucketName, "bucket to read stored activities from")
+	streams := fs.Bool("streams", exportStreams, "also export stream samples, fetching them from strava when not stored")
+	fs.Parse(args)
+
+	useBucket(*bucket)
+	if exporter == nil {
+		return fmt.Errorf("BIGQUERY_DATASET is not set or the dataset could not be opened")
+	}
+	exportStreams = *streams
+
+	client := strava.DefaultClient
+	access_token := ""
+	if exportStreams {
+		var err error
+		if access_token, err = getAccessToken(ctx, client); err != nil {
+			return err
+		}
+	}
+
+	var changes []ActivityChange
+	for _, e := range loadActivityIndex(ctx).Entries {
+		changes = append(changes, ActivityChange{Kind: ChangeCreated, ActivityId: e.Id, NewName: e.Name})
+	}
+	err := exportChanges(ctx, client, access_token, changes)
+	fmt.Fprintf(os.Stderr, "exported %d activities to BigQuery\n", len(changes))
+	return err
+}
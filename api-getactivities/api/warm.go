@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+const (
+	WarmAll      = "all"      // the dashboard's calls, the index and the newest stored activities
+	WarmSnapshot = "snapshot" // only what GET /strava needs
+)
+
+// how many of the newest stored activities, and their streams, WarmAll reads
+var warmActivities = env.Int("WARM_ACTIVITIES", 30)
+
+type WarmResult struct {
+	Objects  int           // stored objects read into the cache
+	Strava   int           // strava calls made, opening the kept alive connections
+	Errors   []error       // warming goes on past them, requests then do the work
+	Duration time.Duration // stopped waiting at the timeout, warming may still run
+}
+
+// WarmCache does the slow work of a cold start before the first request: the
+// GCS client's first calls, the TLS handshakes with strava and a token
+// refresh, and reading stored objects into the generation cache. It waits at
+// most timeout; call it after OpenStorage and before serving
+func WarmCache(mode string, timeout time.Duration) (WarmResult, error) {
+	ctx := context.Background()
+	if mode != WarmAll && mode != WarmSnapshot {
+		return WarmResult{}, fmt.Errorf("warm mode must be %s or %s", WarmAll, WarmSnapshot)
+	}
+	start := time.Now()
+
+	done := make(chan WarmResult, 1)
+	go func() { done <- warmCache(ctx, mode) }()
+
+	select {
+	case result := <-done:
+		result.Duration = time.Since(start)
+		return result, nil
+	case <-time.After(timeout):
+		return WarmResult{Duration: timeout}, fmt.Errorf("cache warming did not finish in %s", timeout)
+	}
+}
+
+func warmCache(ctx context.Context, mode string) WarmResult {
+	var result WarmResult
+	read := func(object string) {
+		if _, err := readGCSObject(ctx, object); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("%s: %w", object, err))
+			return
+		}
+		result.Objects++
+	}
+
+	// what GET /strava does, the access token is not kept so only the
+	// credentials and the connections stay warm
+	read(ownerCredentialsObject)
+	client := strava.DefaultClient
+	access_token, err := getAccessToken(ctx, client)
+	result.Strava++
+	if err != nil {
+		result.Errors = append(result.Errors, err)
+		return result
+	}
+	if _, err := fetchAthleteProfile(client, access_token); err != nil {
+		result.Errors = append(result.Errors, err)
+	}
+	if _, err := fetchFinalActivities(client, access_token); err != nil {
+		result.Errors = append(result.Errors, err)
+	}
+	result.Strava += 2
+	if mode == WarmSnapshot {
+		return result
+	}
+
+	read(activityIndexObject)
+	for i, e := range loadActivityIndex(ctx).Entries {
+		if i >= warmActivities {
+			break
+		}
+		read(activityObject(e.Id))
+		// only activities that were charted have streams stored
+		if _, err := readGCSObject(ctx, streamsObject(e.Id)); err == nil {
+			result.Objects++
+		}
+	}
+	return result
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the push subscription event strava posts for activity and athlete changes
+type WebhookEvent struct {
+	ObjectType     string            `json:"object_type"`
+	ObjectId       int64             `json:"object_id"`
+	AspectType     string            `json:"aspect_type"`
+	Updates        map[string]string `json:"updates"`
+	OwnerId        int64             `json:"owner_id"`
+	SubscriptionId int64             `json:"subscription_id"`
+	EventTime      int64             `json:"event_time"`
+}
+
+// strava echoes hub.challenge back when the subscription is created
+func getWebhook(c *gin.Context) {
+	ctx := c.Request.Context()
+	verifyToken := loadSubscription(ctx).VerifyToken
+	if c.Query("hub.mode") != "subscribe" || verifyToken == "" || c.Query("hub.verify_token") != verifyToken {
+		c.IndentedJSON(http.StatusForbidden, gin.H{"error": "verify token does not match"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"hub.challenge": c.Query("hub.challenge")})
+}
+
+// DEAUTH_CLEANUP chooses what happens to cached data when an athlete revokes access on strava
+func webhookCleanupMode() string {
+	switch mode := os.Getenv("DEAUTH_CLEANUP"); mode {
+	case CleanupPurge, CleanupArchive:
+		return mode
+	}
+	return CleanupKeep
+}
+
+// strava expects a 200 within two seconds, so events are acknowledged even when
+// handling fails; failed events are retried in the background
+func postWebhook(c *gin.Context) {
+	ctx := c.Request.Context()
+	var event WebhookEvent
+	if err := c.ShouldBindJSON(&event); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "body must be a strava webhook event"})
+		return
+	}
+
+	// anyone can post here, only events for our own subscription are acted on
+	subscriptionId := loadSubscription(ctx).Id
+	if subscriptionId == 0 || event.SubscriptionId != subscriptionId {
+		fmt.Println("ignoring webhook event for subscription", event.SubscriptionId)
+		c.Status(http.StatusOK)
+		return
+	}
+
+	if stored, duplicate := receiveWebhookEvent(ctx, event); duplicate {
+		fmt.Println("ignoring redelivered webhook event", webhookDedupeKey(event), "first stored as", stored.Id)
+	}
+	c.Status(http.StatusOK)
+}
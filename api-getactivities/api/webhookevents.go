@@ -0,0 +1,398 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+const (
+	webhookEventsPrefix     = "webhook/events/"
+	webhookDeadLetterPrefix = "webhook/dead/"
+	webhookDedupePrefix     = "webhook/dedupe/"
+)
+
+const (
+	WebhookPending   = "pending"
+	WebhookProcessed = "processed"
+	WebhookRetrying  = "retrying"
+	WebhookDead      = "dead"
+)
+
+// a failed event is tried again after WEBHOOK_RETRY_SECONDS, doubling each
+// time, until WEBHOOK_MAX_ATTEMPTS attempts have failed and it is dead lettered
+var (
+	webhookMaxAttempts  = env.Int("WEBHOOK_MAX_ATTEMPTS", 5)
+	webhookRetrySeconds = env.Int("WEBHOOK_RETRY_SECONDS", 5)
+)
+
+// WEBHOOK_RETENTION_DAYS, default 7, is how long handled events are kept
+var webhookRetention = time.Duration(env.Int("WEBHOOK_RETENTION_DAYS", 7)) * 24 * time.Hour
+
+// strava delivers at least once, so an event seen again within
+// WEBHOOK_DEDUPE_HOURS is acknowledged without being stored or processed again
+var webhookDedupeWindow = time.Duration(env.Int("WEBHOOK_DEDUPE_HOURS", 24)) * time.Hour
+
+// StoredWebhookEvent is every event received for our subscription, kept so
+// failed ones can be retried and replayed
+type StoredWebhookEvent struct {
+	Id         string       `json:"id"`
+	ReceivedAt string       `json:"received_at"`
+	Event      WebhookEvent `json:"event"`
+	Status     string       `json:"status"`
+	Attempts   int          `json:"attempts"`
+	LastError  string       `json:"last_error,omitempty"`
+	UpdatedAt  string       `json:"updated_at,omitempty"`
+}
+
+// ids are the receive time, so they sort oldest first
+func webhookEventObject(id string) string {
+	return webhookEventsPrefix + id + ".json"
+}
+
+// whether the event id was received after the event through
+func webhookEventAfter(id string, through string) bool {
+	return len(id) > len(through) || len(id) == len(through) && id > through
+}
+
+func webhookDeadLetterObject(id string) string {
+	return webhookDeadLetterPrefix + id + ".json"
+}
+
+func loadWebhookEvent(ctx context.Context, object string) (StoredWebhookEvent, bool) {
+	var stored StoredWebhookEvent
+
+	slurp := getDataFromGCS(ctx, object)
+	if slurp == nil {
+		return stored, false
+	}
+	if err := json.Unmarshal(slurp, &stored); err != nil {
+		fmt.Println(err)
+		return stored, false
+	}
+	return stored, true
+}
+
+func saveWebhookEvent(ctx context.Context, stored StoredWebhookEvent) error {
+	stored.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	bytes_event, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	if err := putDataToGCS(ctx, webhookEventObject(stored.Id), bytes_event); err != nil {
+		return err
+	}
+	if stored.Status == WebhookDead {
+		return putDataToGCS(ctx, webhookDeadLetterObject(stored.Id), bytes_event)
+	}
+	return nil
+}
+
+// what strava's event asks for: activity events are published, deauthorizations
+// clean up the athlete's data once strava confirms them
+func processWebhookEvent(ctx context.Context, event WebhookEvent) error {
+	if err := publishWebhookEvent(event); err != nil {
+		return err
+	}
+
+	if event.ObjectType == "athlete" && event.Updates["authorized"] == "false" {
+		target := strconv.FormatInt(event.OwnerId, 10)
+		revoked, err := confirmStravaRevoked(ctx, strava.DefaultClient, athleteCredentialsObject(ctx, event.OwnerId))
+		if err != nil {
+			// retried, strava may answer next time
+			recordAudit(AuditAthleteDeauthorize, "strava", target, err, map[string]interface{}{"source": "webhook", "confirmed": false})
+			return fmt.Errorf("confirming deauthorization: %w", err)
+		}
+		if !revoked {
+			fmt.Println("ignoring deauthorization of athlete", event.OwnerId, "strava still accepts their token")
+			recordAudit(AuditAthleteDeauthorize, "strava", target, errors.New("strava still accepts the athlete's token"), map[string]interface{}{"source": "webhook", "confirmed": false, "ignored": true})
+			return nil
+		}
+
+		result := deauthorizeAthlete(ctx, event.OwnerId, false, webhookCleanupMode())
+		var resultErr error
+		if len(result.Errors) > 0 {
+			resultErr = fmt.Errorf("%d cleanup errors", len(result.Errors))
+			fmt.Println(result.Errors)
+		}
+		recordAudit(AuditAthleteDeauthorize, "strava", target, resultErr, map[string]interface{}{"source": "webhook", "confirmed": true})
+		return resultErr
+	}
+	return nil
+}
+
+// one attempt at the stored event, the outcome is stored with it; a failure
+// is dead lettered unless retry and attempts are left
+func attemptWebhookEvent(ctx context.Context, stored *StoredWebhookEvent, retry bool) error {
+	stored.Attempts++
+	err := processWebhookEvent(ctx, stored.Event)
+	switch {
+	case err == nil:
+		stored.Status = WebhookProcessed
+		stored.LastError = ""
+	case retry && stored.Attempts < webhookMaxAttempts:
+		stored.Status = WebhookRetrying
+		stored.LastError = err.Error()
+	default:
+		stored.Status = WebhookDead
+		stored.LastError = err.Error()
+	}
+	if saveErr := saveWebhookEvent(ctx, *stored); saveErr != nil {
+		fmt.Println("saving webhook event:", saveErr)
+	}
+	return err
+}
+
+// an event left pending or retrying for twice the longest wait between
+// attempts belonged to an instance that stopped before finishing it
+func webhookStaleAfter() time.Duration {
+	wait := time.Duration(webhookRetrySeconds) * time.Second
+	for attempt := 1; attempt < webhookMaxAttempts; attempt++ {
+		wait *= 2
+	}
+	return wait
+}
+
+// resumes the events stopped instances left pending or retrying, an attempt
+// each turn until they succeed or are dead lettered, and deletes the handled
+// events received more than WEBHOOK_RETENTION_DAYS ago; with WEBHOOK_HYDRATE
+// those not yet looked at, after hydratedThrough, are kept. renew is asked
+// before each attempt, false once it fails
+func tendWebhookEvents(ctx context.Context, now time.Time, hydratedThrough string, renew func() bool) bool {
+	objects, err := listGCSObjects(ctx, webhookEventsPrefix)
+	if err != nil {
+		fmt.Println(err)
+		return true
+	}
+	staleAfter := webhookStaleAfter()
+	resumed, deleted := 0, 0
+	for _, object := range objects {
+		stored, ok := loadWebhookEvent(ctx, object)
+		if !ok {
+			continue
+		}
+		switch stored.Status {
+		case WebhookPending, WebhookRetrying:
+			updated, err := time.Parse(time.RFC3339, stored.UpdatedAt)
+			if err == nil && now.Sub(updated) < staleAfter {
+				continue
+			}
+			if !renew() {
+				return false
+			}
+			resumed++
+			if err := attemptWebhookEvent(ctx, &stored, true); err != nil {
+				fmt.Printf("webhook event %s attempt %d: %v\n", stored.Id, stored.Attempts, err)
+			}
+		default:
+			received, err := time.Parse(time.RFC3339, stored.ReceivedAt)
+			if err == nil && now.Sub(received) < webhookRetention {
+				continue
+			}
+			if webhookHydrate && webhookEventAfter(stored.Id, hydratedThrough) {
+				continue
+			}
+			// dead events stay in the dead letters
+			if err := deleteDataFromGCS(ctx, object); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			deleted++
+		}
+	}
+	if resumed > 0 || deleted > 0 {
+		fmt.Printf("housekeeping resumed %d webhook events and deleted %d\n", resumed, deleted)
+	}
+	return true
+}
+
+// retries in the background, strava has long had its 200 by then
+func retryWebhookEvent(ctx context.Context, stored StoredWebhookEvent) {
+	delay := time.Duration(webhookRetrySeconds) * time.Second
+	for stored.Status == WebhookRetrying {
+		time.Sleep(delay)
+		delay *= 2
+		if err := attemptWebhookEvent(ctx, &stored, true); err != nil {
+			fmt.Printf("webhook event %s attempt %d: %v\n", stored.Id, stored.Attempts, err)
+		}
+	}
+}
+
+// what makes two deliveries the same event
+func webhookDedupeKey(event WebhookEvent) string {
+	return fmt.Sprintf("%d-%d-%s-%d", event.OwnerId, event.ObjectId, event.AspectType, event.EventTime)
+}
+
+// the first delivery of an event, kept for the dedupe window
+type webhookDedupeMark struct {
+	EventId    string `json:"event_id"`
+	ReceivedAt string `json:"received_at"`
+}
+
+func webhookDedupeObject(event WebhookEvent) string {
+	return webhookDedupePrefix + webhookDedupeKey(event) + ".json"
+}
+
+// the mark in slurp while it is within the window
+func unexpiredWebhookMark(slurp []byte, now time.Time) (webhookDedupeMark, bool) {
+	var seen webhookDedupeMark
+	if json.Unmarshal(slurp, &seen) != nil {
+		return seen, false
+	}
+	at, err := time.Parse(time.RFC3339, seen.ReceivedAt)
+	return seen, err == nil && now.Sub(at) < webhookDedupeWindow
+}
+
+// marks the event seen, and reports whether it already was within the window
+// along with the id it was stored under then. The mark is only written where
+// there is none or it has expired, at the generation read, so of redeliveries
+// arriving at several instances together only one is taken as new
+func markWebhookEvent(ctx context.Context, event WebhookEvent, id string, now time.Time) (string, bool) {
+	object := webhookDedupeObject(event)
+	slurp, generation, err := readGCSObjectGeneration(ctx, object)
+	switch {
+	case errors.Is(err, storage.ErrObjectNotExist):
+		generation = 0
+	case err != nil:
+		// without the mark a redelivery is processed again, which is better than dropping it
+		fmt.Println("marking webhook event:", err)
+		return id, false
+	default:
+		if seen, ok := unexpiredWebhookMark(slurp, now); ok {
+			return seen.EventId, true
+		}
+	}
+
+	bytes_seen, err := json.Marshal(webhookDedupeMark{EventId: id, ReceivedAt: now.Format(time.RFC3339)})
+	if err == nil {
+		_, err = putDataToGCSIf(ctx, object, bytes_seen, generation)
+	}
+	if errors.Is(err, storage.ErrConflict) {
+		// another delivery marked it first
+		var seen webhookDedupeMark
+		if slurp, err := readGCSObject(ctx, object); err == nil && json.Unmarshal(slurp, &seen) == nil {
+			return seen.EventId, true
+		}
+		return "", true
+	}
+	if err != nil {
+		fmt.Println("marking webhook event:", err)
+	}
+	return id, false
+}
+
+// deletes the marks past WEBHOOK_DEDUPE_HOURS, which no longer hold back a
+// redelivery anyway
+func deleteExpiredWebhookMarks(ctx context.Context, now time.Time) {
+	objects, err := listGCSObjects(ctx, webhookDedupePrefix)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, object := range objects {
+		slurp, err := readGCSObject(ctx, object)
+		if err != nil {
+			continue
+		}
+		if _, ok := unexpiredWebhookMark(slurp, now); ok {
+			continue
+		}
+		if err := deleteDataFromGCS(ctx, object); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			fmt.Println(err)
+		}
+	}
+}
+
+// stores the event and makes the first attempt, later ones are left to
+// retryWebhookEvent; a redelivered event is left alone and reported as a
+// duplicate of the stored one
+func receiveWebhookEvent(ctx context.Context, event WebhookEvent) (StoredWebhookEvent, bool) {
+	now := time.Now().UTC()
+	stored := StoredWebhookEvent{
+		Id:         strconv.FormatInt(now.UnixNano(), 10),
+		ReceivedAt: now.Format(time.RFC3339),
+		Event:      event,
+		Status:     WebhookPending,
+	}
+	if id, duplicate := markWebhookEvent(ctx, event, stored.Id, now); duplicate {
+		stored.Id = id
+		return stored, true
+	}
+	if err := saveWebhookEvent(ctx, stored); err != nil {
+		fmt.Println("saving webhook event:", err)
+	}
+
+	if err := attemptWebhookEvent(ctx, &stored, true); err != nil {
+		fmt.Printf("webhook event %s attempt %d: %v\n", stored.Id, stored.Attempts, err)
+	}
+	if stored.Status == WebhookRetrying {
+		go retryWebhookEvent(context.Background(), stored)
+	}
+	return stored, false
+}
+
+// events that failed every attempt, oldest first
+func getAdminWebhookDeadLetters(c *gin.Context) {
+	ctx := c.Request.Context()
+	objects, err := listGCSObjects(ctx, webhookDeadLetterPrefix)
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to list dead letters"})
+		return
+	}
+	sort.Strings(objects)
+
+	events := []StoredWebhookEvent{}
+	for _, object := range objects {
+		if stored, ok := loadWebhookEvent(ctx, object); ok {
+			events = append(events, stored)
+		}
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"data": events})
+}
+
+// processes a stored event again, dead or not, and takes it off the dead
+// letters once it succeeds
+func postAdminWebhookReplay(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "event id must be numeric"})
+		return
+	}
+	stored, ok := loadWebhookEvent(ctx, webhookEventObject(id))
+	if !ok {
+		// past WEBHOOK_RETENTION_DAYS a dead event is only a dead letter
+		stored, ok = loadWebhookEvent(ctx, webhookDeadLetterObject(id))
+	}
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "webhook event not found"})
+		return
+	}
+
+	// a replay is one more attempt, which is never retried on its own
+	wasDead := stored.Status == WebhookDead
+	err := attemptWebhookEvent(ctx, &stored, false)
+	if err == nil && wasDead {
+		if err := deleteDataFromGCS(ctx, webhookDeadLetterObject(id)); err != nil {
+			fmt.Println(err)
+		}
+	}
+	recordAudit(AuditWebhookReplay, adminActor(c), id, err, map[string]interface{}{"object_id": stored.Event.ObjectId, "aspect_type": stored.Event.AspectType})
+	if err != nil {
+		c.IndentedJSON(http.StatusBadGateway, stored)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, stored)
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/bus"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/storage"
+)
+
+// a publisher that is always down, so every attempt at an activity event fails
+type failingPublisher struct{}
+
+func (failingPublisher) Publish([]bus.Message) error {
+	return errors.New("pubsub is down")
+}
+
+func TestWebhookStaleAfter(t *testing.T) {
+	defer func(attempts, seconds int) { webhookMaxAttempts, webhookRetrySeconds = attempts, seconds }(webhookMaxAttempts, webhookRetrySeconds)
+
+	cases := []struct {
+		attempts int
+		seconds  int
+		want     time.Duration
+	}{
+		{5, 5, 80 * time.Second},
+		{1, 5, 5 * time.Second},
+		{0, 5, 5 * time.Second},
+		{3, 10, 40 * time.Second},
+	}
+	for _, tc := range cases {
+		webhookMaxAttempts, webhookRetrySeconds = tc.attempts, tc.seconds
+		if got := webhookStaleAfter(); got != tc.want {
+			t.Errorf("%d attempts %d seconds apart: stale after %s, want %s", tc.attempts, tc.seconds, got, tc.want)
+		}
+	}
+}
+
+func TestTendWebhookEvents(t *testing.T) {
+	defer func(store storage.ObjectStore, p bus.Publisher) { objects, publisher = store, p }(objects, publisher)
+	objects = storage.NewMemory()
+
+	now := time.Now().UTC()
+	old := now.Add(-webhookRetention - time.Hour)
+	stale := now.Add(-webhookStaleAfter() - time.Minute)
+	activity := WebhookEvent{ObjectType: "activity", AspectType: "create", ObjectId: 1, OwnerId: 2}
+
+	cases := []struct {
+		name       string
+		receivedAt time.Time
+		updatedAt  time.Time
+		status     string
+		attempts   int
+		failing    bool
+		want       string // the status stored afterwards, empty once deleted
+	}{
+		{"processed long ago", old, old, WebhookProcessed, 1, false, ""},
+		{"processed recently", now, now, WebhookProcessed, 1, false, WebhookProcessed},
+		{"dead long ago", old, old, WebhookDead, 5, false, ""},
+		{"retrying, left by a stopped instance", stale, stale, WebhookRetrying, 2, false, WebhookProcessed},
+		{"pending, left by a stopped instance", stale, stale, WebhookPending, 0, false, WebhookProcessed},
+		{"retrying in another instance", now, now, WebhookRetrying, 2, false, WebhookRetrying},
+		{"still failing", stale, stale, WebhookRetrying, 2, true, WebhookRetrying},
+		{"out of attempts", stale, stale, WebhookRetrying, webhookMaxAttempts - 1, true, WebhookDead},
+	}
+	for i, tc := range cases {
+		publisher = nil
+		if tc.failing {
+			publisher = failingPublisher{}
+		}
+		id := strconv.Itoa(1000 + i)
+		stored := StoredWebhookEvent{
+			Id:         id,
+			ReceivedAt: tc.receivedAt.Format(time.RFC3339),
+			Event:      activity,
+			Status:     tc.status,
+			Attempts:   tc.attempts,
+			UpdatedAt:  tc.updatedAt.Format(time.RFC3339),
+		}
+		// written as saveWebhookEvent would have at the time
+		data, err := json.Marshal(stored)
+		if err != nil {
+			t.Fatal(err)
+		}
+		written := []string{webhookEventObject(id)}
+		if tc.status == WebhookDead {
+			written = append(written, webhookDeadLetterObject(id))
+		}
+		for _, object := range written {
+			if err := objects.Write(object, data); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if !tendWebhookEvents(context.Background(), now, "", func() bool { return true }) {
+			t.Fatalf("%s: the lease was lost", tc.name)
+		}
+		got, ok := loadWebhookEvent(context.Background(), webhookEventObject(id))
+		if !ok {
+			got.Status = ""
+		}
+		if got.Status != tc.want {
+			t.Errorf("%s: status %q, want %q", tc.name, got.Status, tc.want)
+		}
+		if tc.status == WebhookDead {
+			if _, ok := loadWebhookEvent(context.Background(), webhookDeadLetterObject(id)); !ok {
+				t.Errorf("%s: the dead letter was deleted", tc.name)
+			}
+		}
+		if err := objects.Delete(webhookEventObject(id)); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMarkWebhookEvent(t *testing.T) {
+	defer func(store storage.ObjectStore) { objects = store }(objects)
+	objects = storage.NewMemory()
+
+	event := WebhookEvent{ObjectType: "activity", AspectType: "update", ObjectId: 1, OwnerId: 2, EventTime: 1700000000}
+	now := time.Now().UTC()
+	later := now.Add(webhookDedupeWindow + time.Minute)
+
+	steps := []struct {
+		name      string
+		id        string
+		at        time.Time
+		wantId    string
+		duplicate bool
+	}{
+		{"first delivery", "1", now, "1", false},
+		{"redelivery", "2", now.Add(time.Hour), "1", true},
+		{"after the window", "3", later, "3", false},
+		{"redelivery after the window", "4", later, "3", true},
+	}
+	for _, step := range steps {
+		id, duplicate := markWebhookEvent(context.Background(), event, step.id, step.at)
+		if id != step.wantId || duplicate != step.duplicate {
+			t.Errorf("%s: markWebhookEvent = %q, %v, want %q, %v", step.name, id, duplicate, step.wantId, step.duplicate)
+		}
+	}
+
+	deleteExpiredWebhookMarks(context.Background(), later)
+	if _, err := readGCSObject(context.Background(), webhookDedupeObject(event)); err != nil {
+		t.Errorf("a mark within the window was deleted: %v", err)
+	}
+	deleteExpiredWebhookMarks(context.Background(), later.Add(webhookDedupeWindow))
+	if _, err := readGCSObject(context.Background(), webhookDedupeObject(event)); !errors.Is(err, storage.ErrObjectNotExist) {
+		t.Errorf("an expired mark was kept: %v", err)
+	}
+}
+
+// as if every instance received the same redelivery at once
+func TestMarkWebhookEventConcurrently(t *testing.T) {
+	defer func(store storage.ObjectStore) { objects = store }(objects)
+	objects = storage.NewMemory()
+
+	event := WebhookEvent{ObjectType: "activity", AspectType: "create", ObjectId: 1, OwnerId: 2, EventTime: 1700000000}
+	now := time.Now().UTC()
+	const deliveries = 20
+	var wg sync.WaitGroup
+	firsts := make(chan string, deliveries)
+	for i := 0; i < deliveries; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if _, duplicate := markWebhookEvent(context.Background(), event, id, now); !duplicate {
+				firsts <- id
+			}
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+	close(firsts)
+	if n := len(firsts); n != 1 {
+		t.Errorf("%d of %d deliveries were taken as new, want 1", n, deliveries)
+	}
+}
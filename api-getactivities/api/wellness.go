@@ -0,0 +1,295 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/render"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// daily wellness entries, keyed by date; health data, so every route takes
+// the admin token
+const (
+	wellnessPrefix = "wellness/"
+	wellnessObject = wellnessPrefix + "entries.json"
+)
+
+// the report covers the last 90 days unless ?from= says otherwise, and a year at most
+const (
+	wellnessReportDays    = 90
+	maxWellnessReportDays = 366
+)
+
+// how far before ?from= activities count towards the load, fitness has all
+// but faded after six of its time constants
+const loadWarmupDays = 6 * analysis.FitnessDays
+
+const maxWellnessNotes = 1000
+
+// the entries are read-modify-written so updates from concurrent handlers are serialized
+var wellnessMu sync.Mutex
+
+func loadWellness(ctx context.Context) map[string]analysis.WellnessEntry {
+	entries := make(map[string]analysis.WellnessEntry)
+
+	slurp := getDataFromGCS(ctx, wellnessObject)
+	if slurp == nil {
+		return entries
+	}
+	if err := json.Unmarshal(slurp, &entries); err != nil {
+		fmt.Println(err)
+	}
+	return entries
+}
+
+// change edits the entries in place and reports whether it changed anything,
+// they are only written back when it did
+func updateWellness(ctx context.Context, change func(entries map[string]analysis.WellnessEntry) bool) error {
+	wellnessMu.Lock()
+	defer wellnessMu.Unlock()
+
+	entries := loadWellness(ctx)
+	if !change(entries) {
+		return nil
+	}
+
+	bytes_entries, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return putDataToGCS(ctx, wellnessObject, bytes_entries)
+}
+
+func wellnessDate(c *gin.Context) (string, error) {
+	date := c.Param("date")
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return "", fmt.Errorf("date must be formatted YYYY-MM-DD")
+	}
+	return date, nil
+}
+
+func bindWellness(c *gin.Context) (analysis.WellnessEntry, error) {
+	var entry analysis.WellnessEntry
+	if err := c.ShouldBindJSON(&entry); err != nil {
+		return entry, fmt.Errorf("body must be a JSON wellness entry")
+	}
+	entry.Notes = strings.TrimSpace(entry.Notes)
+	switch {
+	case entry.Sleep < 0 || entry.Sleep > 24:
+		return entry, fmt.Errorf("sleep must be from 0 to 24 hours")
+	case entry.HRV < 0 || entry.RestingHeartrate < 0:
+		return entry, fmt.Errorf("hrv and resting_heartrate must not be negative")
+	case entry.Soreness < 0 || entry.Soreness > 10 || entry.RPE < 0 || entry.RPE > 10:
+		return entry, fmt.Errorf("soreness and rpe must be from 1 to 10, or 0 to leave them out")
+	case len(entry.Notes) > maxWellnessNotes:
+		return entry, fmt.Errorf("notes must be at most %d characters", maxWellnessNotes)
+	}
+	if entry.Notes == "" {
+		empty := true
+		for _, metric := range analysis.WellnessMetrics {
+			_, taken := entry.Metric(metric)
+			empty = empty && !taken
+		}
+		if empty {
+			return entry, fmt.Errorf("an entry must have a reading or notes, DELETE it instead")
+		}
+	}
+	return entry, nil
+}
+
+func getWellness(c *gin.Context) {
+	ctx := c.Request.Context()
+	from, to, err := planRange(c, "", "")
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries := []analysis.WellnessEntry{}
+	for date, entry := range loadWellness(ctx) {
+		if (from == "" || date >= from) && (to == "" || date <= to) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Date < entries[j].Date })
+	c.IndentedJSON(http.StatusOK, gin.H{"from": from, "to": to, "data": entries})
+}
+
+func getWellnessEntry(c *gin.Context) {
+	ctx := c.Request.Context()
+	date, err := wellnessDate(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	entry, ok := loadWellness(ctx)[date]
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "no wellness entry for " + date})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, entry)
+}
+
+// creates or replaces the day's entry
+func putWellnessEntry(c *gin.Context) {
+	ctx := c.Request.Context()
+	date, err := wellnessDate(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	entry, err := bindWellness(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	entry.Date = date
+
+	status := http.StatusOK
+	err = updateWellness(ctx, func(entries map[string]analysis.WellnessEntry) bool {
+		if _, ok := entries[date]; !ok {
+			status = http.StatusCreated
+		}
+		entries[date] = entry
+		return true
+	})
+	recordAudit(AuditWellnessUpdate, adminActor(c), date, err, nil)
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to store wellness entry"})
+		return
+	}
+	c.IndentedJSON(status, entry)
+}
+
+func deleteWellnessEntry(c *gin.Context) {
+	ctx := c.Request.Context()
+	date, err := wellnessDate(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	found := false
+	err = updateWellness(ctx, func(entries map[string]analysis.WellnessEntry) bool {
+		_, found = entries[date]
+		delete(entries, date)
+		return found
+	})
+	if err == nil && !found {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "no wellness entry for " + date})
+		return
+	}
+	recordAudit(AuditWellnessDelete, adminActor(c), date, err, nil)
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to delete wellness entry"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"date": date, "deleted": true})
+}
+
+// estimated TSS of the stored activities on each of the athlete's days from
+// start up to end, both 2006-01-02 and included
+func dailyTrainingStress(ctx context.Context, start string, end string) map[string]float64 {
+	// activities started in other zones may fall on a day either side
+	first, _ := time.Parse("2006-01-02", start)
+	last, _ := time.Parse("2006-01-02", end)
+	first, last = first.AddDate(0, 0, -1), last.AddDate(0, 0, 2)
+
+	var activities []strava.ActivitySummary
+	powered := false
+	for _, e := range loadActivityIndex(ctx).Entries {
+		at, err := time.Parse(time.RFC3339, e.StartDate)
+		if err != nil || at.Before(first) || !at.Before(last) {
+			continue
+		}
+		if activity, ok := loadActivity(ctx, e.Id); ok {
+			activities = append(activities, activity.ActivitySummary)
+			powered = powered || activity.AverageWatts > 0
+		}
+	}
+
+	stress := trainingStress(activities, trainingFtp(ctx, powered))
+	daily := make(map[string]float64)
+	for _, a := range activities {
+		at, err := a.StartTime()
+		if err != nil {
+			continue
+		}
+		if day := at.Format("2006-01-02"); day >= start && day <= end {
+			daily[day] += stress(a)
+		}
+	}
+	return daily
+}
+
+// the training load curve between ?from= and ?to= with the wellness entries
+// on it, and how each reading follows the load; ?render=svg graphs one
+// reading, chosen by ?metric=, against fitness and fatigue
+func getWellnessReport(c *gin.Context) {
+	ctx := c.Request.Context()
+	view := c.DefaultQuery("render", "json")
+	if view != "json" && view != "svg" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "render must be json or svg"})
+		return
+	}
+	metric := c.DefaultQuery("metric", analysis.WellnessRPE)
+	known := false
+	for _, m := range analysis.WellnessMetrics {
+		known = known || m == metric
+	}
+	if !known {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "metric must be one of " + strings.Join(analysis.WellnessMetrics, ", ")})
+		return
+	}
+	_, accent, err := cardStyle(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	loc, err := athleteZone(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now().In(loc)
+	from, to, err := planRange(c, now.AddDate(0, 0, -wellnessReportDays+1).Format("2006-01-02"), now.Format("2006-01-02"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	start, startErr := time.Parse("2006-01-02", from)
+	end, endErr := time.Parse("2006-01-02", to)
+	if startErr != nil || endErr != nil || end.Before(start) || end.Sub(start) >= maxWellnessReportDays*24*time.Hour {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("from must be before to, at most %d days apart", maxWellnessReportDays)})
+		return
+	}
+
+	daily := dailyTrainingStress(ctx, start.AddDate(0, 0, -loadWarmupDays).Format("2006-01-02"), to)
+	load := analysis.TrainingLoad(daily, from, to)
+	days, correlations := analysis.CompareWellness(load, loadWellness(ctx))
+
+	if view == "json" {
+		c.IndentedJSON(http.StatusOK, gin.H{"from": from, "to": to, "data": days, "correlations": correlations, "periods": periodAnnotations(ctx, from, to)})
+		return
+	}
+
+	svg, err := render.WellnessChart{Days: days, Metric: metric, Accent: accent}.SVG()
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to render chart"})
+		return
+	}
+	c.Data(http.StatusOK, svgContentType, svg)
+}
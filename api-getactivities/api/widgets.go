@@ -0,0 +1,98 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/render"
+)
+
+// how long browsers and CDNs may reuse a widget, it only changes after a sync
+var widgetMaxAge = env.Int("WIDGET_MAX_AGE_SECONDS", 300)
+
+// WIDGET_FRAME_ANCESTORS, e.g. https://example.com, limits which sites may frame
+// the widgets; any site may when unset
+var widgetFrameAncestors = os.Getenv("WIDGET_FRAME_ANCESTORS")
+
+// answers with 304 when the browser already has this exact fragment
+func serveWidget(c *gin.Context, status int, page []byte) {
+	sum := sha256.Sum256(page)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	c.Header("Cache-Control", "public, max-age="+strconv.Itoa(widgetMaxAge))
+	c.Header("ETag", etag)
+	if widgetFrameAncestors != "" {
+		c.Header("Content-Security-Policy", "frame-ancestors "+widgetFrameAncestors)
+	}
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", page)
+}
+
+func widgetError(c *gin.Context, status int, message string) {
+	c.Data(status, "text/html; charset=utf-8", []byte("<!DOCTYPE html><p style=\"font-family:Helvetica,Arial,sans-serif;color:#777\">"+html.EscapeString(message)+"</p>"))
+}
+
+func getLatestActivityWidget(c *gin.Context) {
+	ctx := c.Request.Context()
+	units, accent, err := cardStyle(c)
+	if err != nil {
+		widgetError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// the index is newest first
+	for _, e := range loadActivityIndex(ctx).Entries {
+		activity, ok := loadActivity(ctx, e.Id)
+		if !ok {
+			continue
+		}
+		page, err := activityCard(activity, units, accent).HTML()
+		if err != nil {
+			fmt.Println(err)
+			widgetError(c, http.StatusInternalServerError, "Unable to show the latest activity")
+			return
+		}
+		serveWidget(c, http.StatusOK, page)
+		return
+	}
+	widgetError(c, http.StatusNotFound, "No activities yet")
+}
+
+func getWeeklySummaryWidget(c *gin.Context) {
+	ctx := c.Request.Context()
+	units, accent, err := cardStyle(c)
+	if err != nil {
+		widgetError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	start, err := weekParam(c)
+	if err != nil {
+		widgetError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := render.WeeklyCard{
+		Title:  c.DefaultQuery("title", "Weekly training"),
+		Week:   analysis.SummarizeWeek(start, storedWeek(ctx, start)),
+		Units:  units,
+		Accent: accent,
+	}.HTML()
+	if err != nil {
+		fmt.Println(err)
+		widgetError(c, http.StatusInternalServerError, "Unable to show the weekly summary")
+		return
+	}
+	serveWidget(c, http.StatusOK, page)
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/geo"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/render"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// the year in :year, strava was founded in 2009 so nothing is older
+func yearParam(c *gin.Context) (int, error) {
+	year, err := strconv.Atoi(c.Param("year"))
+	if err != nil || year < 2009 || year > time.Now().Year()+1 {
+		return 0, fmt.Errorf("year must be a year like 2023")
+	}
+	return year, nil
+}
+
+// a past year no longer changes, the current one does with every sync
+func cacheYear(c *gin.Context) {
+	if year, err := yearParam(c); err == nil && year < time.Now().Year() {
+		cacheHistorical(c)
+		return
+	}
+	cacheLatest(c)
+}
+
+// stored activities of the year, with a day either side for activities that
+// started in another zone like storedWeek; SummarizeYear leaves those out
+func storedYear(ctx context.Context, year int) []strava.ActivityDetailed {
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, -1)
+	end := time.Date(year+1, time.January, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+	var activities []strava.ActivityDetailed
+	for _, e := range loadActivityIndex(ctx).Entries {
+		at, err := time.Parse(time.RFC3339, e.StartDate)
+		if err != nil || at.Before(from) || !at.Before(end) {
+			continue
+		}
+		if activity, ok := loadActivity(ctx, e.Id); ok {
+			activities = append(activities, activity)
+		}
+	}
+	return activities
+}
+
+// gear names are only listed on the athlete, one strava call; empty when it fails
+func gearNames(ctx context.Context) map[string]string {
+	names := make(map[string]string)
+	client := strava.DefaultClient
+
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		fmt.Println(err)
+		return names
+	}
+	profile, err := fetchAthleteProfile(client, access_token)
+	if err != nil {
+		fmt.Println(err)
+		return names
+	}
+
+	for _, g := range append(profile.Bikes, profile.Shoes...) {
+		names[g.Id] = g.Name
+	}
+	return names
+}
+
+// the strava call is skipped when no activity of the year has gear; ids are
+// kept when it fails
+func nameGear(ctx context.Context, gear []analysis.GearUse) {
+	if len(gear) == 0 {
+		return
+	}
+	names := gearNames(ctx)
+	for i := range gear {
+		gear[i].Name = names[gear[i].Id]
+	}
+}
+
+func getYearReport(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	year, err := yearParam(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	view := c.DefaultQuery("render", "json")
+	if view != "json" && view != "html" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "render must be json or html"})
+		return
+	}
+	units, accent, err := cardStyle(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var summaries []strava.ActivitySummary
+	for _, activity := range storedYear(ctx, year) {
+		summaries = append(summaries, activity.ActivitySummary)
+	}
+	summary := analysis.SummarizeYear(year, summaries)
+	nameGear(ctx, summary.Gear)
+	mapURL := fmt.Sprintf("%s/strava/reports/year/%d/map.png", pathPrefix, year)
+	periods := periodAnnotations(ctx, fmt.Sprintf("%d-01-01", year), fmt.Sprintf("%d-12-31", year))
+
+	if view == "json" {
+		c.IndentedJSON(http.StatusOK, gin.H{"data": summary, "map": mapURL, "periods": periods})
+		return
+	}
+
+	if summary.Count == 0 {
+		mapURL = ""
+	}
+	page, err := render.YearReport{Summary: summary, MapURL: mapURL, Periods: periods, Units: units, Accent: accent}.HTML()
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to render report"})
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+}
+
+// every route of the year on one map; not cached in storage like the activity
+// maps since the current year changes with each sync
+func getYearMap(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	year, err := yearParam(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	opts, err := mapOptions(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var routes [][]geo.Point
+	for _, activity := range storedYear(ctx, year) {
+		if at, err := activity.StartTime(); err != nil || at.Year() != year {
+			continue
+		}
+		points, err := geo.DecodePolyline(activity.Map.SummaryPolyline)
+		if err != nil {
+			fmt.Println(activity.Id, err)
+		}
+		if len(points) > 0 {
+			routes = append(routes, points)
+		}
+	}
+	if len(routes) == 0 {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "no routes in " + strconv.Itoa(year)})
+		return
+	}
+
+	img, _, err := render.RoutesImage(routes, opts)
+	var buf bytes.Buffer
+	if err == nil {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "unable to render map"})
+		return
+	}
+	c.Data(http.StatusOK, "image/png", buf.Bytes())
+}
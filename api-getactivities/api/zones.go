@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// the owner's zones, a registered athlete's would go under their prefix
+const athleteZonesObject = "athlete/zones.json"
+
+// where the zones time in zone was counted against came from
+const (
+	ZonesStrava    = "strava"
+	ZonesThreshold = "threshold" // THRESHOLD_HEARTRATE or ATHLETE_FTP
+)
+
+type ZoneDistribution struct {
+	Source string              `json:"source"`
+	Zones  []analysis.ZoneTime `json:"zones"`
+}
+
+// ActivityZones is the time an activity spent in each heart rate and power
+// zone, either is missing when it was not recorded or no zones are known
+type ActivityZones struct {
+	Id        int64             `json:"id"`
+	Heartrate *ZoneDistribution `json:"heartrate,omitempty"`
+	Power     *ZoneDistribution `json:"power,omitempty"`
+}
+
+func fetchAthleteZones(client *http.Client, access_token string) (strava.Zones, error) {
+	var zones strava.Zones
+	err := strava.GetJSON(client, access_token, "/athlete/zones", nil, &zones)
+	return zones, err
+}
+
+func loadAthleteZones(ctx context.Context) (strava.Zones, bool) {
+	var zones strava.Zones
+
+	slurp := getDataFromGCS(ctx, athleteZonesObject)
+	if slurp == nil {
+		return zones, false
+	}
+	if err := json.Unmarshal(slurp, &zones); err != nil {
+		fmt.Println(err)
+		return zones, false
+	}
+	return zones, true
+}
+
+func saveAthleteZones(ctx context.Context, zones strava.Zones) error {
+	bytes_zones, err := json.Marshal(zones)
+	if err != nil {
+		return err
+	}
+	return putDataToGCS(ctx, athleteZonesObject, bytes_zones)
+}
+
+// the stored zones, fetched and stored the first time when the token may
+// read them; the zero Zones when they are not known
+func analysisZones(ctx context.Context) strava.Zones {
+	if zones, ok := loadAthleteZones(ctx); ok {
+		return zones
+	}
+
+	creds, err := loadCredentials(ctx, ownerCredentialsObject)
+	if err != nil || len(strava.MissingScopes(creds, []string{strava.ScopeProfileReadAll})) > 0 {
+		return strava.Zones{}
+	}
+	client := strava.DefaultClient
+
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		fmt.Println(err)
+		return strava.Zones{}
+	}
+	zones, err := fetchAthleteZones(client, access_token)
+	if err == nil {
+		err = saveAthleteZones(ctx, zones)
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	return zones
+}
+
+// strava's zones when there are some, otherwise ones split from the threshold
+func zoneDistribution(zones []strava.ZoneRange, threshold float64, power bool, times []int, values []int) *ZoneDistribution {
+	source := ZonesStrava
+	if len(zones) == 0 {
+		source = ZonesThreshold
+		zones = analysis.ThresholdZones(threshold, power)
+	}
+	if len(zones) == 0 {
+		return nil
+	}
+	return &ZoneDistribution{Source: source, Zones: analysis.TimeInZones(zones, times, values)}
+}
+
+func activityZones(id int64, set strava.StreamSet, zones strava.Zones) ActivityZones {
+	result := ActivityZones{Id: id}
+	if set.Time == nil {
+		return result
+	}
+
+	if set.Heartrate != nil {
+		var ranges []strava.ZoneRange
+		if zones.HeartRate != nil {
+			ranges = zones.HeartRate.Zones
+		}
+		result.Heartrate = zoneDistribution(ranges, float64(thresholdHeartrate), false, set.Time.Data, set.Heartrate.Data)
+	}
+	if set.Watts != nil {
+		var ranges []strava.ZoneRange
+		if zones.Power != nil {
+			ranges = zones.Power.Zones
+		}
+		result.Power = zoneDistribution(ranges, float64(athleteFtp), true, set.Time.Data, set.Watts.Data)
+	}
+	return result
+}
+
+// proxies strava's zones, storing them for the time in zone analysis
+func getStravaAthleteZones(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	client := stravaClient(c)
+
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		respondUpstreamError(c, "unable to refresh strava token", err)
+		return
+	}
+
+	zones, err := fetchAthleteZones(client, access_token)
+	if err != nil {
+		respondUpstreamError(c, "unable to fetch athlete zones from strava", err)
+		return
+	}
+	if err := saveAthleteZones(ctx, zones); err != nil {
+		fmt.Println(err)
+	}
+
+	c.IndentedJSON(http.StatusOK, zones)
+}
+
+func getActivityZones(c *gin.Context) {
+	setCorsHeaders(c)
+	ctx := c.Request.Context()
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "activity id must be numeric"})
+		return
+	}
+
+	client := stravaClient(c)
+
+	access_token, err := getAccessToken(ctx, client)
+	if err != nil {
+		respondUpstreamError(c, "unable to refresh strava token", err)
+		return
+	}
+
+	set, err := loadStreams(ctx, client, access_token, id)
+	if err != nil {
+		respondUpstreamError(c, "unable to fetch streams from strava", err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, activityZones(id, set, analysisZones(ctx)))
+}
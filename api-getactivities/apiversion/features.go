@@ -0,0 +1,86 @@
+// Package apiversion tracks what this deployment expects of the Strava API,
+// so fields and endpoints Strava has deprecated can be switched off, and
+// newer ones switched on, without a code change or touching stored data.
+package apiversion
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Version is the Strava API version the strava package speaks
+const Version = "v3"
+
+const (
+	// athlete follower_count and friend_count, which strava no longer keeps current
+	FollowerCounts = "follower_counts"
+	// segment effort history and leaderboards, strava only serves other
+	// athletes' efforts to subscribers
+	SegmentLeaderboards = "segment_leaderboards"
+	// perceived_exertion on detailed activities, stored from when it is enabled
+	PerceivedExertion = "perceived_exertion"
+)
+
+type Feature struct {
+	Name       string `json:"name"`
+	Deprecated bool   `json:"deprecated"` // on by default so existing clients keep working
+	Enabled    bool   `json:"enabled"`
+}
+
+// deprecated features are on and newer ones off until STRAVA_FEATURES says otherwise
+var defaults = map[string]Feature{
+	FollowerCounts:      {Name: FollowerCounts, Deprecated: true, Enabled: true},
+	SegmentLeaderboards: {Name: SegmentLeaderboards, Deprecated: true, Enabled: true},
+	PerceivedExertion:   {Name: PerceivedExertion},
+}
+
+var enabled = mustParse(os.Getenv("STRAVA_FEATURES"))
+
+// Parse reads a comma separated list of features to switch on, each prefixed
+// with - to switch it off instead, such as perceived_exertion,-follower_counts
+func Parse(spec string) (map[string]bool, error) {
+	features := make(map[string]bool)
+	for name, f := range defaults {
+		features[name] = f.Enabled
+	}
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		on := !strings.HasPrefix(s, "-")
+		name := strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+		if _, ok := defaults[name]; !ok {
+			return nil, fmt.Errorf("unknown strava feature %q", name)
+		}
+		features[name] = on
+	}
+	return features, nil
+}
+
+// an unknown feature is a typo in the deployment's settings, the defaults are safer than guessing
+func mustParse(spec string) map[string]bool {
+	features, err := Parse(spec)
+	if err != nil {
+		fmt.Println("STRAVA_FEATURES:", err)
+		features, _ = Parse("")
+	}
+	return features
+}
+
+func Enabled(name string) bool {
+	return enabled[name]
+}
+
+// Features lists every feature with whether it is enabled, by name
+func Features() []Feature {
+	features := []Feature{}
+	for name, f := range defaults {
+		f.Enabled = enabled[name]
+		features = append(features, f)
+	}
+	sort.Slice(features, func(i, j int) bool { return features[i].Name < features[j].Name })
+	return features
+}
@@ -0,0 +1,14 @@
+// Package bus publishes change events to a message bus, Google Pub/Sub normally
+// and the process log in dev mode, and receives what other instances publish.
+package bus
+
+// Message is one event, Attributes let subscribers filter without decoding Data
+type Message struct {
+	Data       []byte
+	Attributes map[string]string
+}
+
+// Publisher sends messages in order; a failed call may have delivered some of them
+type Publisher interface {
+	Publish(messages []Message) error
+}
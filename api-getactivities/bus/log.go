@@ -0,0 +1,14 @@
+package bus
+
+import "fmt"
+
+// Log is a Publisher that prints each message, used by dev mode so the events
+// a sync would publish can be seen without a Pub/Sub topic
+type Log struct{}
+
+func (Log) Publish(messages []Message) error {
+	for _, m := range messages {
+		fmt.Printf("publish %v %s\n", m.Attributes, m.Data)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package bus
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"time"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/pubsub/v1"
+)
+
+// Pub/Sub accepts at most 1000 messages in one publish call
+const maxBatch = 1000
+
+// PubSub is a Publisher onto one topic, named projects/<project>/topics/<topic>
+type PubSub struct {
+	service *pubsub.Service
+	topic   string
+	timeout time.Duration
+}
+
+// PUBSUB_EMULATOR_HOST points the publisher at the local emulator without credentials
+func NewPubSub(topic string, timeout time.Duration) (*PubSub, error) {
+	var opts []option.ClientOption
+	if host := os.Getenv("PUBSUB_EMULATOR_HOST"); host != "" {
+		opts = append(opts, option.WithEndpoint("http://"+host+"/"), option.WithoutAuthentication())
+	}
+	service, err := pubsub.NewService(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &PubSub{service: service, topic: topic, timeout: timeout}, nil
+}
+
+func (p *PubSub) Publish(messages []Message) error {
+	for start := 0; start < len(messages); start += maxBatch {
+		end := start + maxBatch
+		if end > len(messages) {
+			end = len(messages)
+		}
+
+		var batch []*pubsub.PubsubMessage
+		for _, m := range messages[start:end] {
+			batch = append(batch, &pubsub.PubsubMessage{Data: base64.StdEncoding.EncodeToString(m.Data), Attributes: m.Attributes})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+		_, err := p.service.Projects.Topics.Publish(p.topic, &pubsub.PublishRequest{Messages: batch}).Context(ctx).Do()
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package bus
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/api/pubsub/v1"
+)
+
+// an instance that stops without deleting its subscription leaves it to expire
+const subscriptionExpiry = "86400s"
+
+// Subscription receives every message published to a topic from when it was
+// created, each instance creating its own so all of them get every message
+type Subscription struct {
+	service *pubsub.Service
+	name    string
+	timeout time.Duration
+}
+
+// NewSubscription creates subscription id on topic, named
+// projects/<project>/topics/<topic>; PUBSUB_EMULATOR_HOST is used as by NewPubSub
+func NewSubscription(topic string, id string, timeout time.Duration) (*Subscription, error) {
+	project, _, ok := strings.Cut(strings.TrimPrefix(topic, "projects/"), "/topics/")
+	if !ok || !strings.HasPrefix(topic, "projects/") {
+		return nil, errors.New("topic must be projects/<project>/topics/<topic>")
+	}
+
+	var opts []option.ClientOption
+	if host := os.Getenv("PUBSUB_EMULATOR_HOST"); host != "" {
+		opts = append(opts, option.WithEndpoint("http://"+host+"/"), option.WithoutAuthentication())
+	}
+	service, err := pubsub.NewService(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Subscription{service: service, name: "projects/" + project + "/subscriptions/" + id, timeout: timeout}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_, err = service.Projects.Subscriptions.Create(s.name, &pubsub.Subscription{
+		Topic:              topic,
+		AckDeadlineSeconds: 10,
+		ExpirationPolicy:   &pubsub.ExpirationPolicy{Ttl: subscriptionExpiry},
+	}).Context(ctx).Do()
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict {
+		// created by an earlier run with the same id
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Pull waits up to wait for messages and acknowledges the ones returned, so
+// each is received once; no messages and no error when none arrived
+func (s *Subscription) Pull(max int, wait time.Duration) ([]Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+	res, err := s.service.Projects.Subscriptions.Pull(s.name, &pubsub.PullRequest{MaxMessages: int64(max)}).Context(ctx).Do()
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []Message
+	var ackIds []string
+	for _, received := range res.ReceivedMessages {
+		ackIds = append(ackIds, received.AckId)
+		data, err := base64.StdEncoding.DecodeString(received.Message.Data)
+		if err != nil {
+			continue
+		}
+		messages = append(messages, Message{Data: data, Attributes: received.Message.Attributes})
+	}
+	if len(ackIds) == 0 {
+		return messages, nil
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	_, err = s.service.Projects.Subscriptions.Acknowledge(s.name, &pubsub.AcknowledgeRequest{AckIds: ackIds}).Context(ctx).Do()
+	return messages, err
+}
+
+// Delete removes the subscription once the instance no longer needs it
+func (s *Subscription) Delete() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	_, err := s.service.Projects.Subscriptions.Delete(s.name).Context(ctx).Do()
+	return err
+}
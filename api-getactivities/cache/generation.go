@@ -0,0 +1,158 @@
+// Package cache holds object contents in memory for as long as the stored copy is unchanged.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type cachedObject struct {
+	name           string
+	generation     int64
+	metageneration int64
+	data           []byte
+	cachedAt       time.Time
+}
+
+// Stats are the cache's size and counters since it was created
+type Stats struct {
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
+	MaxBytes  int64  `json:"max_bytes"` // 0 when unbounded
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`    // not cached, or cached at another generation
+	Evictions uint64 `json:"evictions"` // dropped to make room, not ones that changed or were deleted
+	Trusted   uint64 `json:"trusted"`   // hits served by GetFresh, without asking GCS
+}
+
+// object contents keyed by name, only served while the stored generation and
+// metageneration still match what GCS reports for the object. A bounded cache
+// drops the least recently used objects once their contents pass maxBytes
+type GenerationCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	objects  map[string]*list.Element
+	recent   *list.List // of cachedObject, most recently used first
+	stats    Stats
+}
+
+func New() *GenerationCache {
+	return NewLimited(0)
+}
+
+// NewLimited is a cache holding at most maxBytes of contents, unbounded when 0;
+// an object larger than that is never cached
+func NewLimited(maxBytes int64) *GenerationCache {
+	return &GenerationCache{maxBytes: maxBytes, objects: make(map[string]*list.Element), recent: list.New()}
+}
+
+func (g *GenerationCache) Get(object string, generation int64, metageneration int64) ([]byte, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	el, ok := g.objects[object]
+	if !ok {
+		g.stats.Misses++
+		return nil, false
+	}
+	cached := el.Value.(cachedObject)
+	if cached.generation != generation || cached.metageneration != metageneration {
+		g.stats.Misses++
+		return nil, false
+	}
+	g.stats.Hits++
+	// confirmed current, so GetFresh may serve it again
+	cached.cachedAt = time.Now()
+	el.Value = cached
+	g.recent.MoveToFront(el)
+	return cached.data, true
+}
+
+// GetFresh serves an object cached less than maxAge ago without knowing the
+// stored generation, returning the generation it was cached at; only for
+// callers told when the object changes, who Evict it then. Misses are not
+// counted, the caller goes on to Get
+func (g *GenerationCache) GetFresh(object string, maxAge time.Duration) ([]byte, int64, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	el, ok := g.objects[object]
+	if !ok {
+		return nil, 0, false
+	}
+	cached := el.Value.(cachedObject)
+	if time.Since(cached.cachedAt) >= maxAge {
+		return nil, 0, false
+	}
+	g.stats.Hits++
+	g.stats.Trusted++
+	g.recent.MoveToFront(el)
+	return cached.data, cached.generation, true
+}
+
+func (g *GenerationCache) Put(object string, generation int64, metageneration int64, data []byte) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.put(cachedObject{name: object, generation: generation, metageneration: metageneration, data: data, cachedAt: time.Now()})
+}
+
+// replaces the entry only if the object is already cached, so write-only objects don't fill memory
+func (g *GenerationCache) Refresh(object string, generation int64, metageneration int64, data []byte) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.objects[object]; ok {
+		g.put(cachedObject{name: object, generation: generation, metageneration: metageneration, data: data, cachedAt: time.Now()})
+	}
+}
+
+// Keeps reports whether contents of size bytes would be cached, so a reader
+// can stream what the cache would drop instead of holding it whole
+func (g *GenerationCache) Keeps(size int) bool {
+	return g.maxBytes == 0 || int64(size) <= g.maxBytes
+}
+
+func (g *GenerationCache) Evict(object string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if el, ok := g.objects[object]; ok {
+		g.remove(el)
+	}
+}
+
+func (g *GenerationCache) Stats() Stats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	stats := g.stats
+	stats.Entries = len(g.objects)
+	stats.Bytes = g.bytes
+	stats.MaxBytes = g.maxBytes
+	return stats
+}
+
+// g.mu is held
+func (g *GenerationCache) put(cached cachedObject) {
+	if el, ok := g.objects[cached.name]; ok {
+		g.remove(el)
+	}
+	size := int64(len(cached.data))
+	if g.maxBytes > 0 && size > g.maxBytes {
+		return
+	}
+
+	for g.maxBytes > 0 && g.bytes+size > g.maxBytes {
+		g.remove(g.recent.Back())
+		g.stats.Evictions++
+	}
+	g.objects[cached.name] = g.recent.PushFront(cached)
+	g.bytes += size
+}
+
+// g.mu is held
+func (g *GenerationCache) remove(el *list.Element) {
+	cached := g.recent.Remove(el).(cachedObject)
+	delete(g.objects, cached.name)
+	g.bytes -= int64(len(cached.data))
+}
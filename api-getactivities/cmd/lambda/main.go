@@ -0,0 +1,17 @@
+// lambda is the AWS Lambda entry point, build it as bootstrap for the
+// provided.al2 runtime and put API Gateway in front of it
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/serverless"
+)
+
+func main() {
+	if err := serverless.StartLambda(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+)
+
+// listen settings, flags fall back to the environment so App Engine, Cloud Run
+// and containers can configure the server without a custom command
+var (
+	addr           = flag.String("addr", env.String("ADDR", ":"+env.String("PORT", "8080")), "listen address, host:port")
+	tlsCert        = flag.String("tls-cert", env.String("TLS_CERT_FILE", ""), "certificate file, serves HTTPS with -tls-key")
+	tlsKey         = flag.String("tls-key", env.String("TLS_KEY_FILE", ""), "private key file for -tls-cert")
+	autocertHosts  = flag.String("autocert", env.String("AUTOCERT_DOMAINS", ""), "comma separated domains to get Let's Encrypt certificates for")
+	autocertCache  = flag.String("autocert-cache", env.String("AUTOCERT_CACHE_DIR", "autocert"), "directory keeping -autocert certificates")
+	readTimeout    = flag.Int("read-timeout", env.Int("READ_TIMEOUT_SECONDS", 30), "seconds allowed to read a request")
+	writeTimeout   = flag.Int("write-timeout", env.Int("WRITE_TIMEOUT_SECONDS", 120), "seconds allowed to write a response, covers slow strava calls")
+	maxHeaderBytes = flag.Int("max-header-bytes", env.Int("MAX_HEADER_BYTES", http.DefaultMaxHeaderBytes), "largest request header accepted")
+	debugAddr      = flag.String("debug-addr", env.String("DEBUG_ADDR", ""), "also serve the profiles and metrics, admin token required, on this address, such as localhost:6060")
+	cleartextH2    = flag.Bool("h2c", env.String("H2C", "") == "true", "accept HTTP/2 without TLS, for proxies such as Cloud Run that speak it")
+)
+
+func tlsEnabled() bool {
+	return *tlsCert != "" || *autocertHosts != ""
+}
+
+func newServer(handler http.Handler) *http.Server {
+	if *cleartextH2 && !tlsEnabled() {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+	return &http.Server{
+		Addr:           *addr,
+		Handler:        handler,
+		ReadTimeout:    time.Duration(*readTimeout) * time.Second,
+		WriteTimeout:   time.Duration(*writeTimeout) * time.Second,
+		MaxHeaderBytes: *maxHeaderBytes,
+	}
+}
+
+// serves plain HTTP, HTTPS from files or HTTPS with autocert; HTTP/2 is
+// negotiated by net/http whenever TLS is on
+func serve(server *http.Server) error {
+	switch {
+	case *autocertHosts != "":
+		if *tlsCert != "" {
+			return errors.New("-autocert and -tls-cert are exclusive")
+		}
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(strings.Split(*autocertHosts, ",")...),
+			Cache:      autocert.DirCache(*autocertCache),
+		}
+		server.TLSConfig = &tls.Config{GetCertificate: manager.GetCertificate, NextProtos: []string{"h2", "http/1.1", "acme-tls/1"}}
+		return server.ListenAndServeTLS("", "")
+	case *tlsCert != "":
+		if *tlsKey == "" {
+			return errors.New("-tls-cert needs -tls-key")
+		}
+		return server.ListenAndServeTLS(*tlsCert, *tlsKey)
+	default:
+		return server.ListenAndServe()
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/api"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+)
+
+func main() {
+	dev := flag.Bool("dev", false, "serve bundled fixture data from memory instead of strava and GCS")
+	fakeStrava := flag.Bool("fake-strava", false, "serve bundled fixture data instead of strava but keep GCS storage")
+	profile := flag.String("profile", "", "storage profile to use, such as production, staging or test")
+	warm := flag.String("warm", env.String("WARM_CACHE", ""), "warm the caches before serving: all, snapshot, or empty to skip")
+	warmTimeout := flag.Int("warm-timeout", env.Int("WARM_TIMEOUT_SECONDS", 10), "seconds to wait for -warm before serving anyway")
+	flag.Parse()
+
+	if (*dev || *fakeStrava) && tlsEnabled() {
+		fmt.Fprintln(os.Stderr, "the fixture strava is only served over plain http, drop the TLS flags")
+		os.Exit(2)
+	}
+
+	cfg := api.Config{Addr: *addr, Dev: *dev, FakeStrava: *fakeStrava, Profile: *profile}
+
+	closeStorage, err := api.OpenStorage(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer closeStorage()
+
+	if args := flag.Args(); len(args) > 0 {
+		command, ok := api.Commands[args[0]]
+		if !ok {
+			fmt.Fprintln(os.Stderr, "unknown command", args[0])
+			os.Exit(2)
+		}
+		if *dev {
+			fmt.Fprintln(os.Stderr, "commands do not run in dev mode")
+			os.Exit(2)
+		}
+		if err := command(args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// dev storage is memory and its strava is served by this process, nothing to warm
+	if *warm != "" && !*dev {
+		result, err := api.WarmCache(*warm, time.Duration(*warmTimeout)*time.Second)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		for _, e := range result.Errors {
+			fmt.Fprintln(os.Stderr, "warming:", e)
+		}
+		fmt.Printf("warmed %d objects and %d strava calls in %s\n", result.Objects, result.Strava, result.Duration.Round(time.Millisecond))
+	}
+
+	// every instance runs it, only the one holding the lease syncs
+	stopWorker := api.StartSyncWorker()
+	defer stopWorker()
+
+	gin.SetMode(gin.ReleaseMode)
+	if *debugAddr != "" {
+		go func() {
+			// no write timeout, a CPU profile records for as long as it is asked
+			debug := &http.Server{Addr: *debugAddr, Handler: api.DebugHandler(), ReadTimeout: time.Duration(*readTimeout) * time.Second}
+			if err := debug.ListenAndServe(); err != nil {
+				fmt.Fprintln(os.Stderr, "debug server:", err)
+			}
+		}()
+	}
+	if err := serve(newServer(api.NewRouter(cfg))); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,141 @@
+// Package display formats distances, paces, durations and dates for a locale,
+// so lightweight frontends can show activities without their own unit handling.
+package display
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+const (
+	metersPerMile = 1609.344
+	feetPerMeter  = 3.28084
+)
+
+// regions that measure distance in miles
+var imperialRegions = map[string]bool{"US": true, "GB": true, "LR": true, "MM": true}
+
+// numeric date layouts by region, ISO 8601 elsewhere
+var dateLayouts = map[string]string{
+	"US": "1/2/2006",
+	"GB": "02/01/2006", "IE": "02/01/2006", "AU": "02/01/2006", "NZ": "02/01/2006", "IN": "02/01/2006",
+	"FR": "02/01/2006", "ES": "02/01/2006", "IT": "02/01/2006", "PT": "02/01/2006", "BR": "02/01/2006", "MX": "02/01/2006",
+	"DE": "02.01.2006", "AT": "02.01.2006", "CH": "02.01.2006", "NO": "02.01.2006", "FI": "02.01.2006", "DK": "02.01.2006",
+	"PL": "02.01.2006", "CZ": "02.01.2006", "RU": "02.01.2006", "UA": "02.01.2006", "TR": "02.01.2006",
+	"NL": "02-01-2006", "BE": "02/01/2006",
+	"JP": "2006/01/02", "CN": "2006/01/02", "TW": "2006/01/02", "KR": "2006. 01. 02.",
+}
+
+// regions with a 12 hour clock, 24 hours elsewhere
+var twelveHourRegions = map[string]bool{"US": true, "CA": true, "AU": true, "NZ": true, "IN": true, "PH": true}
+
+// Formatter formats for one locale; the zero value is not usable, see New
+type Formatter struct {
+	Tag    language.Tag
+	Metric bool // kilometers and meters, otherwise miles and feet
+
+	region  string
+	printer *message.Printer
+}
+
+// New is a formatter for a BCP 47 locale such as en-US, de or pt-BR; its units
+// follow the locale's region until Metric is set otherwise
+func New(locale string) (Formatter, error) {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return Formatter{}, fmt.Errorf("locale %q is not a language tag like en-US", locale)
+	}
+	// a bare language gets its most likely region, de is read as de-DE
+	region, _ := tag.Region()
+
+	return Formatter{
+		Tag:     tag,
+		Metric:  !imperialRegions[region.String()],
+		region:  region.String(),
+		printer: message.NewPrinter(tag),
+	}, nil
+}
+
+// Distance is e.g. 10.5 km, or 10,5 km in locales with a decimal comma
+func (f Formatter) Distance(meters float64) string {
+	if f.Metric {
+		return f.printer.Sprintf("%.1f km", meters/1000)
+	}
+	return f.printer.Sprintf("%.1f mi", meters/metersPerMile)
+}
+
+func (f Formatter) Elevation(meters float64) string {
+	if f.Metric {
+		return f.printer.Sprintf("%.0f m", meters)
+	}
+	return f.printer.Sprintf("%.0f ft", meters*feetPerMeter)
+}
+
+// Pace is time per kilometer or mile, e.g. 4:35/km; empty without distance
+func (f Formatter) Pace(meters float64, seconds int) string {
+	unit, unitMeters := "/km", 1000.0
+	if !f.Metric {
+		unit, unitMeters = "/mi", metersPerMile
+	}
+	if meters <= 0 {
+		return ""
+	}
+	perUnit := int(float64(seconds)/(meters/unitMeters) + 0.5)
+	return fmt.Sprintf("%d:%02d%s", perUnit/60, perUnit%60, unit)
+}
+
+// Speed is e.g. 28.4 km/h, the figure rides are usually shown with
+func (f Formatter) Speed(meters float64, seconds int) string {
+	if seconds <= 0 {
+		return ""
+	}
+	hours := float64(seconds) / 3600
+	if f.Metric {
+		return f.printer.Sprintf("%.1f km/h", meters/1000/hours)
+	}
+	return f.printer.Sprintf("%.1f mph", meters/metersPerMile/hours)
+}
+
+// Clock is h:mm:ss, or m:ss under an hour
+func (f Formatter) Clock(seconds int) string {
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// Duration is humanized to its two largest parts, e.g. 1h 5m or 42m 10s
+func (f Formatter) Duration(seconds int) string {
+	h, m, s := seconds/3600, seconds%3600/60, seconds%60
+	switch {
+	case h > 0 && m > 0:
+		return fmt.Sprintf("%dh %dm", h, m)
+	case h > 0:
+		return fmt.Sprintf("%dh", h)
+	case m > 0 && s > 0:
+		return fmt.Sprintf("%dm %ds", m, s)
+	case m > 0:
+		return fmt.Sprintf("%dm", m)
+	}
+	return fmt.Sprintf("%ds", s)
+}
+
+// Date is the numeric date as written in the locale's region, in t's zone
+func (f Formatter) Date(t time.Time) string {
+	layout, ok := dateLayouts[f.region]
+	if !ok {
+		layout = "2006-01-02"
+	}
+	return t.Format(layout)
+}
+
+// Time is the time of day on the locale's 12 or 24 hour clock, in t's zone
+func (f Formatter) Time(t time.Time) string {
+	if twelveHourRegions[f.region] {
+		return t.Format("3:04 PM")
+	}
+	return t.Format("15:04")
+}
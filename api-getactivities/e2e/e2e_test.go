@@ -0,0 +1,481 @@
+//go:build e2e
+
+// Package e2e drives a running server started with --fake-strava against a
+// fake GCS emulator and checks the main routes end to end, see
+// docker-compose.yml. The tests run in order: those after TestSync read what
+// it stored. Against a server started by hand:
+//
+//	go test -tags e2e -count=1 ./e2e -api http://localhost:8080 -gcs http://localhost:4443 -bucket e2e -admin-token <ADMIN_TOKEN>
+//
+// Without -gcs the checks that read the bucket directly are skipped, so a
+// -dev server can be checked too.
+package e2e
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	api        = flag.String("api", "http://localhost:8080", "server started with --fake-strava")
+	gcs        = flag.String("gcs", "", "fake GCS emulator the server stores into, the bucket checks are skipped without it")
+	bucket     = flag.String("bucket", "e2e", "bucket the server was configured with")
+	adminToken = flag.String("admin-token", "", "ADMIN_TOKEN of the server, for syncing, hydrating and the admin routes")
+	wait       = flag.Duration("wait", 60*time.Second, "how long to wait for the server to start")
+)
+
+const fixtureAthleteId = 1000001
+
+const fixtureActivityCount = 6
+
+const maxRateLimitedAttempts = 10
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+var nextLink = regexp.MustCompile(`<([^>]+)>; rel="next"`)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if err := waitForServer(*api, *wait); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	if *adminToken != "" {
+		printDecodeReport()
+	}
+	os.Exit(code)
+}
+
+func waitForServer(api string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		res, err := client.Get(api + "/")
+		if err == nil {
+			res.Body.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("server at %s did not come up: %w", api, err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// the response to method path with the admin token when admin is set,
+// waiting out the server's rate limit as a client would
+func request(t *testing.T, method string, path string, admin bool, body io.Reader, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+	if admin && *adminToken == "" {
+		t.Skip("needs -admin-token")
+	}
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = io.ReadAll(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, *api+path, bytes.NewReader(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if admin {
+			req.Header.Set("Authorization", "Bearer "+*adminToken)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusTooManyRequests || attempt == maxRateLimitedAttempts {
+			return res, data
+		}
+		retryAfter, err := strconv.Atoi(res.Header.Get("Retry-After"))
+		if err != nil || retryAfter < 1 {
+			retryAfter = 1
+		}
+		time.Sleep(time.Duration(retryAfter) * time.Second)
+	}
+}
+
+// fails unless method path answers 200 with JSON, decoded into out
+func requestJSON(t *testing.T, method string, path string, admin bool, out interface{}) *http.Response {
+	t.Helper()
+	res, data := request(t, method, path, admin, nil, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("%s %s: %d %s", method, path, res.StatusCode, data)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return res
+}
+
+// object names under prefix, read straight from the emulator rather than through the server
+func listObjects(t *testing.T, prefix string) []string {
+	t.Helper()
+	if *gcs == "" {
+		t.Skip("needs -gcs")
+	}
+	var listing struct {
+		Items []struct {
+			Name string `json:"name"`
+		} `json:"items"`
+	}
+	u := fmt.Sprintf("%s/storage/v1/b/%s/o?prefix=%s", *gcs, *bucket, url.QueryEscape(prefix))
+	res, err := client.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %d", u, res.StatusCode)
+	}
+	if err := json.NewDecoder(res.Body).Decode(&listing); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, item := range listing.Items {
+		names = append(names, item.Name)
+	}
+	return names
+}
+
+func TestComposite(t *testing.T) {
+	var payload struct {
+		Athlete struct {
+			Id int64 `json:"id"`
+		} `json:"athlete"`
+		Data     []json.RawMessage `json:"data"`
+		Warnings []string          `json:"warnings"`
+	}
+	requestJSON(t, http.MethodGet, "/strava", false, &payload)
+	if payload.Athlete.Id != fixtureAthleteId {
+		t.Errorf("athlete id %d, want %d", payload.Athlete.Id, fixtureAthleteId)
+	}
+	if len(payload.Data) != fixtureActivityCount {
+		t.Errorf("%d activities, want %d", len(payload.Data), fixtureActivityCount)
+	}
+	if len(payload.Warnings) > 0 {
+		t.Errorf("unexpected warnings %v", payload.Warnings)
+	}
+}
+
+func TestErrorPaths(t *testing.T) {
+	cases := []struct {
+		method string
+		path   string
+		admin  bool
+		body   string
+		status int
+	}{
+		{http.MethodGet, "/strava/activities/abc", false, "", http.StatusBadRequest},
+		{http.MethodGet, "/strava/activities/999999", false, "", http.StatusNotFound},
+		{http.MethodGet, "/strava/activities/index?limit=abc", false, "", http.StatusBadRequest},
+		{http.MethodGet, "/strava/activities/index?cursor=zz", false, "", http.StatusBadRequest},
+		{http.MethodGet, "/strava/activities/changes?since=!!", false, "", http.StatusBadRequest},
+		{http.MethodGet, "/strava/changelog?since=yesterday", false, "", http.StatusBadRequest},
+		{http.MethodGet, "/strava/activities?format=xml", false, "", http.StatusBadRequest},
+		{http.MethodPost, "/strava/sync", false, "", http.StatusUnauthorized},
+		{http.MethodPost, "/strava/hydrate", false, "", http.StatusUnauthorized},
+		{http.MethodGet, "/strava/export.parquet", false, "", http.StatusUnauthorized},
+		{http.MethodGet, "/admin/audit", false, "", http.StatusUnauthorized},
+		{http.MethodGet, "/strava/exports/deadbeef", true, "", http.StatusNotFound},
+		{http.MethodPost, "/admin/import", true, "not a tarball", http.StatusBadRequest},
+		{http.MethodGet, "/no-such-route", false, "", http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			res, data := request(t, tc.method, tc.path, tc.admin, strings.NewReader(tc.body), nil)
+			if res.StatusCode != tc.status {
+				t.Errorf("%d %s, want %d", res.StatusCode, data, tc.status)
+			}
+		})
+	}
+}
+
+func TestTokenRefreshesAreAudited(t *testing.T) {
+	// TestComposite refreshed the token, the first refresh is always written
+	var audit struct {
+		Data []struct {
+			Success bool                   `json:"success"`
+			Details map[string]interface{} `json:"details"`
+		} `json:"data"`
+	}
+	requestJSON(t, http.MethodGet, "/admin/audit?action=token.refresh", true, &audit)
+	if len(audit.Data) == 0 {
+		t.Fatal("no token.refresh audit records")
+	}
+	if refreshes, _ := audit.Data[0].Details["refreshes"].(float64); !audit.Data[0].Success || refreshes < 1 {
+		t.Errorf("token.refresh audit record %+v", audit.Data[0])
+	}
+}
+
+func TestSync(t *testing.T) {
+	var result struct {
+		Listed int `json:"listed"`
+	}
+	requestJSON(t, http.MethodPost, "/strava/sync", true, &result)
+	if result.Listed != fixtureActivityCount {
+		t.Errorf("sync listed %d, want %d", result.Listed, fixtureActivityCount)
+	}
+
+	var changelog struct {
+		Data []json.RawMessage `json:"data"`
+	}
+	requestJSON(t, http.MethodGet, "/strava/changelog", false, &changelog)
+	if len(changelog.Data) == 0 {
+		t.Error("changelog is empty after sync")
+	}
+
+	// one object per activity plus the index
+	if *gcs != "" {
+		if names := listObjects(t, "ACTIVITIES/"); len(names) != fixtureActivityCount+1 {
+			t.Errorf("%d stored activity objects, want %d", len(names), fixtureActivityCount+1)
+		}
+	}
+}
+
+func TestActivityIndexPagination(t *testing.T) {
+	seen := map[int64]bool{}
+	lastStart := ""
+	next := "/strava/activities/index?limit=2"
+	for pages := 0; next != ""; pages++ {
+		if pages > fixtureActivityCount {
+			t.Fatal("pagination did not terminate")
+		}
+		var page struct {
+			Entries []struct {
+				Id        int64  `json:"id"`
+				StartDate string `json:"start_date"`
+			} `json:"entries"`
+		}
+		res := requestJSON(t, http.MethodGet, next, false, &page)
+		for _, e := range page.Entries {
+			if seen[e.Id] {
+				t.Errorf("activity %d returned twice", e.Id)
+			}
+			if lastStart != "" && e.StartDate > lastStart {
+				t.Errorf("activity %d is out of order", e.Id)
+			}
+			seen[e.Id] = true
+			lastStart = e.StartDate
+		}
+
+		next = ""
+		if m := nextLink.FindStringSubmatch(res.Header.Get("Link")); m != nil {
+			next = strings.TrimPrefix(m[1], *api)
+		}
+	}
+	if len(seen) != fixtureActivityCount {
+		t.Errorf("paged through %d activities, want %d", len(seen), fixtureActivityCount)
+	}
+}
+
+func TestActivityChanges(t *testing.T) {
+	var full struct {
+		Data   []json.RawMessage `json:"data"`
+		Full   bool              `json:"full"`
+		Cursor string            `json:"cursor"`
+	}
+	requestJSON(t, http.MethodGet, "/strava/activities/changes", false, &full)
+	if !full.Full || len(full.Data) != fixtureActivityCount {
+		t.Errorf("without since: full %v with %d activities, want every one of %d", full.Full, len(full.Data), fixtureActivityCount)
+	}
+
+	var since struct {
+		Data []json.RawMessage `json:"data"`
+		Full bool              `json:"full"`
+	}
+	requestJSON(t, http.MethodGet, "/strava/activities/changes?since="+url.QueryEscape(full.Cursor), false, &since)
+	if since.Full || len(since.Data) != 0 {
+		t.Errorf("since the latest cursor: full %v with %d changes, want none", since.Full, len(since.Data))
+	}
+}
+
+func TestHydratedDetail(t *testing.T) {
+	var hydrated struct {
+		Hydrated []int64 `json:"hydrated"`
+	}
+	requestJSON(t, http.MethodPost, "/strava/hydrate", true, &hydrated)
+	if len(hydrated.Hydrated) == 0 {
+		t.Fatal("nothing was hydrated")
+	}
+
+	path := fmt.Sprintf("/strava/activities/%d", hydrated.Hydrated[0])
+	var first, second map[string]interface{}
+	requestJSON(t, http.MethodGet, path, false, &first)
+	requestJSON(t, http.MethodGet, path, false, &second)
+	if first["description"] == nil || first["description"] == "" {
+		t.Errorf("activity %d has no detail fields", hydrated.Hydrated[0])
+	}
+	a, _ := json.Marshal(first)
+	b, _ := json.Marshal(second)
+	if string(a) != string(b) {
+		t.Errorf("cached read of activity %d differs from the first read", hydrated.Hydrated[0])
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	for _, format := range []string{"", "?format=simple"} {
+		res, data := request(t, http.MethodGet, "/strava/activities.ndjson"+format, false, nil, nil)
+		if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get("Content-Type"), "application/x-ndjson") {
+			t.Fatalf("ndjson%s: %d %s", format, res.StatusCode, res.Header.Get("Content-Type"))
+		}
+		lines := 0
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var activity struct {
+				Id int64 `json:"id"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &activity); err != nil || activity.Id == 0 {
+				t.Errorf("ndjson%s line %d: %q, %v", format, lines+1, scanner.Text(), err)
+			}
+			lines++
+		}
+		if lines != fixtureActivityCount {
+			t.Errorf("ndjson%s: %d lines, want %d", format, lines, fixtureActivityCount)
+		}
+	}
+}
+
+func TestSimpleFormat(t *testing.T) {
+	var envelope struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	requestJSON(t, http.MethodGet, "/strava/activities?format=simple", false, &envelope)
+	if len(envelope.Data) == 0 {
+		t.Fatal("no activities in the simple envelope")
+	}
+	if _, ok := envelope.Data[0]["sportType"]; !ok {
+		t.Errorf("keys are not camelCase: %v", envelope.Data[0])
+	}
+
+	res, data := request(t, http.MethodGet, "/strava/activities/abc?format=simple", false, nil, nil)
+	var failed struct {
+		Error struct {
+			Status int `json:"status"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &failed); err != nil || res.StatusCode != http.StatusBadRequest || failed.Error.Status != http.StatusBadRequest {
+		t.Errorf("simple error: %d %s", res.StatusCode, data)
+	}
+}
+
+func TestParquetExport(t *testing.T) {
+	res, data := request(t, http.MethodGet, "/strava/export.parquet", true, nil, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("%d %s", res.StatusCode, data)
+	}
+	if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+		t.Error("export is not a parquet file")
+	}
+
+	token := res.Header.Get("X-Download-Token")
+	if token == "" {
+		t.Fatal("no download token")
+	}
+	res, rest := request(t, http.MethodGet, "/strava/exports/"+token, true, nil, http.Header{"Range": {"bytes=4-"}})
+	if res.StatusCode != http.StatusPartialContent || !bytes.Equal(rest, data[4:]) {
+		t.Errorf("resumed download: %d with %d bytes, want 206 with %d", res.StatusCode, len(rest), len(data)-4)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	res, snapshot := request(t, http.MethodGet, "/admin/export", true, nil, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("%d %s", res.StatusCode, snapshot)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(snapshot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(header.Name, "credentials") {
+			t.Errorf("snapshot carries %s", header.Name)
+		}
+		names = append(names, header.Name)
+	}
+	if len(names) < fixtureActivityCount {
+		t.Errorf("snapshot of %d objects, want at least the %d activities", len(names), fixtureActivityCount)
+	}
+
+	// everything is still stored, so nothing is written over
+	res, data := request(t, http.MethodPost, "/admin/import", true, bytes.NewReader(snapshot), nil)
+	var result struct {
+		Written []string `json:"written"`
+		Skipped []string `json:"skipped"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("import: %d %s", res.StatusCode, data)
+	}
+	if len(result.Written) != 0 || len(result.Skipped) != len(names) {
+		t.Errorf("import wrote %d and skipped %d, want 0 and %d", len(result.Written), len(result.Skipped), len(names))
+	}
+}
+
+// prints the fields the server saw but does not model, informational only
+func printDecodeReport() {
+	req, err := http.NewRequest(http.MethodGet, *api+"/admin/decode-report", nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+*adminToken)
+	res, err := client.Do(req)
+	if err != nil {
+		fmt.Println("decode report unavailable:", err)
+		return
+	}
+	defer res.Body.Close()
+
+	var report struct {
+		Enabled       bool `json:"enabled"`
+		UnknownFields []struct {
+			Field string `json:"field"`
+			Count int    `json:"count"`
+		} `json:"unknown_fields"`
+	}
+	if res.StatusCode != http.StatusOK || json.NewDecoder(res.Body).Decode(&report) != nil || !report.Enabled {
+		fmt.Println("decode report unavailable, is STRAVA_STRICT_DECODE set?")
+		return
+	}
+	for _, f := range report.UnknownFields {
+		fmt.Printf("unmodelled field %s seen %d times\n", f.Field, f.Count)
+	}
+}
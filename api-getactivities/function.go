@@ -0,0 +1,13 @@
+// Package getactivities is the Google Cloud Functions entry point, deploy it with
+// --entry-point StravaAPI; the long running server is cmd/server.
+package getactivities
+
+import (
+	"net/http"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/serverless"
+)
+
+func StravaAPI(w http.ResponseWriter, r *http.Request) {
+	serverless.HTTPFunction(w, r)
+}
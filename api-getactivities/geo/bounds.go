@@ -0,0 +1,36 @@
+package geo
+
+type Bounds struct {
+	MinLat float64 `json:"min_lat"`
+	MinLng float64 `json:"min_lng"`
+	MaxLat float64 `json:"max_lat"`
+	MaxLng float64 `json:"max_lng"`
+}
+
+// BoundsOf is the smallest box holding every point, ok is false without points
+func BoundsOf(points []Point) (b Bounds, ok bool) {
+	if len(points) == 0 {
+		return b, false
+	}
+	b = Bounds{MinLat: points[0].Lat, MinLng: points[0].Lng, MaxLat: points[0].Lat, MaxLng: points[0].Lng}
+	for _, p := range points[1:] {
+		if p.Lat < b.MinLat {
+			b.MinLat = p.Lat
+		}
+		if p.Lat > b.MaxLat {
+			b.MaxLat = p.Lat
+		}
+		if p.Lng < b.MinLng {
+			b.MinLng = p.Lng
+		}
+		if p.Lng > b.MaxLng {
+			b.MaxLng = p.Lng
+		}
+	}
+	return b, true
+}
+
+// Intersects is whether the boxes share a point, touching edges included
+func (b Bounds) Intersects(o Bounds) bool {
+	return b.MinLat <= o.MaxLat && o.MinLat <= b.MaxLat && b.MinLng <= o.MaxLng && o.MinLng <= b.MaxLng
+}
@@ -0,0 +1,190 @@
+package geo
+
+import "math"
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Geohash is the cell of the given number of characters holding p, at 5 about
+// 4.9 by 4.9 kilometers on the equator
+func Geohash(p Point, precision int) string {
+	minLat, maxLat := -90.0, 90.0
+	minLng, maxLng := -180.0, 180.0
+	hash := make([]byte, 0, precision)
+	even := true
+	bits, ch := 0, 0
+	for len(hash) < precision {
+		if even {
+			mid := (minLng + maxLng) / 2
+			if p.Lng >= mid {
+				ch = ch<<1 | 1
+				minLng = mid
+			} else {
+				ch <<= 1
+				maxLng = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if p.Lat >= mid {
+				ch = ch<<1 | 1
+				minLat = mid
+			} else {
+				ch <<= 1
+				maxLat = mid
+			}
+		}
+		even = !even
+		if bits++; bits == 5 {
+			hash = append(hash, geohashAlphabet[ch])
+			bits, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
+
+// the height and width of a cell in degrees, longitude taking the odd bit
+func geohashCellSize(precision int) (lat, lng float64) {
+	lngBits := (5*precision + 1) / 2
+	latBits := 5 * precision / 2
+	return 180 / math.Exp2(float64(latBits)), 360 / math.Exp2(float64(lngBits))
+}
+
+// GeohashCells are the cells a route passes through. Points of a summary
+// polyline can be far apart, so the line between them is followed in steps
+// smaller than a cell, the short way across the antimeridian
+func GeohashCells(route []Point, precision int) []string {
+	latSize, lngSize := geohashCellSize(precision)
+	step := math.Min(latSize, lngSize) / 2
+
+	seen := make(map[string]bool)
+	cells := []string{}
+	add := func(p Point) {
+		if hash := Geohash(p, precision); !seen[hash] {
+			seen[hash] = true
+			cells = append(cells, hash)
+		}
+	}
+	for i, p := range route {
+		if i > 0 {
+			prev := route[i-1]
+			dLng := p.Lng - prev.Lng
+			if dLng > 180 {
+				dLng -= 360
+			} else if dLng < -180 {
+				dLng += 360
+			}
+			n := int(math.Max(math.Abs(p.Lat-prev.Lat), math.Abs(dLng)) / step)
+			for s := 1; s <= n; s++ {
+				f := float64(s) / float64(n+1)
+				add(Point{Lat: prev.Lat + (p.Lat-prev.Lat)*f, Lng: wrapLng(prev.Lng + dLng*f)})
+			}
+		}
+		add(p)
+	}
+	return cells
+}
+
+// into -180 to 180 from at most one turn either way
+func wrapLng(lng float64) float64 {
+	if lng > 180 {
+		return lng - 360
+	}
+	if lng < -180 {
+		return lng + 360
+	}
+	return lng
+}
+
+// GeohashCovering are the cells overlapping the box around center that holds
+// every point within radius meters of it. A box past the antimeridian goes on
+// from the other side
+func GeohashCovering(center Point, radius float64, precision int) []string {
+	dLat := radius / earthRadiusMeters * 180 / math.Pi
+	dLng := 180.0
+	if cos := math.Cos(center.Lat * math.Pi / 180); cos > 1e-9 {
+		dLng = math.Min(180, dLat/cos)
+	}
+	box := Bounds{
+		MinLat: math.Max(-90, center.Lat-dLat),
+		MinLng: center.Lng - dLng,
+		MaxLat: math.Min(90, center.Lat+dLat),
+		MaxLng: center.Lng + dLng,
+	}
+	boxes := []Bounds{box}
+	switch {
+	case dLng >= 180:
+		boxes[0].MinLng, boxes[0].MaxLng = -180, 180
+	case box.MinLng < -180:
+		boxes[0].MinLng = -180
+		boxes = append(boxes, Bounds{MinLat: box.MinLat, MinLng: box.MinLng + 360, MaxLat: box.MaxLat, MaxLng: 180})
+	case box.MaxLng > 180:
+		boxes[0].MaxLng = 180
+		boxes = append(boxes, Bounds{MinLat: box.MinLat, MinLng: -180, MaxLat: box.MaxLat, MaxLng: box.MaxLng - 360})
+	}
+
+	seen := make(map[string]bool)
+	cells := []string{}
+	for _, b := range boxes {
+		for _, hash := range GeohashBoxCells(b, precision) {
+			if !seen[hash] {
+				seen[hash] = true
+				cells = append(cells, hash)
+			}
+		}
+	}
+	return cells
+}
+
+// GeohashBoxCells are the cells overlapping the box
+func GeohashBoxCells(b Bounds, precision int) []string {
+	latSize, lngSize := geohashCellSize(precision)
+	seen := make(map[string]bool)
+	cells := []string{}
+	// from the middle of the first cell on, so every cell is hashed once
+	for lat := (math.Floor(b.MinLat/latSize) + 0.5) * latSize; lat < b.MaxLat+latSize/2; lat += latSize {
+		for lng := (math.Floor(b.MinLng/lngSize) + 0.5) * lngSize; lng < b.MaxLng+lngSize/2; lng += lngSize {
+			hash := Geohash(Point{Lat: math.Min(lat, 90), Lng: math.Min(lng, 180)}, precision)
+			if !seen[hash] {
+				seen[hash] = true
+				cells = append(cells, hash)
+			}
+		}
+	}
+	return cells
+}
+
+// GeohashBoxCellCount is how many cells GeohashBoxCells would return, to
+// tell a box too large to look up cell by cell before listing them. A box
+// reaching the pole or the antimeridian ends in the last row or column
+func GeohashBoxCellCount(b Bounds, precision int) int {
+	latSize, lngSize := geohashCellSize(precision)
+	rows := math.Min(math.Floor(b.MaxLat/latSize), 90/latSize-1) - math.Floor(b.MinLat/latSize) + 1
+	cols := math.Min(math.Floor(b.MaxLng/lngSize), 180/lngSize-1) - math.Floor(b.MinLng/lngSize) + 1
+	return int(rows * cols)
+}
+
+// DistanceToRoute is how close in meters the route comes to p, following the
+// lines between its points; it is -1 without points
+func DistanceToRoute(p Point, route []Point) float64 {
+	if len(route) == 0 {
+		return -1
+	}
+	// meters on a plane tangent at p, close enough for lines between route points
+	metersPerLat := earthRadiusMeters * math.Pi / 180
+	metersPerLng := metersPerLat * math.Cos(p.Lat*math.Pi/180)
+	project := func(q Point) (float64, float64) {
+		return wrapLng(q.Lng-p.Lng) * metersPerLng, (q.Lat - p.Lat) * metersPerLat
+	}
+
+	closest := Distance(p, route[0])
+	for i := 1; i < len(route); i++ {
+		ax, ay := project(route[i-1])
+		bx, by := project(route[i])
+		dx, dy := bx-ax, by-ay
+		t := 0.0
+		if length := dx*dx + dy*dy; length > 0 {
+			t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/length))
+		}
+		closest = math.Min(closest, math.Hypot(ax+t*dx, ay+t*dy))
+	}
+	return closest
+}
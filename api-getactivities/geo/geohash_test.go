@@ -0,0 +1,175 @@
+package geo_test
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/geo"
+)
+
+func TestGeohash(t *testing.T) {
+	cases := []struct {
+		p         geo.Point
+		precision int
+		want      string
+	}{
+		{geo.Point{Lat: 57.64911, Lng: 10.40744}, 11, "u4pruydqqvj"},
+		{geo.Point{Lat: 57.64911, Lng: 10.40744}, 5, "u4pru"},
+		{geo.Point{Lat: 0, Lng: 0}, 1, "s"},
+		{geo.Point{Lat: -90, Lng: -180}, 3, "000"},
+		{geo.Point{Lat: 90, Lng: 180}, 3, "zzz"},
+		{geo.Point{Lat: 90, Lng: -180}, 1, "b"},
+		{geo.Point{Lat: -90, Lng: 180}, 1, "p"},
+		{geo.Point{Lat: 0, Lng: 179.99}, 1, "x"},
+		{geo.Point{Lat: 0, Lng: -179.99}, 1, "8"},
+	}
+	for _, tc := range cases {
+		if got := geo.Geohash(tc.p, tc.precision); got != tc.want {
+			t.Errorf("Geohash(%v, %d) = %s, want %s", tc.p, tc.precision, got, tc.want)
+		}
+	}
+}
+
+func TestGeohashCells(t *testing.T) {
+	if cells := geo.GeohashCells(nil, 5); len(cells) != 0 {
+		t.Errorf("cells of no route: %v", cells)
+	}
+	p := geo.Point{Lat: 57.64911, Lng: 10.40744}
+	if cells := geo.GeohashCells([]geo.Point{p, p}, 5); !reflect.DeepEqual(cells, []string{"u4pru"}) {
+		t.Errorf("cells of a point: %v", cells)
+	}
+
+	// two points far apart along the equator, every cell between them is passed
+	route := []geo.Point{{Lat: 0.01, Lng: 0.01}, {Lat: 0.01, Lng: 1}}
+	box, _ := geo.BoundsOf(route)
+	cells := geo.GeohashCells(route, 5)
+	if len(cells) != 23 || !sameCells(cells, geo.GeohashBoxCells(box, 5)) {
+		t.Errorf("%d cells along the equator, want the 23 of its box", len(cells))
+	}
+
+	// across the antimeridian the short way, not around the world
+	route = []geo.Point{{Lat: 0.01, Lng: 179.9}, {Lat: 0.01, Lng: -179.9}}
+	east := geo.GeohashBoxCells(geo.Bounds{MinLat: 0.01, MinLng: 179.9, MaxLat: 0.01, MaxLng: 180}, 5)
+	west := geo.GeohashBoxCells(geo.Bounds{MinLat: 0.01, MinLng: -180, MaxLat: 0.01, MaxLng: -179.9}, 5)
+	if cells := geo.GeohashCells(route, 5); !sameCells(cells, append(east, west...)) {
+		t.Errorf("cells across the antimeridian %v, want %v and %v", cells, east, west)
+	}
+}
+
+func TestGeohashBoxCells(t *testing.T) {
+	cases := []struct {
+		name      string
+		box       geo.Bounds
+		precision int
+		want      int
+	}{
+		{"the world", geo.Bounds{MinLat: -90, MinLng: -180, MaxLat: 90, MaxLng: 180}, 1, 32},
+		{"a point", geo.Bounds{MinLat: 10, MinLng: 10, MaxLat: 10, MaxLng: 10}, 5, 1},
+		{"across the equator and the prime meridian", geo.Bounds{MinLat: -1, MinLng: -1, MaxLat: 1, MaxLng: 1}, 3, 4},
+		{"at the north pole", geo.Bounds{MinLat: 89, MinLng: -180, MaxLat: 90, MaxLng: 180}, 2, 32},
+		{"at the south pole", geo.Bounds{MinLat: -90, MinLng: -180, MaxLat: -89, MaxLng: 180}, 2, 32},
+		{"east of the antimeridian", geo.Bounds{MinLat: 0, MinLng: 170, MaxLat: 10, MaxLng: 180}, 2, 2},
+		{"west of the antimeridian", geo.Bounds{MinLat: 0, MinLng: -180, MaxLat: 10, MaxLng: -170}, 2, 2},
+	}
+	for _, tc := range cases {
+		cells := geo.GeohashBoxCells(tc.box, tc.precision)
+		if len(cells) != tc.want || !distinct(cells) {
+			t.Errorf("%s: %d cells, want %d distinct", tc.name, len(cells), tc.want)
+		}
+		if count := geo.GeohashBoxCellCount(tc.box, tc.precision); count != tc.want {
+			t.Errorf("%s: counted %d cells, want %d", tc.name, count, tc.want)
+		}
+		for _, corner := range []geo.Point{{Lat: tc.box.MinLat, Lng: tc.box.MinLng}, {Lat: tc.box.MaxLat, Lng: tc.box.MaxLng}} {
+			if hash := geo.Geohash(corner, tc.precision); !contains(cells, hash) {
+				t.Errorf("%s: the cell %s of corner %v is missing", tc.name, hash, corner)
+			}
+		}
+	}
+}
+
+func TestGeohashCovering(t *testing.T) {
+	cases := []struct {
+		name   string
+		center geo.Point
+		within []geo.Point // points less than 1 km away
+	}{
+		{"across the antimeridian", geo.Point{Lat: 0, Lng: 179.999}, []geo.Point{{Lat: 0, Lng: -179.999}, {Lat: 0.005, Lng: 179.995}}},
+		{"at the north pole", geo.Point{Lat: 90, Lng: 0}, []geo.Point{{Lat: 89.995, Lng: -179}, {Lat: 89.995, Lng: 179}}},
+		{"at the south pole", geo.Point{Lat: -90, Lng: 0}, []geo.Point{{Lat: -89.995, Lng: 90}}},
+	}
+	for _, tc := range cases {
+		cells := geo.GeohashCovering(tc.center, 1000, 5)
+		if !distinct(cells) {
+			t.Errorf("%s: a cell is listed twice", tc.name)
+		}
+		for _, p := range tc.within {
+			if hash := geo.Geohash(p, 5); !contains(cells, hash) {
+				t.Errorf("%s: %v is within 1 km but its cell %s is not covered", tc.name, p, hash)
+			}
+		}
+	}
+}
+
+func TestDistanceToRoute(t *testing.T) {
+	p := geo.Point{Lat: 0.01, Lng: 0.01}
+	cases := []struct {
+		name  string
+		route []geo.Point
+		want  float64
+	}{
+		{"no points", nil, -1},
+		{"one point", []geo.Point{{Lat: 0, Lng: 0}}, geo.Distance(p, geo.Point{Lat: 0, Lng: 0})},
+		{"the same point twice", []geo.Point{{Lat: 0, Lng: 0}, {Lat: 0, Lng: 0}}, geo.Distance(p, geo.Point{Lat: 0, Lng: 0})},
+		{"through the point", []geo.Point{{Lat: 0, Lng: 0}, {Lat: 0.02, Lng: 0.02}}, 0},
+		{"at a vertex", []geo.Point{{Lat: 0, Lng: 0}, p, {Lat: 0, Lng: 0.02}}, 0},
+		{"beside the middle of a line", []geo.Point{{Lat: 0, Lng: 0}, {Lat: 0, Lng: 0.02}}, geo.Distance(p, geo.Point{Lat: 0, Lng: 0.01})},
+		{"past the end of a line", []geo.Point{{Lat: 0, Lng: 0.03}, {Lat: 0, Lng: 0.05}}, geo.Distance(p, geo.Point{Lat: 0, Lng: 0.03})},
+		{"on the second line", []geo.Point{{Lat: 1, Lng: 1}, {Lat: 0.01, Lng: 0}, {Lat: 0.01, Lng: 0.02}}, 0},
+	}
+	for _, tc := range cases {
+		got := geo.DistanceToRoute(p, tc.route)
+		if math.Abs(got-tc.want) > 0.01+tc.want*0.001 {
+			t.Errorf("%s: %.2f meters, want %.2f", tc.name, got, tc.want)
+		}
+	}
+
+	// the short way across the antimeridian
+	east := geo.Point{Lat: 0, Lng: 179.999}
+	route := []geo.Point{{Lat: 0.001, Lng: 179.99}, {Lat: 0.001, Lng: -179.99}}
+	if got, want := geo.DistanceToRoute(east, route), geo.Distance(east, geo.Point{Lat: 0.001, Lng: 179.999}); math.Abs(got-want) > 0.5 {
+		t.Errorf("across the antimeridian: %.2f meters, want %.2f", got, want)
+	}
+}
+
+func contains(cells []string, hash string) bool {
+	for _, cell := range cells {
+		if cell == hash {
+			return true
+		}
+	}
+	return false
+}
+
+func distinct(cells []string) bool {
+	seen := make(map[string]bool)
+	for _, cell := range cells {
+		if seen[cell] {
+			return false
+		}
+		seen[cell] = true
+	}
+	return true
+}
+
+// whether a and b hold the same cells, each once
+func sameCells(a, b []string) bool {
+	if !distinct(a) || !distinct(b) {
+		return false
+	}
+	sa, sb := append([]string{}, a...), append([]string{}, b...)
+	sort.Strings(sa)
+	sort.Strings(sb)
+	return reflect.DeepEqual(sa, sb)
+}
@@ -0,0 +1,15 @@
+package geo_test
+
+import (
+	"testing"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/benchdata"
+)
+
+var route = benchdata.EncodePolyline(benchdata.Route(benchdata.RoutePoints))
+
+func TestMain(m *testing.M) {
+	benchdata.Main(m, benchdata.Benchmarks{
+		"BenchmarkDecodePolyline": BenchmarkDecodePolyline,
+	})
+}
@@ -0,0 +1,197 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Place is an ISO 3166-1 alpha-2 country and, when the boundaries are of
+// first level subdivisions, the ISO 3166-2 region in it
+type Place struct {
+	Country string `json:"country"`
+	Region  string `json:"region,omitempty"`
+}
+
+type boundary struct {
+	Place
+	box      Bounds
+	polygons [][][]Point // each polygon's outer ring, then its holes
+}
+
+// Boundaries locate points offline, from GeoJSON country or region polygons
+// such as Natural Earth's admin 0 countries or admin 1 states and provinces
+type Boundaries struct {
+	boundaries []boundary
+	names      map[string]string // country and region codes to their names
+}
+
+// the property names Natural Earth uses, in the order they are tried; -99 is
+// its code for none
+var (
+	countryCodeProperties = []string{"ISO_A2_EH", "iso_a2", "ISO_A2"}
+	countryNameProperties = []string{"admin", "ADMIN", "NAME", "name"}
+	regionCodeProperties  = []string{"iso_3166_2", "ISO_3166_2"}
+	regionNameProperties  = []string{"name", "NAME"}
+)
+
+func property(properties map[string]interface{}, names []string) string {
+	for _, name := range names {
+		if value, ok := properties[name].(string); ok {
+			value = strings.TrimSpace(value)
+			if value != "" && value != "-99" {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// ParseBoundaries reads a GeoJSON FeatureCollection of Polygon and
+// MultiPolygon features; features without a country code are left out
+func ParseBoundaries(data []byte) (*Boundaries, error) {
+	var collection struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Properties map[string]interface{} `json:"properties"`
+			Geometry   *struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, err
+	}
+	if collection.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("boundaries must be a GeoJSON FeatureCollection, not %q", collection.Type)
+	}
+
+	b := &Boundaries{names: make(map[string]string)}
+	for i, f := range collection.Features {
+		country := strings.ToUpper(property(f.Properties, countryCodeProperties))
+		if len(country) != 2 || f.Geometry == nil {
+			continue
+		}
+		region := strings.ToUpper(property(f.Properties, regionCodeProperties))
+		if region != "" && !strings.HasPrefix(region, country+"-") {
+			region = ""
+		}
+
+		var polygons [][][][2]float64
+		switch f.Geometry.Type {
+		case "Polygon":
+			var polygon [][][2]float64
+			if err := json.Unmarshal(f.Geometry.Coordinates, &polygon); err != nil {
+				return nil, fmt.Errorf("feature %d: %w", i, err)
+			}
+			polygons = [][][][2]float64{polygon}
+		case "MultiPolygon":
+			if err := json.Unmarshal(f.Geometry.Coordinates, &polygons); err != nil {
+				return nil, fmt.Errorf("feature %d: %w", i, err)
+			}
+		default:
+			continue
+		}
+
+		bd := boundary{Place: Place{Country: country, Region: region}}
+		var points []Point
+		for _, polygon := range polygons {
+			var rings [][]Point
+			for _, ring := range polygon {
+				var r []Point
+				for _, coord := range ring {
+					// GeoJSON positions are longitude first
+					r = append(r, Point{Lat: coord[1], Lng: coord[0]})
+				}
+				rings = append(rings, r)
+				points = append(points, r...)
+			}
+			bd.polygons = append(bd.polygons, rings)
+		}
+		box, ok := BoundsOf(points)
+		if !ok {
+			continue
+		}
+		bd.box = box
+		b.boundaries = append(b.boundaries, bd)
+
+		if name := property(f.Properties, countryNameProperties); name != "" && b.names[country] == "" {
+			b.names[country] = name
+		}
+		if region != "" {
+			if name := property(f.Properties, regionNameProperties); name != "" {
+				b.names[region] = name
+			}
+		}
+	}
+	if len(b.boundaries) == 0 {
+		return nil, fmt.Errorf("boundaries have no polygons with a country code")
+	}
+	return b, nil
+}
+
+// Name is the country's or region's name as the boundaries have it
+func (b *Boundaries) Name(code string) string {
+	return b.names[code]
+}
+
+// points on a west or south edge are inside and on an east or north edge
+// outside, so a point on a border shared with a neighbour is in one of the two
+func (bd boundary) contains(p Point) bool {
+	if p.Lat < bd.box.MinLat || p.Lat > bd.box.MaxLat || p.Lng < bd.box.MinLng || p.Lng > bd.box.MaxLng {
+		return false
+	}
+	for _, rings := range bd.polygons {
+		// even-odd over every ring, so a point in a hole is outside
+		inside := false
+		for _, ring := range rings {
+			for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+				a, c := ring[i], ring[j]
+				if (a.Lat > p.Lat) != (c.Lat > p.Lat) && p.Lng < (c.Lng-a.Lng)*(p.Lat-a.Lat)/(c.Lat-a.Lat)+a.Lng {
+					inside = !inside
+				}
+			}
+		}
+		if inside {
+			return true
+		}
+	}
+	return false
+}
+
+// Locate is the place holding p, ok is false at sea or outside the boundaries
+func (b *Boundaries) Locate(p Point) (Place, bool) {
+	for _, bd := range b.boundaries {
+		if bd.contains(p) {
+			return bd.Place, true
+		}
+	}
+	return Place{}, false
+}
+
+// Places are the distinct places a route passes through, in the order it
+// reaches them
+func (b *Boundaries) Places(route []Point) []Place {
+	places := []Place{}
+	seen := make(map[Place]bool)
+	last := -1
+	for _, p := range route {
+		// consecutive points are nearly always in the same place
+		if last >= 0 && b.boundaries[last].contains(p) {
+			continue
+		}
+		last = -1
+		for i, bd := range b.boundaries {
+			if bd.contains(p) {
+				last = i
+				if !seen[bd.Place] {
+					seen[bd.Place] = true
+					places = append(places, bd.Place)
+				}
+				break
+			}
+		}
+	}
+	return places
+}
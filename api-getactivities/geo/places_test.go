@@ -0,0 +1,102 @@
+package geo_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/geo"
+)
+
+// four one degree squares meeting at 1,1, then a square with a hole and an
+// enclave filling it, and a country of two islands
+const boundariesJSON = `{"type": "FeatureCollection", "features": [
+	{"properties": {"ISO_A2_EH": "SW", "ADMIN": "South West"}, "geometry": {"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 1], [0, 0]]]}},
+	{"properties": {"ISO_A2_EH": "SE", "ADMIN": "South East"}, "geometry": {"type": "Polygon", "coordinates": [[[1, 0], [2, 0], [2, 1], [1, 1], [1, 0]]]}},
+	{"properties": {"ISO_A2_EH": "NW", "ADMIN": "North West"}, "geometry": {"type": "Polygon", "coordinates": [[[0, 1], [1, 1], [1, 2], [0, 2], [0, 1]]]}},
+	{"properties": {"ISO_A2_EH": "NE", "ADMIN": "North East"}, "geometry": {"type": "Polygon", "coordinates": [[[1, 1], [2, 1], [2, 2], [1, 2], [1, 1]]]}},
+	{"properties": {"ISO_A2_EH": "ZA", "ADMIN": "South Africa"}, "geometry": {"type": "Polygon", "coordinates": [
+		[[10, 10], [14, 10], [14, 14], [10, 14], [10, 10]],
+		[[11, 11], [13, 11], [13, 13], [11, 13], [11, 11]]]}},
+	{"properties": {"ISO_A2_EH": "LS", "ADMIN": "Lesotho"}, "geometry": {"type": "Polygon", "coordinates": [[[11.5, 11.5], [12.5, 11.5], [12.5, 12.5], [11.5, 12.5], [11.5, 11.5]]]}},
+	{"properties": {"ISO_A2_EH": "FJ", "ADMIN": "Fiji"}, "geometry": {"type": "MultiPolygon", "coordinates": [
+		[[[20, 20], [21, 20], [20.5, 21], [20, 20]]],
+		[[[22, 20], [23, 20], [22.5, 21], [22, 20]]]]}},
+	{"properties": {"ISO_A2_EH": "-99"}, "geometry": {"type": "Polygon", "coordinates": [[[30, 30], [31, 30], [31, 31], [30, 30]]]}}
+]}`
+
+func TestLocate(t *testing.T) {
+	b, err := geo.ParseBoundaries([]byte(boundariesJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		p    geo.Point
+		want string // "" when at sea
+	}{
+		{"inside", geo.Point{Lat: 0.5, Lng: 0.5}, "SW"},
+		{"inside another", geo.Point{Lat: 1.5, Lng: 1.5}, "NE"},
+		{"outside every polygon", geo.Point{Lat: 5, Lng: 5}, ""},
+		{"inside the box of a triangle but not the triangle", geo.Point{Lat: 20.9, Lng: 20.1}, ""},
+		{"on the west edge", geo.Point{Lat: 0.5, Lng: 0}, "SW"},
+		{"on the south edge", geo.Point{Lat: 0, Lng: 0.5}, "SW"},
+		{"on the east edge", geo.Point{Lat: 0.5, Lng: 2}, ""},
+		{"on the north edge", geo.Point{Lat: 2, Lng: 0.5}, ""},
+		{"on a border shared east and west", geo.Point{Lat: 0.5, Lng: 1}, "SE"},
+		{"on a border shared north and south", geo.Point{Lat: 1, Lng: 0.5}, "NW"},
+		{"at the south west vertex", geo.Point{Lat: 0, Lng: 0}, "SW"},
+		{"at the north east vertex", geo.Point{Lat: 2, Lng: 2}, ""},
+		{"at the vertex four squares share", geo.Point{Lat: 1, Lng: 1}, "NE"},
+		{"in the outer ring", geo.Point{Lat: 10.5, Lng: 10.5}, "ZA"},
+		{"in the hole", geo.Point{Lat: 11.2, Lng: 11.2}, ""},
+		{"in the enclave filling the hole", geo.Point{Lat: 12, Lng: 12}, "LS"},
+		{"on the second island", geo.Point{Lat: 20.2, Lng: 22.5}, "FJ"},
+		{"between the islands", geo.Point{Lat: 20.2, Lng: 21.5}, ""},
+		{"in a polygon without a country code", geo.Point{Lat: 30.2, Lng: 30.5}, ""},
+	}
+	for _, tc := range cases {
+		place, ok := b.Locate(tc.p)
+		if ok != (tc.want != "") || place.Country != tc.want {
+			t.Errorf("%s: %v located in %+v, %v, want %q", tc.name, tc.p, place, ok, tc.want)
+		}
+	}
+	if name := b.Name("LS"); name != "Lesotho" {
+		t.Errorf("name of LS %q", name)
+	}
+}
+
+func TestPlaces(t *testing.T) {
+	b, err := geo.ParseBoundaries([]byte(boundariesJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := []geo.Point{
+		{Lat: 0.5, Lng: 0.2}, {Lat: 0.5, Lng: 0.8}, // SW
+		{Lat: 0.5, Lng: 1.5}, // SE
+		{Lat: 5, Lng: 5},     // at sea
+		{Lat: 1.5, Lng: 1.5}, // NE
+		{Lat: 0.5, Lng: 0.5}, // SW again
+	}
+	want := []geo.Place{{Country: "SW"}, {Country: "SE"}, {Country: "NE"}}
+	if places := b.Places(route); !reflect.DeepEqual(places, want) {
+		t.Errorf("places %v, want %v", places, want)
+	}
+	if places := b.Places(nil); len(places) != 0 {
+		t.Errorf("places of no route %v", places)
+	}
+}
+
+func TestParseBoundariesRejects(t *testing.T) {
+	cases := map[string]string{
+		"not json":           `{`,
+		"not a collection":   `{"type": "Feature"}`,
+		"no country codes":   `{"type": "FeatureCollection", "features": [{"properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [0, 1], [0, 0]]]}}]}`,
+		"broken coordinates": `{"type": "FeatureCollection", "features": [{"properties": {"iso_a2": "SW"}, "geometry": {"type": "Polygon", "coordinates": [0, 0]}}]}`,
+	}
+	for name, data := range cases {
+		if _, err := geo.ParseBoundaries([]byte(data)); err == nil {
+			t.Errorf("%s: parsed", name)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Package geo decodes Strava route polylines and measures the points on them.
+package geo
+
+import "fmt"
+
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// DecodePolyline reads Google's encoded polyline format, used by strava for
+// summary_polyline at a precision of five decimal places
+func DecodePolyline(encoded string) ([]Point, error) {
+	var points []Point
+	var lat, lng int64
+	for i := 0; i < len(encoded); {
+		for _, coord := range []*int64{&lat, &lng} {
+			var result int64
+			shift := uint(0)
+			for {
+				if i >= len(encoded) {
+					return nil, fmt.Errorf("polyline ends inside a coordinate")
+				}
+				b := int64(encoded[i]) - 63
+				i++
+				if b < 0 || b > 63 {
+					return nil, fmt.Errorf("polyline has invalid character %q", encoded[i-1])
+				}
+				result |= (b & 0x1f) << shift
+				shift += 5
+				if b < 0x20 {
+					break
+				}
+			}
+			if result&1 != 0 {
+				*coord += ^(result >> 1)
+			} else {
+				*coord += result >> 1
+			}
+		}
+		points = append(points, Point{Lat: float64(lat) / 1e5, Lng: float64(lng) / 1e5})
+	}
+	return points, nil
+}
@@ -0,0 +1,17 @@
+package geo_test
+
+import (
+	"testing"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/geo"
+)
+
+func BenchmarkDecodePolyline(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(route)))
+	for i := 0; i < b.N; i++ {
+		if _, err := geo.DecodePolyline(route); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,4 +1,4 @@
-module api-getdraftables
+module github.com/agentdanger/golang-strava-api/api-getactivities
 
 go 1.20
 
@@ -6,6 +6,12 @@ require (
 	cloud.google.com/go/storage v1.30.1
 	github.com/gin-gonic/gin v1.9.0
 	github.com/lib/pq v1.10.8
+	github.com/ugorji/go/codec v1.2.9
+	golang.org/x/crypto v0.5.0
+	golang.org/x/net v0.8.0
+	golang.org/x/text v0.8.0
+	google.golang.org/api v0.114.0
+	google.golang.org/protobuf v1.29.1
 )
 
 require (
@@ -34,19 +40,13 @@ require (
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/pelletier/go-toml/v2 v2.0.6 // indirect
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
-	github.com/ugorji/go/codec v1.2.9 // indirect
 	go.opencensus.io v0.24.0 // indirect
 	golang.org/x/arch v0.0.0-20210923205945-b76863e36670 // indirect
-	golang.org/x/crypto v0.5.0 // indirect
-	golang.org/x/net v0.8.0 // indirect
 	golang.org/x/oauth2 v0.6.0 // indirect
 	golang.org/x/sys v0.6.0 // indirect
-	golang.org/x/text v0.8.0 // indirect
 	golang.org/x/xerrors v0.0.0-20220907171357-04be3eba64a2 // indirect
-	google.golang.org/api v0.114.0 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
 	google.golang.org/genproto v0.0.0-20230320184635-7606e756e683 // indirect
 	google.golang.org/grpc v1.53.0 // indirect
-	google.golang.org/protobuf v1.29.1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,122 @@
+// Package benchdata is the synthetic data the hot path benchmarks run over,
+// the size of a long-time athlete's, and the golden numbers they are held to,
+// see the README.
+package benchdata
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/geo"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// about thirty years of daily activities, and a four hour ride at one second
+// intervals
+const (
+	ActivityCount = 10000
+	StreamSamples = 14400
+	RoutePoints   = 10000
+	ChartPoints   = 500
+)
+
+// every run sees the same data, so its numbers compare with the golden ones
+const seed = 2446
+
+var sportTypes = []string{"Run", "Ride", "Swim", "Walk", "TrailRun", "VirtualRide"}
+
+// Activities are one a day going back from 2026, newest first, with the
+// polylines and counts the aggregations read
+func Activities(n int) []strava.ActivitySummary {
+	r := rand.New(rand.NewSource(seed))
+	end := time.Date(2026, 1, 1, 7, 0, 0, 0, time.UTC)
+	route := EncodePolyline(Route(100))
+
+	activities := make([]strava.ActivitySummary, n)
+	for i := range activities {
+		start := end.AddDate(0, 0, -i).Add(time.Duration(r.Intn(12*3600)) * time.Second)
+		sport := sportTypes[r.Intn(len(sportTypes))]
+		a := &activities[i]
+		a.Resource_state = 2
+		a.Id = int64(9000000000 + n - i)
+		a.Name = sport + " " + start.Format("Jan 2")
+		a.Type, a.SportType = sport, sport
+		a.Distance = 2000 + r.Float64()*60000
+		a.MovingTime = 600 + r.Intn(4*3600)
+		a.ElapsedTime = a.MovingTime + r.Intn(900)
+		a.TotalElevationGain = r.Float64() * 1500
+		a.StartDate = start.Format(time.RFC3339)
+		a.StartDateLocal = start.Add(-7 * time.Hour).Format("2006-01-02T15:04:05Z")
+		a.TimeZone = "(GMT-07:00) America/Denver"
+		a.UtcOffset = -7 * 3600
+		a.Country = "United States"
+		a.KudosCount = r.Intn(40)
+		a.CommentCount = r.Intn(5)
+		a.TotalPhotoCount = r.Intn(3)
+		a.AverageSpeed = a.Distance / float64(a.MovingTime)
+		a.HasHeartrate = r.Intn(4) > 0
+		a.AverageHeartrate = 120 + r.Float64()*40
+		a.MaxHeartrate = a.AverageHeartrate + r.Float64()*30
+		a.GearId = "g" + strconv.Itoa(1+r.Intn(4))
+		a.Visibility = "everyone"
+		a.Map.SummaryPolyline = route
+	}
+	return activities
+}
+
+// Route wanders n points around Boulder
+func Route(n int) []geo.Point {
+	r := rand.New(rand.NewSource(seed))
+	points := make([]geo.Point, n)
+	lat, lng := 40.015, -105.27
+	for i := range points {
+		lat += (r.Float64() - 0.5) * 0.001
+		lng += (r.Float64() - 0.5) * 0.001
+		points[i] = geo.Point{Lat: lat, Lng: lng}
+	}
+	return points
+}
+
+// EncodePolyline is Google's encoded polyline format at five decimal places,
+// what strava sends and geo.DecodePolyline reads
+func EncodePolyline(points []geo.Point) string {
+	var b strings.Builder
+	var lastLat, lastLng int64
+	encode := func(delta int64) {
+		v := delta << 1
+		if delta < 0 {
+			v = ^v
+		}
+		for v >= 0x20 {
+			b.WriteByte(byte((0x20 | (v & 0x1f)) + 63))
+			v >>= 5
+		}
+		b.WriteByte(byte(v + 63))
+	}
+	for _, p := range points {
+		lat, lng := int64(math.Round(p.Lat*1e5)), int64(math.Round(p.Lng*1e5))
+		encode(lat - lastLat)
+		encode(lng - lastLng)
+		lastLat, lastLng = lat, lng
+	}
+	return b.String()
+}
+
+// Series is a heart rate like stream, drifting with noise and the odd spike
+func Series(n int) (seconds []float64, values []float64) {
+	r := rand.New(rand.NewSource(seed))
+	seconds, values = make([]float64, n), make([]float64, n)
+	hr := 110.0
+	for i := range values {
+		hr += (r.Float64() - 0.5) * 2
+		seconds[i] = float64(i)
+		values[i] = hr + 10*math.Sin(float64(i)/300)
+		if r.Intn(500) == 0 {
+			values[i] += 60
+		}
+	}
+	return seconds, values
+}
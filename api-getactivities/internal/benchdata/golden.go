@@ -0,0 +1,183 @@
+package benchdata
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"testing"
+)
+
+// registered by every package holding golden benchmarks, so pass them only
+// to those packages' tests
+var (
+	golden         = flag.Bool("golden", false, "after the tests, hold the package's benchmarks to testdata/golden.json")
+	updateGolden   = flag.Bool("update-golden", false, "record the benchmark numbers measured now in testdata/golden.json")
+	timeTolerance  = flag.Float64("time-tolerance", 1.0, "fraction ns/op may exceed the golden number by")
+	allocTolerance = flag.Float64("alloc-tolerance", 0.1, "fraction allocs/op and B/op may exceed the golden numbers by")
+	bytesFloor     = flag.Int64("bytes-floor", 64<<10, "B/op up to which only allocs/op are held to the golden numbers")
+	goldenRuns     = flag.Int("golden-runs", 3, "times each benchmark runs; the best time and the most allocated are recorded, the best of each checked")
+)
+
+// the numbers are kept with the package they measure
+const goldenPath = "testdata/golden.json"
+
+// Benchmarks are a package's benchmark functions by name
+type Benchmarks map[string]func(b *testing.B)
+
+// Result is what golden.json records for each benchmark
+type Result struct {
+	NsPerOp     int64 `json:"ns_per_op"`
+	AllocsPerOp int64 `json:"allocs_per_op"`
+	BytesPerOp  int64 `json:"bytes_per_op"`
+}
+
+func loadGolden() (map[string]Result, error) {
+	results := make(map[string]Result)
+	data, err := os.ReadFile(goldenPath)
+	if os.IsNotExist(err) {
+		return results, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return results, json.Unmarshal(data, &results)
+}
+
+func saveGolden(results map[string]Result) error {
+	data, err := json.MarshalIndent(results, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll("testdata", 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(goldenPath, append(data, '\n'), 0644)
+}
+
+// what about result is worse than want allows, empty when nothing is
+func regressions(result Result, want Result) []string {
+	var worse []string
+	check := func(name string, got int64, want int64, tolerance float64, floor int64) {
+		if limit := math.Max(float64(want)*(1+tolerance), float64(floor)); want > 0 && float64(got) > limit {
+			worse = append(worse, fmt.Sprintf("%s %d, golden %d", name, got, want))
+		}
+	}
+	check("ns/op", result.NsPerOp, want.NsPerOp, *timeTolerance, 0)
+	check("allocs/op", result.AllocsPerOp, want.AllocsPerOp, *allocTolerance, 0)
+	// a pooled buffer or gzip state dropped by a GC mid-run is allocated again
+	// and spread over the few iterations, tens of bytes a run on a path that
+	// otherwise allocates none; small paths are held by their allocs instead
+	check("B/op", result.BytesPerOp, want.BytesPerOp, *allocTolerance, *bytesFloor)
+	// nothing allocated before, so any allocation is new
+	if want.AllocsPerOp == 0 && result.AllocsPerOp > 0 {
+		worse = append(worse, fmt.Sprintf("allocs/op %d, golden 0", result.AllocsPerOp))
+	}
+	return worse
+}
+
+// Main is a TestMain that runs the tests, then with -golden or
+// -update-golden runs every benchmark once more and compares its numbers
+// with the golden ones, or records them
+func Main(m *testing.M, benchmarks Benchmarks) {
+	flag.Parse()
+	code := m.Run()
+	if code == 0 && (*golden || *updateGolden) {
+		code = checkGolden(benchmarks)
+	}
+	os.Exit(code)
+}
+
+// -golden-runs runs of benchmark, the best of each number on its own, and
+// what is recorded: the best time but the most allocated. Whether a GC
+// empties the pools during a run comes and goes between runs and only ever
+// adds allocations, so those are held to the worst run seen
+func measure(benchmark func(b *testing.B)) (best Result, recorded Result) {
+	for run := 0; run < *goldenRuns || run == 0; run++ {
+		r := testing.Benchmark(benchmark)
+		result := Result{NsPerOp: r.NsPerOp(), AllocsPerOp: r.AllocsPerOp(), BytesPerOp: r.AllocedBytesPerOp()}
+		if run == 0 {
+			best, recorded = result, result
+			continue
+		}
+		best = Result{min64(best.NsPerOp, result.NsPerOp), min64(best.AllocsPerOp, result.AllocsPerOp), min64(best.BytesPerOp, result.BytesPerOp)}
+		recorded = Result{best.NsPerOp, max64(recorded.AllocsPerOp, result.AllocsPerOp), max64(recorded.BytesPerOp, result.BytesPerOp)}
+	}
+	return best, recorded
+}
+
+func min64(a int64, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a int64, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func checkGolden(benchmarks Benchmarks) int {
+	results, err := loadGolden()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var names []string
+	for name := range benchmarks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// on one P, as on the machine the numbers were recorded on whatever it has:
+	// with more, a benchmark moving between Ps misses the buffers and gzip
+	// state pooled on the one it left and allocates them again
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	failed := 0
+	for _, name := range names {
+		result, recorded := measure(benchmarks[name])
+		if *updateGolden {
+			result = recorded
+		}
+		fmt.Printf("%-32s %12d ns/op %10d allocs/op %12d B/op\n", name, result.NsPerOp, result.AllocsPerOp, result.BytesPerOp)
+
+		if *updateGolden {
+			results[name] = result
+			continue
+		}
+		want, ok := results[name]
+		if !ok {
+			fmt.Printf("     no golden numbers for %s, record them with -update-golden\n", name)
+			failed++
+			continue
+		}
+		if worse := regressions(result, want); len(worse) > 0 {
+			failed++
+			for _, w := range worse {
+				fmt.Printf("FAIL %s: %s\n", name, w)
+			}
+		}
+	}
+
+	if *updateGolden {
+		if err := saveGolden(results); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("recorded %d benchmarks in %s\n", len(names), goldenPath)
+		return 0
+	}
+	if failed > 0 {
+		fmt.Printf("%d benchmarks regressed\n", failed)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,28 @@
+package benchdata
+
+import "testing"
+
+func TestRegressions(t *testing.T) {
+	cases := []struct {
+		name   string
+		golden Result
+		got    Result
+		worse  int
+	}{
+		{"same", Result{100, 10, 1 << 20}, Result{100, 10, 1 << 20}, 0},
+		{"pool refilled mid-run", Result{80000000, 0, 20}, Result{80000000, 0, 35}, 0},
+		{"small path allocating more bytes", Result{1000, 1, 4096}, Result{1000, 1, 8192}, 0},
+		{"small path past the floor", Result{1000, 1, 4096}, Result{1000, 1, 128 << 10}, 1},
+		{"large path allocating more bytes", Result{1000, 10, 50 << 20}, Result{1000, 10, 60 << 20}, 1},
+		{"one more allocation", Result{1000, 10, 4096}, Result{1000, 12, 4096}, 1},
+		{"allocating where nothing did", Result{1000, 0, 0}, Result{1000, 1, 64}, 1},
+		{"twice as slow", Result{1000, 1, 4096}, Result{2000, 1, 4096}, 0},
+		{"more than twice as slow", Result{1000, 1, 4096}, Result{2500, 1, 4096}, 1},
+		{"faster", Result{1000, 10, 50 << 20}, Result{500, 5, 25 << 20}, 0},
+	}
+	for _, tc := range cases {
+		if worse := regressions(tc.got, tc.golden); len(worse) != tc.worse {
+			t.Errorf("%s: regressions %v, want %d", tc.name, worse, tc.worse)
+		}
+	}
+}
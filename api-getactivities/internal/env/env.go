@@ -0,0 +1,22 @@
+// Package env reads typed settings from environment variables with fallbacks.
+package env
+
+import (
+	"os"
+	"strconv"
+)
+
+func Int(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+func String(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,35 @@
+package pool_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/benchdata"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/pool"
+)
+
+// a compressed activity index, as storage reads and writes it
+var (
+	activities = benchdata.Activities(benchdata.ActivityCount)
+	encoded    []byte
+	compressed []byte
+)
+
+func TestMain(m *testing.M) {
+	var err error
+	if encoded, err = json.Marshal(activities); err != nil {
+		panic(err)
+	}
+	zipped, err := pool.Gzip(encoded)
+	if err != nil {
+		panic(err)
+	}
+	compressed = bytes.Clone(zipped.Bytes())
+
+	benchdata.Main(m, benchdata.Benchmarks{
+		"BenchmarkGzip":         BenchmarkGzip,
+		"BenchmarkGunzip":       BenchmarkGunzip,
+		"BenchmarkIndentedJSON": BenchmarkIndentedJSON,
+	})
+}
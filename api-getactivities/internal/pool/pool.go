@@ -0,0 +1,97 @@
+// Package pool reuses the buffers and gzip state of the hot encode and decode
+// paths, so reading, compressing and rendering large objects allocate once for
+// the result instead of for every step of growing it.
+package pool
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// buffers grown past this are left to the GC, so one unusually large object
+// does not keep its memory pinned in the pool; the pool drops idle buffers
+// within two collections anyway
+const maxPooledBytes = 32 << 20
+
+var buffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// Buffer is an empty buffer to hand back with PutBuffer once its bytes are no
+// longer used
+func Buffer() *bytes.Buffer {
+	b := buffers.Get().(*bytes.Buffer)
+	b.Reset()
+	return b
+}
+
+func PutBuffer(b *bytes.Buffer) {
+	if b.Cap() <= maxPooledBytes {
+		buffers.Put(b)
+	}
+}
+
+// ReadAll is io.ReadAll growing a pooled buffer, with the result copied into
+// a slice of exactly its size that the caller may keep
+func ReadAll(r io.Reader) ([]byte, error) {
+	b := Buffer()
+	defer PutBuffer(b)
+	if _, err := b.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(b.Bytes()), nil
+}
+
+// a gzip.Writer holds about a megabyte of compression state
+var gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+
+// Gzip compresses data into a pooled buffer, PutBuffer it once it is sent
+func Gzip(data []byte) (*bytes.Buffer, error) {
+	b := Buffer()
+	zw := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(zw)
+	zw.Reset(b)
+	if _, err := zw.Write(data); err != nil {
+		PutBuffer(b)
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		PutBuffer(b)
+		return nil, err
+	}
+	return b, nil
+}
+
+var gzipReaders sync.Pool
+
+// GzipReader is gzip.NewReader reusing a reader, PutGzipReader it once read
+func GzipReader(r io.Reader) (*gzip.Reader, error) {
+	if zr, ok := gzipReaders.Get().(*gzip.Reader); ok {
+		if err := zr.Reset(r); err != nil {
+			gzipReaders.Put(zr)
+			return nil, err
+		}
+		return zr, nil
+	}
+	return gzip.NewReader(r)
+}
+
+func PutGzipReader(zr *gzip.Reader) {
+	zr.Close()
+	gzipReaders.Put(zr)
+}
+
+// IndentedJSON encodes v as gin's IndentedJSON does, four spaces and no
+// trailing newline, into a pooled buffer to PutBuffer once it is written
+func IndentedJSON(v any) (*bytes.Buffer, error) {
+	b := Buffer()
+	enc := json.NewEncoder(b)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(v); err != nil {
+		PutBuffer(b)
+		return nil, err
+	}
+	b.Truncate(b.Len() - 1)
+	return b, nil
+}
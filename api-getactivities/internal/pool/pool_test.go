@@ -0,0 +1,46 @@
+package pool_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/pool"
+)
+
+func BenchmarkGzip(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, err := pool.Gzip(encoded)
+		if err != nil {
+			b.Fatal(err)
+		}
+		pool.PutBuffer(buf)
+	}
+}
+
+func BenchmarkGunzip(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(encoded)))
+	for i := 0; i < b.N; i++ {
+		zr, err := pool.GzipReader(bytes.NewReader(compressed))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := pool.ReadAll(zr); err != nil {
+			b.Fatal(err)
+		}
+		pool.PutGzipReader(zr)
+	}
+}
+
+// how the activity lists are rendered
+func BenchmarkIndentedJSON(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, err := pool.IndentedJSON(activities)
+		if err != nil {
+			b.Fatal(err)
+		}
+		pool.PutBuffer(buf)
+	}
+}
@@ -0,0 +1,34 @@
+package set_test
+
+import (
+	"testing"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/benchdata"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// every id twice, as overlapping sync pages and webhook retries send them,
+// and a sync's worth of updates: half the index changed and as many new
+var (
+	activities = benchdata.Activities(benchdata.ActivityCount)
+	ids        []int64
+	updates    []strava.ActivitySummary
+)
+
+func TestMain(m *testing.M) {
+	for _, a := range activities {
+		ids = append(ids, a.Id)
+	}
+	ids = append(ids, ids...)
+	updates = append(append(updates, activities[len(activities)/2:]...), benchdata.Activities(benchdata.ActivityCount/2)...)
+	for i := len(activities) / 2; i < len(updates); i++ {
+		updates[i].Id += benchdata.ActivityCount
+	}
+
+	benchdata.Main(m, benchdata.Benchmarks{
+		"BenchmarkDedupeScan":     BenchmarkDedupeScan,
+		"BenchmarkDedupe":         BenchmarkDedupe,
+		"BenchmarkMergeScan":      BenchmarkMergeScan,
+		"BenchmarkMergePositions": BenchmarkMergePositions,
+	})
+}
@@ -0,0 +1,68 @@
+// Package set keeps activity ids, tags and other keys for constant time
+// lookups, so deduplicating and merging lists stays linear as they grow.
+package set
+
+// Set is a set of keys; the zero value is empty but cannot be added to
+type Set[K comparable] map[K]struct{}
+
+func New[K comparable]() Set[K] {
+	return make(Set[K])
+}
+
+// Of is a set of keys, duplicates counted once
+func Of[K comparable](keys ...K) Set[K] {
+	s := make(Set[K], len(keys))
+	for _, k := range keys {
+		s[k] = struct{}{}
+	}
+	return s
+}
+
+// Keyed is a set of each value's key
+func Keyed[K comparable, V any](values []V, key func(V) K) Set[K] {
+	s := make(Set[K], len(values))
+	for _, v := range values {
+		s[key(v)] = struct{}{}
+	}
+	return s
+}
+
+// Add reports whether k was new, so one call both checks and records a key
+func (s Set[K]) Add(k K) bool {
+	if _, ok := s[k]; ok {
+		return false
+	}
+	s[k] = struct{}{}
+	return true
+}
+
+func (s Set[K]) Has(k K) bool {
+	_, ok := s[k]
+	return ok
+}
+
+func (s Set[K]) Remove(k K) {
+	delete(s, k)
+}
+
+// Dedupe is keys with the repeats dropped, in the order they first appear
+func Dedupe[K comparable](keys []K) []K {
+	seen := make(Set[K], len(keys))
+	var kept []K
+	for _, k := range keys {
+		if seen.Add(k) {
+			kept = append(kept, k)
+		}
+	}
+	return kept
+}
+
+// Positions indexes values by key, the last position winning for a repeated
+// key, so a merge can replace a value in place instead of scanning for it
+func Positions[K comparable, V any](values []V, key func(V) K) map[K]int {
+	positions := make(map[K]int, len(values))
+	for i, v := range values {
+		positions[key(v)] = i
+	}
+	return positions
+}
@@ -0,0 +1,108 @@
+package set_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/set"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+func TestDedupe(t *testing.T) {
+	cases := []struct {
+		name string
+		keys []int64
+		want []int64
+	}{
+		{"nil", nil, nil},
+		{"empty", []int64{}, nil},
+		{"one", []int64{7}, []int64{7}},
+		{"no repeats", []int64{3, 1, 2}, []int64{3, 1, 2}},
+		{"order of first appearance kept", []int64{3, 1, 3, 2, 1, 4}, []int64{3, 1, 2, 4}},
+		{"all the same", []int64{5, 5, 5, 5}, []int64{5}},
+		{"zero is a key", []int64{0, 1, 0}, []int64{0, 1}},
+	}
+	for _, tc := range cases {
+		if got := set.Dedupe(tc.keys); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: Dedupe(%v) = %v, want %v", tc.name, tc.keys, got, tc.want)
+		}
+	}
+	if got := set.Dedupe([]string{"run", "ride", "run"}); !reflect.DeepEqual(got, []string{"run", "ride"}) {
+		t.Errorf("Dedupe of strings %v", got)
+	}
+}
+
+func TestPositions(t *testing.T) {
+	values := []string{"a1", "b1", "a2"}
+	positions := set.Positions(values, func(v string) byte { return v[0] })
+	if want := map[byte]int{'a': 2, 'b': 1}; !reflect.DeepEqual(positions, want) {
+		t.Errorf("positions %v, want the last of each key %v", positions, want)
+	}
+}
+
+// deduplicating and merging activity ids by scanning what is kept so far, as
+// the handlers once did, and with a set
+
+func containsId(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func BenchmarkDedupeScan(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var kept []int64
+		for _, id := range ids {
+			if !containsId(kept, id) {
+				kept = append(kept, id)
+			}
+		}
+	}
+}
+
+func BenchmarkDedupe(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		set.Dedupe(ids)
+	}
+}
+
+func BenchmarkMergeScan(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		merged := append([]strava.ActivitySummary(nil), activities...)
+		for _, u := range updates {
+			replaced := false
+			for j := range merged {
+				if merged[j].Id == u.Id {
+					merged[j], replaced = u, true
+					break
+				}
+			}
+			if !replaced {
+				merged = append(merged, u)
+			}
+		}
+	}
+}
+
+func BenchmarkMergePositions(b *testing.B) {
+	b.ReportAllocs()
+	activityId := func(a strava.ActivitySummary) int64 { return a.Id }
+	for i := 0; i < b.N; i++ {
+		merged := append([]strava.ActivitySummary(nil), activities...)
+		positions := set.Positions(merged, activityId)
+		for _, u := range updates {
+			if j, ok := positions[u.Id]; ok {
+				merged[j] = u
+				continue
+			}
+			positions[u.Id] = len(merged)
+			merged = append(merged, u)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package notify
+
+import "fmt"
+
+// Log is a Notifier that prints the subject, used by dev mode so a report can
+// be sent without a mail server; the report itself is served over http
+type Log struct{}
+
+func (Log) Notify(message Message) error {
+	fmt.Printf("notify %q (%d bytes)\n", message.Subject, len(message.HTML))
+	return nil
+}
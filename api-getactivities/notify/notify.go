@@ -0,0 +1,14 @@
+// Package notify delivers reports to the athlete, by email normally and to
+// the process log in dev mode.
+package notify
+
+// Message is one report, HTML is a whole document with every style inline
+type Message struct {
+	Subject string
+	HTML    []byte
+}
+
+// Notifier delivers a message to every recipient it was set up with
+type Notifier interface {
+	Notify(message Message) error
+}
@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTP is a Notifier sending HTML mail through one server, authenticating
+// with PLAIN when a username is given, which net/smtp only allows over TLS
+// or to localhost
+type SMTP struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+func (s SMTP) Notify(message Message) error {
+	if len(s.To) == 0 {
+		return errors.New("no recipients")
+	}
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", s.From)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/html; charset=utf-8\r\n")
+	body.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	// SMTP lines end in CRLF whatever the template used
+	body.Write(bytes.ReplaceAll(bytes.ReplaceAll(message.HTML, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n")))
+
+	return smtp.SendMail(s.Addr, auth, s.From, s.To, body.Bytes())
+}
@@ -0,0 +1,347 @@
+// Package parquet writes flat tables to Apache Parquet files, enough for
+// pandas, DuckDB or Spark to load the exported activities without conversion.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// physical types
+const (
+	typeBoolean   = 0
+	typeInt64     = 2
+	typeDouble    = 5
+	typeByteArray = 6
+)
+
+// converted types, the logical meaning of a physical type
+const (
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+)
+
+const (
+	encodingPlain = 0
+	encodingRLE   = 3
+	codecGzip     = 2
+)
+
+// RowGroupSize is how many rows are encoded together, readers load a row group at a time
+var RowGroupSize = 100000
+
+// Column is one named column of a table, made with the constructors below;
+// optional columns are null where their value is nil
+type Column struct {
+	name      string
+	physical  int32
+	converted int32 // -1 for none
+	optional  bool
+	length    int
+	defined   func(i int) bool
+	plain     func(buf *bytes.Buffer, from, to int, defined func(i int) bool)
+}
+
+func Int64(name string, values []int64) Column {
+	return required(name, typeInt64, -1, values, plainInt64)
+}
+
+func Float64(name string, values []float64) Column {
+	return required(name, typeDouble, -1, values, plainFloat64)
+}
+
+func Bool(name string, values []bool) Column {
+	return required(name, typeBoolean, -1, values, plainBool)
+}
+
+// empty strings are written as null, strava leaves most optional text fields empty
+func String(name string, values []string) Column {
+	c := required(name, typeByteArray, convertedUTF8, values, plainString)
+	c.optional = true
+	c.defined = func(i int) bool { return values[i] != "" }
+	return c
+}
+
+// millisecond precision in UTC, zero times are written as null
+func Timestamp(name string, values []time.Time) Column {
+	millis := make([]int64, len(values))
+	for i, t := range values {
+		millis[i] = t.UnixMilli()
+	}
+	c := required(name, typeInt64, convertedTimestampMillis, millis, plainInt64)
+	c.optional = true
+	c.defined = func(i int) bool { return !values[i].IsZero() }
+	return c
+}
+
+func OptionalInt64(name string, values []*int64) Column {
+	return optional(name, typeInt64, -1, values, plainInt64)
+}
+
+func OptionalFloat64(name string, values []*float64) Column {
+	return optional(name, typeDouble, -1, values, plainFloat64)
+}
+
+func OptionalBool(name string, values []*bool) Column {
+	return optional(name, typeBoolean, -1, values, plainBool)
+}
+
+func required[T any](name string, physical int32, converted int32, values []T, plain func(*bytes.Buffer, []T)) Column {
+	return Column{
+		name:      name,
+		physical:  physical,
+		converted: converted,
+		length:    len(values),
+		defined:   func(int) bool { return true },
+		plain: func(buf *bytes.Buffer, from, to int, defined func(i int) bool) {
+			var present []T
+			for i := from; i < to; i++ {
+				if defined(i) {
+					present = append(present, values[i])
+				}
+			}
+			plain(buf, present)
+		},
+	}
+}
+
+func optional[T any](name string, physical int32, converted int32, values []*T, plain func(*bytes.Buffer, []T)) Column {
+	c := Column{name: name, physical: physical, converted: converted, optional: true, length: len(values)}
+	c.defined = func(i int) bool { return values[i] != nil }
+	c.plain = func(buf *bytes.Buffer, from, to int, defined func(i int) bool) {
+		var present []T
+		for i := from; i < to; i++ {
+			if values[i] != nil {
+				present = append(present, *values[i])
+			}
+		}
+		plain(buf, present)
+	}
+	return c
+}
+
+func plainInt64(buf *bytes.Buffer, values []int64) {
+	for _, v := range values {
+		binary.Write(buf, binary.LittleEndian, v)
+	}
+}
+
+func plainFloat64(buf *bytes.Buffer, values []float64) {
+	for _, v := range values {
+		binary.Write(buf, binary.LittleEndian, math.Float64bits(v))
+	}
+}
+
+func plainString(buf *bytes.Buffer, values []string) {
+	for _, v := range values {
+		binary.Write(buf, binary.LittleEndian, uint32(len(v)))
+		buf.WriteString(v)
+	}
+}
+
+// booleans are bit packed, least significant bit first
+func plainBool(buf *bytes.Buffer, values []bool) {
+	packed := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	buf.Write(packed)
+}
+
+// definition levels in the RLE/bit packed hybrid encoding, written as runs of 0 (null) or 1
+func definitionLevels(buf *bytes.Buffer, from, to int, defined func(i int) bool) {
+	var levels bytes.Buffer
+	var scratch [binary.MaxVarintLen64]byte
+	for i := from; i < to; {
+		level := defined(i)
+		run := 1
+		for i+run < to && defined(i+run) == level {
+			run++
+		}
+		n := binary.PutUvarint(scratch[:], uint64(run)<<1)
+		levels.Write(scratch[:n])
+		if level {
+			levels.WriteByte(1)
+		} else {
+			levels.WriteByte(0)
+		}
+		i += run
+	}
+	binary.Write(buf, binary.LittleEndian, uint32(levels.Len()))
+	buf.Write(levels.Bytes())
+}
+
+type chunk struct {
+	column           *Column
+	offset           int64
+	numValues        int
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Write encodes the columns, which must all have the same length, as one parquet file
+func Write(w io.Writer, columns []Column) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("a parquet file needs at least one column")
+	}
+	rows := columns[0].length
+	for _, c := range columns {
+		if c.length != rows {
+			return fmt.Errorf("column %s has %d values, want %d", c.name, c.length, rows)
+		}
+	}
+
+	out := &countingWriter{w: w}
+	if _, err := io.WriteString(out, "PAR1"); err != nil {
+		return err
+	}
+
+	var groups [][]chunk
+	for from := 0; from < rows || groups == nil; from += RowGroupSize {
+		to := from + RowGroupSize
+		if to > rows {
+			to = rows
+		}
+		var group []chunk
+		for i := range columns {
+			ch, err := writeChunk(out, &columns[i], from, to)
+			if err != nil {
+				return err
+			}
+			group = append(group, ch)
+		}
+		groups = append(groups, group)
+	}
+
+	footer := fileMetadata(columns, rows, groups)
+	if _, err := out.Write(footer); err != nil {
+		return err
+	}
+	if err := binary.Write(out, binary.LittleEndian, uint32(len(footer))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(out, "PAR1")
+	return err
+}
+
+// one gzip compressed data page per column chunk
+func writeChunk(out *countingWriter, c *Column, from, to int) (chunk, error) {
+	var page bytes.Buffer
+	if c.optional {
+		definitionLevels(&page, from, to, c.defined)
+	}
+	c.plain(&page, from, to, c.defined)
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(page.Bytes())
+	if err := zw.Close(); err != nil {
+		return chunk{}, err
+	}
+
+	var header thriftWriter
+	header.beginStruct()
+	header.i32(1, 0) // DATA_PAGE
+	header.i32(2, int32(page.Len()))
+	header.i32(3, int32(compressed.Len()))
+	header.structField(5)
+	header.i32(1, int32(to-from))
+	header.i32(2, encodingPlain)
+	header.i32(3, encodingRLE)
+	header.i32(4, encodingRLE)
+	header.endStruct()
+	header.endStruct()
+
+	ch := chunk{
+		column:           c,
+		offset:           out.n,
+		numValues:        to - from,
+		uncompressedSize: int64(header.buf.Len() + page.Len()),
+		compressedSize:   int64(header.buf.Len() + compressed.Len()),
+	}
+	if _, err := out.Write(header.buf.Bytes()); err != nil {
+		return ch, err
+	}
+	_, err := out.Write(compressed.Bytes())
+	return ch, err
+}
+
+func fileMetadata(columns []Column, rows int, groups [][]chunk) []byte {
+	var t thriftWriter
+	t.beginStruct()
+	t.i32(1, 1)
+
+	t.list(2, thriftStruct, len(columns)+1)
+	t.beginStruct()
+	t.str(4, "schema")
+	t.i32(5, int32(len(columns)))
+	t.endStruct()
+	for _, c := range columns {
+		t.beginStruct()
+		t.i32(1, c.physical)
+		if c.optional {
+			t.i32(3, 1)
+		} else {
+			t.i32(3, 0)
+		}
+		t.str(4, c.name)
+		if c.converted >= 0 {
+			t.i32(6, c.converted)
+		}
+		t.endStruct()
+	}
+
+	t.i64(3, int64(rows))
+
+	t.list(4, thriftStruct, len(groups))
+	for _, group := range groups {
+		t.beginStruct()
+		t.list(1, thriftStruct, len(group))
+		var total int64
+		for _, ch := range group {
+			total += ch.uncompressedSize
+			t.beginStruct()
+			t.i64(2, ch.offset)
+			t.structField(3)
+			t.i32(1, ch.column.physical)
+			t.list(2, thriftI32, 2)
+			t.zigzag(encodingPlain)
+			t.zigzag(encodingRLE)
+			t.list(3, thriftBinary, 1)
+			t.varint(uint64(len(ch.column.name)))
+			t.buf.WriteString(ch.column.name)
+			t.i32(4, codecGzip)
+			t.i64(5, int64(ch.numValues))
+			t.i64(6, ch.uncompressedSize)
+			t.i64(7, ch.compressedSize)
+			t.i64(9, ch.offset)
+			t.endStruct()
+			t.endStruct()
+		}
+		t.i64(2, total)
+		t.i64(3, int64(group[0].numValues))
+		t.endStruct()
+	}
+
+	t.str(6, "golang-strava-api")
+	t.endStruct()
+	return t.buf.Bytes()
+}
@@ -0,0 +1,334 @@
+package parquet_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/parquet"
+)
+
+// a thrift compact protocol reader written from the spec rather than from the
+// writer, so the two do not share mistakes. Structs read as field id to value,
+// integers as int64, binary as string and lists as []interface{}
+type thriftReader struct {
+	r *bytes.Reader
+}
+
+func (t thriftReader) varint() uint64 {
+	v, err := binary.ReadUvarint(t.r)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func (t thriftReader) zigzag() int64 {
+	v := t.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (t thriftReader) value(kind byte) interface{} {
+	switch kind {
+	case 1, 2: // boolean true and false, in the field header
+		return kind == 1
+	case 5, 6:
+		return t.zigzag()
+	case 8:
+		b := make([]byte, t.varint())
+		if _, err := io.ReadFull(t.r, b); err != nil {
+			panic(err)
+		}
+		return string(b)
+	case 9:
+		header, _ := t.r.ReadByte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(t.varint())
+		}
+		list := []interface{}{}
+		for i := 0; i < size; i++ {
+			list = append(list, t.value(header&0x0f))
+		}
+		return list
+	case 12:
+		return t.structure()
+	}
+	panic(fmt.Sprintf("thrift type %d", kind))
+}
+
+func (t thriftReader) structure() map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var id int16
+	for {
+		header, err := t.r.ReadByte()
+		if err != nil {
+			panic(err)
+		}
+		if header == 0 {
+			return fields
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(t.zigzag())
+		}
+		fields[id] = t.value(header & 0x0f)
+	}
+}
+
+func readStruct(data []byte) (fields map[int16]interface{}, size int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("thrift: %v", r)
+		}
+	}()
+	t := thriftReader{bytes.NewReader(data)}
+	fields = t.structure()
+	return fields, len(data) - t.r.Len(), nil
+}
+
+// a column read back: its schema element and every value, nil where null
+type readColumn struct {
+	name      string
+	physical  int64
+	required  bool
+	converted int64 // -1 for none
+	values    []interface{}
+}
+
+func readFile(t *testing.T, file []byte) (rows int64, groups int, columns []readColumn) {
+	t.Helper()
+	if len(file) < 12 || string(file[:4]) != "PAR1" || string(file[len(file)-4:]) != "PAR1" {
+		t.Fatal("not framed by PAR1")
+	}
+	footerLength := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	if footerLength <= 0 || footerLength > len(file)-12 {
+		t.Fatalf("footer length %d in a file of %d bytes", footerLength, len(file))
+	}
+	footer := file[len(file)-8-footerLength : len(file)-8]
+	meta, size, err := readStruct(footer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != footerLength {
+		t.Fatalf("footer metadata is %d bytes, the length says %d", size, footerLength)
+	}
+	if meta[1] != int64(1) {
+		t.Errorf("version %v", meta[1])
+	}
+
+	schema := meta[2].([]interface{})
+	root := schema[0].(map[int16]interface{})
+	if root[5] != int64(len(schema)-1) {
+		t.Errorf("schema root has %v children, %d columns follow", root[5], len(schema)-1)
+	}
+	for _, element := range schema[1:] {
+		e := element.(map[int16]interface{})
+		c := readColumn{name: e[4].(string), physical: e[1].(int64), required: e[3] == int64(0), converted: -1}
+		if converted, ok := e[6]; ok {
+			c.converted = converted.(int64)
+		}
+		columns = append(columns, c)
+	}
+
+	rows = meta[3].(int64)
+	var groupRows int64
+	for _, g := range meta[4].([]interface{}) {
+		group := g.(map[int16]interface{})
+		groupRows += group[3].(int64)
+		chunks := group[1].([]interface{})
+		if len(chunks) != len(columns) {
+			t.Fatalf("row group of %d chunks for %d columns", len(chunks), len(columns))
+		}
+		for i, ch := range chunks {
+			chunkMeta := ch.(map[int16]interface{})[3].(map[int16]interface{})
+			path := chunkMeta[3].([]interface{})
+			if len(path) != 1 || path[0] != columns[i].name || chunkMeta[1] != columns[i].physical {
+				t.Errorf("chunk %v of type %v in the place of column %s", path, chunkMeta[1], columns[i].name)
+			}
+			values := readPage(t, file, chunkMeta, &columns[i])
+			if int64(len(values)) != group[3].(int64) || chunkMeta[5] != int64(len(values)) {
+				t.Errorf("column %s: %d values in a row group of %v", columns[i].name, len(values), group[3])
+			}
+			columns[i].values = append(columns[i].values, values...)
+		}
+		groups++
+	}
+	if groupRows != rows {
+		t.Errorf("row groups hold %d rows, the file says %d", groupRows, rows)
+	}
+	return rows, groups, columns
+}
+
+// the values of the single gzipped data page of a column chunk
+func readPage(t *testing.T, file []byte, chunkMeta map[int16]interface{}, c *readColumn) []interface{} {
+	t.Helper()
+	offset := chunkMeta[9].(int64)
+	header, size, err := readStruct(file[offset:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := file[offset+int64(size) : offset+int64(size)+header[3].(int64)]
+	if int64(size)+header[3].(int64) != chunkMeta[7].(int64) {
+		t.Errorf("column %s: chunk of %d bytes, %v in its metadata", c.name, int64(size)+header[3].(int64), chunkMeta[7])
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(page)) != header[2].(int64) {
+		t.Errorf("column %s: page of %d bytes, the header says %v", c.name, len(page), header[2])
+	}
+
+	count := int(header[5].(map[int16]interface{})[1].(int64))
+	r := bytes.NewReader(page)
+	defined := make([]bool, count)
+	for i := range defined {
+		defined[i] = true
+	}
+	if !c.required {
+		definitionLevels(t, r, defined)
+	}
+
+	values := make([]interface{}, count)
+	var bits byte
+	var bit int
+	for i := range values {
+		if !defined[i] {
+			continue
+		}
+		switch c.physical {
+		case 0:
+			if bit%8 == 0 {
+				bits, _ = r.ReadByte()
+			}
+			values[i] = bits&(1<<(bit%8)) != 0
+			bit++
+		case 2:
+			var v int64
+			binary.Read(r, binary.LittleEndian, &v)
+			values[i] = v
+		case 5:
+			var v uint64
+			binary.Read(r, binary.LittleEndian, &v)
+			values[i] = math.Float64frombits(v)
+		case 6:
+			var n uint32
+			binary.Read(r, binary.LittleEndian, &n)
+			b := make([]byte, n)
+			io.ReadFull(r, b)
+			values[i] = string(b)
+		}
+	}
+	if r.Len() != 0 {
+		t.Errorf("column %s: %d bytes left over in the page", c.name, r.Len())
+	}
+	return values
+}
+
+// the RLE/bit packed hybrid levels of bit width 1 before the values of an optional column
+func definitionLevels(t *testing.T, r *bytes.Reader, defined []bool) {
+	var length uint32
+	binary.Read(r, binary.LittleEndian, &length)
+	levels := make([]byte, length)
+	io.ReadFull(r, levels)
+	lr := bytes.NewReader(levels)
+	for i := 0; i < len(defined); {
+		header, err := binary.ReadUvarint(lr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header&1 == 1 { // bit packed groups of 8
+			for g := 0; g < int(header>>1); g++ {
+				b, _ := lr.ReadByte()
+				for j := 0; j < 8 && i < len(defined); j++ {
+					defined[i] = b&(1<<j) != 0
+					i++
+				}
+			}
+			continue
+		}
+		level, _ := lr.ReadByte()
+		for n := 0; n < int(header>>1) && i < len(defined); n++ {
+			defined[i] = level == 1
+			i++
+		}
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	defer func(size int) { parquet.RowGroupSize = size }(parquet.RowGroupSize)
+	parquet.RowGroupSize = 2
+
+	elevation := 12.5
+	commute := true
+	kudos := int64(3)
+	start := time.Date(2026, 10, 1, 7, 30, 0, 0, time.UTC)
+	columns := []parquet.Column{
+		parquet.Int64("id", []int64{1, 2, 3, 4, 5}),
+		parquet.Float64("distance", []float64{1000, 2500.5, 0, -1, 42195}),
+		parquet.Bool("trainer", []bool{true, false, false, true, true}),
+		parquet.String("name", []string{"Morning Run", "", "Ride", "", "Marathon"}),
+		parquet.Timestamp("start_date", []time.Time{start, {}, start.Add(time.Hour), start, {}}),
+		parquet.OptionalInt64("kudos", []*int64{nil, &kudos, nil, nil, &kudos}),
+		parquet.OptionalFloat64("elevation", []*float64{&elevation, nil, nil, &elevation, nil}),
+		parquet.OptionalBool("commute", []*bool{nil, nil, &commute, nil, nil}),
+	}
+	var file bytes.Buffer
+	if err := parquet.Write(&file, columns); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, groups, read := readFile(t, file.Bytes())
+	if rows != 5 || groups != 3 {
+		t.Errorf("%d rows in %d row groups, want 5 in 3", rows, groups)
+	}
+	millis := start.UnixMilli()
+	want := []readColumn{
+		{"id", 2, true, -1, []interface{}{int64(1), int64(2), int64(3), int64(4), int64(5)}},
+		{"distance", 5, true, -1, []interface{}{1000.0, 2500.5, 0.0, -1.0, 42195.0}},
+		{"trainer", 0, true, -1, []interface{}{true, false, false, true, true}},
+		{"name", 6, false, 0, []interface{}{"Morning Run", nil, "Ride", nil, "Marathon"}},
+		{"start_date", 2, false, 9, []interface{}{millis, nil, millis + 3600000, millis, nil}},
+		{"kudos", 2, false, -1, []interface{}{nil, kudos, nil, nil, kudos}},
+		{"elevation", 5, false, -1, []interface{}{elevation, nil, nil, elevation, nil}},
+		{"commute", 0, false, -1, []interface{}{nil, nil, true, nil, nil}},
+	}
+	if !reflect.DeepEqual(read, want) {
+		t.Errorf("read back\n%v\nwant\n%v", read, want)
+	}
+}
+
+func TestWriteEmpty(t *testing.T) {
+	var file bytes.Buffer
+	if err := parquet.Write(&file, []parquet.Column{parquet.Int64("id", nil)}); err != nil {
+		t.Fatal(err)
+	}
+	if rows, groups, read := readFile(t, file.Bytes()); rows != 0 || groups != 1 || len(read) != 1 || len(read[0].values) != 0 {
+		t.Errorf("%d rows in %d row groups of %v, want one empty row group", rows, groups, read)
+	}
+}
+
+func TestWriteRejects(t *testing.T) {
+	cases := map[string][]parquet.Column{
+		"no columns":         nil,
+		"unequal lengths":    {parquet.Int64("id", []int64{1, 2}), parquet.Bool("trainer", []bool{true})},
+		"a shorter optional": {parquet.Int64("id", []int64{1, 2}), parquet.OptionalInt64("kudos", []*int64{nil})},
+	}
+	for name, columns := range cases {
+		if err := parquet.Write(io.Discard, columns); err == nil {
+			t.Errorf("%s: written", name)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/geo"
+)
+
+const (
+	cardWidth  = 600
+	cardHeight = 315
+)
+
+type ActivityCard struct {
+	Name       string
+	SportType  string
+	Start      time.Time // shown as given, pass the activity's local time
+	Route      []geo.Point
+	Distance   float64 // meters
+	MovingTime int     // seconds
+	Elevation  float64 // meters
+	Units      Units
+	Accent     color.RGBA
+}
+
+type WeeklyCard struct {
+	Title  string
+	Week   analysis.WeekSummary
+	Units  Units
+	Accent color.RGBA
+}
+
+type stat struct {
+	Label string
+	Value string
+}
+
+type bar struct {
+	X, Y, Width, Height float64
+	Label               string
+	Empty               bool
+}
+
+var cardFuncs = template.FuncMap{"xml": xmlEscape}
+
+var activityCardTemplate = template.Must(template.New("activity").Funcs(cardFuncs).Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}" font-family="Helvetica, Arial, sans-serif">
+  <rect width="100%" height="100%" rx="16" fill="#ffffff" stroke="#e5e5e5"/>
+  <rect x="20" y="20" width="260" height="275" rx="10" fill="#f5f5f5"/>
+  {{if .Path}}<path d="{{.Path}}" fill="none" stroke="{{.Accent}}" stroke-width="4" stroke-linecap="round" stroke-linejoin="round"/>{{end}}
+  <text x="310" y="60" font-size="24" font-weight="bold" fill="#222">{{xml .Name}}</text>
+  <text x="310" y="88" font-size="15" fill="#777">{{xml .Subtitle}}</text>
+  {{range $i, $s := .Stats}}<text x="310" y="{{index $.StatY $i}}" font-size="13" fill="#777">{{xml $s.Label}}</text>
+  <text x="310" y="{{index $.ValueY $i}}" font-size="26" font-weight="bold" fill="{{$.Accent}}">{{xml $s.Value}}</text>
+  {{end}}
+</svg>
+`))
+
+var weeklyCardTemplate = template.Must(template.New("weekly").Funcs(cardFuncs).Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}" font-family="Helvetica, Arial, sans-serif">
+  <rect width="100%" height="100%" rx="16" fill="#ffffff" stroke="#e5e5e5"/>
+  <text x="30" y="50" font-size="24" font-weight="bold" fill="#222">{{xml .Title}}</text>
+  <text x="30" y="76" font-size="15" fill="#777">{{xml .Subtitle}}</text>
+  {{range $i, $s := .Stats}}<text x="{{index $.StatX $i}}" y="112" font-size="13" fill="#777">{{xml $s.Label}}</text>
+  <text x="{{index $.StatX $i}}" y="140" font-size="24" font-weight="bold" fill="{{$.Accent}}">{{xml $s.Value}}</text>
+  {{end}}
+  {{range .Bars}}<rect x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}" rx="2" fill="{{if .Empty}}#e5e5e5{{else}}{{$.Accent}}{{end}}"/>
+  <text x="{{.X}}" y="298" dx="{{$.BarMid}}" font-size="13" text-anchor="middle" fill="#777">{{.Label}}</text>
+  {{end}}
+</svg>
+`))
+
+func xmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;").Replace(s)
+}
+
+// about what fits beside the route at the title's size
+const maxTitleRunes = 22
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return strings.TrimSpace(string(runes[:max-1])) + "…"
+}
+
+func cssColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// the route projected into the card's map area, keeping its proportions
+func routePath(points []geo.Point, x, y, width, height float64) string {
+	if len(points) < 2 {
+		return ""
+	}
+	xs := make([]float64, len(points))
+	ys := make([]float64, len(points))
+	for i, p := range points {
+		xs[i], ys[i] = project(p)
+	}
+	minX, maxX := span(xs)
+	minY, maxY := span(ys)
+	scale := math.Min(width/math.Max(maxX-minX, 1e-9), height/math.Max(maxY-minY, 1e-9))
+	offsetX := x + (width-(maxX-minX)*scale)/2
+	offsetY := y + (height-(maxY-minY)*scale)/2
+
+	var path strings.Builder
+	for i := range points {
+		command := "L"
+		if i == 0 {
+			command = "M"
+		}
+		fmt.Fprintf(&path, "%s%g,%g ", command, round1(offsetX+(xs[i]-minX)*scale), round1(offsetY+(ys[i]-minY)*scale))
+	}
+	return strings.TrimSpace(path.String())
+}
+
+func (card ActivityCard) SVG() ([]byte, error) {
+	subtitle := card.Start.Format("Jan 2, 2006")
+	if card.SportType != "" {
+		subtitle += " · " + card.SportType
+	}
+
+	var buf bytes.Buffer
+	err := activityCardTemplate.Execute(&buf, map[string]interface{}{
+		"Width":    cardWidth,
+		"Height":   cardHeight,
+		"Accent":   cssColor(card.Accent),
+		"Path":     routePath(card.Route, 40, 40, 220, 235),
+		"Name":     truncate(card.Name, maxTitleRunes),
+		"Subtitle": subtitle,
+		"Stats": []stat{
+			{"Distance", formatDistance(card.Distance, card.Units)},
+			{"Moving time", formatDuration(card.MovingTime)},
+			{"Elevation", formatElevation(card.Elevation, card.Units)},
+		},
+		"StatY":  []int{135, 200, 265},
+		"ValueY": []int{165, 230, 295},
+	})
+	return buf.Bytes(), err
+}
+
+func (card WeeklyCard) SVG() ([]byte, error) {
+	const chartTop, chartBottom, barWidth, gap = 165.0, 278.0, 56.0, 20.0
+
+	most := 0.0
+	for _, day := range card.Week.Days {
+		most = math.Max(most, day.Distance)
+	}
+	var bars []bar
+	for i, day := range card.Week.Days {
+		height := 2.0 // an empty day still shows a baseline
+		if most > 0 {
+			height = math.Max(height, (chartBottom-chartTop)*day.Distance/most)
+		}
+		bars = append(bars, bar{
+			X:      30 + float64(i)*(barWidth+gap),
+			Y:      round1(chartBottom - height),
+			Width:  barWidth,
+			Height: round1(height),
+			Label:  card.Week.Start.AddDate(0, 0, i).Format("Mon"),
+			Empty:  day.Count == 0,
+		})
+	}
+
+	activities := fmt.Sprintf("%d activities", card.Week.Count)
+	if card.Week.Count == 1 {
+		activities = "1 activity"
+	}
+
+	var buf bytes.Buffer
+	err := weeklyCardTemplate.Execute(&buf, map[string]interface{}{
+		"Width":    cardWidth,
+		"Height":   cardHeight,
+		"Accent":   cssColor(card.Accent),
+		"Title":    card.Title,
+		"Subtitle": "Week of " + card.Week.Start.Format("Jan 2, 2006") + " · " + activities,
+		"Stats": []stat{
+			{"Distance", formatDistance(card.Week.Distance, card.Units)},
+			{"Moving time", formatDuration(card.Week.MovingTime)},
+			{"Elevation", formatElevation(card.Week.Elevation, card.Units)},
+		},
+		"StatX":  []int{30, 220, 410},
+		"Bars":   bars,
+		"BarMid": barWidth / 2,
+	})
+	return buf.Bytes(), err
+}
@@ -0,0 +1,76 @@
+package render
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+)
+
+type Units string
+
+const (
+	Imperial Units = "imperial"
+	Metric   Units = "metric"
+)
+
+func ParseUnits(s string) (Units, error) {
+	switch Units(s) {
+	case Imperial, Metric:
+		return Units(s), nil
+	}
+	return "", fmt.Errorf("units must be imperial or metric")
+}
+
+func formatDistance(meters float64, units Units) string {
+	if units == Metric {
+		return fmt.Sprintf("%.1f km", meters/1000)
+	}
+	return fmt.Sprintf("%.1f mi", meters*0.000621371)
+}
+
+func formatElevation(meters float64, units Units) string {
+	if units == Metric {
+		return fmt.Sprintf("%.0f m", meters)
+	}
+	return fmt.Sprintf("%.0f ft", meters*3.28084)
+}
+
+// h:mm:ss, or m:ss under an hour
+func formatDuration(seconds int) string {
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// a year of moving time reads better in whole hours than as h:mm:ss
+func formatHours(seconds int) string {
+	return strconv.Itoa(int(math.Round(float64(seconds)/3600))) + " h"
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// periods as shown under a report's chart, e.g. "Injury · Oct 2 – Oct 9"
+func periodLabels(periods []analysis.Period) []string {
+	var labels []string
+	for _, p := range periods {
+		start, err := time.Parse("2006-01-02", p.Start)
+		if err != nil || p.Type == "" {
+			continue
+		}
+		label := strings.ToUpper(p.Type[:1]) + p.Type[1:] + " · "
+		if end, err := time.Parse("2006-01-02", p.End); err == nil {
+			label += start.Format("Jan 2") + " – " + end.Format("Jan 2")
+		} else {
+			label += "since " + start.Format("Jan 2")
+		}
+		labels = append(labels, label)
+	}
+	return labels
+}
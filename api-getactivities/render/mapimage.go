@@ -0,0 +1,221 @@
+// Package render draws activity routes and summaries as images for embedding.
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg" // tile servers answer with png or jpeg
+	_ "image/png"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/geo"
+)
+
+const tileSize = 256
+
+const maxZoom = 18
+
+type MapOptions struct {
+	Width   int
+	Height  int
+	Color   color.RGBA
+	Weight  float64 // line width in pixels
+	Padding int     // kept clear around the route
+
+	// TileURL is a template such as https://tile.openstreetmap.org/{z}/{x}/{y}.png,
+	// the route is drawn on a transparent background when empty
+	TileURL    string
+	TileClient *http.Client
+}
+
+// ParseColor reads rrggbb or rrggbbaa hex, with or without a leading #
+func ParseColor(hex string) (color.RGBA, error) {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || err != nil {
+		return color.RGBA{}, fmt.Errorf("color %q is not rrggbb hex", hex)
+	}
+	return color.RGBA{R: uint8(value >> 24), G: uint8(value >> 16), B: uint8(value >> 8), A: uint8(value)}, nil
+}
+
+// web mercator position at zoom 0, where the whole world is one tile
+func project(p geo.Point) (float64, float64) {
+	lat := math.Max(-85.05112878, math.Min(85.05112878, p.Lat)) * math.Pi / 180
+	x := (p.Lng + 180) / 360 * tileSize
+	y := (1 - math.Log(math.Tan(lat)+1/math.Cos(lat))/math.Pi) / 2 * tileSize
+	return x, y
+}
+
+// MapImage draws the route centered and scaled to fit; over tiles the scale
+// snaps to a tile zoom level, and tiles that fail to load are left transparent
+// and counted in missing
+func MapImage(points []geo.Point, opts MapOptions) (img *image.RGBA, missing int, err error) {
+	return RoutesImage([][]geo.Point{points}, opts)
+}
+
+// RoutesImage is MapImage for several routes fitted together, each drawn
+// over the others so often used roads stand out with a translucent color
+func RoutesImage(routes [][]geo.Point, opts MapOptions) (img *image.RGBA, missing int, err error) {
+	var xs, ys []float64
+	projected := make([][][2]float64, len(routes))
+	for r, points := range routes {
+		projected[r] = make([][2]float64, len(points))
+		for i, p := range points {
+			x, y := project(p)
+			projected[r][i] = [2]float64{x, y}
+			xs, ys = append(xs, x), append(ys, y)
+		}
+	}
+	if len(xs) == 0 {
+		return nil, 0, fmt.Errorf("route has no points")
+	}
+	minX, maxX := span(xs)
+	minY, maxY := span(ys)
+
+	usableW := float64(opts.Width - 2*opts.Padding)
+	usableH := float64(opts.Height - 2*opts.Padding)
+	scale := math.Min(usableW/math.Max(maxX-minX, 1e-9), usableH/math.Max(maxY-minY, 1e-9))
+	zoom := math.Min(math.Floor(math.Log2(scale)), maxZoom)
+	if opts.TileURL != "" || scale > math.Exp2(maxZoom) {
+		scale = math.Exp2(math.Max(zoom, 0))
+	}
+
+	// world pixel at the top left corner of the image
+	originX := (minX+maxX)/2*scale - float64(opts.Width)/2
+	originY := (minY+maxY)/2*scale - float64(opts.Height)/2
+
+	img = image.NewRGBA(image.Rect(0, 0, opts.Width, opts.Height))
+	if opts.TileURL != "" {
+		missing = drawTiles(img, opts, int(math.Max(zoom, 0)), originX, originY)
+	}
+
+	for _, points := range projected {
+		route := make([][2]float64, len(points))
+		for i, p := range points {
+			route[i] = [2]float64{p[0]*scale - originX, p[1]*scale - originY}
+		}
+		drawLine(img, route, opts.Weight, opts.Color)
+	}
+	return img, missing, nil
+}
+
+func span(values []float64) (float64, float64) {
+	lo, hi := values[0], values[0]
+	for _, v := range values[1:] {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+	return lo, hi
+}
+
+func drawTiles(img *image.RGBA, opts MapOptions, zoom int, originX, originY float64) int {
+	client := opts.TileClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	tiles := 1 << zoom
+	missing := 0
+
+	for ty := int(math.Floor(originY / tileSize)); float64(ty*tileSize) < originY+float64(opts.Height); ty++ {
+		if ty < 0 || ty >= tiles {
+			continue
+		}
+		for tx := int(math.Floor(originX / tileSize)); float64(tx*tileSize) < originX+float64(opts.Width); tx++ {
+			tile, err := fetchTile(client, opts.TileURL, zoom, ((tx%tiles)+tiles)%tiles, ty)
+			if err != nil {
+				fmt.Println(err)
+				missing++
+				continue
+			}
+			at := image.Pt(int(math.Round(float64(tx*tileSize)-originX)), int(math.Round(float64(ty*tileSize)-originY)))
+			draw.Draw(img, tile.Bounds().Sub(tile.Bounds().Min).Add(at), tile, tile.Bounds().Min, draw.Src)
+		}
+	}
+	return missing
+}
+
+func fetchTile(client *http.Client, template string, z, x, y int) (image.Image, error) {
+	u := strings.NewReplacer("{z}", strconv.Itoa(z), "{x}", strconv.Itoa(x), "{y}", strconv.Itoa(y)).Replace(template)
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	// public tile servers refuse requests without an identifying agent
+	req.Header.Set("User-Agent", "golang-strava-api/1.0")
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tile %s: %s", u, res.Status)
+	}
+	tile, _, err := image.Decode(res.Body)
+	return tile, err
+}
+
+// an anti-aliased polyline; coverage is collected first so joints between
+// segments are not blended twice
+func drawLine(img *image.RGBA, route [][2]float64, weight float64, c color.RGBA) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	coverage := make([]float32, w*h)
+	radius := weight / 2
+
+	for i := range route {
+		a, b := route[i], route[i]
+		if i > 0 {
+			a = route[i-1]
+		}
+		x0 := int(math.Max(0, math.Floor(math.Min(a[0], b[0])-radius-1)))
+		x1 := int(math.Min(float64(w-1), math.Ceil(math.Max(a[0], b[0])+radius+1)))
+		y0 := int(math.Max(0, math.Floor(math.Min(a[1], b[1])-radius-1)))
+		y1 := int(math.Min(float64(h-1), math.Ceil(math.Max(a[1], b[1])+radius+1)))
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				d := segmentDistance(float64(x)+0.5, float64(y)+0.5, a, b)
+				cover := float32(math.Max(0, math.Min(1, radius-d+0.5)))
+				if cover > coverage[y*w+x] {
+					coverage[y*w+x] = cover
+				}
+			}
+		}
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			cover := coverage[y*w+x]
+			if cover == 0 {
+				continue
+			}
+			alpha := float64(cover) * float64(c.A) / 255
+			under := img.RGBAAt(x, y)
+			blend := func(top, bottom uint8) uint8 {
+				return uint8(math.Round(float64(top)*alpha + float64(bottom)*(1-alpha)))
+			}
+			// image.RGBA is alpha premultiplied, this is the source over operator
+			img.SetRGBA(x, y, color.RGBA{
+				R: blend(c.R, under.R),
+				G: blend(c.G, under.G),
+				B: blend(c.B, under.B),
+				A: uint8(math.Round(255*alpha + float64(under.A)*(1-alpha))),
+			})
+		}
+	}
+}
+
+func segmentDistance(px, py float64, a, b [2]float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	t := 0.0
+	if length := dx*dx + dy*dy; length > 0 {
+		t = math.Max(0, math.Min(1, ((px-a[0])*dx+(py-a[1])*dy)/length))
+	}
+	ex, ey := px-(a[0]+t*dx), py-(a[1]+t*dy)
+	return math.Hypot(ex, ey)
+}
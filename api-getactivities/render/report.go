@@ -0,0 +1,177 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"image/color"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+)
+
+// WeeklyReport is the weekly summary sent by email, so like the widgets
+// every style is inline and the chart is inline SVG rather than an image
+type WeeklyReport struct {
+	Title      string
+	Week       analysis.WeekSummary
+	Previous   analysis.Totals // the week before, for the change in each total
+	Activities []ReportActivity
+	Periods    []analysis.Period // shown under the chart
+	Units      Units
+	Accent     color.RGBA
+}
+
+type ReportActivity struct {
+	Name       string
+	SportType  string
+	Start      time.Time // shown as given, pass the activity's local time
+	Distance   float64   // meters
+	MovingTime int       // seconds
+	PrCount    int
+}
+
+type reportStat struct {
+	Label  string
+	Value  string
+	Change string
+}
+
+type reportRow struct {
+	Day, Name, SportType, Distance, Time string
+	PrCount                              int
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>{{.Title}}</title></head>
+<body style="margin:0;padding:24px 12px;font-family:Helvetica,Arial,sans-serif;color:#222;background:#f5f5f5">
+<table role="presentation" width="100%" cellpadding="0" cellspacing="0" style="max-width:600px;margin:0 auto;background:#fff;border:1px solid #e5e5e5;border-radius:12px">
+<tr><td style="padding:24px 24px 8px">
+<div style="font-size:13px;color:#777">{{.Subtitle}}</div>
+<div style="font-size:22px;font-weight:bold">{{.Title}}</div>
+</td></tr>
+<tr><td style="padding:8px 24px">
+<table role="presentation" width="100%" cellpadding="0" cellspacing="0"><tr>
+{{range .Stats}}<td style="vertical-align:top;padding:8px 0"><div style="font-size:12px;color:#777">{{.Label}}</div><div style="font-size:20px;font-weight:bold;color:{{$.Accent}}">{{.Value}}</div><div style="font-size:11px;color:#777">{{.Change}}</div></td>
+{{end}}</tr></table>
+</td></tr>
+<tr><td style="padding:8px 24px">{{.Chart}}</td></tr>
+{{range .Periods}}<tr><td style="padding:2px 24px;font-size:13px;color:#777">{{.}}</td></tr>
+{{end}}{{if .Records}}<tr><td style="padding:8px 24px">
+<div style="font-size:15px;font-weight:bold;margin-bottom:6px">Personal records</div>
+{{range .Records}}<div style="font-size:14px;padding:3px 0">{{.Name}} <span style="color:#777">· {{.Day}} · {{.PrCount}} PR{{if gt .PrCount 1}}s{{end}}</span></div>
+{{end}}</td></tr>{{end}}
+<tr><td style="padding:8px 24px 24px">
+<div style="font-size:15px;font-weight:bold;margin-bottom:6px">Activities</div>
+{{if .Rows}}<table role="presentation" width="100%" cellpadding="0" cellspacing="0" style="font-size:13px">
+{{range .Rows}}<tr><td style="padding:5px 0;border-top:1px solid #eee;color:#777;white-space:nowrap">{{.Day}}</td><td style="padding:5px 8px;border-top:1px solid #eee">{{.Name}}<div style="font-size:11px;color:#777">{{.SportType}}</div></td><td style="padding:5px 0;border-top:1px solid #eee;text-align:right;white-space:nowrap">{{.Distance}}<div style="font-size:11px;color:#777">{{.Time}}</div></td></tr>
+{{end}}</table>{{else}}<div style="font-size:13px;color:#777">No activities this week.</div>{{end}}
+</td></tr>
+</table>
+</body></html>
+`))
+
+var reportChartTemplate = template.Must(template.New("chart").Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}" font-family="Helvetica, Arial, sans-serif" role="img" aria-label="Distance by day">
+{{range .Bars}}<rect x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}" rx="2" fill="{{if .Empty}}#e5e5e5{{else}}{{$.Accent}}{{end}}"/>
+<text x="{{.X}}" y="{{$.LabelY}}" dx="{{$.BarMid}}" font-size="12" text-anchor="middle" fill="#777">{{.Label}}</text>
+{{end}}</svg>`))
+
+// the change from last week, left out when there is nothing to compare with
+func weekChange(current, previous float64) string {
+	if previous == 0 {
+		return ""
+	}
+	percent := math.Round((current - previous) / previous * 100)
+	if percent > 0 {
+		return fmt.Sprintf("+%.0f%% vs last week", percent)
+	}
+	return fmt.Sprintf("%.0f%% vs last week", percent)
+}
+
+// daily distance as bars, the same chart as the weekly card without its text
+func (report WeeklyReport) chart() (template.HTML, error) {
+	const width, chartHeight, barWidth, gap = 552.0, 110.0, 60.0, 22.0
+
+	most := 0.0
+	for _, day := range report.Week.Days {
+		most = math.Max(most, day.Distance)
+	}
+	var bars []bar
+	for i, day := range report.Week.Days {
+		height := 2.0
+		if most > 0 {
+			height = math.Max(height, chartHeight*day.Distance/most)
+		}
+		bars = append(bars, bar{
+			X:      float64(i) * (barWidth + gap),
+			Y:      round1(chartHeight - height),
+			Width:  barWidth,
+			Height: round1(height),
+			Label:  report.Week.Start.AddDate(0, 0, i).Format("Mon"),
+			Empty:  day.Count == 0,
+		})
+	}
+
+	var buf bytes.Buffer
+	err := reportChartTemplate.Execute(&buf, map[string]interface{}{
+		"Width":  width,
+		"Height": chartHeight + 22,
+		"LabelY": chartHeight + 18,
+		"BarMid": barWidth / 2,
+		"Accent": template.CSS(cssColor(report.Accent)),
+		"Bars":   bars,
+	})
+	// the template escaped everything it was given
+	return template.HTML(buf.String()), err
+}
+
+// Subject is the email subject, naming the week
+func (report WeeklyReport) Subject() string {
+	return report.Title + ", week of " + report.Week.Start.Format("Jan 2")
+}
+
+func (report WeeklyReport) HTML() ([]byte, error) {
+	chart, err := report.chart()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows, records []reportRow
+	for _, a := range report.Activities {
+		row := reportRow{
+			Day:       a.Start.Format("Mon Jan 2"),
+			Name:      a.Name,
+			SportType: a.SportType,
+			Distance:  formatDistance(a.Distance, report.Units),
+			Time:      formatDuration(a.MovingTime),
+			PrCount:   a.PrCount,
+		}
+		rows = append(rows, row)
+		if a.PrCount > 0 {
+			records = append(records, row)
+		}
+	}
+
+	end := report.Week.Start.AddDate(0, 0, 6)
+	week, previous := report.Week.Totals, report.Previous
+
+	var buf bytes.Buffer
+	err = reportTemplate.Execute(&buf, map[string]interface{}{
+		"Title":    report.Title,
+		"Subtitle": report.Week.Start.Format("Jan 2") + " – " + end.Format("Jan 2, 2006"),
+		"Accent":   template.CSS(cssColor(report.Accent)),
+		"Stats": []reportStat{
+			{"Activities", strconv.Itoa(week.Count), weekChange(float64(week.Count), float64(previous.Count))},
+			{"Distance", formatDistance(week.Distance, report.Units), weekChange(week.Distance, previous.Distance)},
+			{"Moving time", formatDuration(week.MovingTime), weekChange(float64(week.MovingTime), float64(previous.MovingTime))},
+			{"Elevation", formatElevation(week.Elevation, report.Units), weekChange(week.Elevation, previous.Elevation)},
+		},
+		"Chart":   chart,
+		"Periods": periodLabels(report.Periods),
+		"Records": records,
+		"Rows":    rows,
+	})
+	return buf.Bytes(), err
+}
@@ -0,0 +1,47 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Thumbnail scales img down to fit within width by height, keeping its aspect
+// ratio; a zero side does not limit it. Each pixel averages the ones of img it
+// covers, and an image already small enough keeps its size
+func Thumbnail(img image.Image, width, height int) *image.RGBA {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if sw == 0 || sh == 0 {
+		return image.NewRGBA(image.Rect(0, 0, 0, 0))
+	}
+
+	scale := 1.0
+	if width > 0 {
+		scale = math.Min(scale, float64(width)/float64(sw))
+	}
+	if height > 0 {
+		scale = math.Min(scale, float64(height)/float64(sh))
+	}
+	dw := int(math.Max(1, math.Round(float64(sw)*scale)))
+	dh := int(math.Max(1, math.Round(float64(sh)*scale)))
+
+	thumb := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := b.Min.Y+y*sh/dh, b.Min.Y+(y+1)*sh/dh
+		for x := 0; x < dw; x++ {
+			x0, x1 := b.Min.X+x*sw/dw, b.Min.X+(x+1)*sw/dw
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(pr), g+uint64(pg), bl+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			thumb.SetRGBA(x, y, color.RGBA{uint8(r / n >> 8), uint8(g / n >> 8), uint8(bl / n >> 8), uint8(a / n >> 8)})
+		}
+	}
+	return thumb
+}
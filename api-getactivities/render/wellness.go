@@ -0,0 +1,124 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+	"text/template"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+)
+
+// WellnessChart draws fitness and fatigue as lines and one wellness reading
+// as dots on its own scale, the days from first to last
+type WellnessChart struct {
+	Days   []analysis.WellnessDay
+	Metric string // one of analysis.WellnessMetrics
+	Accent color.RGBA
+}
+
+type dot struct {
+	X, Y float64
+}
+
+var wellnessChartTemplate = template.Must(template.New("wellness").Funcs(cardFuncs).Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}" font-family="Helvetica, Arial, sans-serif" role="img" aria-label="{{xml .Title}}">
+  <rect width="100%" height="100%" rx="16" fill="#ffffff" stroke="#e5e5e5"/>
+  <text x="30" y="44" font-size="20" font-weight="bold" fill="#222">{{xml .Title}}</text>
+  <text x="30" y="66" font-size="13" fill="{{.Accent}}">Fitness {{.Fitness}}</text>
+  <text x="150" y="66" font-size="13" fill="#999">Fatigue {{.Fatigue}}</text>
+  <text x="270" y="66" font-size="13" fill="#3b82f6">{{xml .Metric}} {{.Range}}</text>
+  <line x1="{{.Left}}" y1="{{.Bottom}}" x2="{{.Right}}" y2="{{.Bottom}}" stroke="#e5e5e5"/>
+  {{if .FatiguePath}}<path d="{{.FatiguePath}}" fill="none" stroke="#999" stroke-width="2" stroke-linejoin="round"/>{{end}}
+  {{if .FitnessPath}}<path d="{{.FitnessPath}}" fill="none" stroke="{{.Accent}}" stroke-width="3" stroke-linejoin="round"/>{{end}}
+  {{range .Dots}}<circle cx="{{.X}}" cy="{{.Y}}" r="3.5" fill="#3b82f6"/>
+  {{end}}
+  <text x="{{.Left}}" y="{{.LabelY}}" font-size="12" fill="#777">{{.First}}</text>
+  <text x="{{.Right}}" y="{{.LabelY}}" font-size="12" text-anchor="end" fill="#777">{{.Last}}</text>
+</svg>
+`))
+
+func linePath(points []dot) string {
+	if len(points) < 2 {
+		return ""
+	}
+	var path strings.Builder
+	for i, p := range points {
+		command := "L"
+		if i == 0 {
+			command = "M"
+		}
+		fmt.Fprintf(&path, "%s%g,%g ", command, p.X, p.Y)
+	}
+	return strings.TrimSpace(path.String())
+}
+
+func (chart WellnessChart) SVG() ([]byte, error) {
+	const left, right, top, bottom = 30.0, 570.0, 90.0, 270.0
+
+	load := 1.0
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, day := range chart.Days {
+		load = math.Max(load, math.Max(day.Fitness, day.Fatigue))
+		if day.Wellness == nil {
+			continue
+		}
+		if value, ok := day.Wellness.Metric(chart.Metric); ok {
+			low, high = math.Min(low, value), math.Max(high, value)
+		}
+	}
+
+	step := 0.0
+	if len(chart.Days) > 1 {
+		step = (right - left) / float64(len(chart.Days)-1)
+	}
+	var fitness, fatigue, dots []dot
+	for i, day := range chart.Days {
+		x := round1(left + float64(i)*step)
+		fitness = append(fitness, dot{x, round1(bottom - (bottom-top)*day.Fitness/load)})
+		fatigue = append(fatigue, dot{x, round1(bottom - (bottom-top)*day.Fatigue/load)})
+		if day.Wellness == nil {
+			continue
+		}
+		if value, ok := day.Wellness.Metric(chart.Metric); ok {
+			share := 0.5 // a reading that never changed sits in the middle
+			if high > low {
+				share = (value - low) / (high - low)
+			}
+			dots = append(dots, dot{x, round1(bottom - (bottom-top)*share)})
+		}
+	}
+
+	var first, last, latestFitness, latestFatigue, valueRange string
+	if len(chart.Days) > 0 {
+		first, last = chart.Days[0].Date, chart.Days[len(chart.Days)-1].Date
+		latest := chart.Days[len(chart.Days)-1]
+		latestFitness, latestFatigue = fmt.Sprintf("%g", latest.Fitness), fmt.Sprintf("%g", latest.Fatigue)
+	}
+	if len(dots) > 0 {
+		valueRange = fmt.Sprintf("%g to %g", round1(low), round1(high))
+	}
+
+	var buf bytes.Buffer
+	err := wellnessChartTemplate.Execute(&buf, map[string]interface{}{
+		"Width":       cardWidth,
+		"Height":      cardHeight,
+		"Accent":      cssColor(chart.Accent),
+		"Title":       "Training load and " + chart.Metric,
+		"Metric":      chart.Metric,
+		"Fitness":     latestFitness,
+		"Fatigue":     latestFatigue,
+		"Range":       valueRange,
+		"Left":        left,
+		"Right":       right,
+		"Bottom":      bottom,
+		"LabelY":      bottom + 22,
+		"FitnessPath": linePath(fitness),
+		"FatiguePath": linePath(fatigue),
+		"Dots":        dots,
+		"First":       first,
+		"Last":        last,
+	})
+	return buf.Bytes(), err
+}
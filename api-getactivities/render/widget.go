@@ -0,0 +1,89 @@
+package render
+
+import (
+	"bytes"
+	"html/template"
+	"math"
+	"strconv"
+)
+
+// widgets are standalone pages meant for an iframe, every style is inline so
+// the embedding page's css neither leaks in nor needs to be loaded
+var widgetTemplates = template.Must(template.New("widgets").Parse(`
+{{define "page"}}<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>{{.Title}}</title></head>
+<body style="margin:0;font-family:Helvetica,Arial,sans-serif;color:#222;background:transparent">
+<div style="box-sizing:border-box;border:1px solid #e5e5e5;border-radius:12px;padding:14px 16px;background:#fff;max-width:420px">{{block "content" .}}{{end}}</div>
+</body></html>{{end}}
+
+{{define "stats"}}<div style="display:flex;gap:18px;margin-top:10px">{{range .}}<div><div style="font-size:12px;color:#777">{{.Label}}</div><div style="font-size:18px;font-weight:bold">{{.Value}}</div></div>{{end}}</div>{{end}}
+`))
+
+var latestContent = template.Must(template.Must(widgetTemplates.Clone()).Parse(`{{define "content"}}
+<div style="display:flex;gap:14px;align-items:center">
+{{if .Path}}<svg width="72" height="72" viewBox="0 0 72 72" style="flex:none;background:#f5f5f5;border-radius:8px"><path d="{{.Path}}" fill="none" stroke="{{.Accent}}" stroke-width="2.5" stroke-linecap="round" stroke-linejoin="round"/></svg>{{end}}
+<div style="min-width:0">
+<div style="font-size:12px;color:#777">{{.Subtitle}}</div>
+<div style="font-size:17px;font-weight:bold;white-space:nowrap;overflow:hidden;text-overflow:ellipsis">{{.Title}}</div>
+</div></div>
+{{template "stats" .Stats}}
+{{end}}`))
+
+var weeklyContent = template.Must(template.Must(widgetTemplates.Clone()).Parse(`{{define "content"}}
+<div style="font-size:12px;color:#777">{{.Subtitle}}</div>
+<div style="font-size:17px;font-weight:bold">{{.Title}}</div>
+{{template "stats" .Stats}}
+<div style="display:flex;gap:6px;align-items:flex-end;height:48px;margin-top:12px">{{range .Bars}}<div style="flex:1;text-align:center"><div style="height:{{.Height}}px;border-radius:2px;background:{{if .Empty}}#e5e5e5{{else}}{{$.Accent}}{{end}}"></div><div style="font-size:11px;color:#777;margin-top:3px">{{.Label}}</div></div>{{end}}</div>
+{{end}}`))
+
+func (card ActivityCard) HTML() ([]byte, error) {
+	subtitle := card.Start.Format("Jan 2, 2006")
+	if card.SportType != "" {
+		subtitle += " · " + card.SportType
+	}
+
+	var buf bytes.Buffer
+	err := latestContent.ExecuteTemplate(&buf, "page", map[string]interface{}{
+		"Title":    card.Name,
+		"Subtitle": subtitle,
+		"Accent":   template.CSS(cssColor(card.Accent)),
+		"Path":     routePath(card.Route, 6, 6, 60, 60),
+		"Stats": []stat{
+			{"Distance", formatDistance(card.Distance, card.Units)},
+			{"Moving time", formatDuration(card.MovingTime)},
+			{"Elevation", formatElevation(card.Elevation, card.Units)},
+		},
+	})
+	return buf.Bytes(), err
+}
+
+func (card WeeklyCard) HTML() ([]byte, error) {
+	const chartHeight = 32.0
+
+	most := 0.0
+	for _, day := range card.Week.Days {
+		most = math.Max(most, day.Distance)
+	}
+	var bars []bar
+	for i, day := range card.Week.Days {
+		height := 2.0
+		if most > 0 {
+			height = math.Max(height, chartHeight*day.Distance/most)
+		}
+		bars = append(bars, bar{Height: round1(height), Label: card.Week.Start.AddDate(0, 0, i).Format("Mon")[:1], Empty: day.Count == 0})
+	}
+
+	var buf bytes.Buffer
+	err := weeklyContent.ExecuteTemplate(&buf, "page", map[string]interface{}{
+		"Title":    card.Title,
+		"Subtitle": "Week of " + card.Week.Start.Format("Jan 2"),
+		"Accent":   template.CSS(cssColor(card.Accent)),
+		"Stats": []stat{
+			{"Distance", formatDistance(card.Week.Distance, card.Units)},
+			{"Time", formatDuration(card.Week.MovingTime)},
+			{"Activities", strconv.Itoa(card.Week.Count)},
+		},
+		"Bars": bars,
+	})
+	return buf.Bytes(), err
+}
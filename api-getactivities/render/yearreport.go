@@ -0,0 +1,171 @@
+package render
+
+import (
+	"bytes"
+	"html/template"
+	"image/color"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/analysis"
+)
+
+// YearReport is the year in review as a standalone page, styled like the
+// weekly report; MapURL is the image of every route, left out when empty
+type YearReport struct {
+	Summary analysis.YearSummary
+	MapURL  string
+	Periods []analysis.Period // shown under the chart
+	Units   Units
+	Accent  color.RGBA
+}
+
+type yearHighlight struct {
+	Label, Name, Detail string
+}
+
+var yearReportTemplate = template.Must(template.New("year").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>{{.Title}}</title></head>
+<body style="margin:0;padding:24px 12px;font-family:Helvetica,Arial,sans-serif;color:#222;background:#f5f5f5">
+<table role="presentation" width="100%" cellpadding="0" cellspacing="0" style="max-width:600px;margin:0 auto;background:#fff;border:1px solid #e5e5e5;border-radius:12px">
+<tr><td style="padding:24px 24px 8px">
+<div style="font-size:13px;color:#777">Year in review</div>
+<div style="font-size:22px;font-weight:bold">{{.Title}}</div>
+</td></tr>
+<tr><td style="padding:8px 24px">
+<table role="presentation" width="100%" cellpadding="0" cellspacing="0"><tr>
+{{range .Stats}}<td style="vertical-align:top;padding:8px 0"><div style="font-size:12px;color:#777">{{.Label}}</div><div style="font-size:20px;font-weight:bold;color:{{$.Accent}}">{{.Value}}</div></td>
+{{end}}</tr></table>
+</td></tr>
+<tr><td style="padding:8px 24px">{{.Chart}}</td></tr>
+{{range .Periods}}<tr><td style="padding:2px 24px;font-size:13px;color:#777">{{.}}</td></tr>
+{{end}}{{if .MapURL}}<tr><td style="padding:8px 24px"><img src="{{.MapURL}}" width="552" alt="Every route of the year" style="display:block;width:100%;height:auto;border-radius:8px"></td></tr>{{end}}
+{{if .Highlights}}<tr><td style="padding:8px 24px">
+{{range .Highlights}}<div style="padding:4px 0"><div style="font-size:12px;color:#777">{{.Label}}</div><div style="font-size:15px;font-weight:bold">{{.Name}}</div><div style="font-size:12px;color:#777">{{.Detail}}</div></div>
+{{end}}</td></tr>{{end}}
+{{if .Gear}}<tr><td style="padding:8px 24px">
+<div style="font-size:15px;font-weight:bold;margin-bottom:6px">Gear</div>
+{{range .Gear}}<div style="font-size:14px;padding:3px 0">{{.Label}} <span style="color:#777">· {{.Value}}</span></div>
+{{end}}</td></tr>{{end}}
+<tr><td style="padding:8px 24px 24px">
+<div style="font-size:15px;font-weight:bold;margin-bottom:6px">Sports</div>
+{{if .Sports}}<table role="presentation" width="100%" cellpadding="0" cellspacing="0" style="font-size:13px">
+{{range .Sports}}<tr><td style="padding:5px 0;border-top:1px solid #eee">{{.Label}}</td><td style="padding:5px 0;border-top:1px solid #eee;text-align:right;color:#777">{{.Value}}</td></tr>
+{{end}}</table>{{else}}<div style="font-size:13px;color:#777">No activities this year.</div>{{end}}
+</td></tr>
+</table>
+</body></html>
+`))
+
+func activityCount(n int) string {
+	if n == 1 {
+		return "1 activity"
+	}
+	return strconv.Itoa(n) + " activities"
+}
+
+// monthly distance, drawn like the weekly report's daily chart
+func (report YearReport) chart() (template.HTML, error) {
+	const width, chartHeight, barWidth, gap = 552.0, 110.0, 38.0, 8.0
+
+	most := 0.0
+	for _, month := range report.Summary.Months {
+		most = math.Max(most, month.Distance)
+	}
+	var bars []bar
+	for i, month := range report.Summary.Months {
+		height := 2.0
+		if most > 0 {
+			height = math.Max(height, chartHeight*month.Distance/most)
+		}
+		bars = append(bars, bar{
+			X:      float64(i) * (barWidth + gap),
+			Y:      round1(chartHeight - height),
+			Width:  barWidth,
+			Height: round1(height),
+			Label:  time.Month(i + 1).String()[:3],
+			Empty:  month.Count == 0,
+		})
+	}
+
+	var buf bytes.Buffer
+	err := reportChartTemplate.Execute(&buf, map[string]interface{}{
+		"Width":  width,
+		"Height": chartHeight + 22,
+		"LabelY": chartHeight + 18,
+		"BarMid": barWidth / 2,
+		"Accent": template.CSS(cssColor(report.Accent)),
+		"Bars":   bars,
+	})
+	return template.HTML(buf.String()), err
+}
+
+func (report YearReport) HTML() ([]byte, error) {
+	chart, err := report.chart()
+	if err != nil {
+		return nil, err
+	}
+	summary := report.Summary
+
+	var highlights []yearHighlight
+	for _, h := range []struct {
+		label     string
+		highlight *analysis.Highlight
+	}{{"Biggest ride", summary.BiggestRide}, {"Biggest run", summary.BiggestRun}} {
+		if h.highlight == nil {
+			continue
+		}
+		detail := formatDistance(h.highlight.Distance, report.Units) + " · " + formatDuration(h.highlight.MovingTime)
+		if at, err := time.Parse(time.RFC3339, h.highlight.StartDate); err == nil {
+			detail = at.Format("Jan 2") + " · " + detail
+		}
+		highlights = append(highlights, yearHighlight{h.label, h.highlight.Name, detail})
+	}
+
+	var gear []stat
+	for _, g := range summary.Gear {
+		name := g.Name
+		if name == "" {
+			name = g.Id
+		}
+		gear = append(gear, stat{name, activityCount(g.Count) + " · " + formatDistance(g.Distance, report.Units)})
+	}
+
+	var sports []stat
+	var names []string
+	for name := range summary.Sports {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := summary.Sports[names[i]], summary.Sports[names[j]]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		totals := summary.Sports[name]
+		sports = append(sports, stat{name, activityCount(totals.Count) + " · " + formatDistance(totals.Distance, report.Units)})
+	}
+
+	var buf bytes.Buffer
+	err = yearReportTemplate.Execute(&buf, map[string]interface{}{
+		"Title":  strconv.Itoa(summary.Year),
+		"Accent": template.CSS(cssColor(report.Accent)),
+		"Stats": []stat{
+			{"Activities", strconv.Itoa(summary.Count)},
+			{"Distance", formatDistance(summary.Distance, report.Units)},
+			{"Moving time", formatHours(summary.MovingTime)},
+			{"Elevation", formatElevation(summary.Elevation, report.Units)},
+		},
+		"Chart":      chart,
+		"Periods":    periodLabels(report.Periods),
+		"MapURL":     report.MapURL,
+		"Highlights": highlights,
+		"Gear":       gear,
+		"Sports":     sports,
+	})
+	return buf.Bytes(), err
+}
@@ -0,0 +1,166 @@
+package serverless
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// the fields of API Gateway REST (version 1.0) and HTTP API (version 2.0)
+// proxy events that are needed to rebuild the request
+type gatewayEvent struct {
+	Version         string              `json:"version"`
+	HTTPMethod      string              `json:"httpMethod"`
+	Path            string              `json:"path"`
+	Headers         map[string]string   `json:"headers"`
+	MultiHeaders    map[string][]string `json:"multiValueHeaders"`
+	MultiQuery      map[string][]string `json:"multiValueQueryStringParameters"`
+	RawPath         string              `json:"rawPath"`
+	RawQueryString  string              `json:"rawQueryString"`
+	Cookies         []string            `json:"cookies"`
+	Body            string              `json:"body"`
+	IsBase64Encoded bool                `json:"isBase64Encoded"`
+	RequestContext  struct {
+		Identity struct {
+			SourceIp string `json:"sourceIp"`
+		} `json:"identity"`
+		HTTP struct {
+			Method   string `json:"method"`
+			SourceIp string `json:"sourceIp"`
+		} `json:"http"`
+	} `json:"requestContext"`
+}
+
+type gatewayResponse struct {
+	StatusCode      int                 `json:"statusCode"`
+	Headers         map[string]string   `json:"headers,omitempty"`
+	MultiHeaders    map[string][]string `json:"multiValueHeaders,omitempty"`
+	Cookies         []string            `json:"cookies,omitempty"`
+	Body            string              `json:"body"`
+	IsBase64Encoded bool                `json:"isBase64Encoded"`
+}
+
+func (e *gatewayEvent) request() (*http.Request, error) {
+	body := []byte(e.Body)
+	if e.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(e.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = decoded
+	}
+
+	method, path, query, sourceIp := e.HTTPMethod, e.Path, url.Values(e.MultiQuery).Encode(), e.RequestContext.Identity.SourceIp
+	if e.Version == "2.0" {
+		method, path, query, sourceIp = e.RequestContext.HTTP.Method, e.RawPath, e.RawQueryString, e.RequestContext.HTTP.SourceIp
+	}
+	if query != "" {
+		path += "?" + query
+	}
+
+	req, err := http.NewRequest(method, path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range e.Headers {
+		req.Header.Set(key, value)
+	}
+	for key, values := range e.MultiHeaders {
+		req.Header.Del(key)
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	if len(e.Cookies) > 0 {
+		req.Header.Set("Cookie", strings.Join(e.Cookies, "; "))
+	}
+	req.Host = req.Header.Get("Host")
+	req.RemoteAddr = sourceIp + ":0"
+	return req, nil
+}
+
+// JSON and text go back as they are, anything else such as the export tarball base64 encoded
+func textual(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "" || strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "json")
+}
+
+// ServeEvent answers one API Gateway proxy event, in the format of its version
+func ServeEvent(event []byte) ([]byte, error) {
+	var e gatewayEvent
+	if err := json.Unmarshal(event, &e); err != nil {
+		return nil, err
+	}
+	req, err := e.request()
+	if err != nil {
+		return nil, err
+	}
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, req)
+
+	res := gatewayResponse{StatusCode: rec.Code, Body: rec.Body.String()}
+	if !textual(rec.Header().Get("Content-Type")) {
+		res.Body = base64.StdEncoding.EncodeToString(rec.Body.Bytes())
+		res.IsBase64Encoded = true
+	}
+	if e.Version == "2.0" {
+		// HTTP APIs take a single value per header, cookies go separately
+		res.Headers = map[string]string{}
+		for key, values := range rec.Header() {
+			if key == "Set-Cookie" {
+				res.Cookies = values
+				continue
+			}
+			res.Headers[key] = strings.Join(values, ",")
+		}
+	} else {
+		res.MultiHeaders = rec.Header()
+	}
+	return json.Marshal(res)
+}
+
+// StartLambda serves events from the Lambda runtime API until the instance is
+// stopped, for the provided.al2 runtime with the binary deployed as bootstrap
+func StartLambda() error {
+	runtime := os.Getenv("AWS_LAMBDA_RUNTIME_API")
+	if runtime == "" {
+		return errors.New("AWS_LAMBDA_RUNTIME_API is not set, this is not running in Lambda")
+	}
+	base := "http://" + runtime + "/2018-06-01/runtime/invocation/"
+
+	// polling for the next event blocks until there is one
+	client := &http.Client{}
+	for {
+		next, err := client.Get(base + "next")
+		if err != nil {
+			return err
+		}
+		requestId := next.Header.Get("Lambda-Runtime-Aws-Request-Id")
+		event, err := io.ReadAll(next.Body)
+		next.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		outcome := "/response"
+		reply, err := ServeEvent(event)
+		if err != nil {
+			reply, _ = json.Marshal(map[string]string{"errorMessage": err.Error(), "errorType": "InvalidEvent"})
+			outcome = "/error"
+		}
+		posted, err := client.Post(base+requestId+outcome, "application/json", bytes.NewReader(reply))
+		if err != nil {
+			return err
+		}
+		posted.Body.Close()
+	}
+}
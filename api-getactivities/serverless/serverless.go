@@ -0,0 +1,38 @@
+// Package serverless runs the API as a Google Cloud Function or an AWS Lambda
+// function behind API Gateway, sharing one router per warm instance.
+package serverless
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/api"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+)
+
+var (
+	setup   sync.Once
+	handler http.Handler
+)
+
+// storage is opened on the first request an instance serves and kept while it
+// is warm, so the GCS object cache survives between invocations
+func Handler() http.Handler {
+	setup.Do(func() {
+		gin.SetMode(gin.ReleaseMode)
+		cfg := api.Config{PathPrefix: env.String("PATH_PREFIX", "")}
+		if _, err := api.OpenStorage(cfg); err != nil {
+			fmt.Println("storage broken:", err)
+		}
+		handler = api.NewHandler(cfg)
+	})
+	return handler
+}
+
+// HTTPFunction is the Cloud Functions entry point, see function.go at the module root
+func HTTPFunction(w http.ResponseWriter, r *http.Request) {
+	Handler().ServeHTTP(w, r)
+}
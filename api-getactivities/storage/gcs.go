@@ -0,0 +1,451 @@
+package storage
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/cache"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/pool"
+)
+
+// EncodingGzip is the Content-Encoding of compressed objects. GCS serves such
+// objects decompressed to readers that do not accept gzip, so other tools
+// can still read the bucket
+const EncodingGzip = "gzip"
+
+// ChecksumKey is the object metadata holding the SHA-256 of its contents,
+// before any compression, so reads can tell a corrupted object from the one written
+const ChecksumKey = "sha256"
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// GCS is an ObjectStore over one bucket, reads are served from memory while
+// the object's generation is unchanged
+type GCS struct {
+	client  *gcs.Client
+	bucket  string
+	timeout time.Duration
+	cache   *cache.GenerationCache
+
+	compress    bool
+	compressMin int
+
+	trustFor time.Duration // 0 unless told when cached objects change
+
+	ctx context.Context // what calls are canceled with besides the timeout, see WithContext
+}
+
+// a nil client gives a store whose every call fails with ErrNoStorage
+func NewGCS(client *gcs.Client, bucket string, timeout time.Duration) *GCS {
+	return NewGCSCached(client, bucket, timeout, cache.New())
+}
+
+// NewGCS reading through c, e.g. a cache.NewLimited one when objects can be large
+func NewGCSCached(client *gcs.Client, bucket string, timeout time.Duration, c *cache.GenerationCache) *GCS {
+	return &GCS{client: client, bucket: bucket, timeout: timeout, cache: c}
+}
+
+// CompressJSON makes Write gzip the .json objects of at least minBytes; Read
+// decompresses whatever was stored gzipped, so a bucket may hold both
+func (g *GCS) CompressJSON(minBytes int) *GCS {
+	g.compress, g.compressMin = true, minBytes
+	return g
+}
+
+// TrustCache makes Read serve objects cached less than maxAge ago without
+// checking their generation, for callers that Evict objects from the cache as
+// other writers change them; maxAge bounds how stale a missed change leaves one
+func (g *GCS) TrustCache(maxAge time.Duration) *GCS {
+	g.trustFor = maxAge
+	return g
+}
+
+// WithContext is the store with its calls canceled with ctx as well, such as
+// when a request they are made for times out; it shares g's cache
+func (g *GCS) WithContext(ctx context.Context) ObjectStore {
+	bound := *g
+	bound.ctx = ctx
+	return &bound
+}
+
+// each call gets the timeout, counted from when it is made
+func (g *GCS) callContext() (context.Context, context.CancelFunc) {
+	parent := g.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	return context.WithTimeout(parent, g.timeout)
+}
+
+func NewClient() (*gcs.Client, error) {
+	return gcs.NewClient(context.Background())
+}
+
+func (g *GCS) Read(object string) ([]byte, error) {
+	data, _, err := g.ReadGeneration(object)
+	return data, err
+}
+
+func (g *GCS) ReadGeneration(object string) ([]byte, int64, error) {
+	if g.client == nil {
+		return nil, 0, ErrNoStorage
+	}
+
+	ctx, cancel := g.callContext()
+	defer cancel()
+
+	cached, generation, obj, attrs, err := g.lookup(ctx, object)
+	if err != nil || attrs == nil {
+		return cached, generation, err
+	}
+
+	slurp, err := download(ctx, obj, attrs)
+	if err != nil {
+		return nil, 0, err
+	}
+	g.cache.Put(object, attrs.Generation, attrs.Metageneration, slurp)
+	return slurp, attrs.Generation, nil
+}
+
+// Decode is Read into v. A StreamDecoder too large for the cache is decoded
+// as it is downloaded, so it is never held whole; anything else is read and
+// cached as Read does, which is faster when the contents are kept anyway
+func (g *GCS) Decode(object string, v any) error {
+	if g.client == nil {
+		return ErrNoStorage
+	}
+
+	ctx, cancel := g.callContext()
+	defer cancel()
+
+	cached, _, obj, attrs, err := g.lookup(ctx, object)
+	if err != nil {
+		return err
+	}
+	if attrs == nil {
+		return json.Unmarshal(cached, v)
+	}
+
+	// the stored size is at most what the object decompresses to
+	if _, ok := v.(StreamDecoder); !ok || g.cache.Keeps(int(attrs.Size)) {
+		slurp, err := download(ctx, obj, attrs)
+		if err != nil {
+			return err
+		}
+		g.cache.Put(object, attrs.Generation, attrs.Metageneration, slurp)
+		return json.Unmarshal(slurp, v)
+	}
+
+	r, closeObject, err := open(ctx, obj, attrs)
+	if err != nil {
+		return err
+	}
+	defer closeObject()
+	return decodeVerified(r, attrs, v)
+}
+
+// the object's contents and generation when they are cached and current, or
+// else the handle and attrs to download it with
+func (g *GCS) lookup(ctx context.Context, object string) ([]byte, int64, *gcs.ObjectHandle, *gcs.ObjectAttrs, error) {
+	if g.trustFor > 0 {
+		if cached, generation, ok := g.cache.GetFresh(object, g.trustFor); ok {
+			return cached, generation, nil, nil, nil
+		}
+	}
+
+	obj := g.client.Bucket(g.bucket).Object(object)
+
+	// a metadata lookup is much cheaper than downloading an unchanged object again
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		if err == gcs.ErrObjectNotExist {
+			g.cache.Evict(object)
+		}
+		return nil, 0, nil, nil, err
+	}
+	if cached, ok := g.cache.Get(object, attrs.Generation, attrs.Metageneration); ok {
+		return cached, attrs.Generation, nil, nil, nil
+	}
+	return nil, 0, obj, attrs, nil
+}
+
+// the object handle that only succeeds at generation, 0 for a new object
+func ifGeneration(obj *gcs.ObjectHandle, generation int64) *gcs.ObjectHandle {
+	switch generation {
+	case AnyGeneration:
+		return obj
+	case 0:
+		return obj.If(gcs.Conditions{DoesNotExist: true})
+	default:
+		return obj.If(gcs.Conditions{GenerationMatch: generation})
+	}
+}
+
+// a failed precondition is another writer's change
+func conflict(err error) error {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+		return fmt.Errorf("%w: %v", ErrConflict, err)
+	}
+	return err
+}
+
+// the generation attrs describes, decompressed, with the func that closes it
+func open(ctx context.Context, obj *gcs.ObjectHandle, attrs *gcs.ObjectAttrs) (io.Reader, func(), error) {
+	// compressed objects are downloaded as stored, which is less egress
+	rc, err := obj.Generation(attrs.Generation).ReadCompressed(true).NewReader(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if attrs.ContentEncoding != EncodingGzip {
+		return rc, func() { rc.Close() }, nil
+	}
+	zr, err := pool.GzipReader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, nil, fmt.Errorf("%s: %w: %v", attrs.Name, ErrChecksumMismatch, err)
+	}
+	return zr, func() {
+		pool.PutGzipReader(zr)
+		rc.Close()
+	}, nil
+}
+
+// checks what was read of an object, with the error reading it ended in and
+// the checksum of what was read, against its checksum; objects written before
+// checksums were pass unchecked
+func verify(attrs *gcs.ObjectAttrs, sum string, err error) error {
+	// a gzipped object cut short or altered fails its own trailer
+	if attrs.ContentEncoding == EncodingGzip && (errors.Is(err, gzip.ErrChecksum) || errors.Is(err, io.ErrUnexpectedEOF)) {
+		return fmt.Errorf("%s: %w: %v", attrs.Name, ErrChecksumMismatch, err)
+	}
+	if err != nil {
+		return err
+	}
+	if want, ok := attrs.Metadata[ChecksumKey]; ok && want != sum {
+		return fmt.Errorf("%s: %w", attrs.Name, ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// the generation attrs describes, decompressed and checked against its checksum
+func download(ctx context.Context, obj *gcs.ObjectHandle, attrs *gcs.ObjectAttrs) ([]byte, error) {
+	r, closeObject, err := open(ctx, obj, attrs)
+	if err != nil {
+		return nil, err
+	}
+	defer closeObject()
+	slurp, err := pool.ReadAll(r)
+	if err := verify(attrs, checksum(slurp), err); err != nil {
+		return nil, err
+	}
+	return slurp, nil
+}
+
+// decodes the JSON read from r into v as it arrives, through DecodeStream,
+// then checks it as download does; v is only usable without an error
+func decodeVerified(r io.Reader, attrs *gcs.ObjectAttrs, v any) error {
+	// the checksum covers the whole object, so it is summed as the decoder
+	// reads and the rest is read once it is done
+	sum := sha256.New()
+	tee := io.TeeReader(r, sum)
+	decodeErr := decodeJSON(tee, v)
+	_, err := io.Copy(io.Discard, tee)
+	if err := verify(attrs, hex.EncodeToString(sum.Sum(nil)), err); err != nil {
+		return err
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("%s: %w", attrs.Name, decodeErr)
+	}
+	return nil
+}
+
+func (g *GCS) Write(object string, data []byte) error {
+	_, err := g.WriteIfGeneration(object, data, AnyGeneration)
+	return err
+}
+
+func (g *GCS) WriteIfGeneration(object string, data []byte, generation int64) (int64, error) {
+	if g.client == nil {
+		return 0, ErrNoStorage
+	}
+
+	ctx, cancel := g.callContext()
+	defer cancel()
+
+	stored, encoding := data, ""
+	if g.compress && strings.HasSuffix(object, ".json") && len(data) >= g.compressMin {
+		buf, err := pool.Gzip(data)
+		if err != nil {
+			return 0, err
+		}
+		defer pool.PutBuffer(buf)
+		stored, encoding = buf.Bytes(), EncodingGzip
+	}
+
+	wc := ifGeneration(g.client.Bucket(g.bucket).Object(object), generation).NewWriter(ctx)
+	wc.ContentType = "application/json"
+	wc.ContentEncoding = encoding
+	wc.Metadata = map[string]string{ChecksumKey: checksum(data)}
+	// GCS refuses an upload that arrives other than it was sent
+	wc.CRC32C = crc32.Checksum(stored, crc32c)
+	wc.SendCRC32C = true
+	if _, err := wc.Write(stored); err != nil {
+		wc.Close()
+		return 0, err
+	}
+	if err := wc.Close(); err != nil {
+		g.cache.Evict(object)
+		return 0, conflict(err)
+	}
+
+	// what was just written is the current generation, no need to read it back
+	// for objects that are being read through the cache
+	attrs := wc.Attrs()
+	g.cache.Refresh(object, attrs.Generation, attrs.Metageneration, data)
+	return attrs.Generation, nil
+}
+
+func (g *GCS) Verify(object string) error {
+	if g.client == nil {
+		return ErrNoStorage
+	}
+
+	ctx, cancel := g.callContext()
+	defer cancel()
+
+	obj := g.client.Bucket(g.bucket).Object(object)
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := download(ctx, obj, attrs); err != nil {
+		if errors.Is(err, ErrChecksumMismatch) {
+			g.cache.Evict(object)
+		}
+		return err
+	}
+	if attrs.Metadata[ChecksumKey] == "" {
+		return ErrNoChecksum
+	}
+	return nil
+}
+
+func (g *GCS) Delete(object string) error {
+	return g.DeleteIfGeneration(object, AnyGeneration)
+}
+
+func (g *GCS) DeleteIfGeneration(object string, generation int64) error {
+	if g.client == nil {
+		return ErrNoStorage
+	}
+
+	ctx, cancel := g.callContext()
+	defer cancel()
+
+	g.cache.Evict(object)
+	err := ifGeneration(g.client.Bucket(g.bucket).Object(object), generation).Delete(ctx)
+	if err == gcs.ErrObjectNotExist {
+		return nil
+	}
+	return conflict(err)
+}
+
+func (g *GCS) List(prefix string) ([]string, error) {
+	if g.client == nil {
+		return nil, ErrNoStorage
+	}
+
+	ctx, cancel := g.callContext()
+	defer cancel()
+
+	var names []string
+	it := g.client.Bucket(g.bucket).Objects(ctx, &gcs.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return names, err
+		}
+		names = append(names, attrs.Name)
+	}
+	return names, nil
+}
+
+func (g *GCS) ListSizes(prefix string) (map[string]int64, error) {
+	if g.client == nil {
+		return nil, ErrNoStorage
+	}
+
+	ctx, cancel := g.callContext()
+	defer cancel()
+
+	sizes := make(map[string]int64)
+	it := g.client.Bucket(g.bucket).Objects(ctx, &gcs.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return sizes, err
+		}
+		sizes[attrs.Name] = attrs.Size
+	}
+	return sizes, nil
+}
+
+func (g *GCS) Exists(object string) (bool, error) {
+	if g.client == nil {
+		return false, ErrNoStorage
+	}
+
+	ctx, cancel := g.callContext()
+	defer cancel()
+
+	_, err := g.client.Bucket(g.bucket).Object(object).Attrs(ctx)
+	if err == gcs.ErrObjectNotExist {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (g *GCS) Copy(src string, dst string) error {
+	return g.CopyIfGeneration(src, dst, AnyGeneration)
+}
+
+func (g *GCS) CopyIfGeneration(src string, dst string, generation int64) error {
+	if g.client == nil {
+		return ErrNoStorage
+	}
+
+	ctx, cancel := g.callContext()
+	defer cancel()
+
+	// a trusted cache would otherwise keep serving what dst held before
+	g.cache.Evict(dst)
+	bucket := g.client.Bucket(g.bucket)
+	_, err := ifGeneration(bucket.Object(dst), generation).CopierFrom(bucket.Object(src)).Run(ctx)
+	return conflict(err)
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	gcs "cloud.google.com/go/storage"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/pool"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// an array decoded an element at a time, as the activity index decodes its entries
+type activityStream []strava.ActivitySummary
+
+func (l *activityStream) DecodeStream(dec *json.Decoder) error {
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	for dec.More() {
+		var a strava.ActivitySummary
+		if err := dec.Decode(&a); err != nil {
+			return err
+		}
+		*l = append(*l, a)
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// what GCS would serve for data stored with attrs, decompressed as open does
+func opened(t testing.TB, attrs *gcs.ObjectAttrs, stored []byte) io.Reader {
+	if attrs.ContentEncoding != EncodingGzip {
+		return bytes.NewReader(stored)
+	}
+	zr, err := pool.GzipReader(bytes.NewReader(stored))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func TestDecodeVerified(t *testing.T) {
+	plain := func(data []byte) *gcs.ObjectAttrs {
+		return &gcs.ObjectAttrs{Name: "plain.json", Metadata: map[string]string{ChecksumKey: checksum(data)}}
+	}
+	altered := *attrs
+	altered.Metadata = map[string]string{ChecksumKey: checksum([]byte("something else"))}
+	unchecked := *attrs
+	unchecked.Metadata = nil
+
+	cases := []struct {
+		name     string
+		attrs    *gcs.ObjectAttrs
+		stored   []byte
+		mismatch bool
+		fails    bool
+	}{
+		{"intact", attrs, compressed, false, false},
+		{"written before checksums", &unchecked, compressed, false, false},
+		{"checksum differs", &altered, compressed, true, true},
+		{"cut short", attrs, compressed[:len(compressed)/2], true, true},
+		{"trailing newline", plain([]byte("[]\n")), []byte("[]\n"), false, false},
+		{"not json", plain([]byte("[{")), []byte("[{"), false, true},
+	}
+	for _, tc := range cases {
+		var activities []strava.ActivitySummary
+		var streamed activityStream
+		for _, v := range []interface{}{&activities, &streamed} {
+			err := decodeVerified(opened(t, tc.attrs, tc.stored), tc.attrs, v)
+			if tc.fails != (err != nil) || errors.Is(err, ErrChecksumMismatch) != tc.mismatch {
+				t.Errorf("%s into %T: err %v, want failure %v and checksum mismatch %v", tc.name, v, err, tc.fails, tc.mismatch)
+			}
+		}
+		if !tc.fails && len(activities) != len(streamed) {
+			t.Errorf("%s: decoded %d activities, streamed %d", tc.name, len(activities), len(streamed))
+		}
+	}
+}
+
+// what Decode does with an object the cache keeps, and what every object
+// took before objects too large for it were decoded as they are read
+func BenchmarkReadThenUnmarshal(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		zr := opened(b, attrs, compressed).(*gzip.Reader)
+		slurp, err := pool.ReadAll(zr)
+		if err := verify(attrs, checksum(slurp), err); err != nil {
+			b.Fatal(err)
+		}
+		pool.PutGzipReader(zr)
+		var activities []strava.ActivitySummary
+		if err := json.Unmarshal(slurp, &activities); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// an object the cache would not keep, which is never held whole
+func BenchmarkDecodeStream(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		zr := opened(b, attrs, compressed).(*gzip.Reader)
+		var activities activityStream
+		if err := decodeVerified(zr, attrs, &activities); err != nil {
+			b.Fatal(err)
+		}
+		pool.PutGzipReader(zr)
+	}
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	gcs "cloud.google.com/go/storage"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/benchdata"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/pool"
+)
+
+// a compressed activity index as GCS serves it, and the attrs it was stored with
+var (
+	encoded    []byte
+	compressed []byte
+	attrs      *gcs.ObjectAttrs
+)
+
+func TestMain(m *testing.M) {
+	var err error
+	if encoded, err = json.Marshal(benchdata.Activities(benchdata.ActivityCount)); err != nil {
+		panic(err)
+	}
+	zipped, err := pool.Gzip(encoded)
+	if err != nil {
+		panic(err)
+	}
+	compressed = bytes.Clone(zipped.Bytes())
+	attrs = &gcs.ObjectAttrs{
+		Name:            "ACTIVITIES/index.json",
+		ContentEncoding: EncodingGzip,
+		Metadata:        map[string]string{ChecksumKey: checksum(encoded)},
+	}
+
+	benchdata.Main(m, benchdata.Benchmarks{
+		"BenchmarkReadThenUnmarshal": BenchmarkReadThenUnmarshal,
+		"BenchmarkDecodeStream":      BenchmarkDecodeStream,
+	})
+}
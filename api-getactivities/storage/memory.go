@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Memory is an ObjectStore kept in process memory, used by dev mode so no GCP credentials are needed
+type Memory struct {
+	mu          sync.RWMutex
+	objects     map[string][]byte
+	generations map[string]int64
+	generation  int64 // the last one given out
+}
+
+func NewMemory() *Memory {
+	return &Memory{objects: make(map[string][]byte), generations: make(map[string]int64)}
+}
+
+// memory calls return at once, there is nothing to cancel
+func (m *Memory) WithContext(ctx context.Context) ObjectStore {
+	return m
+}
+
+func (m *Memory) Read(object string) ([]byte, error) {
+	data, _, err := m.ReadGeneration(object)
+	return data, err
+}
+
+func (m *Memory) ReadGeneration(object string) ([]byte, int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.objects[object]
+	if !ok {
+		return nil, 0, ErrObjectNotExist
+	}
+	return data, m.generations[object], nil
+}
+
+func (m *Memory) Decode(object string, v any) error {
+	data, err := m.Read(object)
+	if err != nil {
+		return err
+	}
+	return decodeJSON(bytes.NewReader(data), v)
+}
+
+func (m *Memory) Write(object string, data []byte) error {
+	_, err := m.WriteIfGeneration(object, data, AnyGeneration)
+	return err
+}
+
+func (m *Memory) WriteIfGeneration(object string, data []byte, generation int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if generation != AnyGeneration && m.generations[object] != generation {
+		return 0, ErrConflict
+	}
+	m.generation++
+	m.objects[object] = append([]byte{}, data...)
+	m.generations[object] = m.generation
+	return m.generation, nil
+}
+
+func (m *Memory) Delete(object string) error {
+	return m.DeleteIfGeneration(object, AnyGeneration)
+}
+
+func (m *Memory) DeleteIfGeneration(object string, generation int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.objects[object]; !ok {
+		return nil
+	}
+	if generation != AnyGeneration && m.generations[object] != generation {
+		return ErrConflict
+	}
+	delete(m.objects, object)
+	delete(m.generations, object)
+	return nil
+}
+
+func (m *Memory) List(prefix string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var names []string
+	for name := range m.objects {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *Memory) ListSizes(prefix string) (map[string]int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sizes := make(map[string]int64)
+	for name, data := range m.objects {
+		if strings.HasPrefix(name, prefix) {
+			sizes[name] = int64(len(data))
+		}
+	}
+	return sizes, nil
+}
+
+func (m *Memory) Exists(object string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.objects[object]
+	return ok, nil
+}
+
+// objects in memory cannot be corrupted, so only their existence is checked
+func (m *Memory) Verify(object string) error {
+	if ok, _ := m.Exists(object); !ok {
+		return ErrObjectNotExist
+	}
+	return nil
+}
+
+func (m *Memory) Copy(src string, dst string) error {
+	return m.CopyIfGeneration(src, dst, AnyGeneration)
+}
+
+func (m *Memory) CopyIfGeneration(src string, dst string, generation int64) error {
+	data, err := m.Read(src)
+	if err != nil {
+		return err
+	}
+	_, err = m.WriteIfGeneration(dst, data, generation)
+	return err
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var namespacePart = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Namespace is the prefix for an environment and tenant, e.g. staging/12345/;
+// either may be empty and both empty is the bucket root
+func Namespace(environment string, tenant string) (string, error) {
+	var parts []string
+	for _, part := range []string{environment, tenant} {
+		if part == "" {
+			continue
+		}
+		if !namespacePart.MatchString(part) || part == "." || part == ".." {
+			return "", fmt.Errorf("namespace part %q may only hold letters, digits, _, . and -", part)
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return "", nil
+	}
+	return strings.Join(parts, "/") + "/", nil
+}
+
+// Namespaced keeps every object of store under prefix, so environments and
+// tenants can share a bucket; names given to it and listed by it are relative
+// to the prefix, so callers do not know they are namespaced
+type Namespaced struct {
+	store  ObjectStore
+	prefix string
+}
+
+func NewNamespaced(store ObjectStore, prefix string) *Namespaced {
+	return &Namespaced{store: store, prefix: prefix}
+}
+
+func (n *Namespaced) Read(object string) ([]byte, error) {
+	return n.store.Read(n.prefix + object)
+}
+
+func (n *Namespaced) Write(object string, data []byte) error {
+	return n.store.Write(n.prefix+object, data)
+}
+
+func (n *Namespaced) Delete(object string) error {
+	return n.store.Delete(n.prefix + object)
+}
+
+func (n *Namespaced) List(prefix string) ([]string, error) {
+	names, err := n.store.List(n.prefix + prefix)
+	for i, name := range names {
+		names[i] = strings.TrimPrefix(name, n.prefix)
+	}
+	return names, err
+}
+
+func (n *Namespaced) ListSizes(prefix string) (map[string]int64, error) {
+	sizes, err := n.store.ListSizes(n.prefix + prefix)
+	relative := make(map[string]int64, len(sizes))
+	for name, size := range sizes {
+		relative[strings.TrimPrefix(name, n.prefix)] = size
+	}
+	return relative, err
+}
+
+func (n *Namespaced) Exists(object string) (bool, error) {
+	return n.store.Exists(n.prefix + object)
+}
+
+func (n *Namespaced) Copy(src string, dst string) error {
+	return n.store.Copy(n.prefix+src, n.prefix+dst)
+}
+
+func (n *Namespaced) Verify(object string) error {
+	return n.store.Verify(n.prefix + object)
+}
+
+func (n *Namespaced) Decode(object string, v any) error {
+	return n.store.Decode(n.prefix+object, v)
+}
+
+func (n *Namespaced) ReadGeneration(object string) ([]byte, int64, error) {
+	return n.store.ReadGeneration(n.prefix + object)
+}
+
+func (n *Namespaced) WriteIfGeneration(object string, data []byte, generation int64) (int64, error) {
+	return n.store.WriteIfGeneration(n.prefix+object, data, generation)
+}
+
+func (n *Namespaced) CopyIfGeneration(src string, dst string, generation int64) error {
+	return n.store.CopyIfGeneration(n.prefix+src, n.prefix+dst, generation)
+}
+
+func (n *Namespaced) WithContext(ctx context.Context) ObjectStore {
+	return NewNamespaced(n.store.WithContext(ctx), n.prefix)
+}
+
+func (n *Namespaced) DeleteIfGeneration(object string, generation int64) error {
+	return n.store.DeleteIfGeneration(n.prefix+object, generation)
+}
@@ -0,0 +1,79 @@
+// Package storage keeps the service's JSON objects in Cloud Storage, or in memory for dev mode.
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	gcs "cloud.google.com/go/storage"
+)
+
+// every ObjectStore reports a missing object with this error
+var ErrObjectNotExist = gcs.ErrObjectNotExist
+
+var ErrNoStorage = errors.New("storage client is not available")
+
+// ErrChecksumMismatch is returned for an object that no longer matches the
+// checksum written with it, such as one corrupted or only partly written
+var ErrChecksumMismatch = errors.New("object does not match its checksum")
+
+// ErrConflict is returned by the IfGeneration calls when another writer
+// changed the object since the generation was read; read it again and retry
+var ErrConflict = errors.New("object was changed by another writer")
+
+// AnyGeneration makes the IfGeneration calls unconditional, and generation 0
+// is an object that does not exist yet
+const AnyGeneration int64 = -1
+
+// ErrNoChecksum is returned by Verify for an object written before checksums were
+var ErrNoChecksum = errors.New("object has no checksum")
+
+// StreamDecoder is implemented by values large enough that holding their JSON
+// whole while decoding them matters, such as the activity index; Decode hands
+// them the decoder to read a piece at a time, e.g. an array element at a time
+type StreamDecoder interface {
+	DecodeStream(dec *json.Decoder) error
+}
+
+// the JSON read from r into v, through DecodeStream when v has it
+func decodeJSON(r io.Reader, v any) error {
+	dec := json.NewDecoder(r)
+	if s, ok := v.(StreamDecoder); ok {
+		return s.DecodeStream(dec)
+	}
+	return dec.Decode(v)
+}
+
+// ObjectStore is where stored objects live, GCS normally and memory in dev mode
+type ObjectStore interface {
+	Read(object string) ([]byte, error)
+	Write(object string, data []byte) error
+	Delete(object string) error
+	List(prefix string) ([]string, error)
+	// ListSizes is List with each object's size in bytes
+	ListSizes(prefix string) (map[string]int64, error)
+	Exists(object string) (bool, error)
+	Copy(src string, dst string) error
+	// Verify reads the object past any cache and checks it against its checksum
+	Verify(object string) error
+
+	// Decode is Read into v, decoding the object's JSON as it is read, see
+	// StreamDecoder
+	Decode(object string, v any) error
+
+	// ReadGeneration is Read with the generation read, for WriteIfGeneration
+	ReadGeneration(object string) ([]byte, int64, error)
+	// WriteIfGeneration and CopyIfGeneration fail with ErrConflict unless the
+	// object, or dst, is still at generation; WriteIfGeneration returns the
+	// generation it wrote
+	WriteIfGeneration(object string, data []byte, generation int64) (int64, error)
+	CopyIfGeneration(src string, dst string, generation int64) error
+	// DeleteIfGeneration is Delete failing with ErrConflict unless the object
+	// is still at generation
+	DeleteIfGeneration(object string, generation int64) error
+
+	// WithContext is the store with its calls canceled with ctx as well
+	WithContext(ctx context.Context) ObjectStore
+}
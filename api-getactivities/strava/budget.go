@@ -0,0 +1,69 @@
+package strava
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var ErrBudgetExhausted = errors.New("strava call budget exhausted")
+
+// Budget caps the strava calls made while serving one inbound request, by
+// count and by time since it was created. Calls are refused once either runs
+// out, one already in flight is left to finish within Timeout
+type Budget struct {
+	mu        sync.Mutex
+	maxCalls  int
+	deadline  time.Time
+	calls     int
+	exhausted bool
+}
+
+func NewBudget(maxCalls int, maxDuration time.Duration) *Budget {
+	return &Budget{maxCalls: maxCalls, deadline: time.Now().Add(maxDuration)}
+}
+
+func (b *Budget) take() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.calls >= b.maxCalls || time.Now().After(b.deadline) {
+		b.exhausted = true
+		return ErrBudgetExhausted
+	}
+	b.calls++
+	return nil
+}
+
+// the calls made, retries of one call count once
+func (b *Budget) Calls() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.calls
+}
+
+// whether a call has been refused
+func (b *Budget) Exhausted() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.exhausted
+}
+
+// refuses each request once the budget is spent, outermost so retries are one call
+func WithBudget(b *Budget) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if err := b.take(); err != nil {
+				return nil, err
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// a client sharing the connections and middleware of client, with its calls
+// counted against the budget
+func (b *Budget) Client(client *http.Client) *http.Client {
+	return Wrap(client, WithBudget(b))
+}
@@ -0,0 +1,152 @@
+package strava
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+)
+
+// both are pointed at the fake strava handlers in dev mode
+var APIBase = "https://www.strava.com/api/v3"
+
+var OAuthBase = "https://www.strava.com/oauth"
+
+var Timeout = time.Duration(env.Int("STRAVA_TIMEOUT_SECONDS", 15)) * time.Second
+
+// shared so connections to strava are kept alive and reused between requests,
+// every call goes through the middleware chain in transport.go
+var DefaultClient = NewClient(&http.Transport{
+	Proxy:               http.ProxyFromEnvironment,
+	MaxIdleConns:        20,
+	MaxIdleConnsPerHost: 10,
+	IdleConnTimeout:     90 * time.Second,
+	TLSHandshakeTimeout: 10 * time.Second,
+})
+
+func RefreshCredentials(client *http.Client, creds Credentials) (Credentials, error) {
+	var payload Payload
+
+	payload.Client_id = creds.Client_id
+	payload.Client_secret = creds.Client_secret
+	payload.Refresh_token = creds.Refresh_token
+	payload.Grant_type = "refresh_token"
+	payload.F = "json"
+
+	var credsToUse Credentials
+
+	bytes_playload, err := json.Marshal(payload)
+	if err != nil {
+		return credsToUse, err
+	}
+
+	refresh_req, err := http.NewRequest("POST", OAuthBase+"/token", bytes.NewBuffer(bytes_playload))
+	if err != nil {
+		return credsToUse, err
+	}
+
+	refresh_req.Header.Add("Content-Type", "application/json")
+
+	res, err := client.Do(refresh_req)
+	if err != nil {
+		return credsToUse, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return credsToUse, DecodeError(res, "/oauth/token")
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&credsToUse); err != nil {
+		return credsToUse, err
+	}
+
+	return credsToUse, nil
+}
+
+func GetJSON(client *http.Client, access_token string, path string, parm url.Values, out interface{}) error {
+	req, err := http.NewRequest("GET", APIBase+path, nil)
+	if err != nil {
+		return err
+	}
+
+	if parm != nil {
+		req.URL.RawQuery = parm.Encode()
+	}
+
+	req.Header.Add("Authorization", "Bearer "+access_token)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return DecodeError(res, path)
+	}
+
+	if StrictDecode {
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		if unknown := Report.inspect(path, body, out); DisallowUnknownFields && len(unknown) > 0 {
+			return fmt.Errorf("%w on %s: %s", ErrUnknownFields, path, strings.Join(unknown, ", "))
+		}
+		return json.Unmarshal(body, out)
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func ExchangeAuthorizationCode(client *http.Client, app Credentials, code string) (Credentials, error) {
+	var payload Payload
+	payload.Client_id = app.Client_id
+	payload.Client_secret = app.Client_secret
+	payload.Code = code
+	payload.Grant_type = "authorization_code"
+	payload.F = "json"
+
+	var granted Credentials
+
+	bytes_playload, err := json.Marshal(payload)
+	if err != nil {
+		return granted, err
+	}
+
+	res, err := client.Post(OAuthBase+"/token", "application/json", bytes.NewBuffer(bytes_playload))
+	if err != nil {
+		return granted, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return granted, DecodeError(res, "/oauth/token")
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&granted)
+	return granted, err
+}
+
+// Deauthorize revokes the athlete's grant to the app, every token for it stops working
+func Deauthorize(client *http.Client, access_token string) error {
+	res, err := client.PostForm(OAuthBase+"/deauthorize", url.Values{"access_token": {access_token}})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return DecodeError(res, "/oauth/deauthorize")
+	}
+	return nil
+}
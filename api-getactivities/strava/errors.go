@@ -0,0 +1,83 @@
+package strava
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	KindAuth      = "auth"
+	KindScope     = "scope"
+	KindRateLimit = "rate_limit"
+	KindNotFound  = "not_found"
+	KindUpstream  = "upstream"
+)
+
+type Fault struct {
+	Resource string `json:"resource"`
+	Field    string `json:"field"`
+	Code     string `json:"code"`
+}
+
+// the {"message": ..., "errors": [...]} body strava returns with non-200 responses
+type Error struct {
+	StatusCode int     `json:"-"`
+	Path       string  `json:"-"`
+	Message    string  `json:"message"`
+	Errors     []Fault `json:"errors"`
+}
+
+func DecodeError(res *http.Response, path string) *Error {
+	stravaErr := &Error{StatusCode: res.StatusCode, Path: path}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if err != nil || json.Unmarshal(body, stravaErr) != nil || stravaErr.Message == "" {
+		stravaErr.Message = http.StatusText(res.StatusCode)
+	}
+	return stravaErr
+}
+
+func (e *Error) Kind() string {
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests:
+		return KindRateLimit
+	case e.StatusCode == http.StatusNotFound:
+		return KindNotFound
+	}
+
+	// a missing scope is reported as a 401 with a fault like
+	// {"resource": "AccessToken", "field": "activity:read_permission", "code": "missing"}
+	for _, f := range e.Errors {
+		if f.Code == "missing" && strings.Contains(f.Field, ":") {
+			return KindScope
+		}
+	}
+
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return KindAuth
+	case http.StatusBadRequest:
+		for _, f := range e.Errors {
+			if f.Field == "refresh_token" || f.Field == "client_secret" || f.Field == "client_id" {
+				return KindAuth
+			}
+		}
+	}
+	return KindUpstream
+}
+
+func (e *Error) Error() string {
+	var faults []string
+	for _, f := range e.Errors {
+		faults = append(faults, fmt.Sprintf("%s.%s %s", f.Resource, f.Field, f.Code))
+	}
+	return fmt.Sprintf("strava %s error on %s: %d %s [%s]", e.Kind(), e.Path, e.StatusCode, e.Message, strings.Join(faults, ", "))
+}
+
+// lets errors.Is(err, ErrRateLimited) keep working for callers that only care about throttling
+func (e *Error) Is(target error) bool {
+	return target == ErrRateLimited && e.Kind() == KindRateLimit
+}
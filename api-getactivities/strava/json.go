@@ -0,0 +1,160 @@
+package strava
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// strava is not strict about the shape of some fields, these decoders accept
+// every shape seen in practice so one odd activity does not fail a whole page
+
+var jsonNull = []byte("null")
+
+// ids arrive as numbers, as numeric strings, or as null
+type flexInt64 int64
+
+func (f *flexInt64) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, jsonNull) {
+		*f = 0
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if s == "" {
+			*f = 0
+			return nil
+		}
+		data = []byte(s)
+	}
+	n, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return fmt.Errorf("id %s is not an integer", data)
+	}
+	*f = flexInt64(n)
+	return nil
+}
+
+// timestamps arrive as RFC3339 strings, as unix seconds, or as null, and are kept as RFC3339 strings
+type flexTimestamp string
+
+func (f *flexTimestamp) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, jsonNull) {
+		*f = ""
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*f = flexTimestamp(s)
+		return nil
+	}
+	seconds, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return fmt.Errorf("timestamp %s is neither a string nor unix seconds", data)
+	}
+	*f = flexTimestamp(time.Unix(seconds, 0).UTC().Format(time.RFC3339))
+	return nil
+}
+
+// activities without gps send [] or null, both decode to the zero location
+func (l *Location) UnmarshalJSON(data []byte) error {
+	var coords []float64
+	if err := json.Unmarshal(data, &coords); err != nil {
+		return err
+	}
+	*l = Location{}
+	if len(coords) == 2 {
+		l[0], l[1] = coords[0], coords[1]
+	}
+	return nil
+}
+
+// the zero location is written back as [] so stored activities keep strava's shape
+func (l Location) MarshalJSON() ([]byte, error) {
+	if l == (Location{}) {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([2]float64(l))
+}
+
+func (a *AthleteSummary) UnmarshalJSON(data []byte) error {
+	type plain AthleteSummary
+	aux := struct {
+		*plain
+		Id flexInt64 `json:"id"`
+	}{plain: (*plain)(a)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	a.Id = int64(aux.Id)
+	return nil
+}
+
+func (a *ActivitySummary) UnmarshalJSON(data []byte) error {
+	type plain ActivitySummary
+	aux := struct {
+		*plain
+		Id             flexInt64     `json:"id"`
+		UploadId       flexInt64     `json:"upload_id"`
+		StartDate      flexTimestamp `json:"start_date"`
+		StartDateLocal flexTimestamp `json:"start_date_local"`
+	}{plain: (*plain)(a)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	a.Id = int64(aux.Id)
+	a.UploadId = int64(aux.UploadId)
+	a.StartDate = string(aux.StartDate)
+	a.StartDateLocal = string(aux.StartDateLocal)
+
+	// strava writes local time with a Z suffix, so it can be derived from the utc start
+	if a.StartDateLocal == "" && a.StartDate != "" {
+		if start, err := time.Parse(time.RFC3339, a.StartDate); err == nil {
+			local := start.UTC().Add(time.Duration(a.UtcOffset) * time.Second)
+			a.StartDateLocal = local.Format(time.RFC3339)
+		}
+	}
+	return nil
+}
+
+// ActivityDetailed needs its own decoder, otherwise the promoted
+// ActivitySummary one would decode only the summary fields
+func (a *ActivityDetailed) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.ActivitySummary); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &a.ActivityDetail)
+}
+
+// a page of activities where an element that still cannot be decoded is
+// dropped and logged instead of failing the page
+type ActivityList []ActivitySummary
+
+func (l *ActivityList) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	list := make(ActivityList, 0, len(raw))
+	for i, element := range raw {
+		var a ActivitySummary
+		if err := json.Unmarshal(element, &a); err != nil {
+			fmt.Println("skipping malformed activity at index", i, err)
+			continue
+		}
+		list = append(list, a)
+	}
+	*l = list
+	return nil
+}
@@ -0,0 +1,32 @@
+package strava_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/benchdata"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+var (
+	activities = benchdata.Activities(benchdata.ActivityCount)
+	encoded    = mustMarshal(activities)
+)
+
+func mustMarshal(v any) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func TestMain(m *testing.M) {
+	// a response the models have fallen behind fails the tests that decode it
+	strava.StrictDecode = true
+	strava.DisallowUnknownFields = true
+	benchdata.Main(m, benchdata.Benchmarks{
+		"BenchmarkDecodeActivities": BenchmarkDecodeActivities,
+		"BenchmarkEncodeActivities": BenchmarkEncodeActivities,
+	})
+}
@@ -0,0 +1,222 @@
+// Package strava is a client for the Strava v3 API and the models it returns,
+// importable by other programs without the rest of the service.
+package strava
+
+import "time"
+
+type AthleteSummary struct {
+	Id             int64 `json:"id"`
+	Resource_state int   `json:"resource_state"`
+}
+
+type Location [2]float64 // [longitude, latitude]
+
+type ActivitySummary struct {
+	Resource_state     int64          `json:"resource_state"` // 1 for “summary”, 2 for “detail”
+	Athlete            AthleteSummary `json:"athlete"`
+	Name               string         `json:"name"`
+	Distance           float64        `json:"distance"`
+	MovingTime         int            `json:"moving_time"`
+	ElapsedTime        int            `json:"elapsed_time"`
+	TotalElevationGain float64        `json:"total_elevation_gain"`
+	Type               string         `json:"type"`       // legacy type, see SportType
+	SportType          string         `json:"sport_type"` // e.g. TrailRun where type is only Run
+	WorkoutType        int            `json:"workout_type"`
+	Id                 int64          `json:"id"`
+	StartDate          string         `json:"start_date"`
+	StartDateLocal     string         `json:"start_date_local"`
+	TimeZone           string         `json:"timezone"`
+	UtcOffset          int            `json:"utc_offset"`
+	City               string         `json:"location_city"`
+	State              string         `json:"location_state"`
+	Country            string         `json:"location_country"`
+	AchievementCount   int            `json:"achievement_count"`
+	KudosCount         int            `json:"kudos_count"`
+	CommentCount       int            `json:"comment_count"`
+	AthleteCount       int            `json:"athlete_count"`
+	PhotoCount         int            `json:"photo_count"`
+	Map                struct {
+		Id              string `json:"id"`
+		SummaryPolyline string `json:"summary_polyline"`
+		Resource_state  int    `json:"resource_state"`
+	} `json:"map"`
+	Trainer              bool     `json:"trainer"`
+	Commute              bool     `json:"commute"`
+	Manual               bool     `json:"manual"`
+	Private              bool     `json:"private"`
+	Visibility           string   `json:"visibility"`     // everyone, followers_only or only_me
+	HideFromHome         bool     `json:"hide_from_home"` // muted, kept out of followers' feeds
+	Flagged              bool     `json:"flagged"`
+	GearId               string   `json:"gear_id"` // bike or pair of shoes
+	StartLocation        Location `json:"start_latlng"`
+	EndLocation          Location `json:"end_latlng"`
+	AverageSpeed         float64  `json:"average_speed"`
+	MaximunSpeed         float64  `json:"max_speed"`
+	AverageCadence       float64  `json:"average_cadence"`
+	AverageWatts         float64  `json:"average_watts"`
+	DeviceWatts          bool     `json:"device_watts"` // measured by a power meter rather than estimated
+	HasHeartrate         bool     `json:"has_heartrate"`
+	AverageHeartrate     float64  `json:"average_heartrate"`
+	MaxHeartrate         float64  `json:"max_heartrate"`
+	HeartRateOptOut      bool     `json:"heartrate_opt_out"`
+	DisplayHideHeartrate bool     `json:"display_hide_heartrate_option"`
+	ElevHigh             float64  `json:"elev_high"`
+	ElevLow              float64  `json:"elev_low"`
+	UploadId             int64    `json:"upload_id"`
+	UploadIdString       string   `json:"upload_id_str"`
+	ExternalId           string   `json:"external_id"`
+	FromAcceptedTag      bool     `json:"from_accepted_tag"`
+	PrCount              int      `json:"pr_count"`
+	TotalPhotoCount      int      `json:"total_photo_count"`
+	HasKudoed            bool     `json:"has_kudoed"`
+}
+
+type AthleteProfile struct {
+	Id                    int64         `json:"id"`
+	Username              string        `json:"username"`
+	Firstname             string        `json:"firstname"`
+	Lastname              string        `json:"lastname"`
+	Bio                   string        `json:"bio"`
+	City                  string        `json:"city"`
+	State                 string        `json:"state"`
+	Country               string        `json:"country"`
+	Sex                   string        `json:"sex"`
+	Premium               bool          `json:"premium"`
+	Summit                bool          `json:"summit"`
+	CreatedAt             string        `json:"created_at"`
+	UpdatedAt             string        `json:"updated_at"`
+	Weight                float64       `json:"weight"`
+	Ftp                   int           `json:"ftp"`
+	MeasurementPreference string        `json:"measurement_preference"`
+	FollowerCount         *int          `json:"follower_count,omitempty"` // see apiversion.FollowerCounts
+	FriendCount           *int          `json:"friend_count,omitempty"`
+	ProfileMedium         string        `json:"profile_medium"`
+	Profile               string        `json:"profile"`
+	Bikes                 []SummaryGear `json:"bikes"`
+	Shoes                 []SummaryGear `json:"shoes"`
+}
+
+// SummaryGear is a bike or pair of shoes as listed on the detailed athlete
+type SummaryGear struct {
+	Id            string  `json:"id"`
+	Primary       bool    `json:"primary"`
+	Name          string  `json:"name"`
+	ResourceState int     `json:"resource_state"`
+	Distance      float64 `json:"distance"` // meters
+}
+
+type AthleteCredentials = struct {
+	Id             int64     `json:"id"`
+	Username       string    `json:"username"`
+	Resource_state int       `json:"resource_state"`
+	Firstname      string    `json:"firstname"`
+	Lastname       string    `json:"lastname"`
+	Bio            string    `json:"bio"`
+	City           string    `json:"city"`
+	State          string    `json:"state"`
+	Country        string    `json:"country"`
+	Sex            string    `json:"sex"`
+	Premium        bool      `json:"premium"`
+	Summit         bool      `json:"summit"`
+	Created_at     time.Time `json:"created_at"`
+	Updated_at     time.Time `json:"updated_at"`
+	Badge_type_id  int       `json:"badge_type_id"`
+	Weight         float64   `json:"weight"`
+	Profile_medium string    `json:"profile_medium"`
+	Profile        string    `json:"profile"`
+	Friend         bool      `json:"friend"`
+	Follower       bool      `json:"follower"`
+}
+
+type Credentials = struct {
+	Client_id     int                `json:"client_id"`
+	Client_secret string             `json:"client_secret"`
+	Token_type    string             `json:"token_type"`
+	Expires_at    int64              `json:"expires_at"`
+	Expires_in    int64              `json:"expires_in"`
+	Refresh_token string             `json:"refresh_token"`
+	Access_token  string             `json:"access_token"`
+	Athlete       AthleteCredentials `json:"athlete"`
+	Scope         string             `json:"scope,omitempty"` // comma separated scopes granted at authorization
+}
+
+type Payload = struct {
+	Client_id     int    `json:"client_id"`
+	Client_secret string `json:"client_secret"`
+	Refresh_token string `json:"refresh_token,omitempty"`
+	Code          string `json:"code,omitempty"`
+	Grant_type    string `json:"grant_type"`
+	F             string `json:"f"`
+}
+
+type Split struct {
+	Distance            float64 `json:"distance"`
+	ElapsedTime         int     `json:"elapsed_time"`
+	MovingTime          int     `json:"moving_time"`
+	ElevationDifference float64 `json:"elevation_difference"`
+	AverageSpeed        float64 `json:"average_speed"`
+	AverageHeartrate    float64 `json:"average_heartrate"`
+	PaceZone            int     `json:"pace_zone"`
+	Split               int     `json:"split"`
+}
+
+type BestEffort struct {
+	Id          int64   `json:"id"`
+	Name        string  `json:"name"`
+	Distance    float64 `json:"distance"`
+	ElapsedTime int     `json:"elapsed_time"`
+	MovingTime  int     `json:"moving_time"`
+	StartDate   string  `json:"start_date"`
+	PrRank      int     `json:"pr_rank"`
+}
+
+type ActivityDetailed struct {
+	ActivitySummary
+	ActivityDetail
+}
+
+// the fields strava only returns from /activities/:id
+type ActivityDetail struct {
+	Description    string       `json:"description"`
+	PrivateNote    string       `json:"private_note,omitempty"` // only the athlete sees it on strava
+	Calories       float64      `json:"calories"`
+	DeviceName     string       `json:"device_name"`
+	SplitsMetric   []Split      `json:"splits_metric"`
+	SplitsStandard []Split      `json:"splits_standard"`
+	BestEfforts    []BestEffort `json:"best_efforts"`
+
+	Gear              *SummaryGear           `json:"gear,omitempty"`
+	PerceivedExertion *float64               `json:"perceived_exertion,omitempty"` // see apiversion.PerceivedExertion
+	SegmentEfforts    []SegmentEffortSummary `json:"segment_efforts"`              // empty, not nil, when the activity has none
+}
+
+type SegmentEffortSummary struct {
+	Id             int64   `json:"id"`
+	ActivityId     int64   `json:"activity_id"`
+	ElapsedTime    int     `json:"elapsed_time"`
+	StartDate      string  `json:"start_date"`
+	StartDateLocal string  `json:"start_date_local"`
+	Distance       float64 `json:"distance"`
+	IsKom          bool    `json:"is_kom"`
+}
+
+// ZoneRange is one zone in whole bpm or watts, Max is -1 for the open top zone
+type ZoneRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+type HeartRateZoneRanges struct {
+	CustomZones bool        `json:"custom_zones"`
+	Zones       []ZoneRange `json:"zones"`
+}
+
+type PowerZoneRanges struct {
+	Zones []ZoneRange `json:"zones"`
+}
+
+// Zones are the athlete's zones from /athlete/zones, power only when they have set an ftp
+type Zones struct {
+	HeartRate *HeartRateZoneRanges `json:"heart_rate,omitempty"`
+	Power     *PowerZoneRanges     `json:"power,omitempty"`
+}
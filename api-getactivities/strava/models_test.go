@@ -0,0 +1,29 @@
+package strava_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// the activity arrays the index, the reports and the analytics read
+func BenchmarkDecodeActivities(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(encoded)))
+	for i := 0; i < b.N; i++ {
+		var decoded []strava.ActivitySummary
+		if err := json.Unmarshal(encoded, &decoded); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeActivities(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(activities); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package strava
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Photo is a photo of an activity as /activities/:id/photos lists it; Urls
+// are keyed by the size asked for, the longest side in pixels
+type Photo struct {
+	UniqueId       string            `json:"unique_id"`
+	ActivityId     int64             `json:"activity_id"`
+	Caption        string            `json:"caption"`
+	Source         int               `json:"source"` // 1 for strava, 2 for instagram
+	CreatedAt      string            `json:"created_at"`
+	CreatedAtLocal string            `json:"created_at_local"`
+	Urls           map[string]string `json:"urls"`
+	Sizes          map[string][2]int `json:"sizes,omitempty"`
+	Location       Location          `json:"location"`
+}
+
+// ListActivityPhotos lists the activity's photos with their urls at size
+func ListActivityPhotos(client *http.Client, access_token string, activityId int64, size int) ([]Photo, error) {
+	parm := url.Values{}
+	parm.Add("size", strconv.Itoa(size))
+	parm.Add("photo_sources", "true")
+
+	photos := []Photo{}
+	err := GetJSON(client, access_token, fmt.Sprintf("/activities/%d/photos", activityId), parm, &photos)
+	return photos, err
+}
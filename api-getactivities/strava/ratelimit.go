@@ -0,0 +1,62 @@
+package strava
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrRateLimited = errors.New("strava rate limit exceeded")
+
+// usage as last reported by strava, index 0 is the 15 minute window and 1 the daily window
+type RateLimit struct {
+	mu    sync.Mutex
+	limit [2]int
+	usage [2]int
+}
+
+var Limits = &RateLimit{}
+
+// X-RateLimit-Limit and X-RateLimit-Usage look like "200,2000" and "12,340"
+func parseRateLimitHeader(value string) ([2]int, bool) {
+	var out [2]int
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return out, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return out, false
+		}
+		out[i] = n
+	}
+	return out, true
+}
+
+func (r *RateLimit) Update(res *http.Response) {
+	limit, okLimit := parseRateLimitHeader(res.Header.Get("X-RateLimit-Limit"))
+	usage, okUsage := parseRateLimitHeader(res.Header.Get("X-RateLimit-Usage"))
+	if !okLimit || !okUsage {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limit = limit
+	r.usage = usage
+}
+
+// reports whether usage in either window has reached the given fraction of its limit
+func (r *RateLimit) NearLimit(fraction float64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.limit {
+		if r.limit[i] > 0 && float64(r.usage[i]) >= fraction*float64(r.limit[i]) {
+			return true
+		}
+	}
+	return false
+}
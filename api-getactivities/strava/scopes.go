@@ -0,0 +1,57 @@
+package strava
+
+import "strings"
+
+const (
+	ScopeRead            = "read"
+	ScopeReadAll         = "read_all"
+	ScopeProfileReadAll  = "profile:read_all"
+	ScopeProfileWrite    = "profile:write"
+	ScopeActivityRead    = "activity:read"
+	ScopeActivityReadAll = "activity:read_all"
+	ScopeActivityWrite   = "activity:write"
+)
+
+// broader scopes that also grant the key
+var scopeImpliedBy = map[string][]string{
+	ScopeRead:         {ScopeReadAll},
+	ScopeActivityRead: {ScopeActivityReadAll},
+}
+
+func ParseScopes(scope string) map[string]bool {
+	granted := make(map[string]bool)
+	for _, s := range strings.Split(scope, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			granted[s] = true
+		}
+	}
+	return granted
+}
+
+func HasScope(granted map[string]bool, scope string) bool {
+	if granted[scope] {
+		return true
+	}
+	for _, broader := range scopeImpliedBy[scope] {
+		if granted[broader] {
+			return true
+		}
+	}
+	return false
+}
+
+// scopes from required that the credentials don't grant, nil when the granted
+// scopes were never recorded since there is nothing to validate against
+func MissingScopes(creds Credentials, required []string) []string {
+	if creds.Scope == "" {
+		return nil
+	}
+	granted := ParseScopes(creds.Scope)
+	var missing []string
+	for _, scope := range required {
+		if !HasScope(granted, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
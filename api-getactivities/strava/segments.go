@@ -0,0 +1,144 @@
+package strava
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Segment is a segment as strava lists and details it; the counts and the
+// map are only on the detailed segment
+type Segment struct {
+	Id                 int64    `json:"id"`
+	Name               string   `json:"name"`
+	ActivityType       string   `json:"activity_type"`
+	Distance           float64  `json:"distance"` // meters
+	AverageGrade       float64  `json:"average_grade"`
+	MaximumGrade       float64  `json:"maximum_grade"`
+	ElevationHigh      float64  `json:"elevation_high"`
+	ElevationLow       float64  `json:"elevation_low"`
+	TotalElevationGain float64  `json:"total_elevation_gain,omitempty"`
+	StartLatlng        Location `json:"start_latlng"`
+	EndLatlng          Location `json:"end_latlng"`
+	ClimbCategory      int      `json:"climb_category"`
+	City               string   `json:"city"`
+	State              string   `json:"state"`
+	Country            string   `json:"country"`
+	Private            bool     `json:"private"`
+	Starred            bool     `json:"starred"`
+	EffortCount        int      `json:"effort_count,omitempty"`
+	AthleteCount       int      `json:"athlete_count,omitempty"`
+	StarCount          int      `json:"star_count,omitempty"`
+	Map                *struct {
+		Polyline string `json:"polyline"`
+	} `json:"map,omitempty"`
+}
+
+// ListStarredSegments pages through the athlete's starred segments
+func ListStarredSegments(client *http.Client, access_token string) ([]Segment, error) {
+	segments := []Segment{}
+	for page := 1; ; page++ {
+		parm := url.Values{}
+		parm.Add("per_page", "200")
+		parm.Add("page", strconv.Itoa(page))
+
+		var fetched []Segment
+		if err := GetJSON(client, access_token, "/segments/starred", parm, &fetched); err != nil {
+			return segments, err
+		}
+		segments = append(segments, fetched...)
+		if len(fetched) < 200 {
+			return segments, nil
+		}
+	}
+}
+
+func GetSegment(client *http.Client, access_token string, segmentId int64) (Segment, error) {
+	var segment Segment
+	err := GetJSON(client, access_token, fmt.Sprintf("/segments/%d", segmentId), nil, &segment)
+	return segment, err
+}
+
+// StarSegment stars or unstars the segment for the athlete, which needs the
+// profile:write scope, and returns it as it now is
+func StarSegment(client *http.Client, access_token string, segmentId int64, starred bool) (Segment, error) {
+	var segment Segment
+	path := fmt.Sprintf("/segments/%d/starred", segmentId)
+
+	form := url.Values{}
+	form.Add("starred", strconv.FormatBool(starred))
+
+	req, err := http.NewRequest("PUT", APIBase+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return segment, err
+	}
+	req.Header.Add("Authorization", "Bearer "+access_token)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return segment, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return segment, DecodeError(res, path)
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&segment)
+	return segment, err
+}
+
+// ExplorerSegment is a popular segment as /segments/explore lists it
+type ExplorerSegment struct {
+	Id                int64    `json:"id"`
+	Name              string   `json:"name"`
+	ClimbCategory     int      `json:"climb_category"`
+	ClimbCategoryDesc string   `json:"climb_category_desc"`
+	AverageGrade      float64  `json:"avg_grade"`
+	StartLatlng       Location `json:"start_latlng"`
+	EndLatlng         Location `json:"end_latlng"`
+	ElevationDiff     float64  `json:"elev_difference"`
+	Distance          float64  `json:"distance"` // meters
+	Points            string   `json:"points"`   // encoded polyline
+	Starred           bool     `json:"starred"`
+}
+
+// ExploreParams narrow /segments/explore, zero values are left out
+type ExploreParams struct {
+	Bounds       [4]float64 // south west latitude and longitude, then north east
+	ActivityType string     // running or riding
+	MinCategory  int
+	MaxCategory  int
+}
+
+// ExploreSegments lists up to 10 of the most popular segments within the bounds
+func ExploreSegments(client *http.Client, access_token string, params ExploreParams) ([]ExplorerSegment, error) {
+	bounds := make([]string, len(params.Bounds))
+	for i, b := range params.Bounds {
+		bounds[i] = strconv.FormatFloat(b, 'f', -1, 64)
+	}
+	parm := url.Values{}
+	parm.Add("bounds", strings.Join(bounds, ","))
+	if params.ActivityType != "" {
+		parm.Add("activity_type", params.ActivityType)
+	}
+	if params.MinCategory > 0 {
+		parm.Add("min_cat", strconv.Itoa(params.MinCategory))
+	}
+	if params.MaxCategory > 0 {
+		parm.Add("max_cat", strconv.Itoa(params.MaxCategory))
+	}
+
+	var explored struct {
+		Segments []ExplorerSegment `json:"segments"`
+	}
+	err := GetJSON(client, access_token, "/segments/explore", parm, &explored)
+	if explored.Segments == nil {
+		explored.Segments = []ExplorerSegment{}
+	}
+	return explored.Segments, err
+}
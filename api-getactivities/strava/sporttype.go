@@ -0,0 +1,146 @@
+package strava
+
+import (
+	"fmt"
+	"strings"
+)
+
+// strava's sport_type enum, the legacy type enum is a subset of it
+const (
+	SportAlpineSki                     = "AlpineSki"
+	SportBackcountrySki                = "BackcountrySki"
+	SportBadminton                     = "Badminton"
+	SportCanoeing                      = "Canoeing"
+	SportCrossfit                      = "Crossfit"
+	SportEBikeRide                     = "EBikeRide"
+	SportElliptical                    = "Elliptical"
+	SportEMountainBikeRide             = "EMountainBikeRide"
+	SportGolf                          = "Golf"
+	SportGravelRide                    = "GravelRide"
+	SportHandcycle                     = "Handcycle"
+	SportHighIntensityIntervalTraining = "HighIntensityIntervalTraining"
+	SportHike                          = "Hike"
+	SportIceSkate                      = "IceSkate"
+	SportInlineSkate                   = "InlineSkate"
+	SportKayaking                      = "Kayaking"
+	SportKitesurf                      = "Kitesurf"
+	SportMountainBikeRide              = "MountainBikeRide"
+	SportNordicSki                     = "NordicSki"
+	SportPickleball                    = "Pickleball"
+	SportPilates                       = "Pilates"
+	SportRacquetball                   = "Racquetball"
+	SportRide                          = "Ride"
+	SportRockClimbing                  = "RockClimbing"
+	SportRollerSki                     = "RollerSki"
+	SportRowing                        = "Rowing"
+	SportRun                           = "Run"
+	SportSail                          = "Sail"
+	SportSkateboard                    = "Skateboard"
+	SportSnowboard                     = "Snowboard"
+	SportSnowshoe                      = "Snowshoe"
+	SportSoccer                        = "Soccer"
+	SportSquash                        = "Squash"
+	SportStairStepper                  = "StairStepper"
+	SportStandUpPaddling               = "StandUpPaddling"
+	SportSurfing                       = "Surfing"
+	SportSwim                          = "Swim"
+	SportTableTennis                   = "TableTennis"
+	SportTennis                        = "Tennis"
+	SportTrailRun                      = "TrailRun"
+	SportVelomobile                    = "Velomobile"
+	SportVirtualRide                   = "VirtualRide"
+	SportVirtualRow                    = "VirtualRow"
+	SportVirtualRun                    = "VirtualRun"
+	SportWalk                          = "Walk"
+	SportWeightTraining                = "WeightTraining"
+	SportWheelchair                    = "Wheelchair"
+	SportWindsurf                      = "Windsurf"
+	SportWorkout                       = "Workout"
+	SportYoga                          = "Yoga"
+)
+
+var SportTypes = []string{
+	SportAlpineSki, SportBackcountrySki, SportBadminton, SportCanoeing, SportCrossfit,
+	SportEBikeRide, SportElliptical, SportEMountainBikeRide, SportGolf, SportGravelRide,
+	SportHandcycle, SportHighIntensityIntervalTraining, SportHike, SportIceSkate, SportInlineSkate,
+	SportKayaking, SportKitesurf, SportMountainBikeRide, SportNordicSki, SportPickleball,
+	SportPilates, SportRacquetball, SportRide, SportRockClimbing, SportRollerSki,
+	SportRowing, SportRun, SportSail, SportSkateboard, SportSnowboard,
+	SportSnowshoe, SportSoccer, SportSquash, SportStairStepper, SportStandUpPaddling,
+	SportSurfing, SportSwim, SportTableTennis, SportTennis, SportTrailRun,
+	SportVelomobile, SportVirtualRide, SportVirtualRow, SportVirtualRun, SportWalk,
+	SportWeightTraining, SportWheelchair, SportWindsurf, SportWorkout, SportYoga,
+}
+
+// the legacy type strava reports for sport types that were added after type was frozen,
+// every other sport type is also a legacy type of the same name
+var sportTypeLegacy = map[string]string{
+	SportBadminton:                     SportWorkout,
+	SportEMountainBikeRide:             SportEBikeRide,
+	SportGravelRide:                    SportRide,
+	SportHighIntensityIntervalTraining: SportWorkout,
+	SportMountainBikeRide:              SportRide,
+	SportPickleball:                    SportWorkout,
+	SportPilates:                       SportWorkout,
+	SportRacquetball:                   SportWorkout,
+	SportSquash:                        SportWorkout,
+	SportTableTennis:                   SportWorkout,
+	SportTennis:                        SportWorkout,
+	SportTrailRun:                      SportRun,
+	SportVirtualRow:                    SportRowing,
+}
+
+// accepts any casing since filters arrive from query strings
+func CanonicalSportType(name string) (string, bool) {
+	for _, sport := range SportTypes {
+		if strings.EqualFold(sport, name) {
+			return sport, true
+		}
+	}
+	return "", false
+}
+
+func LegacyActivityType(sportType string) string {
+	if legacy, ok := sportTypeLegacy[sportType]; ok {
+		return legacy
+	}
+	return sportType
+}
+
+// sport_type when strava sent it, older activities and stored data only have type
+func NormalizeSportType(sportType string, legacyType string) string {
+	if sport, ok := CanonicalSportType(sportType); ok {
+		return sport
+	}
+	if sport, ok := CanonicalSportType(legacyType); ok {
+		return sport
+	}
+	return legacyType
+}
+
+// a filter on a legacy type like Ride also matches its newer sport types like
+// GravelRide, a filter on a specific sport type only matches that sport type
+func MatchesActivityType(filters []string, sportType string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, f := range filters {
+		if f == sportType || f == LegacyActivityType(sportType) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSportTypes reads a comma separated list such as Ride,TrailRun, either enum is accepted
+func ParseSportTypes(raw string) ([]string, error) {
+	var sports []string
+	for _, name := range strings.Split(raw, ",") {
+		sport, ok := CanonicalSportType(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown activity type %q", name)
+		}
+		sports = append(sports, sport)
+	}
+	return sports, nil
+}
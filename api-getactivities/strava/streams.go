@@ -0,0 +1,53 @@
+package strava
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Stream is one channel of samples, all streams of an activity share the same length
+type Stream[T any] struct {
+	Data         []T    `json:"data"`
+	SeriesType   string `json:"series_type"` // distance or time, what the samples are indexed by
+	OriginalSize int    `json:"original_size"`
+	Resolution   string `json:"resolution"`
+}
+
+// StreamSet is the key_by_type form of /activities/:id/streams, channels the
+// device did not record are nil
+type StreamSet struct {
+	Time           *Stream[int]      `json:"time,omitempty"` // seconds since the start
+	Distance       *Stream[float64]  `json:"distance,omitempty"`
+	LatLng         *Stream[Location] `json:"latlng,omitempty"`
+	Altitude       *Stream[float64]  `json:"altitude,omitempty"`
+	VelocitySmooth *Stream[float64]  `json:"velocity_smooth,omitempty"`
+	Heartrate      *Stream[int]      `json:"heartrate,omitempty"`
+	Cadence        *Stream[int]      `json:"cadence,omitempty"`
+	Watts          *Stream[int]      `json:"watts,omitempty"`
+	Temp           *Stream[int]      `json:"temp,omitempty"`
+	Moving         *Stream[bool]     `json:"moving,omitempty"`
+	GradeSmooth    *Stream[float64]  `json:"grade_smooth,omitempty"`
+}
+
+var StreamKeys = []string{"time", "distance", "latlng", "altitude", "velocity_smooth", "heartrate", "cadence", "watts", "temp", "moving", "grade_smooth"}
+
+// Len is the number of samples, taken from the time stream every recorded activity has
+func (s StreamSet) Len() int {
+	if s.Time == nil {
+		return 0
+	}
+	return len(s.Time.Data)
+}
+
+// GetStreams fetches every stream strava has for the activity at full resolution
+func GetStreams(client *http.Client, access_token string, activityId int64) (StreamSet, error) {
+	parm := url.Values{}
+	parm.Add("keys", strings.Join(StreamKeys, ","))
+	parm.Add("key_by_type", "true")
+
+	var streams StreamSet
+	err := GetJSON(client, access_token, fmt.Sprintf("/activities/%d/streams", activityId), parm, &streams)
+	return streams, err
+}
@@ -0,0 +1,169 @@
+package strava
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+)
+
+// STRAVA_STRICT_DECODE=true records every field strava sends that the models
+// do not have, so model updates can be driven by what strava actually returns.
+// Decoder.DisallowUnknownFields stops at the first unknown field and is not
+// honoured by custom UnmarshalJSON methods, so the payload is walked instead.
+// With STRAVA_STRICT_DECODE=fail, as the package tests run, those responses
+// also fail to decode with ErrUnknownFields.
+var (
+	strictDecodeMode      = env.String("STRAVA_STRICT_DECODE", "")
+	StrictDecode          = strictDecodeMode == "true" || strictDecodeMode == "fail"
+	DisallowUnknownFields = strictDecodeMode == "fail"
+)
+
+var ErrUnknownFields = errors.New("strava response has fields the models do not have")
+
+type UnknownField struct {
+	Field     string `json:"field"`      // e.g. ActivitySummary.suffer_score
+	Count     int    `json:"count"`      // times it has been seen since start
+	FirstPath string `json:"first_path"` // strava path of the first response it was seen in
+}
+
+type DecodeReport struct {
+	mu     sync.Mutex
+	fields map[string]*UnknownField
+}
+
+var Report = &DecodeReport{fields: make(map[string]*UnknownField)}
+
+// records the fields of body that out does not have, and returns them sorted
+func (r *DecodeReport) inspect(path string, body []byte, out interface{}) []string {
+	var raw interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil
+	}
+
+	found := map[string]bool{}
+	collectUnknownFields(raw, reflect.TypeOf(out), "", found)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	unknown := []string{}
+	for field := range found {
+		unknown = append(unknown, field)
+		if seen, ok := r.fields[field]; ok {
+			seen.Count++
+			continue
+		}
+		fmt.Println("strict decode: unmodelled field", field, "in", path)
+		r.fields[field] = &UnknownField{Field: field, Count: 1, FirstPath: path}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+func (r *DecodeReport) Snapshot() []UnknownField {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fields := []UnknownField{}
+	for _, f := range r.fields {
+		fields = append(fields, *f)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].Count != fields[j].Count {
+			return fields[i].Count > fields[j].Count
+		}
+		return fields[i].Field < fields[j].Field
+	})
+	return fields
+}
+
+// json names of a struct's fields, including those promoted from embedded structs
+func jsonFieldTypes(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for n, ft := range jsonFieldTypes(embedded) {
+					if _, ok := fields[n]; !ok {
+						fields[n] = ft
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func collectUnknownFields(raw interface{}, t reflect.Type, prefix string, found map[string]bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch value := raw.(type) {
+	case map[string]interface{}:
+		if t.Kind() == reflect.Map {
+			for _, v := range value {
+				collectUnknownFields(v, t.Elem(), prefix, found)
+			}
+			return
+		}
+		if t.Kind() != reflect.Struct {
+			return
+		}
+		if prefix == "" || t.Name() != "" {
+			prefix = t.Name()
+		}
+		known := jsonFieldTypes(t)
+		for key, v := range value {
+			ft, ok := matchJSONField(known, key)
+			if !ok {
+				found[prefix+"."+key] = true
+				continue
+			}
+			collectUnknownFields(v, ft, prefix+"."+key, found)
+		}
+	case []interface{}:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return
+		}
+		for _, v := range value {
+			collectUnknownFields(v, t.Elem(), prefix, found)
+		}
+	}
+}
+
+// encoding/json matches keys case-insensitively when there is no exact match
+func matchJSONField(known map[string]reflect.Type, key string) (reflect.Type, bool) {
+	if ft, ok := known[key]; ok {
+		return ft, true
+	}
+	for name, ft := range known {
+		if strings.EqualFold(name, key) {
+			return ft, true
+		}
+	}
+	return nil, false
+}
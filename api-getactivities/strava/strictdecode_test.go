@@ -0,0 +1,66 @@
+package strava_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+func TestStrictDecode(t *testing.T) {
+	bodies := map[string]string{
+		"/athlete/modelled": `{"id": 1, "firstname": "Ann", "bikes": [{"id": "b1", "name": "road"}]}`,
+		"/athlete/top":      `{"id": 1, "firstname": "Ann", "badge_type_id": 1}`,
+		"/athlete/nested":   `{"id": 1, "bikes": [{"id": "b1", "converted_distance": 1.5}]}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(bodies[r.URL.Path]))
+	}))
+	defer server.Close()
+	defer func(base string) { strava.APIBase = base }(strava.APIBase)
+	strava.APIBase = server.URL
+
+	cases := []struct {
+		path    string
+		unknown string // "" when every field is modelled
+	}{
+		{"/athlete/modelled", ""},
+		{"/athlete/top", "AthleteProfile.badge_type_id"},
+		{"/athlete/nested", "SummaryGear.converted_distance"},
+	}
+	for _, tc := range cases {
+		var athlete strava.AthleteProfile
+		err := strava.GetJSON(server.Client(), "token", tc.path, nil, &athlete)
+		if tc.unknown == "" {
+			if err != nil || athlete.Firstname != "Ann" {
+				t.Errorf("%s: %+v, %v", tc.path, athlete, err)
+			}
+			continue
+		}
+		if !errors.Is(err, strava.ErrUnknownFields) {
+			t.Errorf("%s: decoded with an unknown field, %v", tc.path, err)
+		}
+		if !reported(tc.unknown) {
+			t.Errorf("%s: %s is not in the decode report", tc.path, tc.unknown)
+		}
+	}
+
+	// only recorded when not disallowed, as in production
+	strava.DisallowUnknownFields = false
+	defer func() { strava.DisallowUnknownFields = true }()
+	var athlete strava.AthleteProfile
+	if err := strava.GetJSON(server.Client(), "token", "/athlete/top", nil, &athlete); err != nil || athlete.Firstname != "Ann" {
+		t.Errorf("recording only: %+v, %v", athlete, err)
+	}
+}
+
+func reported(field string) bool {
+	for _, f := range strava.Report.Snapshot() {
+		if f.Field == field {
+			return true
+		}
+	}
+	return false
+}
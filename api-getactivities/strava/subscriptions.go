@@ -0,0 +1,88 @@
+package strava
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// PushSubscription is the app's webhook subscription, strava allows one per app
+type PushSubscription struct {
+	Id            int64  `json:"id"`
+	ResourceState int    `json:"resource_state"`
+	ApplicationId int64  `json:"application_id"`
+	CallbackURL   string `json:"callback_url"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+}
+
+// the subscription calls authenticate as the app rather than an athlete
+func appParams(app Credentials) url.Values {
+	return url.Values{
+		"client_id":     {strconv.Itoa(app.Client_id)},
+		"client_secret": {app.Client_secret},
+	}
+}
+
+func ListPushSubscriptions(client *http.Client, app Credentials) ([]PushSubscription, error) {
+	var subscriptions []PushSubscription
+
+	res, err := client.Get(APIBase + "/push_subscriptions?" + appParams(app).Encode())
+	if err != nil {
+		return subscriptions, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return subscriptions, DecodeError(res, "/push_subscriptions")
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&subscriptions)
+	return subscriptions, err
+}
+
+// CreatePushSubscription returns once strava has validated callbackURL, which
+// must answer GET with hub.challenge when given verifyToken
+func CreatePushSubscription(client *http.Client, app Credentials, callbackURL string, verifyToken string) (int64, error) {
+	parm := appParams(app)
+	parm.Add("callback_url", callbackURL)
+	parm.Add("verify_token", verifyToken)
+
+	res, err := client.PostForm(APIBase+"/push_subscriptions", parm)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+		return 0, DecodeError(res, "/push_subscriptions")
+	}
+
+	var created struct {
+		Id int64 `json:"id"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&created)
+	return created.Id, err
+}
+
+func DeletePushSubscription(client *http.Client, app Credentials, id int64) error {
+	path := fmt.Sprintf("/push_subscriptions/%d", id)
+
+	req, err := http.NewRequest("DELETE", APIBase+path+"?"+appParams(app).Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		return DecodeError(res, path)
+	}
+	return nil
+}
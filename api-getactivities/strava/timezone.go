@@ -0,0 +1,71 @@
+package strava
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // zone names resolve on slim images without /usr/share/zoneinfo
+)
+
+// strava writes an activity's timezone as "(GMT-07:00) America/Denver", the
+// offset being the zone's standard one and not necessarily the one in effect
+var timeZonePattern = regexp.MustCompile(`^\(GMT([+-])(\d{2}):(\d{2})\)\s*(.*)$`)
+
+// ParseTimeZone reads strava's timezone field; the IANA name is used when this
+// system knows it, otherwise a fixed zone at the GMT offset
+func ParseTimeZone(field string) (*time.Location, error) {
+	field = strings.TrimSpace(field)
+	m := timeZonePattern.FindStringSubmatch(field)
+	if m == nil {
+		// a bare IANA name, as some older activities have
+		if loc, err := time.LoadLocation(field); err == nil && field != "" {
+			return loc, nil
+		}
+		return nil, fmt.Errorf("timezone %q is not like (GMT-07:00) America/Denver", field)
+	}
+
+	if loc, err := time.LoadLocation(m[4]); err == nil && m[4] != "" {
+		return loc, nil
+	}
+	hours, _ := strconv.Atoi(m[2])
+	minutes, _ := strconv.Atoi(m[3])
+	offset := hours*3600 + minutes*60
+	if m[1] == "-" {
+		offset = -offset
+	}
+	return time.FixedZone("GMT"+m[1]+m[2]+":"+m[3], offset), nil
+}
+
+// Zone is where the activity started, a fixed zone at utc_offset when the
+// timezone field is missing or unreadable
+func (a ActivitySummary) Zone() *time.Location {
+	if loc, err := ParseTimeZone(a.TimeZone); err == nil {
+		return loc
+	}
+	if a.UtcOffset == 0 {
+		return time.UTC
+	}
+	return time.FixedZone("", a.UtcOffset)
+}
+
+// StartTime is the instant the activity started, in its own zone; unlike
+// start_date_local, which strava writes with a Z, it formats with the real offset
+func (a ActivitySummary) StartTime() (time.Time, error) {
+	zone := a.Zone()
+	if a.StartDate != "" {
+		start, err := time.Parse(time.RFC3339, a.StartDate)
+		if err != nil {
+			return start, err
+		}
+		return start.In(zone), nil
+	}
+
+	// only the local wall clock is known
+	local, err := time.Parse(time.RFC3339, a.StartDateLocal)
+	if err != nil {
+		return local, err
+	}
+	return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), 0, zone), nil
+}
@@ -0,0 +1,156 @@
+package strava
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/env"
+)
+
+// wraps a round tripper with one concern, e.g. logging or retries
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// the first middleware is the outermost, so it sees the request first and the response last
+func ChainTransport(base http.RoundTripper, middleware ...Middleware) http.RoundTripper {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		base = middleware[i](base)
+	}
+	return base
+}
+
+// STRAVA_MAX_ATTEMPTS counts the first try, 1 disables retries
+var MaxAttempts = env.Int("STRAVA_MAX_ATTEMPTS", 3)
+
+const UserAgent = "golang-strava-api/1.0"
+
+const TraceHeader = "X-Request-Id"
+
+func WithUserAgent(agent string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			req.Header.Set("User-Agent", agent)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// tags every upstream call with an id so its log lines can be correlated
+func WithTracing() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(TraceHeader) == "" {
+				id := make([]byte, 8)
+				rand.Read(id)
+				req = req.Clone(req.Context())
+				req.Header.Set(TraceHeader, hex.EncodeToString(id))
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// runs each request under ctx, so the calls are canceled with it, e.g. when
+// the inbound request they are made for times out
+func WithContext(ctx context.Context) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return next.RoundTrip(req.WithContext(ctx))
+		})
+	}
+}
+
+// only the path is logged, query strings and bodies can carry tokens
+func WithLogging() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			res, err := next.RoundTrip(req)
+			elapsed := time.Since(start).Round(time.Millisecond)
+			if err != nil {
+				fmt.Println("strava", req.Header.Get(TraceHeader), req.Method, req.URL.Path, "error", err, elapsed)
+				return res, err
+			}
+			fmt.Println("strava", req.Header.Get(TraceHeader), req.Method, req.URL.Path, res.StatusCode, elapsed)
+			return res, err
+		})
+	}
+}
+
+// retries GETs that failed in transit or with a 5xx, other methods are not safe to repeat
+func WithRetries(attempts int, backoff time.Duration) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method != http.MethodGet {
+				return next.RoundTrip(req)
+			}
+
+			var res *http.Response
+			var err error
+			for attempt := 1; ; attempt++ {
+				res, err = next.RoundTrip(req)
+				retryable := err != nil || res.StatusCode >= http.StatusInternalServerError
+				if !retryable || attempt >= attempts || req.Context().Err() != nil {
+					return res, err
+				}
+				if res != nil {
+					res.Body.Close()
+				}
+
+				select {
+				case <-time.After(backoff * time.Duration(attempt)):
+				case <-req.Context().Done():
+					return nil, req.Context().Err()
+				}
+			}
+		})
+	}
+}
+
+// keeps Limits current from the headers on every response, including errors
+func WithRateLimitAccounting(limits *RateLimit) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			res, err := next.RoundTrip(req)
+			if err == nil {
+				limits.Update(res)
+			}
+			return res, err
+		})
+	}
+}
+
+// Wrap is a copy of client sharing its connections and middleware, with more
+// middleware in front of them
+func Wrap(client *http.Client, middleware ...Middleware) *http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	wrapped := *client
+	wrapped.Transport = ChainTransport(base, middleware...)
+	return &wrapped
+}
+
+func NewClient(base http.RoundTripper) *http.Client {
+	return &http.Client{
+		Timeout: Timeout,
+		Transport: ChainTransport(base,
+			WithUserAgent(UserAgent),
+			WithTracing(),
+			WithLogging(),
+			WithRetries(MaxAttempts, 500*time.Millisecond),
+			WithRateLimitAccounting(Limits),
+		),
+	}
+}
@@ -0,0 +1,51 @@
+package strava
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// UpdatableActivity is the body of PUT /activities/:id, nil fields are left as they are
+type UpdatableActivity struct {
+	Name         *string `json:"name,omitempty"`
+	Description  *string `json:"description,omitempty"`
+	SportType    *string `json:"sport_type,omitempty"`
+	GearId       *string `json:"gear_id,omitempty"`
+	Trainer      *bool   `json:"trainer,omitempty"`
+	Commute      *bool   `json:"commute,omitempty"`
+	HideFromHome *bool   `json:"hide_from_home,omitempty"`
+}
+
+// UpdateActivity changes the activity on strava, which needs the activity:write
+// scope, and returns it as it now is
+func UpdateActivity(client *http.Client, access_token string, activityId int64, update UpdatableActivity) (ActivityDetailed, error) {
+	var updated ActivityDetailed
+	path := fmt.Sprintf("/activities/%d", activityId)
+
+	bytes_update, err := json.Marshal(update)
+	if err != nil {
+		return updated, err
+	}
+
+	req, err := http.NewRequest("PUT", APIBase+path, bytes.NewBuffer(bytes_update))
+	if err != nil {
+		return updated, err
+	}
+	req.Header.Add("Authorization", "Bearer "+access_token)
+	req.Header.Add("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return updated, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return updated, DecodeError(res, path)
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&updated)
+	return updated, err
+}
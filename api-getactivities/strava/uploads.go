@@ -0,0 +1,92 @@
+package strava
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// the file formats POST /uploads takes, each may also be gzipped as e.g. fit.gz
+var UploadDataTypes = []string{"fit", "fit.gz", "tcx", "tcx.gz", "gpx", "gpx.gz"}
+
+// UploadParams are the optional fields sent with the file
+type UploadParams struct {
+	DataType    string
+	Name        string
+	Description string
+	ExternalId  string
+}
+
+// Upload is strava's progress on turning a file into an activity, ActivityId
+// is set once it has, Error when it could not
+type Upload struct {
+	Id         int64  `json:"id"`
+	IdString   string `json:"id_str"`
+	ExternalId string `json:"external_id"`
+	Error      string `json:"error"`
+	Status     string `json:"status"`
+	ActivityId int64  `json:"activity_id"`
+}
+
+// CreateUpload sends the file to strava, which needs the activity:write scope;
+// strava processes it after answering, poll GetUpload for the activity
+func CreateUpload(client *http.Client, access_token string, filename string, file io.Reader, params UploadParams) (Upload, error) {
+	var upload Upload
+	path := "/uploads"
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	fields := map[string]string{
+		"data_type":   params.DataType,
+		"name":        params.Name,
+		"description": params.Description,
+		"external_id": params.ExternalId,
+	}
+	for key, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := form.WriteField(key, value); err != nil {
+			return upload, err
+		}
+	}
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		return upload, err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return upload, err
+	}
+	if err := form.Close(); err != nil {
+		return upload, err
+	}
+
+	req, err := http.NewRequest("POST", APIBase+path, &body)
+	if err != nil {
+		return upload, err
+	}
+	req.Header.Add("Authorization", "Bearer "+access_token)
+	req.Header.Add("Content-Type", form.FormDataContentType())
+
+	res, err := client.Do(req)
+	if err != nil {
+		return upload, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusOK {
+		return upload, DecodeError(res, path)
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&upload)
+	return upload, err
+}
+
+func GetUpload(client *http.Client, access_token string, uploadId int64) (Upload, error) {
+	var upload Upload
+	err := GetJSON(client, access_token, fmt.Sprintf("/uploads/%d", uploadId), nil, &upload)
+	return upload, err
+}
@@ -0,0 +1,77 @@
+package streams
+
+import "github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+
+func concat[T any](a, b *strava.Stream[T], shift func(T) T) *strava.Stream[T] {
+	if a == nil || b == nil {
+		return nil
+	}
+	joined := *a
+	joined.Data = make([]T, 0, len(a.Data)+len(b.Data))
+	joined.Data = append(joined.Data, a.Data...)
+	for _, v := range b.Data {
+		joined.Data = append(joined.Data, shift(v))
+	}
+	joined.OriginalSize = a.OriginalSize + b.OriginalSize
+	return &joined
+}
+
+func same[T any](v T) T { return v }
+
+// Concat appends second's samples to first's, as one recording: second's time
+// is shifted by seconds, the time between the two starts, and its distance by
+// meters, first's total. Channels recorded by only one of them are dropped
+func Concat(first, second strava.StreamSet, seconds int, meters float64) strava.StreamSet {
+	return strava.StreamSet{
+		Time:           concat(first.Time, second.Time, func(t int) int { return t + seconds }),
+		Distance:       concat(first.Distance, second.Distance, func(d float64) float64 { return d + meters }),
+		LatLng:         concat(first.LatLng, second.LatLng, same[strava.Location]),
+		Altitude:       concat(first.Altitude, second.Altitude, same[float64]),
+		VelocitySmooth: concat(first.VelocitySmooth, second.VelocitySmooth, same[float64]),
+		Heartrate:      concat(first.Heartrate, second.Heartrate, same[int]),
+		Cadence:        concat(first.Cadence, second.Cadence, same[int]),
+		Watts:          concat(first.Watts, second.Watts, same[int]),
+		Temp:           concat(first.Temp, second.Temp, same[int]),
+		Moving:         concat(first.Moving, second.Moving, same[bool]),
+		GradeSmooth:    concat(first.GradeSmooth, second.GradeSmooth, same[float64]),
+	}
+}
+
+func slice[T any](s *strava.Stream[T], from, to int, shift func(T) T) *strava.Stream[T] {
+	if s == nil || to > len(s.Data) {
+		return nil
+	}
+	cut := *s
+	cut.Data = make([]T, 0, to-from)
+	for _, v := range s.Data[from:to] {
+		cut.Data = append(cut.Data, shift(v))
+	}
+	cut.OriginalSize = to - from
+	return &cut
+}
+
+// Slice keeps samples [from, to) of every channel, with time and distance
+// counted from the first sample kept
+func Slice(set strava.StreamSet, from, to int) strava.StreamSet {
+	var seconds int
+	var meters float64
+	if set.Time != nil && from < len(set.Time.Data) {
+		seconds = set.Time.Data[from]
+	}
+	if set.Distance != nil && from < len(set.Distance.Data) {
+		meters = set.Distance.Data[from]
+	}
+	return strava.StreamSet{
+		Time:           slice(set.Time, from, to, func(t int) int { return t - seconds }),
+		Distance:       slice(set.Distance, from, to, func(d float64) float64 { return d - meters }),
+		LatLng:         slice(set.LatLng, from, to, same[strava.Location]),
+		Altitude:       slice(set.Altitude, from, to, same[float64]),
+		VelocitySmooth: slice(set.VelocitySmooth, from, to, same[float64]),
+		Heartrate:      slice(set.Heartrate, from, to, same[int]),
+		Cadence:        slice(set.Cadence, from, to, same[int]),
+		Watts:          slice(set.Watts, from, to, same[int]),
+		Temp:           slice(set.Temp, from, to, same[int]),
+		Moving:         slice(set.Moving, from, to, same[bool]),
+		GradeSmooth:    slice(set.GradeSmooth, from, to, same[float64]),
+	}
+}
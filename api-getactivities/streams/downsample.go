@@ -0,0 +1,148 @@
+// Package streams downsamples, smooths and cleans activity streams, the
+// per-second series of strava.StreamSet, for charting and analysis.
+package streams
+
+import "math"
+
+type Number interface {
+	~int | ~float64
+}
+
+// Resolutions are the number of points a series is shrunk to for charting
+var Resolutions = map[string]int{
+	"low":    100,
+	"medium": 500,
+	"high":   1000,
+}
+
+// bucket i of n over size samples is [bucketStart(i), bucketStart(i+1))
+func bucketStart(i, n, size int) int {
+	return i * size / n
+}
+
+// Floats converts a series for the functions that work on float64
+func Floats[T Number](data []T) []float64 {
+	out := make([]float64, len(data))
+	for i, v := range data {
+		out[i] = float64(v)
+	}
+	return out
+}
+
+// Mean shrinks a series to at most n points, each the mean of an equal run of
+// consecutive samples, so peaks soften but the shape is kept; means are
+// rounded to two decimals to keep payloads small
+func Mean[T Number](data []T, n int) []float64 {
+	if n <= 0 {
+		return nil
+	}
+	if len(data) < n {
+		n = len(data)
+	}
+
+	out := make([]float64, n)
+	for i := range out {
+		from, to := bucketStart(i, n, len(data)), bucketStart(i+1, n, len(data))
+		sum := 0.0
+		for _, v := range data[from:to] {
+			sum += float64(v)
+		}
+		out[i] = math.Round(sum/float64(to-from)*100) / 100
+	}
+	return out
+}
+
+// First shrinks a series that cannot be averaged, such as positions or the
+// moving flag, to the first sample of each run
+func First[T any](data []T, n int) []T {
+	if n <= 0 {
+		return nil
+	}
+	if len(data) < n {
+		n = len(data)
+	}
+
+	out := make([]T, n)
+	for i := range out {
+		out[i] = data[bucketStart(i, n, len(data))]
+	}
+	return out
+}
+
+// LTTB picks at most n samples of y with the largest triangle three buckets
+// algorithm, which keeps peaks and troughs that Mean would flatten. It returns
+// the indices of the kept samples, always including the first and last, so
+// the other series of the activity can be sampled at the same points with
+// Pick. x is the axis, seconds or meters, and the sample index when nil
+func LTTB(x, y []float64, n int) []int {
+	size := len(y)
+	switch {
+	case n >= size:
+		indices := make([]int, size)
+		for i := range indices {
+			indices[i] = i
+		}
+		return indices
+	case n <= 0:
+		return nil
+	case n == 1:
+		return []int{0}
+	case n == 2:
+		return []int{0, size - 1}
+	}
+	at := func(i int) float64 {
+		if x == nil {
+			return float64(i)
+		}
+		return x[i]
+	}
+
+	// the first and last samples are kept, the rest are split into n-2 buckets
+	every := float64(size-2) / float64(n-2)
+	indices := make([]int, 0, n)
+	indices = append(indices, 0)
+	a := 0
+	for i := 0; i < n-2; i++ {
+		// the third triangle point is the average of the next bucket
+		avgFrom := int(float64(i+1)*every) + 1
+		avgTo := int(float64(i+2)*every) + 1
+		if avgTo > size {
+			avgTo = size
+		}
+		if avgFrom >= avgTo {
+			avgFrom = avgTo - 1
+		}
+		var avgX, avgY float64
+		for j := avgFrom; j < avgTo; j++ {
+			avgX += at(j)
+			avgY += y[j]
+		}
+		count := float64(avgTo - avgFrom)
+		avgX /= count
+		avgY /= count
+
+		from := int(float64(i)*every) + 1
+		to := int(float64(i+1)*every) + 1
+		best, bestArea := from, -1.0
+		for j := from; j < to; j++ {
+			area := math.Abs((at(a)-avgX)*(y[j]-y[a]) - (at(a)-at(j))*(avgY-y[a]))
+			if area > bestArea {
+				best, bestArea = j, area
+			}
+		}
+		indices = append(indices, best)
+		a = best
+	}
+	return append(indices, size-1)
+}
+
+// Pick is the samples of data at indices, as returned by LTTB
+func Pick[T any](data []T, indices []int) []T {
+	out := make([]T, 0, len(indices))
+	for _, i := range indices {
+		if i < len(data) {
+			out = append(out, data[i])
+		}
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+package streams_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/benchdata"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/streams"
+)
+
+func BenchmarkLTTB(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		streams.LTTB(seconds, values, benchdata.ChartPoints)
+	}
+}
+
+func BenchmarkMean(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		streams.Mean(values, benchdata.ChartPoints)
+	}
+}
+
+func TestLTTB(t *testing.T) {
+	y := make([]float64, 20)
+	y[7] = 100 // a peak Mean would flatten
+	y[13] = -100
+	for _, n := range []int{-1, 0, 1, 2, 3, 5, 19, 20, 40} {
+		indices := streams.LTTB(nil, y, n)
+		want := n
+		if n < 0 {
+			want = 0
+		} else if n > len(y) {
+			want = len(y)
+		}
+		if len(indices) != want {
+			t.Errorf("n %d: %d indices, want %d", n, len(indices), want)
+			continue
+		}
+		for i := 1; i < len(indices); i++ {
+			if indices[i] <= indices[i-1] {
+				t.Errorf("n %d: indices %v out of order", n, indices)
+			}
+		}
+		if n >= 2 && (indices[0] != 0 || indices[len(indices)-1] != len(y)-1) {
+			t.Errorf("n %d: indices %v without the first and last samples", n, indices)
+		}
+		if n >= 4 && !containsAll(indices, 7, 13) {
+			t.Errorf("n %d: indices %v lost the peak or the trough", n, indices)
+		}
+	}
+	if indices := streams.LTTB(nil, y, 1); !reflect.DeepEqual(indices, []int{0}) {
+		t.Errorf("n 1: %v", indices)
+	}
+
+	indices := streams.LTTB(seconds, values, benchdata.ChartPoints)
+	if len(indices) != benchdata.ChartPoints || indices[0] != 0 || indices[len(indices)-1] != len(values)-1 {
+		t.Errorf("a stream shrunk to %d points from %d to %d", len(indices), indices[0], indices[len(indices)-1])
+	}
+}
+
+func containsAll(indices []int, want ...int) bool {
+	for _, w := range want {
+		found := false
+		for _, i := range indices {
+			found = found || i == w
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMean(t *testing.T) {
+	cases := []struct {
+		data []float64
+		n    int
+		want []float64
+	}{
+		{[]float64{1, 2, 3, 4, 5, 6}, 3, []float64{1.5, 3.5, 5.5}},
+		{[]float64{1, 2, 3, 4, 5}, 2, []float64{1.5, 4}},
+		{[]float64{1, 1, 2}, 1, []float64{1.33}},
+		{[]float64{1, 2, 3}, 5, []float64{1, 2, 3}},
+		{[]float64{1, 2, 3}, 0, nil},
+		{nil, 3, []float64{}},
+	}
+	for _, tc := range cases {
+		if got := streams.Mean(tc.data, tc.n); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Mean(%v, %d) = %v, want %v", tc.data, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestFirstAndPick(t *testing.T) {
+	data := []string{"a", "b", "c", "d", "e", "f"}
+	if got := streams.First(data, 3); !reflect.DeepEqual(got, []string{"a", "c", "e"}) {
+		t.Errorf("First %v", got)
+	}
+	if got := streams.First(data, 10); !reflect.DeepEqual(got, data) {
+		t.Errorf("First of more than there are %v", got)
+	}
+	if got := streams.Pick(data, []int{0, 3, 5, 99}); !reflect.DeepEqual(got, []string{"a", "d", "f"}) {
+		t.Errorf("Pick %v", got)
+	}
+}
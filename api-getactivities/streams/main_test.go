@@ -0,0 +1,17 @@
+package streams_test
+
+import (
+	"testing"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/internal/benchdata"
+)
+
+var seconds, values = benchdata.Series(benchdata.StreamSamples)
+
+func TestMain(m *testing.M) {
+	benchdata.Main(m, benchdata.Benchmarks{
+		"BenchmarkLTTB":   BenchmarkLTTB,
+		"BenchmarkMean":   BenchmarkMean,
+		"BenchmarkHampel": BenchmarkHampel,
+	})
+}
@@ -0,0 +1,85 @@
+package streams
+
+import (
+	"github.com/agentdanger/golang-strava-api/api-getactivities/geo"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// heart rates outside this range are sensor dropouts or interference
+const (
+	minHeartrate = 30
+	maxHeartrate = 230
+)
+
+// CleanHeartrate replaces impossible readings with the last good one, then
+// spikes such as cadence lock with a Hampel filter; it returns how many
+// samples were replaced
+func CleanHeartrate(hr []int) ([]float64, int) {
+	out := Floats(hr)
+	replaced := 0
+
+	last := -1.0
+	for i, v := range out {
+		if v >= minHeartrate && v <= maxHeartrate {
+			last = v
+			continue
+		}
+		replaced++
+		if last < 0 {
+			// before the first good reading, take the next one
+			for _, next := range out[i:] {
+				if next >= minHeartrate && next <= maxHeartrate {
+					last = next
+					break
+				}
+			}
+		}
+		out[i] = last
+	}
+
+	out, spikes := Hampel(out, 5, 3)
+	return out, replaced + spikes
+}
+
+// Points converts a latlng stream, [latitude, longitude] pairs, to geo points
+func Points(latlng []strava.Location) []geo.Point {
+	points := make([]geo.Point, len(latlng))
+	for i, l := range latlng {
+		points[i] = geo.Point{Lat: l[0], Lng: l[1]}
+	}
+	return points
+}
+
+// RemoveJumps replaces single position fixes that are reached from the
+// previous good fix, and left for the next one, faster than maxSpeed meters
+// per second with the previous good fix. seconds is the time stream, the
+// track keeps its length so it still lines up with the other streams, and
+// the number of replaced fixes is returned
+func RemoveJumps(points []geo.Point, seconds []int, maxSpeed float64) ([]geo.Point, int) {
+	out := append([]geo.Point(nil), points...)
+	if len(points) < 3 || len(seconds) != len(points) {
+		return out, 0
+	}
+
+	// meters per second from p, the fix at sample a, to the fix at sample b
+	speed := func(p geo.Point, a, b int) float64 {
+		dt := seconds[b] - seconds[a]
+		if dt < 1 {
+			dt = 1
+		}
+		return geo.Distance(p, points[b]) / float64(dt)
+	}
+
+	replaced := 0
+	good := 0
+	for i := 1; i < len(points)-1; i++ {
+		// a real change of position is followed by fixes near it, a jump is not
+		if speed(out[good], good, i) > maxSpeed && speed(points[i], i, i+1) > maxSpeed {
+			out[i] = out[good]
+			replaced++
+			continue
+		}
+		good = i
+	}
+	return out, replaced
+}
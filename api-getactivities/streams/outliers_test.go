@@ -0,0 +1,71 @@
+package streams_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/geo"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+	"github.com/agentdanger/golang-strava-api/api-getactivities/streams"
+)
+
+func TestCleanHeartrate(t *testing.T) {
+	cases := []struct {
+		name     string
+		hr       []int
+		want     []float64
+		replaced int
+	}{
+		{"dropouts", []int{0, 120, 121, 250, 122, 0}, []float64{120, 120, 121, 121, 122, 122}, 3},
+		{"a spike", []int{120, 121, 120, 121, 200, 121, 120, 121, 120}, []float64{120, 121, 120, 121, 121, 121, 120, 121, 120}, 1},
+		{"clean", []int{120, 125, 130}, []float64{120, 125, 130}, 0},
+	}
+	for _, tc := range cases {
+		got, replaced := streams.CleanHeartrate(tc.hr)
+		if !reflect.DeepEqual(got, tc.want) || replaced != tc.replaced {
+			t.Errorf("%s: %v with %d replaced, want %v with %d", tc.name, got, replaced, tc.want, tc.replaced)
+		}
+	}
+}
+
+func TestRemoveJumps(t *testing.T) {
+	// about 10 meters a second north, once 1 km east
+	track := func(east ...int) []geo.Point {
+		points := make([]geo.Point, 6)
+		for i := range points {
+			points[i] = geo.Point{Lat: 0.00009 * float64(i), Lng: 0}
+		}
+		for _, i := range east {
+			points[i].Lng = 0.009
+		}
+		return points
+	}
+	seconds := []int{0, 1, 2, 3, 4, 5}
+
+	jumped := track(3)
+	got, replaced := streams.RemoveJumps(jumped, seconds, 50)
+	want := track()
+	want[3] = want[2]
+	if !reflect.DeepEqual(got, want) || replaced != 1 {
+		t.Errorf("a jump: %v with %d replaced, want %v", got, replaced, want)
+	}
+	if jumped[3].Lng != 0.009 {
+		t.Error("the track passed in was changed")
+	}
+
+	// a gap in recording followed by fixes near the new position is real
+	moved := track(3, 4, 5)
+	if got, replaced := streams.RemoveJumps(moved, seconds, 50); !reflect.DeepEqual(got, moved) || replaced != 0 {
+		t.Errorf("a move: %v with %d replaced", got, replaced)
+	}
+	if _, replaced := streams.RemoveJumps(jumped, seconds[:5], 50); replaced != 0 {
+		t.Errorf("%d replaced without a time for every fix", replaced)
+	}
+}
+
+func TestPoints(t *testing.T) {
+	got := streams.Points([]strava.Location{{57.6, 10.4}, {0, -179.9}})
+	if want := []geo.Point{{Lat: 57.6, Lng: 10.4}, {Lat: 0, Lng: -179.9}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("points %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,80 @@
+package streams
+
+import (
+	"math"
+	"sort"
+)
+
+// MovingAverage smooths a series with a centered window of window samples,
+// shrinking the window at the ends; windows under 2 leave the series as it is
+func MovingAverage[T Number](data []T, window int) []float64 {
+	out := Floats(data)
+	if window < 2 || len(data) == 0 {
+		return out
+	}
+
+	// prefix sums make each window constant time
+	sums := make([]float64, len(data)+1)
+	for i, v := range out {
+		sums[i+1] = sums[i] + v
+	}
+	half := window / 2
+	for i := range out {
+		from, to := i-half, i+window-half
+		if from < 0 {
+			from = 0
+		}
+		if to > len(data) {
+			to = len(data)
+		}
+		out[i] = (sums[to] - sums[from]) / float64(to-from)
+	}
+	return out
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// Hampel replaces samples further than k scaled median absolute deviations
+// from the median of the half samples either side of them with that median.
+// It removes isolated spikes while keeping real steps, and returns how many
+// samples were replaced
+func Hampel(data []float64, half int, k float64) ([]float64, int) {
+	out := append([]float64(nil), data...)
+	if half < 1 {
+		return out, 0
+	}
+
+	replaced := 0
+	deviations := make([]float64, 0, 2*half+1)
+	for i := range data {
+		from, to := i-half, i+half+1
+		if from < 0 {
+			from = 0
+		}
+		if to > len(data) {
+			to = len(data)
+		}
+		window := data[from:to]
+		m := median(window)
+
+		deviations = deviations[:0]
+		for _, v := range window {
+			deviations = append(deviations, math.Abs(v-m))
+		}
+		// 1.4826 scales the MAD to a standard deviation for normal noise
+		mad := 1.4826 * median(deviations)
+		if mad > 0 && math.Abs(data[i]-m) > k*mad {
+			out[i] = m
+			replaced++
+		}
+	}
+	return out, replaced
+}
@@ -0,0 +1,60 @@
+package streams_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/streams"
+)
+
+func BenchmarkHampel(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		streams.Hampel(values, 5, 3)
+	}
+}
+
+func TestMovingAverage(t *testing.T) {
+	data := []int{1, 2, 3, 4, 5}
+	cases := []struct {
+		window int
+		want   []float64
+	}{
+		{0, []float64{1, 2, 3, 4, 5}},
+		{1, []float64{1, 2, 3, 4, 5}},
+		{2, []float64{1, 1.5, 2.5, 3.5, 4.5}},
+		{3, []float64{1.5, 2, 3, 4, 4.5}},
+		{10, []float64{3, 3, 3, 3, 3}},
+	}
+	for _, tc := range cases {
+		if got := streams.MovingAverage(data, tc.window); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("window %d: %v, want %v", tc.window, got, tc.want)
+		}
+	}
+	if got := streams.MovingAverage([]int{}, 3); len(got) != 0 {
+		t.Errorf("of nothing %v", got)
+	}
+}
+
+func TestHampel(t *testing.T) {
+	cases := []struct {
+		name     string
+		data     []float64
+		want     []float64
+		replaced int
+	}{
+		{"a spike", []float64{1, 2, 1, 2, 50, 2, 1, 2, 1}, []float64{1, 2, 1, 2, 2, 2, 1, 2, 1}, 1},
+		{"a step", []float64{0, 1, 0, 1, 10, 11, 10, 11}, []float64{0, 1, 0, 1, 10, 11, 10, 11}, 0},
+		{"no spread", []float64{1, 1, 1, 10, 1, 1, 1}, []float64{1, 1, 1, 10, 1, 1, 1}, 0},
+		{"nothing", nil, nil, 0},
+	}
+	for _, tc := range cases {
+		got, replaced := streams.Hampel(tc.data, 2, 3)
+		if !reflect.DeepEqual(got, tc.want) || replaced != tc.replaced {
+			t.Errorf("%s: %v with %d replaced, want %v with %d", tc.name, got, replaced, tc.want, tc.replaced)
+		}
+	}
+	if got, replaced := streams.Hampel([]float64{1, 2, 50}, 0, 3); replaced != 0 || got[2] != 50 {
+		t.Errorf("without a window: %v, %d replaced", got, replaced)
+	}
+}
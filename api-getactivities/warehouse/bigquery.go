@@ -0,0 +1,164 @@
+package warehouse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	ActivitiesTable = "activities"
+	SamplesTable    = "activity_samples"
+)
+
+// bigquery recommends about 500 rows per streaming insert
+const insertBatch = 500
+
+var activityColumns = []*bigquery.TableFieldSchema{
+	{Name: "activity_id", Type: "INTEGER", Mode: "REQUIRED"},
+	{Name: "athlete_id", Type: "INTEGER"},
+	{Name: "name", Type: "STRING"},
+	{Name: "type", Type: "STRING"},
+	{Name: "sport_type", Type: "STRING"},
+	{Name: "workout_type", Type: "INTEGER"},
+	{Name: "start_date", Type: "TIMESTAMP"},
+	{Name: "start_date_local", Type: "DATETIME"},
+	{Name: "timezone", Type: "STRING"},
+	{Name: "distance_m", Type: "FLOAT"},
+	{Name: "moving_time_s", Type: "INTEGER"},
+	{Name: "elapsed_time_s", Type: "INTEGER"},
+	{Name: "total_elevation_gain_m", Type: "FLOAT"},
+	{Name: "average_speed_mps", Type: "FLOAT"},
+	{Name: "max_speed_mps", Type: "FLOAT"},
+	{Name: "has_heartrate", Type: "BOOLEAN"},
+	{Name: "calories", Type: "FLOAT"},
+	{Name: "kudos_count", Type: "INTEGER"},
+	{Name: "comment_count", Type: "INTEGER"},
+	{Name: "achievement_count", Type: "INTEGER"},
+	{Name: "pr_count", Type: "INTEGER"},
+	{Name: "gear_id", Type: "STRING"},
+	{Name: "trainer", Type: "BOOLEAN"},
+	{Name: "commute", Type: "BOOLEAN"},
+	{Name: "manual", Type: "BOOLEAN"},
+	{Name: "private", Type: "BOOLEAN"},
+	{Name: "device_name", Type: "STRING"},
+	{Name: "deleted", Type: "BOOLEAN"},
+	{Name: "synced_at", Type: "TIMESTAMP", Mode: "REQUIRED"},
+}
+
+var sampleColumns = []*bigquery.TableFieldSchema{
+	{Name: "activity_id", Type: "INTEGER", Mode: "REQUIRED"},
+	{Name: "offset_s", Type: "INTEGER", Mode: "REQUIRED"},
+	{Name: "distance_m", Type: "FLOAT"},
+	{Name: "lat", Type: "FLOAT"},
+	{Name: "lng", Type: "FLOAT"},
+	{Name: "altitude_m", Type: "FLOAT"},
+	{Name: "velocity_mps", Type: "FLOAT"},
+	{Name: "heartrate", Type: "INTEGER"},
+	{Name: "cadence", Type: "INTEGER"},
+	{Name: "watts", Type: "INTEGER"},
+	{Name: "temp_c", Type: "INTEGER"},
+	{Name: "moving", Type: "BOOLEAN"},
+	{Name: "grade_percent", Type: "FLOAT"},
+	{Name: "synced_at", Type: "TIMESTAMP", Mode: "REQUIRED"},
+}
+
+// BigQuery streams rows into the activities and activity_samples tables of one dataset
+type BigQuery struct {
+	service *bigquery.Service
+	project string
+	dataset string
+	timeout time.Duration
+}
+
+// dataset is named project.dataset and must exist, the tables are created by EnsureTables
+func NewBigQuery(dataset string, timeout time.Duration) (*BigQuery, error) {
+	project, name, ok := strings.Cut(dataset, ".")
+	if !ok || project == "" || name == "" {
+		return nil, fmt.Errorf("bigquery dataset %q is not project.dataset", dataset)
+	}
+	service, err := bigquery.NewService(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &BigQuery{service: service, project: project, dataset: name, timeout: timeout}, nil
+}
+
+// creates missing tables partitioned by day of synced_at, existing tables are left as they are
+func (b *BigQuery) EnsureTables() error {
+	for table, columns := range map[string][]*bigquery.TableFieldSchema{ActivitiesTable: activityColumns, SamplesTable: sampleColumns} {
+		ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+		_, err := b.service.Tables.Get(b.project, b.dataset, table).Context(ctx).Do()
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+			_, err = b.service.Tables.Insert(b.project, b.dataset, &bigquery.Table{
+				TableReference:   &bigquery.TableReference{ProjectId: b.project, DatasetId: b.dataset, TableId: table},
+				Schema:           &bigquery.TableSchema{Fields: columns},
+				TimePartitioning: &bigquery.TimePartitioning{Type: "DAY", Field: "synced_at"},
+			}).Context(ctx).Do()
+		}
+		cancel()
+		if err != nil {
+			return fmt.Errorf("table %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+func (b *BigQuery) InsertActivities(rows []ActivityRow) error {
+	return insert(b, ActivitiesTable, rows, func(r ActivityRow) string {
+		return fmt.Sprintf("%d-%s", r.ActivityId, r.SyncedAt)
+	})
+}
+
+func (b *BigQuery) InsertSamples(rows []SampleRow) error {
+	return insert(b, SamplesTable, rows, func(r SampleRow) string {
+		return fmt.Sprintf("%d-%d-%s", r.ActivityId, r.Offset, r.SyncedAt)
+	})
+}
+
+// insert ids let bigquery drop the duplicates a retried batch would otherwise add
+func insert[T any](b *BigQuery, table string, rows []T, insertId func(T) string) error {
+	for start := 0; start < len(rows); start += insertBatch {
+		end := start + insertBatch
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		req := &bigquery.TableDataInsertAllRequest{}
+		for _, row := range rows[start:end] {
+			data, err := json.Marshal(row)
+			if err != nil {
+				return err
+			}
+			var values map[string]bigquery.JsonValue
+			if err := json.Unmarshal(data, &values); err != nil {
+				return err
+			}
+			req.Rows = append(req.Rows, &bigquery.TableDataInsertAllRequestRows{InsertId: insertId(row), Json: values})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+		res, err := b.service.Tabledata.InsertAll(b.project, b.dataset, table, req).Context(ctx).Do()
+		cancel()
+		if err != nil {
+			return fmt.Errorf("table %s: %w", table, err)
+		}
+		if len(res.InsertErrors) > 0 {
+			first := res.InsertErrors[0]
+			reason := ""
+			if len(first.Errors) > 0 {
+				reason = first.Errors[0].Message
+			}
+			return fmt.Errorf("table %s: %d rows rejected, row %d: %s", table, len(res.InsertErrors), int64(start)+first.Index, reason)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+// Package warehouse streams normalized activity rows and stream samples into
+// BigQuery tables for SQL analysis.
+package warehouse
+
+import (
+	"time"
+
+	"github.com/agentdanger/golang-strava-api/api-getactivities/strava"
+)
+
+// ActivityRow is one version of an activity, every sync appends a row so the
+// latest synced_at per activity_id is its current state
+type ActivityRow struct {
+	ActivityId         int64   `json:"activity_id"`
+	AthleteId          int64   `json:"athlete_id,omitempty"`
+	Name               string  `json:"name,omitempty"`
+	Type               string  `json:"type,omitempty"`
+	SportType          string  `json:"sport_type,omitempty"`
+	WorkoutType        int     `json:"workout_type"`
+	StartDate          string  `json:"start_date,omitempty"`       // TIMESTAMP
+	StartDateLocal     string  `json:"start_date_local,omitempty"` // DATETIME, wall clock where the activity happened
+	TimeZone           string  `json:"timezone,omitempty"`
+	Distance           float64 `json:"distance_m"`
+	MovingTime         int     `json:"moving_time_s"`
+	ElapsedTime        int     `json:"elapsed_time_s"`
+	TotalElevationGain float64 `json:"total_elevation_gain_m"`
+	AverageSpeed       float64 `json:"average_speed_mps"`
+	MaxSpeed           float64 `json:"max_speed_mps"`
+	HasHeartrate       bool    `json:"has_heartrate"`
+	Calories           float64 `json:"calories"`
+	KudosCount         int     `json:"kudos_count"`
+	CommentCount       int     `json:"comment_count"`
+	AchievementCount   int     `json:"achievement_count"`
+	PrCount            int     `json:"pr_count"`
+	GearId             string  `json:"gear_id,omitempty"`
+	Trainer            bool    `json:"trainer"`
+	Commute            bool    `json:"commute"`
+	Manual             bool    `json:"manual"`
+	Private            bool    `json:"private"`
+	DeviceName         string  `json:"device_name,omitempty"`
+	Deleted            bool    `json:"deleted"`
+	SyncedAt           string  `json:"synced_at"`
+}
+
+// SampleRow is one point of an activity's streams, channels that were not recorded are null
+type SampleRow struct {
+	ActivityId int64    `json:"activity_id"`
+	Offset     int      `json:"offset_s"`
+	Distance   *float64 `json:"distance_m,omitempty"`
+	Lat        *float64 `json:"lat,omitempty"`
+	Lng        *float64 `json:"lng,omitempty"`
+	Altitude   *float64 `json:"altitude_m,omitempty"`
+	Velocity   *float64 `json:"velocity_mps,omitempty"`
+	Heartrate  *int     `json:"heartrate,omitempty"`
+	Cadence    *int     `json:"cadence,omitempty"`
+	Watts      *int     `json:"watts,omitempty"`
+	Temp       *int     `json:"temp_c,omitempty"`
+	Moving     *bool    `json:"moving,omitempty"`
+	Grade      *float64 `json:"grade_percent,omitempty"`
+	SyncedAt   string   `json:"synced_at"`
+}
+
+func syncedAt(at time.Time) string {
+	return at.UTC().Format(time.RFC3339)
+}
+
+func NewActivityRow(a strava.ActivityDetailed, at time.Time) ActivityRow {
+	sportType := strava.NormalizeSportType(a.SportType, a.Type)
+	return ActivityRow{
+		ActivityId:         a.Id,
+		AthleteId:          a.Athlete.Id,
+		Name:               a.Name,
+		Type:               strava.LegacyActivityType(sportType),
+		SportType:          sportType,
+		WorkoutType:        a.WorkoutType,
+		StartDate:          a.StartDate,
+		StartDateLocal:     localDateTime(a.StartDateLocal),
+		TimeZone:           a.TimeZone,
+		Distance:           a.Distance,
+		MovingTime:         a.MovingTime,
+		ElapsedTime:        a.ElapsedTime,
+		TotalElevationGain: a.TotalElevationGain,
+		AverageSpeed:       a.AverageSpeed,
+		MaxSpeed:           a.MaximunSpeed,
+		HasHeartrate:       a.HasHeartrate,
+		Calories:           a.Calories,
+		KudosCount:         a.KudosCount,
+		CommentCount:       a.CommentCount,
+		AchievementCount:   a.AchievementCount,
+		PrCount:            a.PrCount,
+		GearId:             a.GearId,
+		Trainer:            a.Trainer,
+		Commute:            a.Commute,
+		Manual:             a.Manual,
+		Private:            a.Private,
+		DeviceName:         a.DeviceName,
+		SyncedAt:           syncedAt(at),
+	}
+}
+
+// a tombstone, bigquery streaming inserts cannot delete the earlier rows
+func NewDeletedRow(activityId int64, at time.Time) ActivityRow {
+	return ActivityRow{ActivityId: activityId, Deleted: true, SyncedAt: syncedAt(at)}
+}
+
+// strava sends local times with a misleading Z suffix, DATETIME columns take them without a zone
+func localDateTime(local string) string {
+	t, err := time.Parse(time.RFC3339, local)
+	if err != nil {
+		return ""
+	}
+	return t.Format("2006-01-02T15:04:05")
+}
+
+func NewSampleRows(activityId int64, streams strava.StreamSet, at time.Time) []SampleRow {
+	rows := make([]SampleRow, streams.Len())
+	for i := range rows {
+		row := SampleRow{ActivityId: activityId, Offset: streams.Time.Data[i], SyncedAt: syncedAt(at)}
+		row.Distance = sample(streams.Distance, i)
+		row.Altitude = sample(streams.Altitude, i)
+		row.Velocity = sample(streams.VelocitySmooth, i)
+		row.Heartrate = sample(streams.Heartrate, i)
+		row.Cadence = sample(streams.Cadence, i)
+		row.Watts = sample(streams.Watts, i)
+		row.Temp = sample(streams.Temp, i)
+		row.Moving = sample(streams.Moving, i)
+		row.Grade = sample(streams.GradeSmooth, i)
+		if point := sample(streams.LatLng, i); point != nil && *point != (strava.Location{}) {
+			row.Lat, row.Lng = &point[0], &point[1]
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+func sample[T any](stream *strava.Stream[T], i int) *T {
+	if stream == nil || i >= len(stream.Data) {
+		return nil
+	}
+	value := stream.Data[i]
+	return &value
+}